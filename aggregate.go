@@ -0,0 +1,260 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// DefaultMaxKeys is the default number of keys held in memory by an Aggregator before its
+// accumulators are spilled to disk.
+const DefaultMaxKeys = 1 << 20
+
+// A KeyFn returns the aggregation key of the record r, and whether r is to be aggregated.
+type KeyFn func(r *Record) (key string, ok bool)
+
+// TagKey returns a KeyFn keying records by the value of the tag t formatted as a string.
+// Records without the tag are not aggregated.
+func TagKey(t Tag) KeyFn {
+	return func(r *Record) (string, bool) {
+		a, ok := r.Tag(t[:])
+		if !ok {
+			return "", false
+		}
+		switch v := a.Value().(type) {
+		case string:
+			return v, true
+		case byte:
+			if a.Type() == 'A' {
+				return string(v), true
+			}
+			return fmt.Sprint(v), true
+		default:
+			return fmt.Sprint(v), true
+		}
+	}
+}
+
+// ReadGroupKey is a KeyFn keying records by read group. Records without an RG tag are keyed
+// by the empty string.
+func ReadGroupKey(r *Record) (string, bool) {
+	a, ok := r.Tag([]byte("RG"))
+	if !ok || a.Type() != 'Z' {
+		return "", true
+	}
+	return a.Value().(string), true
+}
+
+// LibraryKey returns a KeyFn keying records by the library of their read group as described
+// by the LB fields of the @RG lines of h. Records without an RG tag, or whose read group has
+// no library, are keyed by the empty string. The returned KeyFn does not retain h.
+func LibraryKey(h *Header) KeyFn {
+	libs := h.readGroupField("LB")
+	return func(r *Record) (string, bool) {
+		rg, _ := ReadGroupKey(r)
+		return libs[rg], true
+	}
+}
+
+// An Aggregator folds records into per-key accumulators of type T. Each record is keyed by Key
+// and combined with the accumulator for its key, starting from the zero value of T, using Add.
+// If Merge is not nil, the accumulators are spilled to temporary files when more than MaxKeys
+// keys are held, and partial accumulators for a key are combined with Merge when results are
+// retrieved; spilled accumulators are encoded with encoding/gob, so T must be gob encodable.
+// If Merge is nil, all accumulators are held in memory.
+type Aggregator[T any] struct {
+	Key   KeyFn
+	Add   func(acc T, r *Record) T
+	Merge func(a, b T) T
+
+	// MaxKeys is the number of keys held in memory before
+	// spilling. If MaxKeys is zero, DefaultMaxKeys is used.
+	MaxKeys int
+
+	accs map[string]T
+	runs []*os.File
+}
+
+// aggEntry is a spilled accumulator.
+type aggEntry[T any] struct {
+	K string
+	V T
+}
+
+// Fold adds r to the accumulator for its key.
+func (self *Aggregator[T]) Fold(r *Record) error {
+	k, ok := self.Key(r)
+	if !ok {
+		return nil
+	}
+	if self.accs == nil {
+		self.accs = make(map[string]T)
+	}
+	self.accs[k] = self.Add(self.accs[k], r)
+	max := self.MaxKeys
+	if max == 0 {
+		max = DefaultMaxKeys
+	}
+	if self.Merge != nil && len(self.accs) >= max {
+		return self.spill()
+	}
+	return nil
+}
+
+// ReadFrom folds all the remaining records of r.
+func (self *Aggregator[T]) ReadFrom(r RecordReader) error {
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err = self.Fold(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// sortedKeys returns the keys held in memory in sorted order.
+func (self *Aggregator[T]) sortedKeys() []string {
+	keys := make([]string, 0, len(self.accs))
+	for k := range self.accs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// spill writes the accumulators held in memory to a temporary file in key order.
+func (self *Aggregator[T]) spill() error {
+	f, err := os.CreateTemp("", "boom-aggregate-")
+	if err != nil {
+		return err
+	}
+	self.runs = append(self.runs, f)
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	for _, k := range self.sortedKeys() {
+		if err = enc.Encode(aggEntry[T]{K: k, V: self.accs[k]}); err != nil {
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	self.accs = make(map[string]T)
+	return nil
+}
+
+// Each calls fn for each key and its final accumulator in key order, stopping if fn returns
+// an error. Each may be called once, after all records have been folded, and releases any
+// temporary files.
+func (self *Aggregator[T]) Each(fn func(key string, acc T) error) error {
+	defer self.Close()
+	if len(self.runs) == 0 {
+		for _, k := range self.sortedKeys() {
+			if err := fn(k, self.accs[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(self.accs) != 0 {
+		if err := self.spill(); err != nil {
+			return err
+		}
+	}
+	var h aggHeap[T]
+	for _, f := range self.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		c := &aggCursor[T]{dec: gob.NewDecoder(bufio.NewReader(f))}
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+	for len(h) != 0 {
+		k := h[0].e.K
+		var (
+			acc   T
+			first = true
+		)
+		for len(h) != 0 && h[0].e.K == k {
+			c := h[0]
+			if first {
+				acc, first = c.e.V, false
+			} else {
+				acc = self.Merge(acc, c.e.V)
+			}
+			ok, err := c.next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(&h, 0)
+			} else {
+				heap.Pop(&h)
+			}
+		}
+		if err := fn(k, acc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases any temporary files held by the Aggregator.
+func (self *Aggregator[T]) Close() error {
+	for _, f := range self.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	self.runs = nil
+	return nil
+}
+
+// aggCursor reads successive entries from a spilled run.
+type aggCursor[T any] struct {
+	dec *gob.Decoder
+	e   aggEntry[T]
+}
+
+func (self *aggCursor[T]) next() (bool, error) {
+	self.e = aggEntry[T]{}
+	err := self.dec.Decode(&self.e)
+	if err == io.EOF {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// aggHeap is a min-heap of run cursors ordered by their current key.
+type aggHeap[T any] []*aggCursor[T]
+
+func (h aggHeap[T]) Len() int            { return len(h) }
+func (h aggHeap[T]) Less(i, j int) bool  { return h[i].e.K < h[j].e.K }
+func (h aggHeap[T]) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *aggHeap[T]) Push(x interface{}) { *h = append(*h, x.(*aggCursor[T])) }
+func (h *aggHeap[T]) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
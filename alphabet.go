@@ -0,0 +1,87 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+)
+
+// An Alphabet describes the bytes used to represent the 4-bit nucleotide codes of BAM encoded
+// sequences, allowing sequences to be decoded directly into the representation needed by
+// downstream code, such as lower case letters or the letter indexes of a bíogo alphabet.
+type Alphabet struct {
+	dec [16]byte
+	enc [256]byte
+}
+
+// NewAlphabet returns an Alphabet decoding each BAM nucleotide code, in the order "=ACMGRSVTWYHKDBN",
+// to the corresponding byte of letters. The bytes must be distinct. Sequences set using the
+// Alphabet are encoded by the inverse mapping, and bytes not in letters are encoded as by the
+// default upper case alphabet.
+func NewAlphabet(letters [16]byte) (*Alphabet, error) {
+	a := &Alphabet{dec: letters, enc: bamNT16Table}
+	var seen [256]bool
+	for i, c := range letters {
+		if seen[c] {
+			return nil, fmt.Errorf("boom: duplicate alphabet letter %q", c)
+		}
+		seen[c] = true
+		a.enc[c] = byte(i)
+	}
+	return a, nil
+}
+
+// Letters returns the bytes that the nucleotide codes "=ACMGRSVTWYHKDBN" decode to.
+func (self *Alphabet) Letters() [16]byte { return self.dec }
+
+var (
+	// UpperAlphabet is the default upper case alphabet.
+	UpperAlphabet = mustAlphabet(bamNT16TableRev)
+
+	// LowerAlphabet decodes sequences to lower case letters,
+	// as used for soft masked sequence.
+	LowerAlphabet = mustAlphabet([16]byte{'=', 'a', 'c', 'm', 'g', 'r', 's', 'v', 't', 'w', 'y', 'h', 'k', 'd', 'b', 'n'})
+)
+
+func mustAlphabet(letters [16]byte) *Alphabet {
+	a, err := NewAlphabet(letters)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// alphabet returns the Alphabet used by the record.
+func (self *Record) alphabet() *Alphabet {
+	if self.alpha == nil {
+		return UpperAlphabet
+	}
+	return self.alpha
+}
+
+// SetAlphabet sets the Alphabet used to decode the record's sequence, and to encode sequences
+// passed to SetSeq. Passing nil selects UpperAlphabet. Functions of this package that inspect
+// sequences, such as those comparing reads with a reference, expect UpperAlphabet.
+func (self *Record) SetAlphabet(a *Alphabet) {
+	if a == self.alpha {
+		return
+	}
+	self.marshal()
+	self.alpha = a
+	self.decoded &^= seqField
+}
+
+// SetAlphabet sets the Alphabet used to decode the sequences of records subsequently read
+// from the file, and of records passed to its Fetch function. Passing nil selects
+// UpperAlphabet.
+func (self *BAMFile) SetAlphabet(a *Alphabet) {
+	self.alpha = a
+}
+
+// SetAlphabet sets the Alphabet used to decode the sequences of records subsequently read
+// from the file. Passing nil selects UpperAlphabet.
+func (self *SAMFile) SetAlphabet(a *Alphabet) {
+	self.alpha = a
+}
@@ -0,0 +1,382 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An Annotation is a named, optionally stranded, feature on a reference sequence.
+// Annotations sharing a Name are counted together as a single meta-feature, for
+// example the exons of a gene.
+type Annotation struct {
+	Region
+	Name   string
+	Strand int8 // 1 for the forward strand, -1 for the reverse strand and 0 if unstranded.
+}
+
+// ReadGTF reads GTF or GFF3 features of the given type, for example "exon", from r, returning
+// them as annotations on the reference sequences described by h and named by the value of the
+// attribute attr, for example "gene_id". Features on references not described by h are ignored.
+func ReadGTF(r io.Reader, h *Header, typ, attr string) ([]Annotation, error) {
+	index := refIndex(h)
+
+	var anns []Annotation
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		t := sc.Text()
+		if t == "" || t[0] == '#' {
+			continue
+		}
+		f := strings.Split(t, "\t")
+		if len(f) < 9 {
+			return nil, fmt.Errorf("boom: too few fields in GTF line %d", line)
+		}
+		if f[2] != typ {
+			continue
+		}
+		tid, ok := index[f[0]]
+		if !ok {
+			continue
+		}
+		beg, err := strconv.Atoi(f[3])
+		if err != nil {
+			return nil, fmt.Errorf("boom: bad start in GTF line %d: %v", line, err)
+		}
+		end, err := strconv.Atoi(f[4])
+		if err != nil {
+			return nil, fmt.Errorf("boom: bad end in GTF line %d: %v", line, err)
+		}
+		if beg < 1 || end < beg {
+			return nil, fmt.Errorf("boom: invalid interval in GTF line %d", line)
+		}
+		name, ok := gtfAttribute(f[8], attr)
+		if !ok {
+			return nil, fmt.Errorf("boom: missing %s attribute in GTF line %d", attr, line)
+		}
+		anns = append(anns, Annotation{
+			Region: Region{RefID: tid, Start: beg - 1, End: end},
+			Name:   name,
+			Strand: parseStrand(f[6]),
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return anns, nil
+}
+
+// gtfAttribute returns the value of the attribute key in the GTF or GFF3 attribute field, s.
+func gtfAttribute(s, key string) (string, bool) {
+	for _, a := range strings.Split(s, ";") {
+		a = strings.TrimSpace(a)
+		var k, v string
+		if i := strings.IndexAny(a, " ="); i >= 0 {
+			k, v = a[:i], strings.TrimSpace(a[i+1:])
+		}
+		if k == key {
+			return strings.Trim(v, `"`), true
+		}
+	}
+	return "", false
+}
+
+// ReadBEDAnnotations reads BED intervals from r, returning them as annotations on the reference
+// sequences described by h. Annotations are named by the fourth column and stranded by the sixth
+// column if present; unnamed intervals are named by their location. Intervals on references not
+// described by h are returned as an error, as for ReadBED.
+func ReadBEDAnnotations(r io.Reader, h *Header) ([]Annotation, error) {
+	var anns []Annotation
+	err := readBED(r, h, func(reg Region, f []string) {
+		a := Annotation{Region: reg}
+		if len(f) > 3 {
+			a.Name = f[3]
+		} else {
+			a.Name = fmt.Sprintf("%s:%d-%d", f[0], reg.Start+1, reg.End)
+		}
+		if len(f) > 5 {
+			a.Strand = parseStrand(f[5])
+		}
+		anns = append(anns, a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return anns, nil
+}
+
+func parseStrand(s string) int8 {
+	switch s {
+	case "+":
+		return 1
+	case "-":
+		return -1
+	}
+	return 0
+}
+
+// annotationBinShift is the log2 of the window size used to index annotations.
+const annotationBinShift = 14
+
+// An annotationIndex finds the meta-features overlapping reference positions.
+type annotationIndex struct {
+	names []string
+	refs  []map[int][]annotationEntry
+}
+
+type annotationEntry struct {
+	beg, end int
+	strand   int8
+	id       int
+}
+
+func newAnnotationIndex(anns []Annotation) *annotationIndex {
+	ids := make(map[string]int)
+	idx := &annotationIndex{}
+	for _, a := range anns {
+		id, ok := ids[a.Name]
+		if !ok {
+			id = len(idx.names)
+			ids[a.Name] = id
+			idx.names = append(idx.names, a.Name)
+		}
+		for len(idx.refs) <= a.RefID {
+			idx.refs = append(idx.refs, make(map[int][]annotationEntry))
+		}
+		if a.End <= a.Start {
+			continue
+		}
+		e := annotationEntry{beg: a.Start, end: a.End, strand: a.Strand, id: id}
+		bins := idx.refs[a.RefID]
+		for b := a.Start >> annotationBinShift; b <= (a.End-1)>>annotationBinShift; b++ {
+			bins[b] = append(bins[b], e)
+		}
+	}
+	return idx
+}
+
+// at returns the IDs of the meta-features overlapping pos on the reference tid with strands
+// accepted by ok, appending them to dst.
+func (self *annotationIndex) at(dst []int, tid, pos int, ok func(strand int8) bool) []int {
+	if tid < 0 || tid >= len(self.refs) {
+		return dst
+	}
+	for _, e := range self.refs[tid][pos>>annotationBinShift] {
+		if e.beg <= pos && pos < e.end && ok(e.strand) && !containsInt(dst, e.id) {
+			dst = append(dst, e.id)
+		}
+	}
+	return dst
+}
+
+func containsInt(s []int, v int) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// OverlapMode specifies how an alignment overlapping several meta-features is assigned, using
+// the definitions of htseq-count. The set of meta-features overlapping each aligned base is
+// considered: Union assigns to the union of the sets, IntersectionStrict to their intersection
+// and IntersectionNonEmpty to the intersection of the non-empty sets. An alignment is counted
+// for a meta-feature only if the resulting set has a single member.
+type OverlapMode int
+
+const (
+	Union OverlapMode = iota
+	IntersectionStrict
+	IntersectionNonEmpty
+)
+
+// Strandedness specifies how the strand of an alignment is compared with the strand of an
+// annotation. The strand of a fragment is the strand of its first read.
+type Strandedness int
+
+const (
+	Unstranded      Strandedness = iota // Strand is ignored.
+	Stranded                            // The fragment must be on the annotation's strand.
+	ReverseStranded                     // The fragment must be on the opposite strand.
+)
+
+// CountOptions specifies the behaviour of CountFeatures.
+type CountOptions struct {
+	Mode   OverlapMode
+	Strand Strandedness
+
+	// Pairs specifies that the two mapped reads of a pair are
+	// counted once as a single fragment.
+	Pairs bool
+
+	// Keep selects the records that are counted. If Keep is nil,
+	// unmapped, secondary, supplementary and QC failed records are
+	// not counted.
+	Keep RecordFilter
+}
+
+// FeatureCounts holds the counts of alignments or fragments assigned to each meta-feature.
+type FeatureCounts struct {
+	Names  []string // Meta-feature names in order of first appearance in the annotation.
+	Counts []int    // Counts indexed in parallel with Names.
+
+	NoFeature  int // Alignments not overlapping any meta-feature.
+	Ambiguous  int // Alignments overlapping more than one meta-feature.
+	Unassigned int // Records excluded by the filter or unmapped.
+}
+
+// Count returns the count for the named meta-feature.
+func (self *FeatureCounts) Count(name string) int {
+	for i, n := range self.Names {
+		if n == name {
+			return self.Counts[i]
+		}
+	}
+	return 0
+}
+
+// CountFeatures reads the remaining records from r and counts the alignments, or fragments if
+// opts.Pairs is true, that overlap the annotations, anns, according to opts. Strandless
+// annotations match alignments on either strand. If opts is nil, unstranded unpaired counting
+// in Union mode is performed.
+func CountFeatures(r RecordReader, anns []Annotation, opts *CountOptions) (*FeatureCounts, error) {
+	var o CountOptions
+	if opts != nil {
+		o = *opts
+	}
+	keep := o.Keep
+	if keep == nil {
+		keep = func(r *Record) bool { return r.Flags()&(Unmapped|Secondary|Supplementary|QCFail) == 0 }
+	}
+
+	idx := newAnnotationIndex(anns)
+	fc := &FeatureCounts{Names: idx.names, Counts: make([]int, len(idx.names))}
+
+	pending := make(map[string]*fragment)
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		fl := rec.Flags()
+		if fl&Unmapped != 0 || !keep(rec) {
+			fc.Unassigned++
+			continue
+		}
+		frag := &fragment{tid: rec.RefID(), reverse: fl&Reverse != 0}
+		if fl&Read2 != 0 {
+			frag.reverse = !frag.reverse
+		}
+		alignedBlocks(rec.Start(), rec.Cigar(), func(beg, end int) {
+			frag.blocks = append(frag.blocks, [2]int{beg, end})
+		})
+		if o.Pairs && fl&Paired != 0 && fl&MateUnmapped == 0 {
+			name := rec.Name()
+			mate, ok := pending[name]
+			if !ok {
+				pending[name] = frag
+				continue
+			}
+			delete(pending, name)
+			if mate.tid == frag.tid {
+				frag.blocks = append(frag.blocks, mate.blocks...)
+			}
+		}
+		fc.assign(idx, frag, &o)
+	}
+
+	// Reads whose mates were not counted are counted alone.
+	names := make([]string, 0, len(pending))
+	for n := range pending {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fc.assign(idx, pending[n], &o)
+	}
+
+	return fc, nil
+}
+
+// A fragment is the set of aligned reference blocks of a read or read pair.
+type fragment struct {
+	tid     int
+	reverse bool
+	blocks  [][2]int
+}
+
+// assign counts the fragment f against the meta-features in idx.
+func (self *FeatureCounts) assign(idx *annotationIndex, f *fragment, o *CountOptions) {
+	strand := int8(1)
+	if f.reverse {
+		strand = -1
+	}
+	ok := func(s int8) bool {
+		switch {
+		case s == 0 || o.Strand == Unstranded:
+			return true
+		case o.Strand == Stranded:
+			return s == strand
+		default:
+			return s == -strand
+		}
+	}
+
+	var (
+		set   []int
+		first = true
+		buf   []int
+	)
+	for _, b := range f.blocks {
+		for pos := b[0]; pos < b[1]; pos++ {
+			buf = idx.at(buf[:0], f.tid, pos, ok)
+			switch o.Mode {
+			case Union:
+				for _, id := range buf {
+					if !containsInt(set, id) {
+						set = append(set, id)
+					}
+				}
+				continue
+			case IntersectionNonEmpty:
+				if len(buf) == 0 {
+					continue
+				}
+			}
+			if first {
+				set = append(set, buf...)
+				first = false
+				continue
+			}
+			n := 0
+			for _, id := range set {
+				if containsInt(buf, id) {
+					set[n] = id
+					n++
+				}
+			}
+			set = set[:n]
+		}
+	}
+
+	switch len(set) {
+	case 0:
+		self.NoFeature++
+	case 1:
+		self.Counts[set[0]]++
+	default:
+		self.Ambiguous++
+	}
+}
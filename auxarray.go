@@ -0,0 +1,143 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	notArray     = errors.New("boom: aux tag is not an array")
+	notIntArray  = errors.New("boom: aux tag is not an integer array")
+	shortArray   = errors.New("boom: aux array data truncated")
+	intOverflows = errors.New("boom: aux array value overflows int32")
+)
+
+// auxElemSize holds the sizes of the elements of 'B' aux arrays indexed by subtype.
+var auxElemSize = [256]int{'c': 1, 'C': 1, 's': 2, 'S': 2, 'i': 4, 'I': 4, 'f': 4}
+
+// array returns the subtype, length and element data of a 'B' aux array.
+func (self Aux) array() (typ byte, n int, data []byte, err error) {
+	if len(self) < 8 || self.Type() != 'B' {
+		return 0, 0, nil, notArray
+	}
+	typ = self[3]
+	size := auxElemSize[typ]
+	if size == 0 {
+		return 0, 0, nil, fmt.Errorf("boom: invalid aux array subtype %q", typ)
+	}
+	n = int(endian.Uint32(self[4:8]))
+	if n > (len(self)-8)/size {
+		return 0, 0, nil, shortArray
+	}
+	return typ, n, self[8 : 8+n*size], nil
+}
+
+// ArrayLen returns the number of elements of a 'B' array auxiliary tag, or -1 if the tag is not
+// a valid array.
+func (self Aux) ArrayLen() int {
+	_, n, _, err := self.array()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// DecodeInts appends the elements of an integer 'B' array auxiliary tag to dst[:0] and returns
+// the extended slice. No allocation is made if dst has sufficient capacity, so DecodeInts may be
+// used to read array tags on every record of a file without the allocations made by Value.
+func (self Aux) DecodeInts(dst []int32) ([]int32, error) {
+	typ, n, d, err := self.array()
+	if err != nil {
+		return dst[:0], err
+	}
+	if typ == 'f' {
+		return dst[:0], notIntArray
+	}
+	dst = grow(dst, n)
+	switch typ {
+	case 'c':
+		for i := range dst {
+			dst[i] = int32(int8(d[i]))
+		}
+	case 'C':
+		for i := range dst {
+			dst[i] = int32(d[i])
+		}
+	case 's':
+		for i := range dst {
+			dst[i] = int32(int16(endian.Uint16(d[2*i:])))
+		}
+	case 'S':
+		for i := range dst {
+			dst[i] = int32(endian.Uint16(d[2*i:]))
+		}
+	case 'i':
+		for i := range dst {
+			dst[i] = int32(endian.Uint32(d[4*i:]))
+		}
+	case 'I':
+		for i := range dst {
+			v := endian.Uint32(d[4*i:])
+			if v > math.MaxInt32 {
+				return dst[:i], intOverflows
+			}
+			dst[i] = int32(v)
+		}
+	}
+	return dst, nil
+}
+
+// DecodeFloats appends the elements of a numeric 'B' array auxiliary tag to dst[:0], converting
+// integer elements to float32, and returns the extended slice. No allocation is made if dst has
+// sufficient capacity.
+func (self Aux) DecodeFloats(dst []float32) ([]float32, error) {
+	typ, n, d, err := self.array()
+	if err != nil {
+		return dst[:0], err
+	}
+	dst = grow(dst, n)
+	switch typ {
+	case 'c':
+		for i := range dst {
+			dst[i] = float32(int8(d[i]))
+		}
+	case 'C':
+		for i := range dst {
+			dst[i] = float32(d[i])
+		}
+	case 's':
+		for i := range dst {
+			dst[i] = float32(int16(endian.Uint16(d[2*i:])))
+		}
+	case 'S':
+		for i := range dst {
+			dst[i] = float32(endian.Uint16(d[2*i:]))
+		}
+	case 'i':
+		for i := range dst {
+			dst[i] = float32(int32(endian.Uint32(d[4*i:])))
+		}
+	case 'I':
+		for i := range dst {
+			dst[i] = float32(endian.Uint32(d[4*i:]))
+		}
+	case 'f':
+		for i := range dst {
+			dst[i] = math.Float32frombits(endian.Uint32(d[4*i:]))
+		}
+	}
+	return dst, nil
+}
+
+// grow returns dst resliced to length n, allocating if its capacity is insufficient.
+func grow[T any](dst []T, n int) []T {
+	if cap(dst) < n {
+		return make([]T, n)
+	}
+	return dst[:n]
+}
@@ -0,0 +1,50 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"runtime"
+)
+
+// The AuxGet, AuxAppend and AuxDelete methods operate directly on the encoded data of a record
+// using libbam's bam_aux_get, bam_aux_append and bam_aux_del, without decoding the record's
+// auxiliary fields, for tools that stamp or strip a small number of tags on each record.
+
+// AuxGet returns a copy of the auxiliary field with the tag t, and whether the field is present.
+func (self *Record) AuxGet(t Tag) (Aux, bool) {
+	self.marshal()
+	off := self.auxGet(t)
+	if off < 0 {
+		return nil, false
+	}
+	a, _ := nextAux(self.dataView()[off:])
+	a = append(Aux(nil), a...)
+	runtime.KeepAlive(self.bamRecord)
+	return a, true
+}
+
+// AuxAppend appends the auxiliary field, a, to the record. AuxAppend does not check whether
+// a field with the same tag is already present; AuxDelete may be used to remove it first.
+func (self *Record) AuxAppend(a Aux) {
+	self.marshal()
+	d := []byte(a[3:])
+	switch a.Type() {
+	case 'Z', 'H':
+		d = append(d[:len(d):len(d)], 0)
+	}
+	self.auxAppend(a.Tag(), a.Type(), d)
+	self.decoded &^= auxField
+}
+
+// AuxDelete removes the first auxiliary field with the tag t from the record and returns whether
+// the field was present.
+func (self *Record) AuxDelete(t Tag) bool {
+	self.marshal()
+	if !self.auxDel(t) {
+		return false
+	}
+	self.decoded &^= auxField
+	return true
+}
@@ -0,0 +1,189 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+var badIndex = errors.New("boom: malformed BAM index")
+
+const (
+	baiLinearShift = 14      // Width of linear index windows as a power of two.
+	baiPseudoBin   = 37450   // Bin number of the samtools metadata pseudo-bin.
+	baiMaxChunks   = 1 << 24 // Sanity bound on counts read from an index.
+)
+
+// A baiChunk is a half-open interval of BGZF virtual file offsets.
+type baiChunk struct {
+	beg, end uint64
+}
+
+// A baiRef holds the binning and linear index of a single reference sequence.
+type baiRef struct {
+	bins      map[uint32][]baiChunk
+	intervals []uint64
+}
+
+// A bai holds the contents of a BAM index file.
+type bai struct {
+	refs     []baiRef
+	noCoord  uint64
+	hasCount bool
+}
+
+// dataRange returns the virtual file offsets of the start and end of the records of the
+// reference, and whether these are known.
+func (self *baiRef) dataRange() (beg, end uint64, ok bool) {
+	if meta, ok := self.bins[baiPseudoBin]; ok && len(meta) != 0 {
+		return meta[0].beg, meta[0].end, true
+	}
+	for b, chunks := range self.bins {
+		if b == baiPseudoBin {
+			continue
+		}
+		for _, c := range chunks {
+			if !ok || c.beg < beg {
+				beg = c.beg
+			}
+			if c.end > end {
+				end = c.end
+			}
+			ok = true
+		}
+	}
+	return beg, end, ok
+}
+
+// counts returns the numbers of mapped and unmapped records placed on the reference recorded
+// in the metadata pseudo-bin, and whether these are present.
+func (self *baiRef) counts() (mapped, unmapped uint64, ok bool) {
+	meta := self.bins[baiPseudoBin]
+	if len(meta) < 2 {
+		return 0, 0, false
+	}
+	return meta[1].beg, meta[1].end, true
+}
+
+// baiFilename returns the name of the index file for the BAM file, filename, following
+// the samtools convention of trying filename.bai and then replacing a .bam extension
+// with .bai.
+func baiFilename(filename string) string {
+	fn := filename + ".bai"
+	if _, err := os.Stat(fn); err == nil {
+		return fn
+	}
+	if strings.HasSuffix(filename, "bam") {
+		alt := filename[:len(filename)-3] + "bai"
+		if _, err := os.Stat(alt); err == nil {
+			return alt
+		}
+	}
+	return fn
+}
+
+// readBAIFile reads the BAM index for the BAM file, filename.
+func readBAIFile(filename string) (*bai, error) {
+	f, err := os.Open(baiFilename(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readBAI(bufio.NewReader(f))
+}
+
+// readBAI reads a BAM index from r.
+func readBAI(r io.Reader) (*bai, error) {
+	var magic [4]byte
+	_, err := io.ReadFull(r, magic[:])
+	if err != nil {
+		return nil, err
+	}
+	if magic != [4]byte{'B', 'A', 'I', 1} {
+		return nil, badIndex
+	}
+
+	le := binary.LittleEndian
+	var buf [16]byte
+	u32 := func() (uint32, error) {
+		_, err := io.ReadFull(r, buf[:4])
+		return le.Uint32(buf[:4]), err
+	}
+	u64 := func() (uint64, error) {
+		_, err := io.ReadFull(r, buf[:8])
+		return le.Uint64(buf[:8]), err
+	}
+
+	n, err := u32()
+	if err != nil {
+		return nil, err
+	}
+	if n > baiMaxChunks {
+		return nil, badIndex
+	}
+	idx := &bai{refs: make([]baiRef, n)}
+	for i := range idx.refs {
+		nBin, err := u32()
+		if err != nil {
+			return nil, err
+		}
+		if nBin > baiMaxChunks {
+			return nil, badIndex
+		}
+		ref := &idx.refs[i]
+		ref.bins = make(map[uint32][]baiChunk, nBin)
+		for j := uint32(0); j < nBin; j++ {
+			bin, err := u32()
+			if err != nil {
+				return nil, err
+			}
+			nChunk, err := u32()
+			if err != nil {
+				return nil, err
+			}
+			if nChunk > baiMaxChunks {
+				return nil, badIndex
+			}
+			chunks := make([]baiChunk, nChunk)
+			for k := range chunks {
+				_, err = io.ReadFull(r, buf[:16])
+				if err != nil {
+					return nil, err
+				}
+				chunks[k] = baiChunk{beg: le.Uint64(buf[:8]), end: le.Uint64(buf[8:])}
+			}
+			ref.bins[bin] = chunks
+		}
+		nIntv, err := u32()
+		if err != nil {
+			return nil, err
+		}
+		if nIntv > baiMaxChunks {
+			return nil, badIndex
+		}
+		ref.intervals = make([]uint64, nIntv)
+		for j := range ref.intervals {
+			ref.intervals[j], err = u64()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	idx.noCoord, err = u64()
+	switch err {
+	case nil:
+		idx.hasCount = true
+	case io.EOF:
+	default:
+		return nil, err
+	}
+
+	return idx, nil
+}
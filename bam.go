@@ -68,20 +68,94 @@ func (self *BAMFile) Close() error {
 	return self.samClose()
 }
 
+// SetVerbosity sets the level of debugging information emitted on stderr by libbam for
+// subsequent operations on the file, independently of the process-wide level set by
+// Verbosity. Passing a negative value restores use of the process-wide level.
+func (self *BAMFile) SetVerbosity(v int) {
+	self.setVerbosity(v)
+}
+
+// SetTagRewriter sets fn to be applied to the auxiliary fields of subsequently written records,
+// allowing tags to be stripped or rewritten as records are encoded for output. Records passed
+// to Write are not modified. Passing nil removes the TagRewriter.
+func (self *BAMFile) SetTagRewriter(fn TagRewriter) {
+	self.rewrite = fn
+}
+
+// SetSortOrderCheck sets the sort order, by, that subsequently written records are required
+// to follow, typically the order declared in the file's header. Write returns an error, and
+// does not write the record, if a record sorts before the previously written record.
+// Passing UnknownOrder or Unsorted disables the check.
+func (self *BAMFile) SetSortOrderCheck(by SortOrder) {
+	self.order = by
+	self.last = nil
+}
+
 // Read reads a single BAM record and returns this or any error, and the number of bytes read.
+// At the end of the file the error is io.EOF; other read failures return a *ReadError.
 func (self *BAMFile) Read() (r *Record, n int, err error) {
 	n, br, err := self.samRead()
 	r = &Record{bamRecord: br, marshalled: true}
+	self.attach(r)
+	return
+}
+
+// ReadInto reads the next BAM record into r, reusing the C and Go allocations held by r, and
+// returns the number of bytes read and any error. Fields of r are decoded lazily when first
+// accessed, so records read by ReadInto whose fields are not all inspected incur fewer
+// allocations than those returned by Read. Slices previously returned by, or passed to, the
+// methods of r may be overwritten by subsequent calls to ReadInto and must be copied if they
+// are to be retained. A zero Record may be passed to ReadInto.
+func (self *BAMFile) ReadInto(r *Record) (n int, err error) {
+	if r.bamRecord == nil {
+		r.bamRecord, err = newBamRecord(nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err = self.samReadInto(r.bamRecord)
+	r.marshalled = true
+	r.decoded = 0
+	self.attach(r)
 	return
 }
 
 // Write writes a BAM record, r, returning the number of bytes written and any error that occurred.
 func (self *BAMFile) Write(r *Record) (n int, err error) {
+	err = self.checkValid(r)
+	if err != nil {
+		return 0, err
+	}
+	k, err := self.checkOrder(r, self.last)
+	if err != nil {
+		return 0, err
+	}
 	if r.marshalled == false {
-		r.setDataUnsafe(r.marshalData())
+		r.setData(r.marshalData())
 		r.marshalled = true
 	}
-	return self.samWrite(r.bamRecord)
+	br, err := self.rewriteTags(r.bamRecord)
+	if err != nil {
+		return 0, err
+	}
+	n, err = self.samWrite(br)
+	if err == nil && n >= 0 {
+		self.setLast(k)
+	}
+	return n, err
+}
+
+// Tell returns the virtual file offset of the next record to be read from, or written to, the
+// BAM file. The high 48 bits of the offset hold the position of the BGZF block in the file
+// and the low 16 bits the position within the uncompressed block.
+func (self *BAMFile) Tell() (int64, error) {
+	return self.bamTell()
+}
+
+// SeekVirtual positions the BAM file, which must be open for reading, at the virtual file offset,
+// off. off must have been returned by a call to Tell on the same file.
+func (self *BAMFile) SeekVirtual(off int64) error {
+	return self.bamSeek(off)
 }
 
 // RefID returns the tid corresponding to the string chr and true if a match is present.
@@ -148,8 +222,73 @@ type FetchFn func(*Record) (done bool)
 // each iteration and is unusable after Fetch returns, so the values should not be stored.
 func (self *BAMFile) Fetch(i *Index, tid int, beg, end int, fn FetchFn) (ret int, err error) {
 	f := func(b *bamRecord) bool {
-		return fn(&Record{bamRecord: b})
+		r := &Record{bamRecord: b, marshalled: true}
+		self.attach(r)
+		return fn(r)
 	}
 
 	return self.bamFetch(i.bamIndex, tid, beg, end, f)
 }
+
+// A RecordReader reads successive alignment records. BAMFile, SAMFile and Iterator satisfy
+// RecordReader.
+type RecordReader interface {
+	Read() (r *Record, n int, err error)
+}
+
+// An Iterator iterates over the records of a region of an indexed BAM file. An Iterator shares
+// the file position of the BAMFile it was created from, so reads from the BAMFile and other
+// Iterators must not be interleaved with reads from the Iterator.
+type Iterator struct {
+	*bamIter
+}
+
+// Query returns an Iterator over all BAM records within the interval [beg, end) of the reference
+// sequence identified by tid.
+func (self *BAMFile) Query(i *Index, tid int, beg, end int) (it *Iterator, err error) {
+	bi, err := self.bamIterQuery(i.bamIndex, tid, beg, end)
+	if err != nil {
+		return
+	}
+	return &Iterator{bi}, nil
+}
+
+// Read reads the next BAM record in the Iterator's region and returns this or any error, and the
+// number of bytes read. At the end of the region io.EOF is returned.
+func (self *Iterator) Read() (r *Record, n int, err error) {
+	n, br, err := self.bamIterRead()
+	r = &Record{bamRecord: br, marshalled: true}
+	self.sf.attach(r)
+	return
+}
+
+// ReadInto reads the next record in the Iterator's region into r, reusing the allocations held
+// by r as described for BAMFile.ReadInto.
+func (self *Iterator) ReadInto(r *Record) (n int, err error) {
+	if r.bamRecord == nil {
+		r.bamRecord, err = newBamRecord(nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err = self.bamIterReadInto(r.bamRecord)
+	r.marshalled = true
+	r.decoded = 0
+	self.sf.attach(r)
+	return
+}
+
+// Close releases the resources held by the Iterator.
+func (self *Iterator) Close() error {
+	if self == nil {
+		return nil
+	}
+	return self.bamIterDestroy()
+}
+
+// ParseRegion parses the samtools region string, region, in the format "ref:beg-end" returning
+// the reference ID and the half-open interval [beg, end) described. If the region is not
+// valid for the BAM file's header, an error is returned.
+func (self *BAMFile) ParseRegion(region string) (tid, beg, end int, err error) {
+	return self.header().bamParseRegion(region)
+}
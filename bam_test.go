@@ -0,0 +1,123 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom_test
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/biogo/boom"
+	"github.com/biogo/boom/generator"
+)
+
+// openBench returns a BAM file holding synthetic paired reads and the virtual offset of its
+// first record.
+func openBench(tb testing.TB) (*boom.BAMFile, int64) {
+	g, err := generator.New(generator.Config{
+		Seed:      1,
+		Paired:    true,
+		Coverage:  5,
+		Mismatch:  0.01,
+		ReadGroup: "rg1",
+	})
+	if err != nil {
+		tb.Fatalf("failed to create generator: %v", err)
+	}
+	fn := filepath.Join(tb.TempDir(), "bench.bam")
+	err = g.WriteBAM(fn)
+	if err != nil {
+		tb.Fatalf("failed to write BAM: %v", err)
+	}
+	f, err := boom.OpenBAM(fn)
+	if err != nil {
+		tb.Fatalf("failed to open BAM: %v", err)
+	}
+	tb.Cleanup(func() { f.Close() })
+	off, err := f.Tell()
+	if err != nil {
+		tb.Fatalf("failed to get offset: %v", err)
+	}
+	return f, off
+}
+
+// inspect reads the variable length fields of r other than the read name, which is
+// returned as a newly allocated string.
+func inspect(r *boom.Record) int {
+	return len(r.Cigar()) + len(r.Seq()) + len(r.Quality()) + len(r.Tags())
+}
+
+func benchmarkRead(b *testing.B, fields bool) {
+	f, off := openBench(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, _, err := f.Read()
+		if err == io.EOF {
+			err = f.SeekVirtual(off)
+			if err == nil {
+				r, _, err = f.Read()
+			}
+		}
+		if err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+		if fields {
+			inspect(r)
+		} else {
+			r.Flags()
+		}
+	}
+}
+
+func benchmarkReadInto(b *testing.B, fields bool) {
+	f, off := openBench(b)
+	var r boom.Record
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := f.ReadInto(&r)
+		if err == io.EOF {
+			err = f.SeekVirtual(off)
+			if err == nil {
+				_, err = f.ReadInto(&r)
+			}
+		}
+		if err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+		if fields {
+			inspect(&r)
+		} else {
+			r.Flags()
+		}
+	}
+}
+
+func BenchmarkRead(b *testing.B)           { benchmarkRead(b, false) }
+func BenchmarkReadFields(b *testing.B)     { benchmarkRead(b, true) }
+func BenchmarkReadInto(b *testing.B)       { benchmarkReadInto(b, false) }
+func BenchmarkReadIntoFields(b *testing.B) { benchmarkReadInto(b, true) }
+
+func TestReadIntoAllocs(t *testing.T) {
+	f, off := openBench(t)
+	var r boom.Record
+	allocs := testing.AllocsPerRun(1000, func() {
+		_, err := f.ReadInto(&r)
+		if err == io.EOF {
+			err = f.SeekVirtual(off)
+			if err == nil {
+				_, err = f.ReadInto(&r)
+			}
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		inspect(&r)
+	})
+	if allocs != 0 {
+		t.Errorf("unexpected allocations reading into a reused record: got %v want 0", allocs)
+	}
+}
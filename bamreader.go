@@ -0,0 +1,342 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"iter"
+	"slices"
+	"sort"
+
+	"github.com/biogo/boom/bgzf"
+)
+
+var (
+	notBAMData   = errors.New("boom: not BAM data")
+	bigEndianBAM = errors.New("boom: BAMReader is not supported on big-endian hosts")
+)
+
+// bamRecordCoreLen is the length of the fixed fields of a BAM record following its block size.
+const bamRecordCoreLen = 32
+
+// A BAMReader reads BAM data from an io.ReadSeeker, such as a RemoteFile, decompressing and
+// decoding in Go rather than with libbam. Decompressed blocks may be retained in a bgzf.Cache
+// shared between BAMReaders, and regions may be queried once an index has been read. A
+// BAMReader is not safe for concurrent use.
+type BAMReader struct {
+	r    io.ReadSeeker
+	bg   *bgzf.Reader
+	h    *Header
+	refs []string
+	idx  *bai
+	buf  []byte
+}
+
+// NewBAMReader returns a BAMReader reading the BAM data in r, which must be positioned at the
+// start of the data. If c is not nil, decompressed blocks are retained in c keyed by name and
+// their file offsets, and are taken from c rather than read from r when present.
+func NewBAMReader(r io.ReadSeeker, name string, c *bgzf.Cache) (*BAMReader, error) {
+	if bamIsBigEndian {
+		// Record data is held in libbam's byte order.
+		return nil, bigEndianBAM
+	}
+	bg := bgzf.NewReader(r)
+	if c != nil {
+		err := bg.SetCache(c, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	h, err := readBAMHeader(bg)
+	if err != nil {
+		return nil, err
+	}
+	return &BAMReader{r: r, bg: bg, h: h, refs: h.RefNames()}, nil
+}
+
+// readBAMHeader reads the header of BAM data from r. Reference sequences are taken from the
+// binary reference list rather than the @SQ lines of the header text.
+func readBAMHeader(r io.Reader) (*Header, error) {
+	le := binary.LittleEndian
+	var buf [4]byte
+	i32 := func() (int, error) {
+		_, err := io.ReadFull(r, buf[:])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return int(int32(le.Uint32(buf[:]))), err
+	}
+	_, err := io.ReadFull(r, buf[:])
+	if err != nil {
+		return nil, err
+	}
+	if buf != [4]byte{'B', 'A', 'M', 1} {
+		return nil, notBAMData
+	}
+	n, err := i32()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, notBAMData
+	}
+	text := make([]byte, n)
+	_, err = io.ReadFull(r, text)
+	if err != nil {
+		return nil, err
+	}
+	n, err = i32()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, notBAMData
+	}
+	var (
+		names []string
+		lens  []uint32
+	)
+	for i := 0; i < n; i++ {
+		l, err := i32()
+		if err != nil {
+			return nil, err
+		}
+		if l < 1 {
+			return nil, notBAMData
+		}
+		name := make([]byte, l)
+		_, err = io.ReadFull(r, name)
+		if err != nil {
+			return nil, err
+		}
+		ln, err := i32()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, string(name[:l-1]))
+		lens = append(lens, uint32(ln))
+	}
+
+	// Trim the text at its terminating NUL, if it has one.
+	if i := slices.Index(text, 0); i >= 0 {
+		text = text[:i]
+	}
+	h, err := NewHeader(string(text))
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(h.RefNames(), names) || !slices.Equal(h.RefLengths(), lens) {
+		h.setTargets(names, lens)
+	}
+	return h, nil
+}
+
+// Header returns the header of the BAM data.
+func (self *BAMReader) Header() *Header { return self.h }
+
+// Read reads the next record and returns it and the number of bytes read. At the end of the
+// data io.EOF is returned.
+func (self *BAMReader) Read() (*Record, int, error) {
+	r, err := NewRecord()
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := self.ReadInto(r)
+	if err != nil {
+		return nil, n, err
+	}
+	return r, n, nil
+}
+
+// ReadInto reads the next record into r, reusing the allocations held by r, and returns the
+// number of bytes read.
+func (self *BAMReader) ReadInto(r *Record) (int, error) {
+	if r.bamRecord == nil {
+		var err error
+		r.bamRecord, err = newBamRecord(nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+	le := binary.LittleEndian
+	var size [4]byte
+	_, err := io.ReadFull(self.bg, size[:])
+	if err != nil {
+		return 0, err
+	}
+	n := int(int32(le.Uint32(size[:])))
+	if n < bamRecordCoreLen {
+		return len(size), &MalformedRecord{Reason: "record shorter than its fixed fields"}
+	}
+	if cap(self.buf) < n {
+		self.buf = make([]byte, n)
+	}
+	b := self.buf[:n]
+	_, err = io.ReadFull(self.bg, b)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return len(size), err
+	}
+
+	lQname, nCigar, lSeq := int(b[8]), int(le.Uint16(b[12:])), int(int32(le.Uint32(b[16:])))
+	lAux := n - bamRecordCoreLen - lQname - 4*nCigar - (lSeq+1)/2 - lSeq
+	if lSeq < 0 || lAux < 0 {
+		return len(size) + n, &MalformedRecord{Reason: "record fields longer than the record"}
+	}
+	r.setTid(int32(le.Uint32(b[0:])))
+	r.setPos(int32(le.Uint32(b[4:])))
+	r.setLQname(b[8])
+	r.setQual(b[9])
+	r.setBin(le.Uint16(b[10:]))
+	r.setNCigar(uint16(nCigar))
+	r.setFlag(Flags(le.Uint16(b[14:])))
+	r.setLQseq(int32(lSeq))
+	r.setMtid(int32(le.Uint32(b[20:])))
+	r.setMpos(int32(le.Uint32(b[24:])))
+	r.setIsize(int32(le.Uint32(b[28:])))
+	r.setLAux(int32(lAux))
+	r.setData(b[bamRecordCoreLen:])
+	r.marshalled = true
+	r.decoded = 0
+	r.refs = self.refs
+	return len(size) + n, nil
+}
+
+// Tell returns the virtual file offset of the next record to be read.
+func (self *BAMReader) Tell() int64 { return self.bg.Tell() }
+
+// SeekVirtual positions the BAMReader at the virtual file offset, off.
+func (self *BAMReader) SeekVirtual(off int64) error { return self.bg.SeekVirtual(off) }
+
+// ReadIndex reads the BAI index held in r for use by Query.
+func (self *BAMReader) ReadIndex(r io.Reader) error {
+	idx, err := readBAI(r)
+	if err != nil {
+		return err
+	}
+	self.idx = idx
+	return nil
+}
+
+// Query returns an iterator over the records overlapping the half-open interval [beg, end) of
+// the reference sequence identified by tid, as for BAMFile.QueryRecords. An index must have
+// been read using ReadIndex. Query shares the position of the BAMReader.
+func (self *BAMReader) Query(tid, beg, end int) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		chunks, err := self.chunks(tid, beg, end)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, c := range chunks {
+			if uint64(self.bg.Tell()) != c.beg {
+				err = self.bg.SeekVirtual(int64(c.beg))
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+			}
+			for uint64(self.bg.Tell()) < c.end {
+				r, _, err := self.Read()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+				if r.RefID() != tid || r.Start() >= end {
+					return
+				}
+				rend := r.Start() + 1
+				if cigar := r.Cigar(); len(cigar) != 0 {
+					rend = r.Start() + refLen(cigar)
+				}
+				if rend > beg && !yield(r, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// chunks returns the chunks of the index that may hold records overlapping [beg, end) of the
+// reference sequence tid, selected, ordered and merged as in libbam's bam_iter_query.
+func (self *BAMReader) chunks(tid, beg, end int) ([]baiChunk, error) {
+	if self.idx == nil {
+		return nil, noIndex
+	}
+	if tid < 0 || tid >= len(self.idx.refs) {
+		return nil, badRegion
+	}
+	beg = max(beg, 0)
+	ref := &self.idx.refs[tid]
+
+	var minOff uint64
+	if n := len(ref.intervals); n != 0 {
+		i := min(beg>>baiLinearShift, n-1)
+		minOff = ref.intervals[i]
+		if minOff == 0 {
+			// Handle indexes built by early versions of tabix.
+			for i = min(beg>>baiLinearShift, n) - 1; i >= 0 && ref.intervals[i] == 0; i-- {
+			}
+			if i >= 0 {
+				minOff = ref.intervals[i]
+			}
+		}
+	}
+	var chunks []baiChunk
+	for _, bin := range Reg2Bins(nil, beg, end) {
+		for _, c := range ref.bins[uint32(bin)] {
+			if c.end > minOff {
+				chunks = append(chunks, c)
+			}
+		}
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].beg < chunks[j].beg })
+
+	// Drop chunks contained by their predecessor, trim
+	// overlapping chunks and merge chunks that end and
+	// start in the same BGZF block.
+	l := 0
+	for _, c := range chunks[1:] {
+		if chunks[l].end < c.end {
+			l++
+			chunks[l] = c
+		}
+	}
+	chunks = chunks[:l+1]
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i-1].end >= chunks[i].beg {
+			chunks[i-1].end = chunks[i].beg
+		}
+	}
+	l = 0
+	for _, c := range chunks[1:] {
+		if chunks[l].end>>16 == c.beg>>16 {
+			chunks[l].end = c.end
+		} else {
+			l++
+			chunks[l] = c
+		}
+	}
+	return chunks[:l+1], nil
+}
+
+// Close closes the BAMReader and, if it is an io.Closer, the underlying reader.
+func (self *BAMReader) Close() error {
+	self.bg.Close()
+	if c, ok := self.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
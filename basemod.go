@@ -0,0 +1,164 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A BaseMod is a base modification call held in the MM and ML tags of a record.
+type BaseMod struct {
+	Pos    int    // Position of the base in the record's sequence as stored.
+	Base   byte   // The unmodified base in the sequenced orientation.
+	Strand byte   // '+' for a modification on the sequenced strand, '-' for the opposite strand.
+	Code   string // The modification code, such as "m" for 5mC, or a ChEBI identifier.
+
+	// Prob is the likelihood of the modification scaled to
+	// [0, 255] as held in the ML tag. Calls are given a
+	// likelihood of 255 if the record has no ML tag.
+	Prob int
+
+	// Implicit is true for calls inferred as unmodified
+	// because the base was skipped by an MM entry in the
+	// implicit mode. Implicit calls have a Prob of zero.
+	Implicit bool
+}
+
+// BaseMods returns the base modification calls described by the MM and ML tags of the record,
+// or by the Mm and Ml tags used by earlier versions of the specification. Calls are returned
+// in the order of the MM entries and, within an entry, in order along the sequenced read. For
+// entries in implicit mode, marked by '.' or by no mode, bases skipped by the entry are
+// returned as implicit unmodified calls. Entries in explicit mode, marked by '?', make no
+// statement about skipped bases. A record without an MM tag has no calls.
+func (self *Record) BaseMods() ([]BaseMod, error) {
+	mm, ok := self.Tag([]byte("MM"))
+	if !ok {
+		mm, ok = self.Tag([]byte("Mm"))
+	}
+	if !ok {
+		return nil, nil
+	}
+	fail := func(reason string) error { return &MalformedRecord{Name: self.Name(), Reason: reason} }
+	if mm.Type() != 'Z' {
+		return nil, fail("MM tag is not a string")
+	}
+	var ml []int32
+	a, ok := self.Tag([]byte("ML"))
+	if !ok {
+		a, ok = self.Tag([]byte("Ml"))
+	}
+	if ok {
+		var err error
+		ml, err = a.DecodeInts(nil)
+		if err != nil {
+			return nil, fail("invalid ML tag")
+		}
+	}
+
+	seq := self.Seq()
+	rev := self.Flags()&Reverse != 0
+	base := func(i int) byte {
+		if rev {
+			return complement(upper(seq[len(seq)-1-i]))
+		}
+		return upper(seq[i])
+	}
+	stored := func(i int) int {
+		if rev {
+			return len(seq) - 1 - i
+		}
+		return i
+	}
+
+	var (
+		mods []BaseMod
+		next int // Index of the next ML value.
+	)
+	desc := strings.TrimSuffix(string(mm[3:]), ";")
+	if desc == "" {
+		return nil, nil
+	}
+	for _, ent := range strings.Split(desc, ";") {
+		f := strings.Split(ent, ",")
+		h := f[0]
+		if len(h) < 3 || strings.IndexByte("ACGTUN", h[0]) < 0 || (h[1] != '+' && h[1] != '-') {
+			return nil, fail("invalid MM entry " + strconv.Quote(ent))
+		}
+		b, strand := h[0], h[1]
+		if b == 'U' {
+			b = 'T'
+		}
+		implicit := true
+		switch h[len(h)-1] {
+		case '?':
+			implicit = false
+			h = h[:len(h)-1]
+		case '.':
+			h = h[:len(h)-1]
+		}
+		var codes []string
+		if c := h[2:]; c != "" && strings.Trim(c, "0123456789") == "" {
+			codes = []string{c}
+		} else {
+			for i := range c {
+				codes = append(codes, c[i:i+1])
+			}
+		}
+		if len(codes) == 0 {
+			return nil, fail("missing modification code in MM entry " + strconv.Quote(ent))
+		}
+
+		i := 0 // Position along the sequenced read.
+		for _, d := range f[1:] {
+			skip, err := strconv.Atoi(d)
+			if err != nil || skip < 0 {
+				return nil, fail("invalid skip count in MM entry " + strconv.Quote(ent))
+			}
+			for ; ; i++ {
+				if i == len(seq) {
+					return nil, fail("MM entry " + strconv.Quote(ent) + " extends beyond sequence")
+				}
+				if b != 'N' && base(i) != b {
+					continue
+				}
+				if skip == 0 {
+					break
+				}
+				skip--
+				if implicit {
+					for _, c := range codes {
+						mods = append(mods, BaseMod{Pos: stored(i), Base: b, Strand: strand, Code: c, Implicit: true})
+					}
+				}
+			}
+			for _, c := range codes {
+				p := 255
+				if ml != nil {
+					if next == len(ml) {
+						return nil, fail("ML tag shorter than MM tag")
+					}
+					p = int(ml[next])
+					next++
+				}
+				mods = append(mods, BaseMod{Pos: stored(i), Base: b, Strand: strand, Code: c, Prob: p})
+			}
+			i++
+		}
+		if implicit {
+			for ; i < len(seq); i++ {
+				if b == 'N' || base(i) == b {
+					for _, c := range codes {
+						mods = append(mods, BaseMod{Pos: stored(i), Base: b, Strand: strand, Code: c, Implicit: true})
+					}
+				}
+			}
+		}
+	}
+	if ml != nil && next != len(ml) {
+		return nil, fail("ML tag longer than MM tag")
+	}
+	return mods, nil
+}
@@ -0,0 +1,179 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+)
+
+// batchBufSize is the size of the buffer used to pass records between libbam and Go in a
+// single call by ReadBatch and WriteBatch.
+const batchBufSize = 1 << 20
+
+// A recordBatch holds the buffers used for batched record I/O.
+type recordBatch struct {
+	buf     []byte
+	scratch *bamRecord // Receives records read by libbam.
+	ref     *bamRecord // Refers to records written by libbam; holds no data.
+}
+
+// recordBatch returns the file's batch buffers, allocating them if necessary.
+func (sf *samFile) recordBatch() (*recordBatch, error) {
+	if sf.batch != nil {
+		return sf.batch, nil
+	}
+	scratch, err := newBamRecord(nil)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := newBamRecord(nil)
+	if err != nil {
+		return nil, err
+	}
+	sf.batch = &recordBatch{buf: make([]byte, batchBufSize), scratch: scratch, ref: ref}
+	return sf.batch, nil
+}
+
+// ReadBatch reads up to len(rs) records into the elements of rs, as described for ReadInto,
+// and returns the number of records read. Records are passed from libbam in batches, so
+// streaming reads using ReadBatch make far fewer calls into C than reads using ReadInto. Nil
+// elements of rs are replaced with new records. If a record is malformed, the records before
+// it are returned with the error and the records following it in the same batch are lost.
+// ReadBatch returns io.EOF only when no records were read, and returns read errors as
+// described for Read.
+func (self *BAMFile) ReadBatch(rs []*Record) (n int, err error) {
+	b, err := self.recordBatch()
+	if err != nil {
+		return 0, err
+	}
+	for n < len(rs) {
+		c, carry, last, rerr := self.samReadBatch(b.buf, len(rs)-n, b.scratch)
+		self.readAhead()
+		if err = self.verifyBlocks(); err != nil {
+			return n, err
+		}
+		for off, i := 0, 0; i < c; i++ {
+			r, err := self.batchRecord(rs, n)
+			if err != nil {
+				return n, err
+			}
+			var voff int64
+			off, voff = r.unbatch(b.buf, off)
+			self.nrec++
+			if err = atPos(r.validate(), self.nrec-1, voff); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if carry {
+			r, err := self.batchRecord(rs, n)
+			if err != nil {
+				return n, err
+			}
+			r.bamRecord.assign(b.scratch)
+			self.nrec++
+			if err = atPos(r.validate(), self.nrec-1, last); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if rerr != nil {
+			if rerr == io.EOF && n != 0 {
+				break
+			}
+			return n, rerr
+		}
+	}
+	return n, nil
+}
+
+// batchRecord returns rs[i] prepared to receive a record, allocating it if it is nil.
+func (sf *samFile) batchRecord(rs []*Record, i int) (*Record, error) {
+	r := rs[i]
+	if r == nil {
+		r = &Record{}
+		rs[i] = r
+	}
+	if r.bamRecord == nil {
+		var err error
+		r.bamRecord, err = newBamRecord(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.marshalled = true
+	r.decoded = 0
+	sf.attach(r)
+	return r, nil
+}
+
+// assign sets br to hold a copy of the record held by src.
+func (br *bamRecord) assign(src *bamRecord) {
+	br.b.core = src.b.core
+	br.b.l_aux = src.b.l_aux
+	br.setData(src.dataView())
+}
+
+// WriteBatch writes the records in rs, as described for Write, and returns the number of
+// records written. Records are passed to libbam in batches, so writing many records with
+// WriteBatch makes far fewer calls into C than writing them with Write.
+func (self *BAMFile) WriteBatch(rs []*Record) (n int, err error) {
+	b, err := self.recordBatch()
+	if err != nil {
+		return 0, err
+	}
+	buf := b.buf[:0]
+	var (
+		held int
+
+		// last points to the sort keys of the last held
+		// record, which are recorded once it is written.
+		last = self.last
+		k    sortKey
+	)
+	flush := func() error {
+		w, err := self.samWriteBatch(buf, held, b.ref)
+		n += w
+		if err == nil && w < held {
+			err = writeFailed
+		}
+		if err == nil && held != 0 {
+			self.setLast(k)
+		}
+		buf, held = buf[:0], 0
+		return err
+	}
+	for _, r := range rs {
+		if err = self.checkValid(r); err != nil {
+			break
+		}
+		var rk sortKey
+		if rk, err = self.checkOrder(r, last); err != nil {
+			break
+		}
+		r.marshal()
+		var br *bamRecord
+		br, err = self.rewriteTags(r.bamRecord)
+		if err != nil {
+			break
+		}
+		buf = br.batch(buf)
+		held++
+		k = rk
+		last = &k
+		if len(buf) >= batchBufSize {
+			if err = flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if ferr := flush(); err == nil {
+		err = ferr
+	}
+	if cap(buf) > cap(b.buf) {
+		b.buf = buf[:cap(buf)]
+	}
+	return n, err
+}
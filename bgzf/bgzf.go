@@ -0,0 +1,177 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bgzf implements reading and writing of BGZF (blocked gzip) compressed data as used by
+// BAM, tabix and bgzipped FASTA files. BGZF files are concatenations of gzip members of at most
+// 64kiB, allowing random access by virtual file offset; a virtual file offset holds the file
+// offset of the start of a block in its upper 48 bits and the offset of a byte within the
+// uncompressed data of the block in its lower 16 bits. The package does not depend on libbam
+// and may be used independently of package boom.
+package bgzf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// HeaderLen is the length of a BGZF block header.
+	HeaderLen = 18
+
+	// FooterLen is the length of the CRC32 and ISIZE fields
+	// ending a BGZF block.
+	FooterLen = 8
+
+	// MaxBlockSize is the largest permitted length of a block.
+	MaxBlockSize = 0x10000
+
+	// BlockDataSize is the largest amount of uncompressed data
+	// written to a single block by a Writer, ensuring that the
+	// compressed block fits within MaxBlockSize.
+	BlockDataSize = 0xff00
+)
+
+// ErrNotBGZF is returned when data are not in BGZF format.
+var ErrNotBGZF = errors.New("bgzf: not BGZF data")
+
+// eofMarker is the empty block marking the end of a BGZF file.
+var eofMarker = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0xff, 0x06, 0x00, 0x42, 0x43, 0x02, 0x00,
+	0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00,
+}
+
+// A BlockError is the error returned when a block cannot be decoded.
+type BlockError struct {
+	Offset int64 // File offset of the start of the block.
+	Err    error // The reason the block could not be decoded.
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("bgzf: corrupt block at offset %d: %v", e.Offset, e.Err)
+}
+
+// MakeOffset returns the virtual file offset of the byte at offset block within the
+// uncompressed data of the block starting at the file offset, file.
+func MakeOffset(file int64, block int) int64 {
+	return file<<16 | int64(block&0xffff)
+}
+
+// SplitOffset returns the file offset of the block and the offset within its uncompressed data
+// described by the virtual file offset v.
+func SplitOffset(v int64) (file int64, block int) {
+	return v >> 16, int(v & 0xffff)
+}
+
+// BlockSize returns the total length of the block with the header h, or zero if h is not a
+// valid BGZF block header.
+func BlockSize(h []byte) int {
+	if len(h) < HeaderLen ||
+		h[0] != 0x1f || h[1] != 0x8b || h[2] != 8 || h[3]&4 == 0 ||
+		binary.LittleEndian.Uint16(h[10:]) != 6 || h[12] != 'B' || h[13] != 'C' ||
+		binary.LittleEndian.Uint16(h[14:]) != 2 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(h[16:])) + 1
+}
+
+// HasEOF returns whether the size bytes of data held by r end with the BGZF EOF marker block.
+func HasEOF(r io.ReaderAt, size int64) (bool, error) {
+	if size < int64(len(eofMarker)) {
+		return false, nil
+	}
+	b := make([]byte, len(eofMarker))
+	_, err := r.ReadAt(b, size-int64(len(b)))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(b, eofMarker), nil
+}
+
+// A Decoder decodes individual BGZF blocks, reusing its buffers between blocks. The zero value
+// is ready to use.
+type Decoder struct {
+	zr  io.ReadCloser
+	src bytes.Reader
+	out bytes.Buffer
+}
+
+// DecodeBlock returns the uncompressed data of the complete block, blk, after checking them
+// against the CRC32 and ISIZE fields of the block. The returned slice is valid until the next
+// call to DecodeBlock.
+func (self *Decoder) DecodeBlock(blk []byte) ([]byte, error) {
+	size := BlockSize(blk)
+	switch {
+	case size == 0:
+		return nil, ErrNotBGZF
+	case size < HeaderLen+FooterLen || size != len(blk):
+		return nil, fmt.Errorf("invalid block size %d", size)
+	}
+	footer := blk[size-FooterLen:]
+	crc := binary.LittleEndian.Uint32(footer)
+	isize := binary.LittleEndian.Uint32(footer[4:])
+
+	self.src.Reset(blk[HeaderLen : size-FooterLen])
+	if self.zr == nil {
+		self.zr = flate.NewReader(&self.src)
+	} else {
+		self.zr.(flate.Resetter).Reset(&self.src, nil)
+	}
+	self.out.Reset()
+	if _, err := self.out.ReadFrom(self.zr); err != nil {
+		return nil, fmt.Errorf("inflate failed: %v", err)
+	}
+	if l := self.out.Len(); uint32(l) != isize {
+		return nil, fmt.Errorf("ISIZE mismatch: recorded %d, inflated %d", isize, l)
+	}
+	if c := crc32.ChecksumIEEE(self.out.Bytes()); c != crc {
+		return nil, fmt.Errorf("CRC32 mismatch: recorded %#08x, calculated %#08x", crc, c)
+	}
+	return self.out.Bytes(), nil
+}
+
+// An encoder deflates blocks, reusing its buffers.
+type encoder struct {
+	zw  *flate.Writer
+	buf bytes.Buffer
+}
+
+// encode returns the block holding data compressed at the given level, appended to dst.
+func (self *encoder) encode(dst, data []byte, level int) ([]byte, error) {
+	self.buf.Reset()
+	var err error
+	if self.zw == nil {
+		self.zw, err = flate.NewWriter(&self.buf, level)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		self.zw.Reset(&self.buf)
+	}
+	if _, err = self.zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = self.zw.Close(); err != nil {
+		return nil, err
+	}
+	size := HeaderLen + self.buf.Len() + FooterLen
+	if size > MaxBlockSize {
+		return nil, fmt.Errorf("bgzf: block too large: %d", size)
+	}
+	var h [HeaderLen]byte
+	copy(h[:], eofMarker[:16])
+	binary.LittleEndian.PutUint16(h[16:], uint16(size-1))
+	dst = append(dst, h[:]...)
+	dst = append(dst, self.buf.Bytes()...)
+	var f [FooterLen]byte
+	binary.LittleEndian.PutUint32(f[:], crc32.ChecksumIEEE(data))
+	binary.LittleEndian.PutUint32(f[4:], uint32(len(data)))
+	return append(dst, f[:]...), nil
+}
@@ -0,0 +1,175 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bgzf
+
+import (
+	"container/list"
+	"io"
+	"sync"
+)
+
+// DefaultPageSize is the default size of the pages read by a PageReader.
+const DefaultPageSize = 64 << 10
+
+// A Cache is a least recently used cache of decompressed BGZF blocks and file pages keyed by a
+// file name and file offset. A Cache is safe for concurrent use and may be shared between
+// Readers and PageReaders.
+type Cache struct {
+	mu   sync.Mutex
+	max  int64
+	used int64
+	lru  list.List
+	m    map[cacheKey]*list.Element
+
+	hits, misses int64
+}
+
+type cacheKey struct {
+	name string
+	off  int64
+	page bool
+}
+
+// A cacheEntry holds a decompressed block and the compressed size of the block, or a page
+// of a file.
+type cacheEntry struct {
+	data []byte
+	size int64
+}
+
+type cacheItem struct {
+	key cacheKey
+	cacheEntry
+}
+
+// NewCache returns a Cache holding up to max bytes of data.
+func NewCache(max int64) *Cache {
+	return &Cache{max: max, m: make(map[cacheKey]*list.Element)}
+}
+
+// Stats returns the numbers of cache hits and misses.
+func (self *Cache) Stats() (hits, misses int64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.hits, self.misses
+}
+
+// Size returns the number of bytes of data held by the cache.
+func (self *Cache) Size() int64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.used
+}
+
+// get returns the block of the named file at off.
+func (self *Cache) get(name string, off int64) (cacheEntry, bool) {
+	return self.lookup(cacheKey{name: name, off: off})
+}
+
+// put adds the block of the named file at off.
+func (self *Cache) put(name string, off int64, e cacheEntry) {
+	self.insert(cacheKey{name: name, off: off}, e)
+}
+
+func (self *Cache) lookup(k cacheKey) (cacheEntry, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	el, ok := self.m[k]
+	if !ok {
+		self.misses++
+		return cacheEntry{}, false
+	}
+	self.hits++
+	self.lru.MoveToFront(el)
+	return el.Value.(*cacheItem).cacheEntry, true
+}
+
+func (self *Cache) insert(k cacheKey, e cacheEntry) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if int64(len(e.data)) > self.max {
+		return
+	}
+	if el, ok := self.m[k]; ok {
+		self.used -= int64(len(el.Value.(*cacheItem).data))
+		self.lru.Remove(el)
+	}
+	self.m[k] = self.lru.PushFront(&cacheItem{key: k, cacheEntry: e})
+	self.used += int64(len(e.data))
+	for self.used > self.max {
+		el := self.lru.Back()
+		it := el.Value.(*cacheItem)
+		self.lru.Remove(el)
+		delete(self.m, it.key)
+		self.used -= int64(len(it.data))
+	}
+}
+
+// A PageReader provides random access to a file through a Cache, reading the file in fixed
+// size pages. It is intended for small, randomly accessed files such as indexes held on remote
+// servers, so that repeated queries do not repeat requests. The most recently read page is
+// always retained, so a PageReader without a Cache may be used to read ahead of a sequential
+// reader. A PageReader is not safe for concurrent use.
+type PageReader struct {
+	r        io.ReaderAt
+	size     int64
+	cache    *Cache
+	name     string
+	pageSize int
+
+	last    []byte
+	lastOff int64
+}
+
+// NewPageReader returns a PageReader reading the size bytes of r, caching pages of the given
+// size in c keyed by name. If c is nil, only the most recently read page is retained. If
+// pageSize is not positive, DefaultPageSize is used.
+func NewPageReader(r io.ReaderAt, size int64, c *Cache, name string, pageSize int) *PageReader {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return &PageReader{r: r, size: size, cache: c, name: name, pageSize: pageSize}
+}
+
+// ReadAt reads len(p) bytes starting at off.
+func (self *PageReader) ReadAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) {
+		if off >= self.size {
+			return n, io.EOF
+		}
+		page, err := self.page(off / int64(self.pageSize))
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], page[off%int64(self.pageSize):])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// page returns the page with index i.
+func (self *PageReader) page(i int64) ([]byte, error) {
+	k := cacheKey{name: self.name, off: i * int64(self.pageSize), page: true}
+	if self.last != nil && self.lastOff == k.off {
+		return self.last, nil
+	}
+	if self.cache != nil {
+		if e, ok := self.cache.lookup(k); ok {
+			self.last, self.lastOff = e.data, k.off
+			return e.data, nil
+		}
+	}
+	b := make([]byte, min(int64(self.pageSize), self.size-k.off))
+	_, err := self.r.ReadAt(b, k.off)
+	if err != nil && !(err == io.EOF && k.off+int64(len(b)) == self.size) {
+		return nil, err
+	}
+	if self.cache != nil {
+		self.cache.insert(k, cacheEntry{data: b})
+	}
+	self.last, self.lastOff = b, k.off
+	return b, nil
+}
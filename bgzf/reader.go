@@ -0,0 +1,163 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bgzf
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	errNotSeeker = errors.New("bgzf: underlying reader is not an io.Seeker")
+	errBadOffset = errors.New("bgzf: virtual offset beyond end of block")
+)
+
+// A Reader reads the uncompressed data of a BGZF stream. Each block is checked against its
+// CRC32 and ISIZE fields as it is read.
+type Reader struct {
+	r io.Reader
+
+	dec  Decoder
+	buf  []byte
+	data []byte // Uncompressed data of the current block.
+	pos  int    // Offset of the next byte in data.
+
+	block int64 // File offset of the current block.
+	next  int64 // File offset of the next block.
+	at    int64 // File offset of the position of r.
+	err   error
+
+	cache *Cache
+	name  string
+}
+
+// NewReader returns a Reader reading BGZF data from r, which must be positioned at the start
+// of the data. If r is an io.Seeker, the Reader may be positioned using SeekVirtual.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Read reads up to len(p) bytes of uncompressed data into p. Empty blocks, including the EOF
+// marker block, are skipped.
+func (self *Reader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if self.pos == len(self.data) {
+			if self.err != nil {
+				break
+			}
+			self.err = self.readBlock()
+			continue
+		}
+		c := copy(p[n:], self.data[self.pos:])
+		self.pos += c
+		n += c
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, self.err
+}
+
+// SetCache sets the Reader to retain the decompressed blocks it reads in c, keyed by name and
+// the file offset of each block, and to take blocks from c rather than reading them from the
+// underlying reader when they are present. Readers of the same data may share a Cache by using
+// the same name. The underlying reader must be an io.Seeker. Passing a nil Cache disables
+// caching.
+func (self *Reader) SetCache(c *Cache, name string) error {
+	if _, ok := self.r.(io.Seeker); !ok && c != nil {
+		return errNotSeeker
+	}
+	self.cache, self.name = c, name
+	return nil
+}
+
+// readBlock reads and decodes the next block.
+func (self *Reader) readBlock() error {
+	self.block = self.next
+	self.data, self.pos = nil, 0
+	if self.cache != nil {
+		if e, ok := self.cache.get(self.name, self.block); ok {
+			self.data = e.data
+			self.next += e.size
+			return nil
+		}
+	}
+	if self.at != self.next {
+		if _, err := self.r.(io.Seeker).Seek(self.next, io.SeekStart); err != nil {
+			return err
+		}
+		self.at = self.next
+	}
+	if self.buf == nil {
+		self.buf = make([]byte, MaxBlockSize)
+	}
+	n, err := io.ReadFull(self.r, self.buf[:HeaderLen])
+	self.at += int64(n)
+	switch {
+	case n == 0 && err == io.EOF:
+		return io.EOF
+	case err == io.ErrUnexpectedEOF:
+		return &BlockError{Offset: self.block, Err: err}
+	case err != nil:
+		return err
+	}
+	size := BlockSize(self.buf)
+	if size < HeaderLen+FooterLen {
+		return &BlockError{Offset: self.block, Err: ErrNotBGZF}
+	}
+	n, err = io.ReadFull(self.r, self.buf[HeaderLen:size])
+	self.at += int64(n)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &BlockError{Offset: self.block, Err: err}
+	}
+	self.next += int64(size)
+	self.data, err = self.dec.DecodeBlock(self.buf[:size])
+	if err != nil {
+		return &BlockError{Offset: self.block, Err: err}
+	}
+	if self.cache != nil {
+		self.data = append([]byte(nil), self.data...)
+		self.cache.put(self.name, self.block, cacheEntry{data: self.data, size: int64(size)})
+	}
+	return nil
+}
+
+// Tell returns the virtual file offset of the next byte to be read. When the current block has
+// been completely read, the offset of the start of the next block is returned.
+func (self *Reader) Tell() int64 {
+	if self.pos == len(self.data) {
+		return MakeOffset(self.next, 0)
+	}
+	return MakeOffset(self.block, self.pos)
+}
+
+// SeekVirtual positions the Reader at the virtual file offset, v. The underlying reader must
+// be an io.Seeker.
+func (self *Reader) SeekVirtual(v int64) error {
+	if _, ok := self.r.(io.Seeker); !ok {
+		return errNotSeeker
+	}
+	file, off := SplitOffset(v)
+	self.next = file
+	self.err = self.readBlock()
+	if self.err != nil && !(self.err == io.EOF && off == 0) {
+		return self.err
+	}
+	if off > len(self.data) {
+		self.data = nil
+		return errBadOffset
+	}
+	self.pos = off
+	return nil
+}
+
+// Close closes the Reader. It does not close the underlying reader.
+func (self *Reader) Close() error {
+	self.data, self.buf = nil, nil
+	return nil
+}
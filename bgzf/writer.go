@@ -0,0 +1,214 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bgzf
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var errClosed = errors.New("bgzf: write to closed writer")
+
+// A Writer writes data to a BGZF stream. Blocks may be compressed concurrently, but are
+// always written to the underlying writer in order.
+type Writer struct {
+	w     io.Writer
+	level int
+
+	buf []byte // Data not yet submitted for compression.
+
+	enc     encoder       // Used when compressing synchronously.
+	jobs    chan *job     // Blocks waiting for compression.
+	order   chan *job     // Blocks waiting to be written, in order.
+	done    chan struct{} // Closed when the writing goroutine exits.
+	pending sync.WaitGroup
+
+	mu     sync.Mutex
+	off    int64 // File offset following the last written block.
+	err    error
+	closed bool
+}
+
+// A job is a block to be compressed and written.
+type job struct {
+	data []byte
+	blk  []byte
+	err  error
+	done chan struct{}
+}
+
+// NewWriter returns a Writer writing BGZF data to w using the default compression level and wc
+// goroutines to compress blocks. If wc is less than 2, blocks are compressed synchronously.
+func NewWriter(w io.Writer, wc int) *Writer {
+	bw, _ := NewWriterLevel(w, flate.DefaultCompression, wc)
+	return bw
+}
+
+// NewWriterLevel returns a Writer writing BGZF data to w using the given compression level,
+// which must be a valid compress/flate level, and wc goroutines to compress blocks. If wc is
+// less than 2, blocks are compressed synchronously.
+func NewWriterLevel(w io.Writer, level, wc int) (*Writer, error) {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, fmt.Errorf("bgzf: invalid compression level: %d", level)
+	}
+	bw := &Writer{w: w, level: level}
+	if wc > 1 {
+		bw.jobs = make(chan *job, wc)
+		bw.order = make(chan *job, 2*wc)
+		bw.done = make(chan struct{})
+		for i := 0; i < wc; i++ {
+			go bw.compress()
+		}
+		go bw.write()
+	}
+	return bw, nil
+}
+
+// compress compresses blocks received from the jobs channel.
+func (self *Writer) compress() {
+	var enc encoder
+	for j := range self.jobs {
+		j.blk, j.err = enc.encode(nil, j.data, self.level)
+		close(j.done)
+	}
+}
+
+// write writes compressed blocks to the underlying writer in the order they were submitted.
+func (self *Writer) write() {
+	defer close(self.done)
+	for j := range self.order {
+		<-j.done
+		err := j.err
+		if err == nil {
+			err = self.emit(j.blk)
+		}
+		if err != nil {
+			self.setErr(err)
+		}
+		self.pending.Done()
+	}
+}
+
+// emit writes the block, blk, to the underlying writer unless an error has occurred.
+func (self *Writer) emit(blk []byte) error {
+	if self.Err() != nil {
+		return nil
+	}
+	n, err := self.w.Write(blk)
+	self.mu.Lock()
+	self.off += int64(n)
+	self.mu.Unlock()
+	return err
+}
+
+// setErr records the first error encountered.
+func (self *Writer) setErr(err error) {
+	self.mu.Lock()
+	if self.err == nil {
+		self.err = err
+	}
+	self.mu.Unlock()
+}
+
+// Err returns the first error encountered while compressing or writing blocks.
+func (self *Writer) Err() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.err
+}
+
+// Write writes p to the BGZF stream. Data are held until a block is filled, or until Flush or
+// Close is called.
+func (self *Writer) Write(p []byte) (n int, err error) {
+	if self.closed {
+		return 0, errClosed
+	}
+	if err = self.Err(); err != nil {
+		return 0, err
+	}
+	for len(p) != 0 {
+		c := min(len(p), BlockDataSize-len(self.buf))
+		self.buf = append(self.buf, p[:c]...)
+		p = p[c:]
+		n += c
+		if len(self.buf) == BlockDataSize {
+			if err = self.submit(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// submit compresses the held data into a block and queues it for writing.
+func (self *Writer) submit() error {
+	data := self.buf
+	self.buf = nil
+	if self.jobs == nil {
+		blk, err := self.enc.encode(nil, data, self.level)
+		if err == nil {
+			err = self.emit(blk)
+		}
+		if err != nil {
+			self.setErr(err)
+		}
+		self.buf = data[:0]
+		return err
+	}
+	j := &job{data: data, done: make(chan struct{})}
+	self.pending.Add(1)
+	self.order <- j
+	self.jobs <- j
+	return nil
+}
+
+// Flush writes any held data as a block, even if it is not full, and waits until all blocks
+// have been written to the underlying writer. Data written after Flush start a new block.
+func (self *Writer) Flush() error {
+	if self.closed {
+		return errClosed
+	}
+	if len(self.buf) != 0 {
+		if err := self.submit(); err != nil {
+			return err
+		}
+	}
+	self.pending.Wait()
+	return self.Err()
+}
+
+// Tell returns the virtual file offset of the next byte to be written. Tell waits until all
+// submitted blocks have been written.
+func (self *Writer) Tell() int64 {
+	self.pending.Wait()
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return MakeOffset(self.off, len(self.buf))
+}
+
+// Close flushes any held data and writes the EOF marker block. It does not close the
+// underlying writer.
+func (self *Writer) Close() error {
+	if self.closed {
+		return self.Err()
+	}
+	err := self.Flush()
+	self.closed = true
+	if self.jobs != nil {
+		close(self.jobs)
+		close(self.order)
+		<-self.done
+	}
+	if err != nil {
+		return err
+	}
+	if err = self.emit(eofMarker); err != nil {
+		self.setErr(err)
+	}
+	return self.Err()
+}
@@ -0,0 +1,72 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// MaxBinPos is the exclusive upper bound on the positions described by the BAM binning scheme.
+const MaxBinPos = 1 << 29
+
+// binLevels holds the first bin number and the bin width, as a power of two, of each level of
+// the BAM binning scheme.
+var binLevels = [...]struct{ first, shift int }{
+	{0, 29},
+	{1, 26},
+	{9, 23},
+	{73, 20},
+	{585, 17},
+	{4681, 14},
+}
+
+// Reg2Bin returns the BAM bin of the smallest binning interval holding the zero-based
+// half-open interval [beg, end), as calculated by libbam's bam_reg2bin. This is the value
+// expected in the bin field of a record aligned to [beg, end). Unplaced records conventionally
+// hold Reg2Bin(-1, 0).
+func Reg2Bin(beg, end int) int {
+	return int(reg2bin(beg, end))
+}
+
+// Reg2Bins appends to dst the bins that may hold records overlapping the zero-based half-open
+// interval [beg, end), in the order used by libbam's index queries, and returns the extended
+// slice. No bins are appended if the interval is empty.
+func Reg2Bins(dst []int, beg, end int) []int {
+	if beg < 0 {
+		beg = 0
+	}
+	if end > MaxBinPos {
+		end = MaxBinPos
+	}
+	if beg >= end {
+		return dst
+	}
+	end--
+	for _, l := range binLevels {
+		for k := l.first + beg>>l.shift; k <= l.first+end>>l.shift; k++ {
+			dst = append(dst, k)
+		}
+	}
+	return dst
+}
+
+// BinInterval returns the zero-based half-open interval of positions covered by bin, and
+// whether bin is a valid bin number of the BAM binning scheme.
+func BinInterval(bin int) (beg, end int, ok bool) {
+	for i := len(binLevels) - 1; i >= 0; i-- {
+		l := binLevels[i]
+		if bin >= l.first {
+			k := bin - l.first
+			if k >= MaxBinPos>>l.shift {
+				return 0, 0, false
+			}
+			return k << l.shift, (k + 1) << l.shift, true
+		}
+	}
+	return 0, 0, false
+}
+
+// BinOverlaps returns whether the interval covered by bin overlaps the zero-based half-open
+// interval [beg, end), and so whether bin may hold records overlapping [beg, end).
+func BinOverlaps(bin, beg, end int) bool {
+	b, e, ok := BinInterval(bin)
+	return ok && b < end && beg < e
+}
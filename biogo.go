@@ -0,0 +1,78 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build biogo
+
+// The bíogo conversions depend on github.com/biogo/biogo and are only built
+// when the biogo build tag is provided.
+
+package boom
+
+import (
+	"github.com/biogo/biogo/alphabet"
+	"github.com/biogo/biogo/seq"
+	"github.com/biogo/biogo/seq/linear"
+)
+
+// LinearSeq returns the query sequence of r as a bíogo DNA sequence with the ID set to the read name.
+// The sequence is in the orientation stored in the record and the strand annotation is set to
+// seq.Minus for reverse strand alignments.
+func (self *Record) LinearSeq() *linear.Seq {
+	s := linear.NewSeq(self.Name(), alphabet.BytesToLetters(self.Seq()), alphabet.DNAredundant)
+	s.Strand = self.seqStrand()
+	return s
+}
+
+// QSeq returns the query sequence and qualities of r as a bíogo DNA sequence with the ID set to
+// the read name. The sequence is in the orientation stored in the record and the strand annotation
+// is set to seq.Minus for reverse strand alignments. Missing quality scores are returned as zero.
+func (self *Record) QSeq() *linear.QSeq {
+	sq, q := self.Seq(), self.Quality()
+	ql := make([]alphabet.QLetter, len(sq))
+	for i, b := range sq {
+		ql[i].L = alphabet.Letter(b)
+		if i < len(q) && q[i] != 0xff {
+			ql[i].Q = alphabet.Qphred(q[i])
+		}
+	}
+	s := linear.NewQSeq(self.Name(), ql, alphabet.DNAredundant, alphabet.Sanger)
+	s.Strand = self.seqStrand()
+	return s
+}
+
+func (self *Record) seqStrand() seq.Strand {
+	if self.Flags()&Reverse != 0 {
+		return seq.Minus
+	}
+	return seq.Plus
+}
+
+// RecordFromQSeq returns an unaligned Record holding the ID, sequence and qualities of s. A
+// minus strand sequence is reverse complemented so that the record holds the sequence in its
+// original orientation.
+func RecordFromQSeq(s *linear.QSeq) (*Record, error) {
+	if s.Strand == seq.Minus {
+		s = s.Clone().(*linear.QSeq)
+		s.RevComp()
+	}
+	r, err := NewRecord()
+	if err != nil {
+		return nil, err
+	}
+	r.setTid(-1)
+	r.setPos(-1)
+	r.setMtid(-1)
+	r.setMpos(-1)
+	r.setBin(reg2bin(-1, 0))
+	r.setFlag(Unmapped)
+
+	r.nameStr = s.ID
+	r.seqBytes = make([]byte, len(s.Seq))
+	r.qualScores = make([]byte, len(s.Seq))
+	for i, ql := range s.Seq {
+		r.seqBytes[i] = byte(ql.L)
+		r.qualScores[i] = byte(ql.Q)
+	}
+	return r, nil
+}
@@ -10,15 +10,121 @@ package boom
 /*
 #cgo CFLAGS: -g -O2 -fPIC -m64 -pthread
 #cgo LDFLAGS: -lz
+#include <fcntl.h>
+#include <unistd.h>
 #include "sam.h"
 #include "bam_endian.h"
+#include "faidx.h"
 void bam_init_header_hash(bam_header_t *header);
 void bam_destroy_header_hash(bam_header_t *header);
+bam_header_t *bam_header_dup(const bam_header_t *h0);
+uint16_t getBin(bam1_t *b)                  { return b->core.bin; }
+uint8_t getQual(bam1_t *b)                  { return b->core.qual; }
+uint8_t getLQname(bam1_t *b)                { return b->core.l_qname; }
+uint16_t getFlag(bam1_t *b)                 { return b->core.flag; }
+uint16_t getNCigar(bam1_t *b)               { return b->core.n_cigar; }
 void setBin(bam1_t *b, uint16_t bin)        { b->core.bin = bin; }
-void setQual(bam1_t *b, uint8_t flag)       { b->core.flag = flag; }
+void setQual(bam1_t *b, uint8_t qual)       { b->core.qual = qual; }
 void setLQname(bam1_t *b, uint8_t l_qname)  { b->core.l_qname = l_qname; }
 void setFlag(bam1_t *b, uint16_t flag)      { b->core.flag = flag; }
 void setNCigar(bam1_t *b, uint16_t n_cigar) { b->core.n_cigar = n_cigar; }
+int64_t samTell(samfile_t *fp)              { return bam_tell(fp->x.bam); }
+int64_t samSeek(samfile_t *fp, int64_t off) { return bam_seek(fp->x.bam, off, SEEK_SET); }
+int samFileno(samfile_t *fp)                { return fileno(fp->x.bam->file); }
+int64_t bgzfTell(BGZF *fp)                  { return bgzf_tell(fp); }
+// A batchHead precedes the variable length data of each record held in a batch buffer.
+typedef struct {
+	int64_t off; // Virtual file offset of the record.
+	bam1_core_t core;
+	int32_t l_aux, data_len;
+} batchHead;
+
+// samReadBatch reads up to n records from fp into buf, which holds cap bytes, storing each
+// as a batchHead followed by its data padded to a multiple of 8 bytes. Records are read into
+// b. If a record does not fit in buf it is left in b and *carry is set. The number of records
+// stored is returned, the value returned by the last call to samread is stored in *ret and the
+// virtual file offset of the record it read in *off.
+int samReadBatch(samfile_t *fp, bam1_t *b, uint8_t *buf, int cap, int n, int *carry, int *ret, int64_t *off) {
+	int i = 0, used = 0;
+	*carry = 0;
+	*ret = 0;
+	while (i < n) {
+		*off = fp->type & 1 ? bam_tell(fp->x.bam) : -1;
+		*ret = samread(fp, b);
+		if (*ret < 0) break;
+		int l = sizeof(batchHead) + ((b->data_len + 7) & ~7);
+		if (used + l > cap) {
+			*carry = 1;
+			break;
+		}
+		batchHead *h = (batchHead*)(buf + used);
+		h->off = *off;
+		h->core = b->core;
+		h->l_aux = b->l_aux;
+		h->data_len = b->data_len;
+		memcpy(buf + used + sizeof(batchHead), b->data, b->data_len);
+		used += l;
+		i++;
+	}
+	return i;
+}
+
+// samWriteBatch writes the n records stored in buf as described for samReadBatch to fp,
+// using b, which must not hold data, to refer to each record. It returns the number of
+// records written.
+int samWriteBatch(samfile_t *fp, bam1_t *b, uint8_t *buf, int n) {
+	int i, used = 0;
+	for (i = 0; i < n; i++) {
+		batchHead *h = (batchHead*)(buf + used);
+		b->core = h->core;
+		b->l_aux = h->l_aux;
+		b->data_len = b->m_data = h->data_len;
+		b->data = buf + used + sizeof(batchHead);
+		if (samwrite(fp, b) < 0) break;
+		used += sizeof(batchHead) + ((h->data_len + 7) & ~7);
+	}
+	b->data = 0;
+	b->data_len = b->m_data = 0;
+	return i;
+}
+
+uint32_t calEnd(bam1_t *b)                  { return bam_calend(&b->core, bam1_cigar(b)); }
+int32_t cigar2qlen(bam1_t *b)               { return bam_cigar2qlen(&b->core, bam1_cigar(b)); }
+int samReadAt(samfile_t *fp, bam1_t *b, int64_t *off) {
+	*off = fp->type & 1 ? bam_tell(fp->x.bam) : -1;
+	return samread(fp, b);
+}
+int samFerror(samfile_t *fp)                { return (fp->type & 1) && ferror(fp->x.bam->file); }
+const char *samBGZFError(samfile_t *fp)     { return fp->type & 1 ? fp->x.bam->error : 0; }
+
+int samAdvise(int fd, int64_t off, int64_t n, int seq) {
+	return posix_fadvise(fd, off, n, seq ? POSIX_FADV_SEQUENTIAL : POSIX_FADV_WILLNEED);
+}
+
+// samBufOpen opens a BAM file as samopen does, but sets the size of the stdio buffer
+// used by the BGZF stream before the header is read or written.
+samfile_t *samBufOpen(const char *fn, const char *mode, const bam_header_t *h, int buf) {
+	int rd = mode[0] == 'r';
+	int fd = rd ? open(fn, O_RDONLY) : open(fn, O_WRONLY|O_CREAT|O_TRUNC, 0666);
+	if (fd < 0) return 0;
+	samfile_t *fp = calloc(1, sizeof(samfile_t));
+	if (fp == 0 || (fp->x.bam = bam_dopen(fd, mode)) == 0) {
+		free(fp);
+		close(fd);
+		return 0;
+	}
+	fp->x.bam->owned_file = 1;
+	if (buf > 0) setvbuf(fp->x.bam->file, 0, _IOFBF, buf);
+	fp->type = 1; // TYPE_BAM in sam.c.
+	if (rd) {
+		fp->type |= 2; // TYPE_READ in sam.c.
+		fp->header = bam_header_read(fp->x.bam);
+	} else {
+		fp->header = bam_header_dup(h);
+		bam_header_write(fp->x.bam, fp->header);
+	}
+	return fp;
+}
 */
 import "C"
 
@@ -27,8 +133,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"reflect"
 	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"unsafe"
 )
 
@@ -37,6 +145,11 @@ var (
 	notBamFile       = fmt.Errorf("boom: not bam file")
 	couldNotAllocate = fmt.Errorf("boom: could not allocate")
 	cannotAddr       = fmt.Errorf("boom: cannot address value")
+	couldNotOpen     = fmt.Errorf("boom: could not open file")
+	writeFailed      = fmt.Errorf("boom: write failed")
+	badRegion        = fmt.Errorf("boom: invalid region")
+	badOffset        = fmt.Errorf("boom: invalid virtual offset")
+	readFailed       = fmt.Errorf("boom: read failed")
 	bamIsBigEndian   = C.bam_is_big_endian() == 1
 	endian           = [2]binary.ByteOrder{
 		binary.LittleEndian,
@@ -52,15 +165,52 @@ var (
 // The level of verbosity intrepreted by libbam ranges from 0 to 3 inclusive, with lower values
 // being less verbose. Passing values of v outside this range do not alter verbosity.
 func Verbosity(v int) int {
+	verbosityLock.Lock()
+	defer verbosityLock.Unlock()
 	if 0 <= v && v <= 3 {
 		C.bam_verbose = C.int(v)
 	}
 	return int(C.bam_verbose)
 }
 
+// verbosityLock protects bam_verbose. Calls into libbam for files using the process-wide
+// verbosity hold the read lock, and calls for files with their own verbosity hold the write
+// lock while bam_verbose is temporarily changed.
+var verbosityLock sync.RWMutex
+
+// lockVerbosity sets bam_verbose for a call into libbam with the verbosity level v, or
+// the process-wide level if v is negative, and returns the level to be passed to
+// unlockVerbosity when the call is complete.
+func lockVerbosity(v int) int {
+	if v < 0 {
+		verbosityLock.RLock()
+		return v
+	}
+	verbosityLock.Lock()
+	old := int(C.bam_verbose)
+	C.bam_verbose = C.int(v)
+	return old
+}
+
+// unlockVerbosity restores the process-wide bam_verbose level after a call made following
+// lockVerbosity with the level v. The restored level, old, is the value returned by
+// lockVerbosity.
+func unlockVerbosity(v, old int) {
+	if v < 0 {
+		verbosityLock.RUnlock()
+		return
+	}
+	C.bam_verbose = C.int(old)
+	verbosityLock.Unlock()
+}
+
 // A bamRecord wraps the bam1_t BAM record.
 type bamRecord struct {
 	b *C.bam1_t
+
+	// acct is the number of bytes accounted for the bam1_t,
+	// or -1 if the record is not tracked.
+	acct int64
 }
 
 // newBamRecord creates a new bamRecord wrapping b or a newly malloc'd bam1_t if b is nil,
@@ -68,6 +218,10 @@ type bamRecord struct {
 // newBamRecord should always be used unless the bamRecord will be explicitly memory managed, or
 // wraps a bam1_t that will be memory managed elsewhere.
 func newBamRecord(b *C.bam1_t) (br *bamRecord, err error) {
+	track, err := memReserve(int64(unsafe.Sizeof(C.bam1_t{})))
+	if err != nil {
+		return nil, err
+	}
 	if b == nil {
 		b = (*C.bam1_t)(unsafe.Pointer(C.malloc((C.size_t)(unsafe.Sizeof(C.bam1_t{})))))
 
@@ -77,12 +231,27 @@ func newBamRecord(b *C.bam1_t) (br *bamRecord, err error) {
 		*b = C.bam1_t{}
 	}
 
-	br = &bamRecord{b}
+	br = &bamRecord{b: b, acct: -1}
+	if track {
+		br.acct = 0
+		mem.numRecords.Add(1)
+		br.account()
+	}
 	runtime.SetFinalizer(br, (*bamRecord).bamRecordFree)
 
 	return
 }
 
+// account updates the tracked memory use for changes in the size of the bam1_t's data block.
+func (br *bamRecord) account() {
+	if br.acct < 0 {
+		return
+	}
+	n := int64(br.size())
+	mem.records.Add(n - br.acct)
+	br.acct = n
+}
+
 // The following methods are helpers to safely return bam1_t field values.
 // All first check that the pointer to the bam1_t is not nil and convert to the appropriate
 // Go type.
@@ -114,7 +283,7 @@ func (br *bamRecord) bin() uint16 {
 	if br.b == nil {
 		panic(valueIsNil)
 	}
-	return uint16(br.b.core.bin)
+	return uint16(C.getBin(br.b))
 }
 func (br *bamRecord) setBin(bin uint16) {
 	if br.b == nil {
@@ -126,7 +295,7 @@ func (br *bamRecord) qual() byte {
 	if br.b == nil {
 		panic(valueIsNil)
 	}
-	return byte(br.b.core.qual)
+	return byte(C.getQual(br.b))
 }
 func (br *bamRecord) setQual(qual byte) {
 	if br.b == nil {
@@ -138,7 +307,7 @@ func (br *bamRecord) lQname() byte {
 	if br.b == nil {
 		panic(valueIsNil)
 	}
-	return byte(br.b.core.l_qname)
+	return byte(C.getLQname(br.b))
 }
 func (br *bamRecord) setLQname(lQname byte) {
 	if br.b == nil {
@@ -150,7 +319,7 @@ func (br *bamRecord) flag() Flags {
 	if br.b == nil {
 		panic(valueIsNil)
 	}
-	return Flags(br.b.core.flag)
+	return Flags(C.getFlag(br.b))
 }
 func (br *bamRecord) setFlag(flags Flags) {
 	if br.b == nil {
@@ -162,7 +331,7 @@ func (br *bamRecord) nCigar() uint16 {
 	if br.b == nil {
 		panic(valueIsNil)
 	}
-	return uint16(br.b.core.n_cigar)
+	return uint16(C.getNCigar(br.b))
 }
 func (br *bamRecord) setNCigar(nCigar uint16) {
 	if br.b == nil {
@@ -188,11 +357,11 @@ func (br *bamRecord) mtid() int32 {
 	}
 	return int32(br.b.core.mtid)
 }
-func (br *bamRecord) setMtid() int32 {
+func (br *bamRecord) setMtid(mtid int32) {
 	if br.b == nil {
 		panic(valueIsNil)
 	}
-	return int32(br.b.core.mtid)
+	br.b.core.mtid = C.int32_t(mtid)
 }
 func (br *bamRecord) mpos() int32 {
 	if br.b == nil {
@@ -248,48 +417,152 @@ func (br *bamRecord) dataPtr() uintptr {
 	}
 	return uintptr(unsafe.Pointer(br.b.data))
 }
-func (br *bamRecord) dataUnsafe() []byte {
+
+// size returns the number of bytes of C memory held by the bam1_t.
+func (br *bamRecord) size() int {
 	if br.b == nil {
 		panic(valueIsNil)
 	}
+	return int(unsafe.Sizeof(*br.b)) + int(br.b.m_data)
+}
 
-	l := int(br.b.data_len)
-	var data []byte
-	sliceHeader := (*reflect.SliceHeader)(unsafe.Pointer(&data))
-	sliceHeader.Cap = l
-	sliceHeader.Len = l
-	sliceHeader.Data = uintptr(unsafe.Pointer(br.b.data))
+// dataView returns a byte slice sharing the bam1_t's variable length data block. The slice
+// refers to C memory and is valid only until the data block is reallocated by a subsequent
+// read into or modification of the bam1_t, or the bam1_t is freed. Callers must copy any data
+// that is retained and must keep br reachable while the view is in use.
+func (br *bamRecord) dataView() []byte {
+	if br.b == nil {
+		panic(valueIsNil)
+	}
+	if br.b.data == nil || br.b.data_len <= 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(br.b.data)), int(br.b.data_len))
+}
 
-	return data
+// data returns a copy of the bam1_t's variable length data block.
+func (br *bamRecord) data() []byte {
+	d := append([]byte(nil), br.dataView()...)
+	runtime.KeepAlive(br)
+	return d
 }
-func (br *bamRecord) setDataUnsafe(data []byte) {
+
+// setData copies data into the bam1_t's variable length data block, growing the C allocation
+// if necessary.
+func (br *bamRecord) setData(data []byte) {
 	if br.b == nil {
 		panic(valueIsNil)
 	}
 
 	l := len(data)
-	if br.dataCap() < len(data) {
-		if br.b.data == nil {
-			br.b.data = (*C.uint8_t)(unsafe.Pointer(C.malloc((C.size_t)(l))))
-		} else {
-
-			br.b.data = (*C.uint8_t)(unsafe.Pointer(C.realloc(unsafe.Pointer(br.b.data), (C.size_t)(l))))
-		}
-		if br.b.data == nil {
+	if br.dataCap() < l {
+		p := C.realloc(unsafe.Pointer(br.b.data), C.size_t(l))
+		if p == nil {
 			panic(couldNotAllocate)
 		}
+		br.b.data = (*C.uint8_t)(p)
+		br.b.m_data = C.int(l)
+	}
+	br.b.data_len = C.int(l)
+	copy(br.dataView(), data)
+	runtime.KeepAlive(br)
+	br.account()
+}
+
+// auxGet returns the offset in the variable length data block of the auxiliary field with the
+// tag t, found using bam_aux_get, or -1 if the field is not present.
+func (br *bamRecord) auxGet(t Tag) int {
+	if br.b == nil {
+		panic(valueIsNil)
+	}
+	p := C.bam_aux_get(br.b, (*C.char)(unsafe.Pointer(&t[0])))
+	if p == nil {
+		return -1
+	}
+	return int(uintptr(unsafe.Pointer(p))-uintptr(unsafe.Pointer(br.b.data))) - 2
+}
+
+// auxAppend appends an auxiliary field with the tag t, type typ and encoded value data to the
+// bam1_t's data block using bam_aux_append.
+func (br *bamRecord) auxAppend(t Tag, typ byte, data []byte) {
+	if br.b == nil {
+		panic(valueIsNil)
+	}
+	C.bam_aux_append(
+		br.b,
+		(*C.char)(unsafe.Pointer(&t[0])),
+		C.char(typ),
+		C.int(len(data)),
+		(*C.uint8_t)(unsafe.Pointer(&data[0])),
+	)
+	br.account()
+}
+
+// auxDel removes the first auxiliary field with the tag t from the bam1_t's data block using
+// bam_aux_del, and returns whether the field was present.
+func (br *bamRecord) auxDel(t Tag) bool {
+	if br.b == nil {
+		panic(valueIsNil)
+	}
+	p := C.bam_aux_get(br.b, (*C.char)(unsafe.Pointer(&t[0])))
+	if p == nil {
+		return false
+	}
+	C.bam_aux_del(br.b, p)
+	return true
+}
+
+// bamValidate returns whether the record passes bam_validate1, checking reference IDs against
+// h if it is not nil.
+func (br *bamRecord) bamValidate(h *bamHeader) bool {
+	if br.b == nil {
+		panic(valueIsNil)
+	}
+	var bh *C.bam_header_t
+	if h != nil {
+		bh = (*C.bam_header_t)(unsafe.Pointer(h.bh))
 	}
+	return C.bam_validate1(bh, br.b) != 0
+}
+
+// calEnd returns the rightmost reference position of the alignment computed by bam_calend.
+func (br *bamRecord) calEnd() int {
+	if br.b == nil {
+		panic(valueIsNil)
+	}
+	return int(C.calEnd(br.b))
+}
+
+// cigar2qlen returns the query length described by the CIGAR computed by bam_cigar2qlen.
+func (br *bamRecord) cigar2qlen() int {
+	if br.b == nil {
+		panic(valueIsNil)
+	}
+	return int(C.cigar2qlen(br.b))
+}
 
-	var newData []byte
-	sliceHeader := (*reflect.SliceHeader)(unsafe.Pointer(&newData))
-	sliceHeader.Cap = l
-	sliceHeader.Len = l
-	sliceHeader.Data = uintptr(unsafe.Pointer(br.b.data))
-	copy(newData, data)
+// cloneCore returns a new bamRecord holding a copy of the fixed-length fields of br, with no
+// variable length data.
+func (br *bamRecord) cloneCore() (*bamRecord, error) {
+	if br.b == nil {
+		return nil, valueIsNil
+	}
+	c, err := newBamRecord(nil)
+	if err != nil {
+		return nil, err
+	}
+	c.b.core = br.b.core
+	c.b.l_aux = br.b.l_aux
+	return c, nil
 }
 
 // bamRecordFree C.free()s the contained bam1_t and its data, first checking for nil pointers.
 func (br *bamRecord) bamRecordFree() {
+	if br.acct >= 0 {
+		mem.records.Add(-br.acct)
+		mem.numRecords.Add(-1)
+		br.acct = -1
+	}
 	if br.b != nil {
 		if br.b.data != nil {
 			C.free(unsafe.Pointer(br.b.data))
@@ -299,9 +572,76 @@ func (br *bamRecord) bamRecordFree() {
 	}
 }
 
+// reg2bin returns the BAM index bin for the zero-based half-open interval [beg, end).
+func reg2bin(beg, end int) uint16 {
+	return uint16(C.bam_reg2bin(C.uint32_t(beg), C.uint32_t(end)))
+}
+
 // A samFile wraps a samfile_t.
 type samFile struct {
 	fp *C.samfile_t
+
+	// verbose is the libbam verbosity level used for calls on the
+	// file, or -1 if the process-wide level is used.
+	verbose int
+
+	// rewrite is applied to the auxiliary fields of written
+	// records. Rewritten records are constructed in scratch.
+	rewrite TagRewriter
+	scratch *bamRecord
+
+	// hdrAcct is the number of bytes accounted for the header
+	// owned by the samfile_t.
+	hdrAcct int64
+
+	// opened describes where the file was opened if open
+	// files are being tracked.
+	opened *Leak
+	// order is the sort order enforced on written records and
+	// last holds the sort keys of the previous written record.
+	order SortOrder
+	last  *sortKey
+
+	// verify checks the integrity of BGZF blocks read from
+	// the file if it is not nil.
+	verify *blockVerifier
+
+	// ahead requests readahead of the file ahead of the read
+	// position if it is not nil.
+	ahead *readahead
+
+	// batch holds the buffers used for batched record I/O.
+	batch *recordBatch
+
+	// nrec is the number of records read since the file was
+	// opened or last positioned by a seek.
+	nrec int64
+
+	// off receives the file offset of the record being read.
+	// It is held here so that reads do not allocate.
+	off C.int64_t
+
+	// validate specifies that written records are validated.
+	validate bool
+
+	// alpha is the Alphabet given to records read from the file.
+	alpha *Alphabet
+
+	// refs holds the reference sequence names of the file's
+	// header once they have been given to a record.
+	refs []string
+}
+
+// setVerbosity sets the libbam verbosity level used for calls on the file. Negative values
+// select the process-wide level and values above 3 are treated as 3.
+func (sf *samFile) setVerbosity(v int) {
+	switch {
+	case v < 0:
+		v = -1
+	case v > 3:
+		v = 3
+	}
+	sf.verbose = v
 }
 
 // samOpen/samFdOpen open a SAM or BAM file with the given filename/fd, mode and optional auxilliary header.
@@ -354,8 +694,13 @@ func samOpen(filename, mode string, aux header) (sf *samFile, err error) {
 		(*C.char)(unsafe.Pointer(m)),
 		unsafe.Pointer(auxAddr),
 	)
-	sf = &samFile{fp: (*C.samfile_t)(unsafe.Pointer(fp))}
-	runtime.SetFinalizer(sf, (*samFile).samClose)
+	if fp == nil && err == nil {
+		err = couldNotOpen
+	}
+	sf = &samFile{fp: (*C.samfile_t)(unsafe.Pointer(fp)), verbose: -1}
+	sf.accountHeader()
+	sf.trackOpen(filename)
+	runtime.SetFinalizer(sf, (*samFile).finalize)
 
 	return
 }
@@ -388,12 +733,57 @@ func samFdOpen(fd uintptr, mode string, aux header) (sf *samFile, err error) {
 		(*C.char)(unsafe.Pointer(m)),
 		auxAddr,
 	)
-	sf = &samFile{fp: (*C.samfile_t)(unsafe.Pointer(fp))}
-	runtime.SetFinalizer(sf, (*samFile).samClose)
+	if fp == nil && err == nil {
+		err = couldNotOpen
+	}
+	sf = &samFile{fp: (*C.samfile_t)(unsafe.Pointer(fp)), verbose: -1}
+	sf.accountHeader()
+	sf.trackOpen(fmt.Sprintf("file descriptor %d", fd))
+	runtime.SetFinalizer(sf, (*samFile).finalize)
 
 	return
 }
 
+// samBufOpen opens the BAM file, filename, for reading if mode is "r", or for writing with
+// compression if mode is "w" or without if mode is "wu", using a stdio buffer of buf bytes.
+// If mode is not "r", h must be a valid bamHeader.
+func samBufOpen(filename, mode string, h *bamHeader, buf int) (sf *samFile, err error) {
+	fn, m := C.CString(filename), C.CString(mode)
+	defer C.free(unsafe.Pointer(fn))
+	defer C.free(unsafe.Pointer(m))
+
+	var bh *C.bam_header_t
+	if h != nil {
+		bh = (*C.bam_header_t)(unsafe.Pointer(h.bh))
+	}
+	fp, err := C.samBufOpen(fn, m, bh, C.int(buf))
+	if fp == nil {
+		if err == nil {
+			err = couldNotOpen
+		}
+		return nil, err
+	}
+	sf = &samFile{fp: (*C.samfile_t)(unsafe.Pointer(fp)), verbose: -1}
+	sf.accountHeader()
+	sf.trackOpen(filename)
+	runtime.SetFinalizer(sf, (*samFile).finalize)
+
+	return sf, nil
+}
+
+// fadvise advises the kernel that the n bytes of the file descriptor, fd, starting at off
+// will be needed soon, or that the whole file will be read sequentially if seq is true.
+func fadvise(fd int, off, n int64, seq bool) error {
+	var s C.int
+	if seq {
+		s = 1
+	}
+	if errno := C.samAdvise(C.int(fd), C.int64_t(off), C.int64_t(n), s); errno != 0 {
+		return syscall.Errno(errno)
+	}
+	return nil
+}
+
 type bamTypeFlags int
 
 const (
@@ -404,6 +794,16 @@ const (
 	strFlags bamTypeFlags = C.BAM_OFSTR << 2 // Flags are in hex format.
 )
 
+// accountHeader adds the memory held by the header owned by the file to the tracked memory
+// use if accounting is enabled.
+func (sf *samFile) accountHeader() {
+	if !mem.enabled.Load() || sf.fp == nil {
+		return
+	}
+	sf.hdrAcct = sf.header().size()
+	mem.headers.Add(sf.hdrAcct)
+}
+
 // fileType returns the type of file wrapped by the samFile struct.
 func (sf *samFile) fileType() bamTypeFlags {
 	if sf.fp != nil {
@@ -431,10 +831,15 @@ func (sf *samFile) samClose() error {
 		C.bam_destroy_header_hash(
 			(*C.bam_header_t)(unsafe.Pointer(h.bh)),
 		)
+		h.bh.hash = nil // Prevent a double free in bam_header_destroy.
 	}
 
+	old := lockVerbosity(sf.verbose)
 	C.samclose((*C.samfile_t)(unsafe.Pointer(sf.fp)))
+	unlockVerbosity(sf.verbose, old)
 	sf.fp = nil
+	mem.headers.Add(-sf.hdrAcct)
+	sf.hdrAcct = 0
 
 	return nil
 }
@@ -450,17 +855,36 @@ func (sf *samFile) samRead() (n int, br *bamRecord, err error) {
 	if err != nil {
 		return
 	}
+	n, err = sf.samReadInto(br)
+
+	return
+}
+
+// samReadInto reads the next record into br, reusing its bam1_t and data allocation.
+func (sf *samFile) samReadInto(br *bamRecord) (n int, err error) {
+	if sf.fp == nil || br.b == nil {
+		return 0, valueIsNil
+	}
 
-	cn, err := C.samread(
+	old := lockVerbosity(sf.verbose)
+	cn, errno := C.samReadAt(
 		(*C.samfile_t)(unsafe.Pointer(sf.fp)),
 		(*C.bam1_t)(unsafe.Pointer(br.b)),
+		&sf.off,
 	)
+	unlockVerbosity(sf.verbose, old)
 	n = int(cn)
+	br.account()
+	if err = sf.verifyBlocks(); err != nil {
+		return n, err
+	}
+	sf.readAhead()
 	if n < 0 {
-		err = io.EOF
+		return n, atPos(sf.readError(n, errno), sf.nrec, int64(sf.off))
 	}
+	sf.nrec++
 
-	return
+	return n, atPos(br.validate(), sf.nrec-1, int64(sf.off))
 }
 
 // samWrite writes a BAM record represented by br, returning the number of bytes written
@@ -470,15 +894,162 @@ func (sf *samFile) samWrite(br *bamRecord) (n int, err error) {
 		return 0, valueIsNil
 	}
 
+	old := lockVerbosity(sf.verbose)
+	defer unlockVerbosity(sf.verbose, old)
 	return int(C.samwrite(
 		(*C.samfile_t)(unsafe.Pointer(sf.fp)),
 		(*C.bam1_t)(unsafe.Pointer(br.b)),
 	)), nil
 }
 
+// ferror returns whether the stream underlying a BAM file has encountered an I/O error, and
+// the description of any error recorded by libbam's BGZF reader.
+func (sf *samFile) ferror() (failed bool, reason string) {
+	if sf.fp == nil {
+		return false, ""
+	}
+	fp := (*C.samfile_t)(unsafe.Pointer(sf.fp))
+	if e := C.samBGZFError(fp); e != nil {
+		reason = C.GoString(e)
+	}
+	return C.samFerror(fp) != 0, reason
+}
+
+// batchHeadLen is the length of the batchHead preceding each record in a batch buffer.
+const batchHeadLen = int(unsafe.Sizeof(C.batchHead{}))
+
+// samReadBatch reads up to n records into buf, as described for the C samReadBatch, using
+// scratch to hold each record as it is read. It returns the number of records stored, whether
+// a further record that did not fit in buf is held by scratch, the virtual file offset of the
+// last record read, and io.EOF or a *ReadError if the last read failed.
+func (sf *samFile) samReadBatch(buf []byte, n int, scratch *bamRecord) (c int, carry bool, last int64, err error) {
+	if sf.fp == nil || scratch.b == nil || len(buf) == 0 {
+		return 0, false, -1, valueIsNil
+	}
+
+	var (
+		cc, cr C.int
+		off    C.int64_t
+	)
+	old := lockVerbosity(sf.verbose)
+	cn, errno := C.samReadBatch(
+		(*C.samfile_t)(unsafe.Pointer(sf.fp)),
+		(*C.bam1_t)(unsafe.Pointer(scratch.b)),
+		(*C.uint8_t)(unsafe.Pointer(&buf[0])),
+		C.int(len(buf)),
+		C.int(n),
+		&cc,
+		&cr,
+		&off,
+	)
+	unlockVerbosity(sf.verbose, old)
+	scratch.account()
+	if cr < 0 {
+		err = atPos(sf.readError(int(cr), errno), sf.nrec+int64(cn), int64(off))
+	}
+
+	return int(cn), cc != 0, int64(off), err
+}
+
+// samWriteBatch writes the n records held in buf, as described for the C samReadBatch, using
+// ref, a bamRecord holding no data, to refer to each. It returns the number of records written.
+func (sf *samFile) samWriteBatch(buf []byte, n int, ref *bamRecord) (int, error) {
+	if sf.fp == nil || ref.b == nil {
+		return 0, valueIsNil
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	old := lockVerbosity(sf.verbose)
+	defer unlockVerbosity(sf.verbose, old)
+	return int(C.samWriteBatch(
+		(*C.samfile_t)(unsafe.Pointer(sf.fp)),
+		(*C.bam1_t)(unsafe.Pointer(ref.b)),
+		(*C.uint8_t)(unsafe.Pointer(&buf[0])),
+		C.int(n),
+	)), nil
+}
+
+// unbatch sets br to hold the record stored at off in a batch buffer, returning the offset of
+// the following record and the virtual file offset of the record.
+func (br *bamRecord) unbatch(buf []byte, off int) (next int, voff int64) {
+	h := (*C.batchHead)(unsafe.Pointer(&buf[off]))
+	voff = int64(h.off)
+	br.b.core = h.core
+	br.b.l_aux = C.int(h.l_aux)
+	l := int(h.data_len)
+	off += batchHeadLen
+	br.setData(buf[off : off+l])
+	return off + (l+7)&^7, voff
+}
+
+// batch appends the record held by br to a batch buffer.
+func (br *bamRecord) batch(buf []byte) []byte {
+	d := br.dataView()
+	defer runtime.KeepAlive(br)
+	off := len(buf)
+	l := batchHeadLen + (len(d)+7)&^7
+	if cap(buf)-off < l {
+		buf = append(buf[:cap(buf)], make([]byte, off+l-cap(buf))...)
+	}
+	buf = buf[:off+l]
+	h := (*C.batchHead)(unsafe.Pointer(&buf[off]))
+	h.off = -1
+	h.core = br.b.core
+	h.l_aux = C.int32_t(br.b.l_aux)
+	h.data_len = C.int32_t(len(d))
+	copy(buf[off+batchHeadLen:], d)
+	return buf
+}
+
+// bamTell returns the virtual file offset of the next record in a BAM file.
+func (sf *samFile) bamTell() (int64, error) {
+	if sf.fp == nil {
+		return 0, valueIsNil
+	}
+	if sf.fileType()&bamFile == 0 {
+		return 0, notBamFile
+	}
+	return int64(C.samTell((*C.samfile_t)(unsafe.Pointer(sf.fp)))), nil
+}
+
+// bamFileno returns the file descriptor underlying a BAM file opened for reading.
+func (sf *samFile) bamFileno() (int, error) {
+	if sf.fp == nil {
+		return -1, valueIsNil
+	}
+	if sf.fileType()&(bamFile|readFile) != bamFile|readFile {
+		return -1, notBamFile
+	}
+	return int(C.samFileno((*C.samfile_t)(unsafe.Pointer(sf.fp)))), nil
+}
+
+// bamSeek sets the position of a BAM file opened for reading to the virtual file offset, off,
+// which must have been returned by bamTell.
+func (sf *samFile) bamSeek(off int64) error {
+	if sf.fp == nil {
+		return valueIsNil
+	}
+	if sf.fileType()&(bamFile|readFile) != bamFile|readFile {
+		return notBamFile
+	}
+	if C.samSeek((*C.samfile_t)(unsafe.Pointer(sf.fp)), C.int64_t(off)) < 0 {
+		return badOffset
+	}
+	if sf.verify != nil {
+		sf.verify.next = off >> 16
+	}
+	sf.nrec = 0
+	return nil
+}
+
 // A bamIndex wraps a bam_index_t.
 type bamIndex struct {
 	idx *C.bam_index_t
+
+	// acct is the number of bytes accounted for the index.
+	acct int64
 }
 
 // bamIndexBuild builds a BAM index file, filename.bai, from a bam file, filename. It returns an
@@ -498,6 +1069,12 @@ func bamIndexBuild(filename string) (ret int, err error) {
 // The error should be checked as a non-nil bamIndex is returned independent of error conditions.
 // The bamIndex is created setting a finaliser that C.free()s the contained bam_index_t.
 func bamIndexLoad(filename string) (bi *bamIndex, err error) {
+	size := indexSize(filename)
+	track, err := memReserve(size)
+	if err != nil {
+		return nil, err
+	}
+
 	fn := C.CString(filename)
 	defer C.free(unsafe.Pointer(fn))
 
@@ -505,6 +1082,10 @@ func bamIndexLoad(filename string) (bi *bamIndex, err error) {
 		(*C.char)(unsafe.Pointer(fn)),
 	)
 	bi = &bamIndex{idx: (*C.bam_index_t)(unsafe.Pointer(ip))}
+	if track && ip != nil {
+		bi.acct = size
+		mem.indexes.Add(size)
+	}
 	runtime.SetFinalizer(bi, (*bamIndex).bamIndexDestroy)
 
 	return
@@ -519,6 +1100,8 @@ func (bi *bamIndex) bamIndexDestroy() (err error) {
 	C.bam_index_destroy(
 		(*C.bam_index_t)(unsafe.Pointer(bi.idx)),
 	)
+	mem.indexes.Add(-bi.acct)
+	bi.acct = 0
 
 	return
 }
@@ -540,16 +1123,37 @@ func (sf *samFile) bamFetch(bi *bamIndex, tid, beg, end int, fn bamFetchFn) (ret
 
 	fp := *(*C.bamFile)(unsafe.Pointer(&sf.fp.x))
 	iter := C.bam_iter_query(bi.idx, C.int(tid), C.int(beg), C.int(end))
-	var br *bamRecord
+	runtime.KeepAlive(bi)
+	var (
+		br   *bamRecord
+		nrec int64
+	)
 	for {
 		br, err = newBamRecord(nil)
 		if err != nil {
-			return
+			break
+		}
+		old := lockVerbosity(sf.verbose)
+		cr, errno := C.bam_iter_read(fp, iter, br.b)
+		unlockVerbosity(sf.verbose, old)
+		ret = int(cr)
+		br.account()
+		sf.readAhead()
+		err = sf.verifyBlocks()
+		if err != nil {
+			break
 		}
-		ret = int(C.bam_iter_read(fp, iter, br.b))
 		if ret < 0 {
+			if err = atPos(sf.readError(ret, errno), nrec, -1); err == io.EOF {
+				err = nil
+			}
+			break
+		}
+		err = atPos(br.validate(), nrec, -1)
+		if err != nil {
 			break
 		}
+		nrec++
 		if fn(br) {
 			break
 		}
@@ -559,6 +1163,92 @@ func (sf *samFile) bamFetch(bi *bamIndex, tid, beg, end int, fn bamFetchFn) (ret
 	return
 }
 
+// A bamIter wraps a bam_iter_t and the BAM file it iterates over.
+type bamIter struct {
+	sf   *samFile
+	fp   C.bamFile
+	iter C.bam_iter_t
+
+	// nrec is the number of records read by the iterator.
+	nrec int64
+}
+
+// bamIterQuery returns a bamIter over all BAM records within the interval [beg, end) of the
+// reference sequence identified by tid. The bamIter is created setting a finaliser that
+// destroys the contained bam_iter_t.
+func (sf *samFile) bamIterQuery(bi *bamIndex, tid, beg, end int) (it *bamIter, err error) {
+	if sf.fp == nil || bi.idx == nil {
+		return nil, valueIsNil
+	}
+
+	if sf.fileType()&bamFile == 0 {
+		return nil, notBamFile
+	}
+
+	it = &bamIter{
+		sf:   sf,
+		fp:   *(*C.bamFile)(unsafe.Pointer(&sf.fp.x)),
+		iter: C.bam_iter_query(bi.idx, C.int(tid), C.int(beg), C.int(end)),
+	}
+	runtime.SetFinalizer(it, (*bamIter).bamIterDestroy)
+	runtime.KeepAlive(bi)
+
+	return
+}
+
+// bamIterRead reads and returns the next BAM record from the iterator returning the number
+// of bytes read, a *bamRecord containing the record data and any error that occurred.
+func (it *bamIter) bamIterRead() (n int, br *bamRecord, err error) {
+	if it.iter == nil {
+		return 0, nil, valueIsNil
+	}
+
+	br, err = newBamRecord(nil)
+	if err != nil {
+		return
+	}
+	n, err = it.bamIterReadInto(br)
+
+	return
+}
+
+// bamIterReadInto reads the next record of the iterator into br, reusing its bam1_t and data
+// allocation.
+func (it *bamIter) bamIterReadInto(br *bamRecord) (n int, err error) {
+	if it.iter == nil || br.b == nil {
+		return 0, valueIsNil
+	}
+
+	old := lockVerbosity(it.sf.verbose)
+	cn, errno := C.bam_iter_read(it.fp, it.iter, br.b)
+	unlockVerbosity(it.sf.verbose, old)
+	n = int(cn)
+	br.account()
+	it.sf.readAhead()
+	if err = it.sf.verifyBlocks(); err != nil {
+		return n, err
+	}
+	if n < 0 {
+		return n, atPos(it.sf.readError(n, errno), it.nrec, -1)
+	}
+	it.nrec++
+
+	return n, atPos(br.validate(), it.nrec-1, -1)
+}
+
+// bamIterDestroy frees the contained bam_iter_t, first checking for nil pointers.
+func (it *bamIter) bamIterDestroy() error {
+	if it.iter == nil {
+		return valueIsNil
+	}
+	runtime.SetFinalizer(it, nil)
+
+	C.bam_iter_destroy(it.iter)
+	it.iter = nil
+
+	return nil
+}
+
 // A bamFetchCFn is called on each bam1_t found by bamFetchC and the unsafe.Pointer is passed as a
 // pointer to a store of user data. The integer return value is ignored internally by bam_fetch,
 // but is specified in the libbam headers.
@@ -584,6 +1274,7 @@ func (sf *samFile) bamFetchC(bi *bamIndex, tid, beg, end int, data unsafe.Pointe
 		data,
 		(*[0]byte)(unsafe.Pointer(&fn)),
 	)
+	runtime.KeepAlive(bi)
 
 	return int(r), nil
 }
@@ -596,6 +1287,11 @@ type header interface {
 // A bamHeader wraps a bam_header_t.
 type bamHeader struct {
 	bh *C.bam_header_t
+
+	// track indicates that the memory held by the bam_header_t
+	// is accounted, with acct bytes currently accounted.
+	track bool
+	acct  int64
 }
 
 // bamGetTid return the target id for for a reference sequence target matching the string, name.
@@ -618,6 +1314,33 @@ func (bh *bamHeader) bamGetTid(name string) int {
 	return int(tid)
 }
 
+// bamParseRegion parses the samtools region string, region, returning the target id and the
+// zero-based half-open interval described.
+func (bh *bamHeader) bamParseRegion(region string) (tid, beg, end int, err error) {
+	if bh.bh == nil {
+		panic(valueIsNil)
+	}
+	if !strings.Contains(region, ":") && bh.bamGetTid(region) < 0 {
+		// bam_parse_region does not check for missing names without an interval.
+		return -1, -1, -1, badRegion
+	}
+
+	r := C.CString(region)
+	defer C.free(unsafe.Pointer(r))
+
+	var cTid, cBeg, cEnd C.int
+	ret := C.bam_parse_region(
+		(*C.bam_header_t)(unsafe.Pointer(bh.bh)),
+		(*C.char)(unsafe.Pointer(r)),
+		&cTid, &cBeg, &cEnd,
+	)
+	if ret < 0 || cBeg > cEnd {
+		return -1, -1, -1, badRegion
+	}
+
+	return int(cTid), int(cBeg), int(cEnd), nil
+}
+
 // nTargets returns the number of reference sequence targets described in the BAM header.
 func (bh *bamHeader) nTargets() int32 {
 	if bh.bh != nil {
@@ -630,35 +1353,49 @@ func (bh *bamHeader) nTargets() int32 {
 // targets described in the BAM header.
 func (bh *bamHeader) targetNames() (n []string) {
 	if bh.bh != nil {
-		n = make([]string, bh.bh.n_targets)
 		l := int(bh.bh.n_targets)
-		var nPtrs []*C.char
-		sh := (*reflect.SliceHeader)(unsafe.Pointer(&nPtrs))
-		sh.Cap = l
-		sh.Len = l
-		sh.Data = uintptr(unsafe.Pointer(bh.bh.target_name))
-
-		for i, p := range nPtrs {
+		if l == 0 || bh.bh.target_name == nil {
+			return []string{}
+		}
+		n = make([]string, l)
+		for i, p := range unsafe.Slice(bh.bh.target_name, l) {
 			n[i] = C.GoString(p)
 		}
+		runtime.KeepAlive(bh)
 
 		return
 	}
 	panic(valueIsNil)
 }
 
+// targetLen returns the length of the reference sequence with ID tid.
+func (bh *bamHeader) targetLen(tid int) int {
+	if bh.bh == nil {
+		panic(valueIsNil)
+	}
+	if tid < 0 || tid >= int(bh.bh.n_targets) || bh.bh.target_len == nil {
+		return -1
+	}
+	l := int(unsafe.Slice(bh.bh.target_len, bh.bh.n_targets)[tid])
+	runtime.KeepAlive(bh)
+	return l
+}
+
 // targetLengths returns a slice of uint32 containing the lengths of the reference sequence
 // targets described in the BAM header.
 func (bh *bamHeader) targetLengths() []uint32 {
 	if bh.bh != nil {
 		l := int(bh.bh.n_targets)
-		var unsafeLengths []uint32
-		sh := (*reflect.SliceHeader)(unsafe.Pointer(&unsafeLengths))
-		sh.Cap = l
-		sh.Len = l
-		sh.Data = uintptr(unsafe.Pointer(bh.bh.target_len))
+		if l == 0 || bh.bh.target_len == nil {
+			return []uint32{}
+		}
+		n := make([]uint32, l)
+		for i, v := range unsafe.Slice(bh.bh.target_len, l) {
+			n[i] = uint32(v)
+		}
+		runtime.KeepAlive(bh)
 
-		return append([]uint32(nil), unsafeLengths...)
+		return n
 	}
 	panic(valueIsNil)
 }
@@ -671,6 +1408,245 @@ func (bh *bamHeader) text() (t string) {
 	panic(valueIsNil)
 }
 
+// newBamHeader creates a new bamHeader wrapping a newly allocated bam_header_t with the
+// given text, parsing any @SQ lines to populate the reference sequence targets, and setting
+// a finaliser that destroys the contained bam_header_t.
+func newBamHeader(text string) (bh *bamHeader, err error) {
+	track, err := memReserve(int64(len(text)))
+	if err != nil {
+		return nil, err
+	}
+	h := C.bam_header_init()
+	if h == nil {
+		return nil, couldNotAllocate
+	}
+	bh = &bamHeader{bh: h, track: track}
+	runtime.SetFinalizer(bh, (*bamHeader).bamHeaderDestroy)
+	bh.setText(text)
+	C.sam_header_parse(h)
+	C.bam_init_header_hash(h)
+	bh.account()
+
+	return
+}
+
+// dup returns a copy of the bam_header_t wrapped by bh, setting a finaliser that destroys
+// the copy.
+func (bh *bamHeader) dup() *bamHeader {
+	if bh.bh == nil {
+		panic(valueIsNil)
+	}
+	track := mem.enabled.Load()
+	d := &bamHeader{bh: C.bam_header_dup(bh.bh), track: track}
+	d.account()
+	runtime.SetFinalizer(d, (*bamHeader).bamHeaderDestroy)
+	return d
+}
+
+// size returns an estimate of the number of bytes held by the bam_header_t.
+func (bh *bamHeader) size() int64 {
+	if bh.bh == nil {
+		return 0
+	}
+	n := int64(unsafe.Sizeof(*bh.bh)) + int64(bh.bh.l_text)
+	l := int(bh.bh.n_targets)
+	if l != 0 && bh.bh.target_name != nil {
+		for _, p := range unsafe.Slice(bh.bh.target_name, l) {
+			n += int64(C.strlen(p)) + 1
+		}
+	}
+	n += int64(l) * int64(unsafe.Sizeof(uintptr(0))+4)
+	runtime.KeepAlive(bh)
+	return n
+}
+
+// account updates the tracked memory use for changes in the size of the bam_header_t.
+func (bh *bamHeader) account() {
+	if !bh.track {
+		return
+	}
+	n := bh.size()
+	mem.headers.Add(n - bh.acct)
+	bh.acct = n
+}
+
+// setText replaces the unparsed header text of bh with text. The reference sequence
+// targets are not altered.
+func (bh *bamHeader) setText(text string) {
+	if bh.bh == nil {
+		panic(valueIsNil)
+	}
+	C.free(unsafe.Pointer(bh.bh.text))
+	bh.bh.text = C.CString(text)
+	bh.bh.l_text = C.size_t(len(text))
+	bh.account()
+}
+
+// setTargets replaces the reference sequence targets of bh with the given names and lengths.
+// The unparsed header text is not altered.
+func (bh *bamHeader) setTargets(names []string, lens []uint32) {
+	if bh.bh == nil {
+		panic(valueIsNil)
+	}
+	h := bh.bh
+	if h.target_name != nil {
+		for _, p := range unsafe.Slice(h.target_name, h.n_targets) {
+			C.free(unsafe.Pointer(p))
+		}
+		C.free(unsafe.Pointer(h.target_name))
+		C.free(unsafe.Pointer(h.target_len))
+	}
+	C.bam_destroy_header_hash(h)
+	h.hash = nil
+	h.target_name, h.target_len = nil, nil
+	h.n_targets = C.int32_t(len(names))
+	if len(names) != 0 {
+		h.target_name = (**C.char)(C.calloc(C.size_t(len(names)), C.size_t(unsafe.Sizeof((*C.char)(nil)))))
+		h.target_len = (*C.uint32_t)(C.calloc(C.size_t(len(names)), 4))
+		tn, tl := unsafe.Slice(h.target_name, len(names)), unsafe.Slice(h.target_len, len(names))
+		for i, n := range names {
+			tn[i] = C.CString(n)
+			tl[i] = C.uint32_t(lens[i])
+		}
+	}
+	C.bam_init_header_hash(h)
+	bh.account()
+}
+
+// bamHeaderDestroy frees the contained bam_header_t and its data, first checking for nil pointers.
+func (bh *bamHeader) bamHeaderDestroy() {
+	if bh.track {
+		mem.headers.Add(-bh.acct)
+		bh.track, bh.acct = false, 0
+	}
+	if bh.bh != nil {
+		C.bam_header_destroy(bh.bh)
+		bh.bh = nil
+	}
+}
+
+// A faidx wraps a faidx_t FASTA index.
+type faidx struct {
+	fai *C.faidx_t
+}
+
+// faiLoad loads the FASTA index for the FASTA file, filename, building the index file,
+// filename.fai, if it does not exist. The faidx is created setting a finaliser that destroys
+// the contained faidx_t.
+func faiLoad(filename string) (fi *faidx, err error) {
+	fn := C.CString(filename)
+	defer C.free(unsafe.Pointer(fn))
+
+	fai := C.fai_load(fn)
+	if fai == nil {
+		return nil, couldNotOpen
+	}
+	fi = &faidx{fai: fai}
+	runtime.SetFinalizer(fi, (*faidx).faiDestroy)
+
+	return
+}
+
+// faiFetchSeq returns the sequence of the named reference between the zero-based positions
+// beg and end inclusive. Positions outside the sequence are clipped to the sequence bounds.
+func (fi *faidx) faiFetchSeq(name string, beg, end int) ([]byte, error) {
+	if fi.fai == nil {
+		panic(valueIsNil)
+	}
+	cn := C.CString(name)
+	defer C.free(unsafe.Pointer(cn))
+
+	var l C.int
+	s := C.faidx_fetch_seq(fi.fai, cn, C.int(beg), C.int(end), &l)
+	if s == nil {
+		return nil, badRegion
+	}
+	defer C.free(unsafe.Pointer(s))
+
+	return C.GoBytes(unsafe.Pointer(s), l), nil
+}
+
+// faiDestroy frees the contained faidx_t and its data, first checking for nil pointers.
+func (fi *faidx) faiDestroy() {
+	if fi.fai != nil {
+		C.fai_destroy(fi.fai)
+		fi.fai = nil
+	}
+}
+
+// A bgzfFile wraps a BGZF opened for reading.
+type bgzfFile struct {
+	fp *C.BGZF
+}
+
+// bgzfOpen opens the BGZF file, filename, for reading. The bgzfFile is created setting a
+// finaliser that closes the contained BGZF.
+func bgzfOpen(filename string) (bf *bgzfFile, err error) {
+	fn := C.CString(filename)
+	defer C.free(unsafe.Pointer(fn))
+	mode := C.CString("r")
+	defer C.free(unsafe.Pointer(mode))
+
+	fp := C.bgzf_open(fn, mode)
+	if fp == nil {
+		return nil, couldNotOpen
+	}
+	bf = &bgzfFile{fp: fp}
+	runtime.SetFinalizer(bf, (*bgzfFile).bgzfClose)
+
+	return
+}
+
+// bgzfRead reads up to len(p) uncompressed bytes into p. At the end of the file io.EOF is
+// returned.
+func (bf *bgzfFile) bgzfRead(p []byte) (n int, err error) {
+	if bf.fp == nil {
+		return 0, valueIsNil
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n = int(C.bgzf_read(bf.fp, unsafe.Pointer(&p[0]), C.int(len(p))))
+	switch {
+	case n < 0:
+		return 0, readFailed
+	case n == 0:
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// bgzfTell returns the virtual file offset of the next byte to be read.
+func (bf *bgzfFile) bgzfTell() (int64, error) {
+	if bf.fp == nil {
+		return 0, valueIsNil
+	}
+	return int64(C.bgzfTell(bf.fp)), nil
+}
+
+// bgzfSeek sets the position of the file to the virtual file offset, off.
+func (bf *bgzfFile) bgzfSeek(off int64) error {
+	if bf.fp == nil {
+		return valueIsNil
+	}
+	if C.bgzf_seek(bf.fp, C.int64_t(off), C.SEEK_SET) < 0 {
+		return badOffset
+	}
+	return nil
+}
+
+// bgzfClose closes the contained BGZF, first checking for nil pointers.
+func (bf *bgzfFile) bgzfClose() error {
+	if bf.fp == nil {
+		return valueIsNil
+	}
+	runtime.SetFinalizer(bf, nil)
+	C.bgzf_close(bf.fp)
+	bf.fp = nil
+
+	return nil
+}
+
 // header is a no-op function required to allow *bamHeader to satisfy the header interface.
 func (bh *bamHeader) header() {}
 
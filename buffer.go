@@ -0,0 +1,95 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// A BufferConfig specifies the buffering used when reading or writing a BAM file, allowing
+// I/O to be tuned for the storage holding the file. Zero values select the defaults.
+type BufferConfig struct {
+	// ReadBuffer is the size in bytes of the buffer used to
+	// read the compressed file. The default is the block size
+	// of the file system. Large buffers reduce the number of
+	// requests made to network file systems and object stores.
+	ReadBuffer int
+
+	// Readahead is the number of bytes ahead of the read
+	// position that the operating system is asked to prefetch.
+	// If Readahead is zero, the operating system's readahead
+	// policy is used. Large values benefit spinning disks and
+	// network file systems with high latency.
+	Readahead int
+
+	// WriteBuffer is the size in bytes of the buffer used to
+	// write the compressed file. The default is the block
+	// size of the file system.
+	WriteBuffer int
+}
+
+// OpenBAMBuffered opens the file, filename, as a BAM file using the buffering described by
+// cfg. If cfg is nil, OpenBAMBuffered is equivalent to OpenBAM.
+func OpenBAMBuffered(filename string, cfg *BufferConfig) (b *BAMFile, err error) {
+	if cfg == nil {
+		return OpenBAM(filename)
+	}
+	sf, err := samBufOpen(filename, "r", nil, cfg.ReadBuffer)
+	if err != nil {
+		return
+	}
+	if cfg.Readahead > 0 {
+		fd, _ := sf.bamFileno()
+		sf.ahead = &readahead{fd: fd, window: int64(cfg.Readahead)}
+		if err = fadvise(fd, 0, 0, true); err != nil {
+			sf.samClose()
+			return nil, err
+		}
+		sf.readAhead()
+	}
+	return &BAMFile{sf}, nil
+}
+
+// CreateBAMBuffered opens a file, filename for writing using the buffering described by cfg.
+// ref is required to point to a valid Header. If comp is true, compression is used. If cfg is
+// nil, CreateBAMBuffered is equivalent to CreateBAM.
+func CreateBAMBuffered(filename string, ref *Header, comp bool, cfg *BufferConfig) (b *BAMFile, err error) {
+	if cfg == nil {
+		return CreateBAM(filename, ref, comp)
+	}
+	if ref == nil {
+		return nil, noHeader
+	}
+	mode := "w"
+	if !comp {
+		mode = "wu"
+	}
+	sf, err := samBufOpen(filename, mode, ref.bamHeader, cfg.WriteBuffer)
+	if err != nil {
+		return
+	}
+	return &BAMFile{sf}, nil
+}
+
+// A readahead requests prefetching of a file ahead of its read position.
+type readahead struct {
+	fd     int
+	window int64
+	mark   int64 // File offset of the end of the last requested range.
+}
+
+// readAhead requests prefetching of the window following the current read position when the
+// position has advanced beyond half of the last requested window, or has moved back before it.
+func (sf *samFile) readAhead() {
+	ra := sf.ahead
+	if ra == nil {
+		return
+	}
+	off, err := sf.bamTell()
+	if err != nil {
+		return
+	}
+	cur := off >> 16
+	if cur < ra.mark-ra.window || cur >= ra.mark-ra.window/2 {
+		fadvise(ra.fd, cur, ra.window, false)
+		ra.mark = cur + ra.window
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// CalEnd returns the zero-based, exclusive end of the alignment on the reference as calculated
+// by libbam's bam_calend from the record's encoded CIGAR, without decoding the CIGAR. As in
+// libbam, only M, D and N operations consume the reference, so CalEnd matches the end positions
+// used by libbam's indexing and pileup, and differs from the reference length implied by the
+// SAM specification for CIGARs holding = or X operations.
+func (self *Record) CalEnd() int {
+	self.marshal()
+	return self.calEnd()
+}
+
+// CigarQueryLen returns the length of the query sequence described by the record's encoded
+// CIGAR as calculated by libbam's bam_cigar2qlen, without decoding the CIGAR. The length
+// includes soft clipped bases, and may be compared with Len to check the consistency of the
+// CIGAR with the sequence.
+func (self *Record) CigarQueryLen() int {
+	self.marshal()
+	return self.cigar2qlen()
+}
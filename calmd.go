@@ -0,0 +1,235 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// CalMDOptions specifies the behaviour of CalMD.
+type CalMDOptions struct {
+	// EqualBases specifies that read bases matching the
+	// reference are replaced with '='.
+	EqualBases bool
+}
+
+// CalMD reads the BAM file, in, and writes its records to the BAM file, out, with MD and NM
+// tags recomputed against the reference sequences in the indexed FASTA file, ref. Unmapped
+// records and records whose reference is not present in ref are written unaltered. If opts
+// is nil, bases are not replaced. Coordinate-sorted input avoids repeated loading of reference
+// sequences.
+func CalMD(in, out, ref string, opts *CalMDOptions) error {
+	var o CalMDOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	fa, err := OpenFasta(ref)
+	if err != nil {
+		return err
+	}
+	defer fa.Close()
+	f, err := OpenBAM(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bf, err := CreateBAM(out, f.Header(), true)
+	if err != nil {
+		return err
+	}
+
+	refs := newRefCache(fa, f.RefNames())
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			bf.Close()
+			return err
+		}
+		if r.Flags()&Unmapped == 0 {
+			if seq := refs.seqFor(r.RefID()); seq != nil {
+				err = FillMD(r, seq, o.EqualBases)
+				if err != nil {
+					bf.Close()
+					return err
+				}
+			}
+		}
+		n, err := bf.Write(r)
+		if err == nil && n < 0 {
+			err = writeFailed
+		}
+		if err != nil {
+			bf.Close()
+			return err
+		}
+	}
+
+	return bf.Close()
+}
+
+// FillMD sets the MD and NM tags of the mapped record r by comparing its aligned bases to ref,
+// the complete sequence of the reference r is aligned to. If equal is true, read bases matching
+// the reference are replaced with '='. Comparison stops at the end of ref. Existing MD and NM
+// tags are replaced in place. An error is returned if the tags cannot be constructed.
+func FillMD(r *Record, ref []byte, equal bool) error {
+	var (
+		md      []byte
+		nm, run int
+
+		seq     = r.Seq()
+		changed bool
+		x       = r.Start()
+		y       int
+	)
+cigar:
+	for _, co := range r.Cigar() {
+		l := co.Len()
+		switch co.Type() {
+		case CigarMatch, CigarEqual, CigarMismatch:
+			for j := 0; j < l; j++ {
+				if x+j >= len(ref) || y+j >= len(seq) {
+					break cigar
+				}
+				c1, c2 := upper(seq[y+j]), upper(ref[x+j])
+				if (c1 == c2 && c1 != 'N') || c1 == '=' {
+					if equal && c1 != '=' {
+						seq[y+j] = '='
+						changed = true
+					}
+					run++
+					continue
+				}
+				md = strconv.AppendInt(md, int64(run), 10)
+				md = append(md, c2)
+				run = 0
+				nm++
+			}
+			x += l
+			y += l
+		case CigarInsertion:
+			nm += l
+			y += l
+		case CigarSoftClipped:
+			y += l
+		case CigarDeletion:
+			md = strconv.AppendInt(md, int64(run), 10)
+			md = append(md, '^')
+			for j := 0; j < l && x+j < len(ref); j++ {
+				md = append(md, upper(ref[x+j]))
+			}
+			run = 0
+			nm += l
+			x += l
+		case CigarSkipped:
+			x += l
+		}
+	}
+	md = strconv.AppendInt(md, int64(run), 10)
+
+	if changed {
+		r.SetSeq(seq)
+	}
+	err := setTag(r, Tag{'M', 'D'}, string(md))
+	if err != nil {
+		return err
+	}
+	return setTag(r, Tag{'N', 'M'}, nm)
+}
+
+// upper returns the upper case of the ASCII letter c.
+func upper(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// setTag sets the tag t of r to v, replacing an existing tag in place or appending a new tag.
+// If v cannot be held by an aux tag, an error is returned and r is unaltered.
+func setTag(r *Record, t Tag, v interface{}) error {
+	a, err := NewAux(t, v)
+	if err != nil {
+		return err
+	}
+	aa := r.Tags()
+	for i, e := range aa {
+		if e.Tag() == t {
+			aa[i] = a
+			r.SetTags(aa)
+			return nil
+		}
+	}
+	r.SetTags(append(aa, a))
+	return nil
+}
+
+// ResolveBases replaces the '=' bases of the mapped record r with the reference bases they
+// are aligned to in ref, the complete sequence of the reference r is aligned to. It returns
+// whether all '=' bases were resolved.
+func ResolveBases(r *Record, ref []byte) bool {
+	seq := r.Seq()
+	if bytes.IndexByte(seq, '=') < 0 {
+		return true
+	}
+	var (
+		changed bool
+		x       = r.Start()
+		y       int
+	)
+	for _, co := range r.Cigar() {
+		l := co.Len()
+		switch co.Type() {
+		case CigarMatch, CigarEqual, CigarMismatch:
+			for j := 0; j < l && y+j < len(seq); j++ {
+				if seq[y+j] == '=' && x+j < len(ref) {
+					seq[y+j] = upper(ref[x+j])
+					changed = true
+				}
+			}
+			x += l
+			y += l
+		case CigarInsertion, CigarSoftClipped:
+			y += l
+		case CigarDeletion, CigarSkipped:
+			x += l
+		}
+	}
+	if changed {
+		r.SetSeq(seq)
+	}
+	return bytes.IndexByte(seq, '=') < 0
+}
+
+// A ResolveReader is a RecordReader that replaces '=' bases in the records of an
+// underlying RecordReader with reference bases read from a Fasta.
+type ResolveReader struct {
+	r    RecordReader
+	refs *refCache
+}
+
+// NewResolveReader returns a ResolveReader reading records from r, which are described by
+// the header h, and resolving '=' bases against fa. Records whose reference is not present
+// in fa are returned unaltered.
+func NewResolveReader(r RecordReader, h *Header, fa *Fasta) *ResolveReader {
+	return &ResolveReader{r: r, refs: newRefCache(fa, h.RefNames())}
+}
+
+// Read returns the next record with its '=' bases resolved.
+func (self *ResolveReader) Read() (r *Record, n int, err error) {
+	r, n, err = self.r.Read()
+	if err != nil || r.Flags()&Unmapped != 0 {
+		return
+	}
+	if seq := self.refs.seqFor(r.RefID()); seq != nil {
+		ResolveBases(r, seq)
+	}
+	return
+}
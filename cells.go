@@ -0,0 +1,300 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultCellBufferSize is the default number of bytes of record data held in memory by a
+// CellSplitter before buffered records are spilled to disk.
+const DefaultCellBufferSize = 64 << 20
+
+// A Whitelist is a set of accepted cell barcodes.
+type Whitelist map[string]bool
+
+// ReadWhitelist reads a whitelist holding one barcode per line from r. Empty lines are ignored.
+func ReadWhitelist(r io.Reader) (Whitelist, error) {
+	wl := make(Whitelist)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if bc := strings.TrimSpace(sc.Text()); bc != "" {
+			wl[bc] = true
+		}
+	}
+	return wl, sc.Err()
+}
+
+// Contains returns whether the barcode bc is in the whitelist. Barcodes with a "-N" suffix, as
+// added by some single-cell pipelines, are also accepted if the barcode without the suffix is
+// listed. A nil Whitelist contains all barcodes.
+func (self Whitelist) Contains(bc string) bool {
+	if self == nil || self[bc] {
+		return true
+	}
+	if i := strings.LastIndexByte(bc, '-'); i >= 0 {
+		return self[bc[:i]]
+	}
+	return false
+}
+
+// CellBarcode returns the cell barcode held in the string tag t of r and whether it was found.
+func CellBarcode(r *Record, t Tag) (string, bool) {
+	a, ok := r.Tag(t[:])
+	if !ok || a.Type() != 'Z' {
+		return "", false
+	}
+	bc := a.Value().(string)
+	return bc, bc != ""
+}
+
+// A CellSplitter is a RecordWriter that routes records to per-cell BAM files according to
+// their cell barcode tag. Records are buffered in memory and spilled to a single temporary
+// file when the buffer is full, and the per-cell BAM files are written one at a time when the
+// CellSplitter is closed, so the number of open files is bounded regardless of the number of
+// cells. Within each cell, records are written in the order they were received.
+type CellSplitter struct {
+	// Tag is the tag holding the cell barcode.
+	Tag Tag
+
+	// Whitelist specifies the accepted barcodes. If Whitelist is
+	// nil all barcodes are accepted.
+	Whitelist Whitelist
+
+	// BufferSize is the number of bytes of record data buffered
+	// before spilling to disk.
+	BufferSize int
+
+	NoBarcode int // Number of records without a cell barcode.
+	Rejected  int // Number of records with barcodes not in the whitelist.
+
+	h      *Header
+	prefix string
+
+	bufs     map[string][]byte
+	buffered int
+	spill    *os.File
+	spillLen int64
+	chunks   map[string][][2]int64
+	counts   map[string]int
+}
+
+// NewCellSplitter returns a CellSplitter writing records described by h to BAM files named by
+// the prefix followed by the cell barcode and ".bam", using the CB tag, the whitelist, wl, and
+// DefaultCellBufferSize. The header is copied, so it need not outlive the file it was obtained
+// from. Path separators in barcodes are replaced by underscores.
+func NewCellSplitter(h *Header, prefix string, wl Whitelist) *CellSplitter {
+	return &CellSplitter{
+		Tag:        Tag{'C', 'B'},
+		Whitelist:  wl,
+		BufferSize: DefaultCellBufferSize,
+		h:          &Header{h.dup()},
+		prefix:     prefix,
+		bufs:       make(map[string][]byte),
+		chunks:     make(map[string][][2]int64),
+		counts:     make(map[string]int),
+	}
+}
+
+// Write buffers r for writing to the file for its cell and returns the number of bytes
+// buffered. Records without a barcode, or with barcodes not in the whitelist, are counted
+// and discarded.
+func (self *CellSplitter) Write(r *Record) (n int, err error) {
+	bc, ok := CellBarcode(r, self.Tag)
+	if !ok {
+		self.NoBarcode++
+		return 0, nil
+	}
+	if !self.Whitelist.Contains(bc) {
+		self.Rejected++
+		return 0, nil
+	}
+	b := self.bufs[bc]
+	l := len(b)
+	b = appendRecord(b, r)
+	self.bufs[bc] = b
+	self.counts[bc]++
+	n = len(b) - l
+	self.buffered += n
+	if self.buffered >= self.BufferSize {
+		err = self.spillBuffers()
+	}
+	return n, err
+}
+
+// Cells returns the barcodes of the cells that have been written to, in sorted order.
+func (self *CellSplitter) Cells() []string {
+	cells := make([]string, 0, len(self.counts))
+	for bc := range self.counts {
+		cells = append(cells, bc)
+	}
+	sort.Strings(cells)
+	return cells
+}
+
+// Count returns the number of records written for the cell with the barcode bc.
+func (self *CellSplitter) Count(bc string) int { return self.counts[bc] }
+
+// Filename returns the name of the BAM file for the cell with the barcode bc.
+func (self *CellSplitter) Filename(bc string) string {
+	return self.prefix + strings.Map(func(r rune) rune {
+		if r == '/' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, bc) + ".bam"
+}
+
+// spillBuffers appends each cell's buffered records to the spill file.
+func (self *CellSplitter) spillBuffers() error {
+	if self.spill == nil {
+		f, err := os.CreateTemp("", "boom-cells-")
+		if err != nil {
+			return err
+		}
+		self.spill = f
+	}
+	w := bufio.NewWriter(self.spill)
+	for bc, b := range self.bufs {
+		if len(b) == 0 {
+			continue
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		self.chunks[bc] = append(self.chunks[bc], [2]int64{self.spillLen, int64(len(b))})
+		self.spillLen += int64(len(b))
+		self.bufs[bc] = b[:0]
+	}
+	self.buffered = 0
+	return w.Flush()
+}
+
+// Close writes the BAM file for each cell and removes any temporary data.
+func (self *CellSplitter) Close() error {
+	if self.spill != nil {
+		defer func() {
+			self.spill.Close()
+			os.Remove(self.spill.Name())
+		}()
+	}
+	r, err := NewRecord()
+	if err != nil {
+		return err
+	}
+	for _, bc := range self.Cells() {
+		bf, err := CreateBAM(self.Filename(bc), self.h, true)
+		if err != nil {
+			return err
+		}
+		write := func(b []byte) error {
+			for len(b) != 0 {
+				b = readRecord(r, b)
+				n, err := bf.Write(r)
+				if err == nil && n < 0 {
+					err = writeFailed
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, c := range self.chunks[bc] {
+			b := make([]byte, c[1])
+			_, err = self.spill.ReadAt(b, c[0])
+			if err == nil {
+				err = write(b)
+			}
+			if err != nil {
+				bf.Close()
+				return err
+			}
+		}
+		err = write(self.bufs[bc])
+		if err != nil {
+			bf.Close()
+			return err
+		}
+		delete(self.bufs, bc)
+		if err = bf.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordCoreLen is the length of the fixed part of a record encoded by appendRecord.
+const recordCoreLen = 40
+
+// appendRecord appends an encoding of r to b. The encoding holds the length of the data block,
+// the fixed length fields of the record and the data block in the byte order of the host.
+func appendRecord(b []byte, r *Record) []byte {
+	d, core := r.RecordData()
+	var c [recordCoreLen]byte
+	endian.PutUint32(c[0:], uint32(len(d)))
+	endian.PutUint32(c[4:], uint32(core.RefID))
+	endian.PutUint32(c[8:], uint32(core.Pos))
+	endian.PutUint16(c[12:], core.Bin)
+	c[14] = core.MapQ
+	c[15] = core.LQName
+	endian.PutUint16(c[16:], uint16(core.Flags))
+	endian.PutUint16(c[18:], core.NCigar)
+	endian.PutUint32(c[20:], uint32(core.LSeq))
+	endian.PutUint32(c[24:], uint32(core.NextRefID))
+	endian.PutUint32(c[28:], uint32(core.NextPos))
+	endian.PutUint32(c[32:], uint32(core.TLen))
+	endian.PutUint32(c[36:], uint32(core.LAux))
+	b = append(b, c[:]...)
+	return append(b, d...)
+}
+
+// readRecord decodes the first record encoded by appendRecord in b into r and returns the
+// remainder of b.
+func readRecord(r *Record, b []byte) []byte {
+	n := int(endian.Uint32(b[0:]))
+	r.setTid(int32(endian.Uint32(b[4:])))
+	r.setPos(int32(endian.Uint32(b[8:])))
+	r.setBin(endian.Uint16(b[12:]))
+	r.setQual(b[14])
+	r.setLQname(b[15])
+	r.setFlag(Flags(endian.Uint16(b[16:])))
+	r.setNCigar(endian.Uint16(b[18:]))
+	r.setLQseq(int32(endian.Uint32(b[20:])))
+	r.setMtid(int32(endian.Uint32(b[24:])))
+	r.setMpos(int32(endian.Uint32(b[28:])))
+	r.setIsize(int32(endian.Uint32(b[32:])))
+	r.setLAux(int32(endian.Uint32(b[36:])))
+	r.setData(b[recordCoreLen : recordCoreLen+n])
+	r.marshalled = true
+	r.decoded = 0
+	return b[recordCoreLen+n:]
+}
+
+// AggregateCells reads the remaining records from r and combines the records of each cell,
+// identified by the barcode held in the string tag t, using add. Records without a barcode or
+// with barcodes not in the whitelist, wl, are ignored; if wl is nil all barcodes are accepted.
+// The returned map holds the final aggregate for each cell, starting from the zero value of T.
+// For numbers of cells too large to hold in memory, use an Aggregator with a Merge function.
+func AggregateCells[T any](r RecordReader, t Tag, wl Whitelist, add func(acc T, r *Record) T) (map[string]T, error) {
+	agg := Aggregator[T]{
+		Key: func(r *Record) (string, bool) {
+			bc, ok := CellBarcode(r, t)
+			return bc, ok && wl.Contains(bc)
+		},
+		Add: add,
+	}
+	if err := agg.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	if agg.accs == nil {
+		return make(map[string]T), nil
+	}
+	return agg.accs, nil
+}
@@ -0,0 +1,266 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/boom/bgzf"
+)
+
+// CheckSampleInterval is the interval between records validated by Check.
+const CheckSampleInterval = 100
+
+// maxCheckErrors is the maximum number of record validation errors retained by Check.
+const maxCheckErrors = 10
+
+var (
+	noEOFMarker = errors.New("boom: missing BGZF EOF marker")
+	noIndex     = errors.New("boom: no index file")
+)
+
+// A CheckReport describes the result of checking a BAM file with Check.
+type CheckReport struct {
+	// EOF is nil if the file ends with a BGZF EOF marker block.
+	EOF error
+
+	// Header holds the problems found in the header.
+	Header []error
+
+	// Records is the number of records read and Sampled is
+	// the number of those records that were validated.
+	// Invalid holds up to the first ten validation errors and
+	// InvalidCount holds the total number.
+	Records      int64
+	Sampled      int64
+	Invalid      []error
+	InvalidCount int64
+
+	// Order describes the first record found out of the sort
+	// order declared by the header, or is nil if the records
+	// are in order or no order is declared.
+	Order error
+
+	// Read is the error that terminated reading records, or
+	// nil if all records were read.
+	Read error
+
+	// Index is nil if the file's BAM index is consistent with
+	// the file, and otherwise describes the inconsistency. If
+	// no index was found, HasIndex is false and Index reports
+	// the missing index.
+	Index    error
+	HasIndex bool
+}
+
+// OK returns whether no problems were found. A missing index is not considered a problem.
+func (self *CheckReport) OK() bool {
+	return self.Err() == nil
+}
+
+// Err returns the first problem found, or nil if no problems were found.
+func (self *CheckReport) Err() error {
+	switch {
+	case self.Read != nil:
+		return self.Read
+	case self.EOF != nil:
+		return self.EOF
+	case len(self.Header) != 0:
+		return self.Header[0]
+	case len(self.Invalid) != 0:
+		return self.Invalid[0]
+	case self.Order != nil:
+		return self.Order
+	case self.HasIndex && self.Index != nil:
+		return self.Index
+	}
+	return nil
+}
+
+// Check checks the BAM file, filename, reporting whether it ends with an EOF marker, whether
+// its header is valid, whether its BGZF blocks pass their integrity checks, whether a sample of one in CheckSampleInterval of its records, starting
+// with the first, are valid, whether its records are in the sort order declared by its header,
+// and whether its index, if present, is consistent with it. An error is returned only if the
+// file cannot be opened; problems with its content are described by the returned report.
+func Check(filename string) (*CheckReport, error) {
+	var rep CheckReport
+
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fd.Stat()
+	if err == nil {
+		var ok bool
+		ok, err = bgzf.HasEOF(fd, fi.Size())
+		if err == nil && !ok {
+			err = noEOFMarker
+		}
+	}
+	rep.EOF = err
+	fd.Close()
+
+	f, err := OpenBAM(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err = f.SetIntegrityCheck(true); err != nil {
+		return nil, err
+	}
+	h := f.Header()
+	rep.Header = h.problems()
+	rep.Read, rep.Order = rep.records(f, h)
+
+	if _, err := os.Stat(baiFilename(filename)); err != nil {
+		rep.Index = noIndex
+	} else {
+		rep.HasIndex = true
+		rep.Index = CheckIndex(filename)
+	}
+
+	return &rep, nil
+}
+
+// records reads the records of f, validating a sample and checking their order against that
+// declared by h. It returns any read error and the first ordering error.
+func (self *CheckReport) records(f *BAMFile, h *Header) (readErr, orderErr error) {
+	so := h.SortOrder()
+	var recs [2]*Record
+	for i := range recs {
+		var err error
+		recs[i], err = NewRecord()
+		if err != nil {
+			return err, nil
+		}
+	}
+	for ; ; self.Records++ {
+		r, prev := recs[self.Records%2], recs[(self.Records+1)%2]
+		_, err := f.ReadInto(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil, orderErr
+			}
+			return err, orderErr
+		}
+		if self.Records%CheckSampleInterval == 0 {
+			self.Sampled++
+			if err := r.Validate(h); err != nil {
+				self.InvalidCount++
+				if len(self.Invalid) < maxCheckErrors {
+					self.Invalid = append(self.Invalid, fmt.Errorf("boom: record %d: %w", self.Records, err))
+				}
+			}
+		}
+		if orderErr != nil || self.Records == 0 {
+			continue
+		}
+		var c int
+		switch so {
+		case Coordinate:
+			c = CompareCoordinate(prev, r)
+		case QueryName:
+			c = strnumCmp(prev.Name(), r.Name())
+		}
+		if c > 0 {
+			orderErr = fmt.Errorf("boom: record %d (%s) out of %v order", self.Records, r.Name(), so)
+		}
+	}
+}
+
+// Validate checks the header text, returning an error describing the first problem found.
+// Each line must be a tab-delimited record type and TAG:VALUE fields, any @HD line must be
+// the first line and hold a VN field, each @SQ line must have a unique SN field and an LN
+// field and together they must agree with the reference sequences of the header, and @RG
+// and @PG lines must have unique ID fields.
+func (self *Header) Validate() error {
+	if p := self.problems(); len(p) != 0 {
+		return p[0]
+	}
+	return nil
+}
+
+// problems returns the problems found in the header by Validate.
+func (self *Header) problems() []error {
+	var errs []error
+	fail := func(line int, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("boom: header line %d: %s", line+1, fmt.Sprintf(format, args...)))
+	}
+
+	names, lens := self.RefNames(), self.RefLengths()
+	ids := map[string]map[string]bool{"SQ": {}, "RG": {}, "PG": {}}
+	var nsq int
+	for i, line := range strings.Split(strings.TrimRight(self.Text(), "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			fail(i, "empty line")
+			continue
+		}
+		f := strings.Split(line, "\t")
+		if len(f[0]) != 3 || f[0][0] != '@' {
+			fail(i, "invalid record type %q", f[0])
+			continue
+		}
+		typ := f[0][1:]
+		if typ == "CO" {
+			continue
+		}
+		fields := make(map[string]string)
+		for _, fv := range f[1:] {
+			if len(fv) < 3 || fv[2] != ':' {
+				fail(i, "invalid field %q in @%s line", fv, typ)
+				continue
+			}
+			fields[fv[:2]] = fv[3:]
+		}
+
+		switch typ {
+		case "HD":
+			if i != 0 {
+				fail(i, "@HD line is not the first line")
+			}
+			if _, ok := fields["VN"]; !ok {
+				fail(i, "@HD line has no VN field")
+			}
+		case "SQ":
+			sn, ok := fields["SN"]
+			if !ok {
+				fail(i, "@SQ line has no SN field")
+				break
+			}
+			if ids[typ][sn] {
+				fail(i, "duplicate @SQ SN %q", sn)
+			}
+			ids[typ][sn] = true
+			ln, err := strconv.ParseUint(fields["LN"], 10, 32)
+			if err != nil {
+				fail(i, "@SQ line for %q has invalid LN field", sn)
+			}
+			if nsq < len(names) && (names[nsq] != sn || (err == nil && uint64(lens[nsq]) != ln)) {
+				fail(i, "@SQ line for %q does not match reference %d (%s, length %d)", sn, nsq, names[nsq], lens[nsq])
+			}
+			nsq++
+		case "RG", "PG":
+			id, ok := fields["ID"]
+			if !ok {
+				fail(i, "@%s line has no ID field", typ)
+				break
+			}
+			if ids[typ][id] {
+				fail(i, "duplicate @%s ID %q", typ, id)
+			}
+			ids[typ][id] = true
+		}
+	}
+	if nsq != 0 && nsq != len(names) {
+		errs = append(errs, fmt.Errorf("boom: header has %d @SQ lines for %d references", nsq, len(names)))
+	}
+	return errs
+}
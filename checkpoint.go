@@ -0,0 +1,131 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+var (
+	badCheckpoint = errors.New("boom: invalid checkpoint")
+	notResumable  = errors.New("boom: reader does not support virtual offsets")
+)
+
+// A VirtualSeeker is a RecordReader that can report and restore its position as a virtual file
+// offset. BAMFile satisfies VirtualSeeker.
+type VirtualSeeker interface {
+	RecordReader
+	Tell() (int64, error)
+	SeekVirtual(off int64) error
+}
+
+// A Checkpoint records the state of a scan so that it can be resumed after a restart. Offset is
+// the virtual file offset of the next record to be read from the input and Records holds the
+// records that had been read but were still buffered by the reader, in file order.
+type Checkpoint struct {
+	Offset  int64
+	Records []*Record
+}
+
+var checkpointMagic = [4]byte{'B', 'M', 'C', 1}
+
+// WriteTo writes an encoding of the Checkpoint to w. It returns the number of bytes written
+// and any error that occurred.
+func (self *Checkpoint) WriteTo(w io.Writer) (int64, error) {
+	b := make([]byte, 16, 16+len(self.Records)*(recordCoreLen+128))
+	copy(b, checkpointMagic[:])
+	endian.PutUint64(b[4:], uint64(self.Offset))
+	endian.PutUint32(b[12:], uint32(len(self.Records)))
+	for _, r := range self.Records {
+		b = appendRecord(b, r)
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// ReadCheckpoint reads a Checkpoint written by Checkpoint.WriteTo from r.
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 16 || [4]byte(b[:4]) != checkpointMagic {
+		return nil, badCheckpoint
+	}
+	c := &Checkpoint{Offset: int64(endian.Uint64(b[4:]))}
+	n := int(endian.Uint32(b[12:]))
+	b = b[16:]
+	c.Records = make([]*Record, 0, n)
+	for i := 0; i < n; i++ {
+		if len(b) < recordCoreLen || len(b) < recordCoreLen+int(endian.Uint32(b)) {
+			return nil, badCheckpoint
+		}
+		rec, err := NewRecord()
+		if err != nil {
+			return nil, err
+		}
+		b = readRecord(rec, b)
+		c.Records = append(c.Records, rec)
+	}
+	if len(b) != 0 {
+		return nil, badCheckpoint
+	}
+	return c, nil
+}
+
+// SaveCheckpoint returns a Checkpoint holding the position of the PairReader's input and the
+// records it is holding, including those of Pairs not yet returned by Read. The input must
+// be a VirtualSeeker.
+func (self *PairReader) SaveCheckpoint() (*Checkpoint, error) {
+	vs, ok := self.r.(VirtualSeeker)
+	if !ok {
+		return nil, notResumable
+	}
+	off, err := vs.Tell()
+	if err != nil {
+		return nil, err
+	}
+	var recs []*Record
+	for _, p := range self.out {
+		for _, r := range [2]*Record{p.Read1, p.Read2} {
+			if r != nil {
+				recs = append(recs, r)
+			}
+		}
+	}
+	for _, p := range self.byName {
+		recs = append(recs, p.r)
+	}
+	sort.SliceStable(recs, func(i, j int) bool {
+		a, b := recs[i], recs[j]
+		if a.RefID() != b.RefID() {
+			return uint(a.RefID()) < uint(b.RefID())
+		}
+		return a.Start() < b.Start()
+	})
+	return &Checkpoint{Offset: off, Records: recs}, nil
+}
+
+// ResumeFrom restores the PairReader to the state saved in c, discarding its current state.
+// The input is positioned at c.Offset and the records held in c are returned to the
+// PairReader's buffers, so that subsequent calls to Read return the Pairs that would have
+// been returned after the checkpoint was taken. The input must be a VirtualSeeker.
+func (self *PairReader) ResumeFrom(c *Checkpoint) error {
+	vs, ok := self.r.(VirtualSeeker)
+	if !ok {
+		return notResumable
+	}
+	err := vs.SeekVirtual(c.Offset)
+	if err != nil {
+		return err
+	}
+	*self = *NewPairReader(self.r, self.maxDist)
+	for _, r := range c.Records {
+		self.add(r)
+	}
+	return nil
+}
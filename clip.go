@@ -0,0 +1,182 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// clipFront returns cigar with the aligned bases covering the first n reference positions of
+// the alignment converted to a leading soft clip, along with the number of reference positions
+// removed and the number of query bases newly clipped. Insertions and deletions adjacent to the
+// new alignment start are removed. If no aligned bases would remain, ok is false.
+func clipFront(cigar []CigarOp, n int) (out []CigarOp, ref, query int, ok bool) {
+	var (
+		hard, soft int
+		i          int
+	)
+	for ; i < len(cigar) && cigar[i].Type() == CigarHardClipped; i++ {
+		hard += cigar[i].Len()
+	}
+	for ; i < len(cigar) && cigar[i].Type() == CigarSoftClipped; i++ {
+		soft += cigar[i].Len()
+	}
+
+	var rest []CigarOp
+loop:
+	for ; i < len(cigar); i++ {
+		co := cigar[i]
+		l := co.Len()
+		switch t := co.Type(); t {
+		case CigarMatch, CigarEqual, CigarMismatch:
+			if n == 0 {
+				rest = cigar[i:]
+				break loop
+			}
+			k := l
+			if n < k {
+				k = n
+			}
+			soft += k
+			query += k
+			ref += k
+			n -= k
+			if k < l {
+				rest = append([]CigarOp{NewCigarOp(t, l-k)}, cigar[i+1:]...)
+				break loop
+			}
+		case CigarInsertion:
+			soft += l
+			query += l
+		case CigarDeletion, CigarSkipped:
+			ref += l
+			if n -= l; n < 0 {
+				n = 0
+			}
+		case CigarSoftClipped, CigarHardClipped:
+			return cigar, 0, 0, false
+		}
+	}
+	if len(rest) == 0 {
+		return cigar, 0, 0, false
+	}
+
+	out = make([]CigarOp, 0, len(rest)+2)
+	if hard != 0 {
+		out = append(out, NewCigarOp(CigarHardClipped, hard))
+	}
+	if soft != 0 {
+		out = append(out, NewCigarOp(CigarSoftClipped, soft))
+	}
+	return append(out, rest...), ref, query, true
+}
+
+// reverseCigar returns a reversed copy of cigar.
+func reverseCigar(cigar []CigarOp) []CigarOp {
+	rev := make([]CigarOp, len(cigar))
+	for i, co := range cigar {
+		rev[len(cigar)-1-i] = co
+	}
+	return rev
+}
+
+// clipStart soft clips, or hard clips if hard is true, the alignment of r so that it starts at
+// or after the reference position pos, returning the number of query bases clipped and whether
+// any aligned bases remain. Hard clipping converts all leading soft clipping to hard clipping.
+// The record is not altered if no aligned bases would remain.
+func (self *Record) clipStart(pos int, hard bool) (int, bool) {
+	if pos <= self.Start() {
+		return 0, true
+	}
+	cigar, ref, query, ok := clipFront(self.Cigar(), pos-self.Start())
+	if !ok {
+		return 0, false
+	}
+	if hard {
+		cigar = self.hardenFront(cigar)
+	}
+	self.setCigar(cigar)
+	self.setPos(int32(self.Start() + ref))
+	self.setBin(reg2bin(self.Start(), self.Start()+refLen(cigar)))
+	return query, true
+}
+
+// clipEnd soft clips, or hard clips if hard is true, the alignment of r so that it ends at or
+// before the reference position end, returning the number of query bases clipped and whether
+// any aligned bases remain. Hard clipping converts all trailing soft clipping to hard clipping.
+// The record is not altered if no aligned bases would remain.
+func (self *Record) clipEnd(end int, hard bool) (int, bool) {
+	cur := self.Start() + refLen(self.Cigar())
+	if end >= cur {
+		return 0, true
+	}
+	cigar, _, query, ok := clipFront(reverseCigar(self.Cigar()), cur-end)
+	if !ok {
+		return 0, false
+	}
+	if hard {
+		// Reverse the sequence and qualities around the hardening so
+		// that the leading clip of the reversed alignment is removed.
+		seq, qual := self.Seq(), self.Quality()
+		n := leadingSoft(cigar)
+		self.setSeqQual(seq[:len(seq)-n], qual[:len(qual)-n])
+		cigar = hardenLeading(cigar)
+	}
+	cigar = reverseCigar(cigar)
+	self.setCigar(cigar)
+	self.setBin(reg2bin(self.Start(), self.Start()+refLen(cigar)))
+	return query, true
+}
+
+// hardenFront removes the query bases of the leading soft clip of cigar from r and returns
+// cigar with the soft clip converted to a hard clip.
+func (self *Record) hardenFront(cigar []CigarOp) []CigarOp {
+	n := leadingSoft(cigar)
+	seq, qual := self.Seq(), self.Quality()
+	self.setSeqQual(seq[n:], qual[n:])
+	return hardenLeading(cigar)
+}
+
+// leadingSoft returns the length of the soft clip following any hard clip at the start of cigar.
+func leadingSoft(cigar []CigarOp) int {
+	for _, co := range cigar {
+		switch co.Type() {
+		case CigarHardClipped:
+			continue
+		case CigarSoftClipped:
+			return co.Len()
+		}
+		break
+	}
+	return 0
+}
+
+// hardenLeading returns cigar with its leading soft clip merged into its leading hard clip.
+func hardenLeading(cigar []CigarOp) []CigarOp {
+	var hard, i int
+	for ; i < len(cigar); i++ {
+		switch cigar[i].Type() {
+		case CigarHardClipped, CigarSoftClipped:
+			hard += cigar[i].Len()
+			continue
+		}
+		break
+	}
+	if hard == 0 {
+		return cigar
+	}
+	return append([]CigarOp{NewCigarOp(CigarHardClipped, hard)}, cigar[i:]...)
+}
+
+// setCigar sets the CIGAR of r to cigar.
+func (self *Record) setCigar(cigar []CigarOp) {
+	self.unmarshalData()
+	self.cigar = cigar
+	self.marshalled = false
+}
+
+// setSeqQual sets the sequence and qualities of r without copying.
+func (self *Record) setSeqQual(seq, qual []byte) {
+	self.unmarshalData()
+	self.seqBytes = seq
+	self.qualScores = qual
+	self.marshalled = false
+}
@@ -0,0 +1,369 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// boom is a command line tool for manipulating SAM and BAM files using the boom library.
+//
+// Usage:
+//
+//	boom view [options] <in.bam>|<in.sam> [region ...]
+//	boom sort [options] -o <out.bam> <in.bam>
+//	boom index <in.bam>
+//	boom merge [options] <out.bam> <in.bam> ...
+//	boom flagstat <in.bam>|<in.sam>
+//	boom depth [options] <in.bam>
+//
+// Run a command with -h for its options.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/biogo/boom"
+)
+
+// A command is a boom subcommand.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+// commands is populated by init to avoid an initialization cycle
+// through the command functions' use of flags.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"view", "view [options] <in.bam>|<in.sam> [region ...]", view},
+		{"sort", "sort [options] -o <out.bam> <in.bam>", sortCmd},
+		{"index", "index <in.bam>", index},
+		{"merge", "merge [options] <out.bam> <in.bam> ...", merge},
+		{"flagstat", "flagstat <in.bam>|<in.sam>", flagstat},
+		{"depth", "depth [options] <in.bam>", depth},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			boom.Verbosity(0)
+			err := c.run(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "boom %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\tboom %s\n", c.usage)
+	}
+	os.Exit(2)
+}
+
+// flags returns a FlagSet for the named command that prints the command usage on error.
+func flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		for _, c := range commands {
+			if c.name == name {
+				fmt.Fprintf(os.Stderr, "usage: boom %s\n", c.usage)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// isSAM returns whether filename names a SAM file.
+func isSAM(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".sam")
+}
+
+// recordWriter is satisfied by *boom.BAMFile and *boom.SAMFile.
+type recordWriter interface {
+	Write(*boom.Record) (int, error)
+	Close() error
+}
+
+func view(args []string) error {
+	fs := flags("view")
+	var (
+		inc   = fs.Uint("f", 0, "only output records with all bits in `FLAG` set")
+		exc   = fs.Uint("F", 0, "only output records with no bits in `FLAG` set")
+		mapq  = fs.Uint("q", 0, "only output records with mapping quality at least `INT`")
+		rg    = fs.String("r", "", "only output records in the comma separated read `GROUPS`")
+		lib   = fs.String("l", "", "only output records in the comma separated `LIBRARIES`")
+		out   = fs.String("o", "", "write output to `FILE`, as BAM unless it has a .sam extension")
+		bam   = fs.Bool("b", false, "write BAM to standard output")
+		noHdr = fs.Bool("H", false, "omit the header from SAM output")
+	)
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	in, regions := fs.Arg(0), fs.Args()[1:]
+	if *mapq > 255 {
+		return fmt.Errorf("invalid mapping quality %d", *mapq)
+	}
+
+	filt := &boom.Filter{
+		Include: boom.Flags(*inc),
+		Exclude: boom.Flags(*exc),
+		MinMapQ: byte(*mapq),
+	}
+	if *rg != "" {
+		filt.ReadGroups = strings.Split(*rg, ",")
+	}
+	if *lib != "" {
+		filt.Libraries = strings.Split(*lib, ",")
+	}
+
+	var (
+		r   boom.RecordReader
+		h   *boom.Header
+		bf  *boom.BAMFile
+		err error
+	)
+	if isSAM(in) {
+		if len(regions) != 0 {
+			return fmt.Errorf("regions require an indexed BAM file")
+		}
+		sf, err := boom.OpenSAM(in, "")
+		if err != nil {
+			return err
+		}
+		defer sf.Close()
+		r, h = sf, sf.Header()
+	} else {
+		bf, err = boom.OpenBAM(in)
+		if err != nil {
+			return err
+		}
+		defer bf.Close()
+		r, h = bf, bf.Header()
+	}
+
+	var w recordWriter
+	switch {
+	case *out != "" && isSAM(*out):
+		w, err = boom.CreateSAM(*out, h, !*noHdr)
+	case *out != "":
+		w, err = boom.CreateBAM(*out, h, true)
+	case *bam:
+		w, err = boom.OpenBAMFile(os.Stdout, "wb", h)
+	default:
+		mode := "wh"
+		if *noHdr {
+			mode = "w"
+		}
+		w, err = boom.OpenSAMFile(os.Stdout, mode, h)
+	}
+	if err != nil {
+		return err
+	}
+
+	keep := filt.ForHeader(h)
+	if len(regions) == 0 {
+		err = copyRecords(w, boom.NewFilterReader(r, keep))
+		if err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	}
+
+	idx, err := boom.LoadIndex(in)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	for _, reg := range regions {
+		tid, beg, end, err := bf.ParseRegion(reg)
+		if err != nil {
+			w.Close()
+			return fmt.Errorf("%v: %q", err, reg)
+		}
+		it, err := bf.Query(idx, tid, beg, end)
+		if err != nil {
+			w.Close()
+			return err
+		}
+		err = copyRecords(w, boom.NewFilterReader(it, keep))
+		it.Close()
+		if err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// copyRecords writes the remaining records of r to w.
+func copyRecords(w recordWriter, r boom.RecordReader) error {
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		n, err := w.Write(rec)
+		if err == nil && n < 0 {
+			err = fmt.Errorf("failed to write record %s", rec.Name())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func sortCmd(args []string) error {
+	fs := flags("sort")
+	var (
+		byName  = fs.Bool("n", false, "sort by read name rather than coordinate")
+		tag     = fs.String("t", "", "sort by the value of `TAG` then by position or name")
+		mem     = fs.Int("m", boom.DefaultSortMem, "maximum memory use in `BYTES`")
+		threads = fs.Int("@", 0, "number of sorting `THREADS`")
+		tmp     = fs.String("T", "", "write temporary files to `DIR`")
+		out     = fs.String("o", "", "write the sorted output to `FILE`")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	opts := &boom.SortOptions{By: boom.Coordinate, MaxMem: *mem, Threads: *threads, TempDir: *tmp}
+	if *byName {
+		opts.By = boom.QueryName
+	}
+	if *tag != "" {
+		if len(*tag) != 2 {
+			return fmt.Errorf("invalid tag %q", *tag)
+		}
+		copy(opts.Tag[:], *tag)
+	}
+	return boom.Sort(fs.Arg(0), *out, opts)
+}
+
+func index(args []string) error {
+	fs := flags("index")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return boom.BuildIndex(fs.Arg(0))
+}
+
+func merge(args []string) error {
+	fs := flags("merge")
+	var (
+		byName   = fs.Bool("n", false, "input files are sorted by read name")
+		attachRG = fs.Bool("r", false, "attach an RG tag derived from each input file name")
+		region   = fs.String("R", "", "merge only records overlapping `REGION`")
+	)
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	opts := &boom.MergeOptions{By: boom.Coordinate, AttachRG: *attachRG, Region: *region}
+	if *byName {
+		opts.By = boom.QueryName
+	}
+	return boom.Merge(fs.Arg(0), fs.Args()[1:], opts)
+}
+
+func flagstat(args []string) error {
+	fs := flags("flagstat")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var r boom.RecordReader
+	if isSAM(fs.Arg(0)) {
+		sf, err := boom.OpenSAM(fs.Arg(0), "")
+		if err != nil {
+			return err
+		}
+		defer sf.Close()
+		r = sf
+	} else {
+		bf, err := boom.OpenBAM(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer bf.Close()
+		r = bf
+	}
+	st, err := boom.Flagstat(r)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Print(st)
+	return err
+}
+
+func depth(args []string) error {
+	fs := flags("depth")
+	var (
+		mapq = fs.Uint("Q", 0, "only count records with mapping quality at least `INT`")
+		bg   = fs.Bool("bg", false, "write bedGraph rather than per-position depths")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *mapq > 255 {
+		return fmt.Errorf("invalid mapping quality %d", *mapq)
+	}
+
+	bf, err := boom.OpenBAM(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer bf.Close()
+	filt := boom.DefaultCoverageFilter
+	filt.MinMapQ = byte(*mapq)
+
+	if *bg {
+		return boom.WriteBedGraph(os.Stdout, bf, &filt)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	names := bf.RefNames()
+	var werr error
+	err = boom.Depth(bf, &filt, func(tid, pos, d int) bool {
+		_, werr = fmt.Fprintf(w, "%s\t%d\t%d\n", names[tid], pos+1, d)
+		return werr != nil
+	})
+	if err != nil {
+		return err
+	}
+	if werr != nil {
+		return werr
+	}
+	return w.Flush()
+}
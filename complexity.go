@@ -0,0 +1,72 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"math"
+)
+
+// EstimateLibrarySize returns the number of unique molecules in a library estimated from the
+// number of reads or read pairs observed, n, and the number of these that are unique, c, using
+// the Lander-Waterman equation as implemented by Picard. If there are no duplicates or the
+// values are inconsistent, ok is returned false.
+func EstimateLibrarySize(n, c int) (size int, ok bool) {
+	if n <= 0 || c <= 0 || c >= n {
+		return 0, false
+	}
+	f := func(x float64) float64 {
+		return float64(c)/x - 1 + math.Exp(-float64(n)/x)
+	}
+
+	lo, hi := 1.0, 100.0
+	if f(lo*float64(c)) < 0 {
+		return 0, false
+	}
+	for f(hi*float64(c)) >= 0 {
+		hi *= 10
+	}
+	for i := 0; i < 40; i++ {
+		m := (lo + hi) / 2
+		u := f(m * float64(c))
+		if u == 0 {
+			break
+		}
+		if u > 0 {
+			lo = m
+		} else {
+			hi = m
+		}
+	}
+	return int(float64(c) * (lo + hi) / 2), true
+}
+
+// EstimateUniqueMolecules returns the expected number of unique molecules observed when n reads
+// are sampled from a library of the given size.
+func EstimateUniqueMolecules(size, n int) float64 {
+	if size <= 0 {
+		return 0
+	}
+	return float64(size) * (1 - math.Exp(-float64(n)/float64(size)))
+}
+
+// LibrarySize returns the estimated library size in read pairs based on the duplicate pairs
+// identified, excluding optical duplicates, as reported by Picard MarkDuplicates. If there are
+// no duplicate pairs, ok is returned false.
+func (self *DuplicateMetrics) LibrarySize() (size int, ok bool) {
+	return EstimateLibrarySize(self.PairsExamined-self.PairOptical, self.PairsExamined-self.PairDuplicates)
+}
+
+// ReturnOnInvestment returns the multiple of unique read pairs expected from sequencing x times
+// the number of pairs examined, relative to the number of unique pairs observed. Values near x
+// indicate a complex library, and values near one an exhausted, over-amplified library. If the
+// library size cannot be estimated, ok is returned false.
+func (self *DuplicateMetrics) ReturnOnInvestment(x float64) (roi float64, ok bool) {
+	size, ok := self.LibrarySize()
+	if !ok {
+		return 0, false
+	}
+	unique := self.PairsExamined - self.PairDuplicates
+	return EstimateUniqueMolecules(size, int(x*float64(self.PairsExamined))) / float64(unique), true
+}
@@ -0,0 +1,339 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	badBinSize = errors.New("boom: bin size must be positive")
+	notSorted  = errors.New("boom: input not coordinate sorted")
+)
+
+// A CoverageFilter specifies the records that contribute to a coverage calculation.
+// A record is counted if its mapping quality is at least MinMapQ, all the flags in
+// Include are set, none of the flags in Exclude are set and it is on the strand
+// selected by Strand.
+type CoverageFilter struct {
+	MinMapQ byte
+	Include Flags
+	Exclude Flags
+	Strand  CoverageStrand
+}
+
+// A CoverageStrand selects the records contributing to coverage by strand.
+type CoverageStrand int
+
+const (
+	BothStrands  CoverageStrand = iota // Records on either strand.
+	ForwardReads                       // Records aligned to the forward strand.
+	ReverseReads                       // Records aligned to the reverse strand.
+
+	// ForwardFragments and ReverseFragments select records by the strand of
+	// the fragment they were sequenced from, taken to be the strand of the
+	// first read of a pair; second reads are counted with their strand
+	// inverted. For dUTP libraries, where the first read is antisense to the
+	// transcript, ReverseFragments gives the coverage of forward strand
+	// transcripts and ForwardFragments that of reverse strand transcripts.
+	ForwardFragments
+	ReverseFragments
+)
+
+// onStrand returns whether r is on the strand selected by the CoverageStrand.
+func (self CoverageStrand) onStrand(r *Record) bool {
+	if self == BothStrands {
+		return true
+	}
+	fl := r.Flags()
+	rev := fl&Reverse != 0
+	switch self {
+	case ForwardReads:
+		return !rev
+	case ReverseReads:
+		return rev
+	}
+	if fl&(Paired|Read2) == Paired|Read2 {
+		rev = !rev
+	}
+	if self == ForwardFragments {
+		return !rev
+	}
+	return rev
+}
+
+// DefaultCoverageFilter is used by the coverage functions when a nil filter is passed.
+// It excludes unmapped, secondary, QC failed and duplicate records.
+var DefaultCoverageFilter = CoverageFilter{Exclude: Unmapped | Secondary | QCFail | Duplicate}
+
+// accept returns whether the record r passes the filter.
+func (self *CoverageFilter) accept(r *Record) bool {
+	if self == nil {
+		self = &DefaultCoverageFilter
+	}
+	fl := r.Flags()
+	return r.RefID() >= 0 &&
+		r.Score() >= self.MinMapQ &&
+		fl&self.Include == self.Include &&
+		fl&self.Exclude == 0 &&
+		self.Strand.onStrand(r)
+}
+
+// alignedBlocks calls fn with the half-open reference interval of each run of aligned bases
+// described by cigar for an alignment starting at pos.
+func alignedBlocks(pos int, cigar []CigarOp, fn func(beg, end int)) {
+	for _, co := range cigar {
+		switch co.Type() {
+		case CigarMatch, CigarEqual, CigarMismatch:
+			fn(pos, pos+co.Len())
+			pos += co.Len()
+		case CigarDeletion, CigarSkipped:
+			pos += co.Len()
+		}
+	}
+}
+
+// A DepthFn is called by Depth for each reference position with a non-zero depth of coverage.
+// Returning a true done value stops the iteration.
+type DepthFn func(tid, pos, depth int) (done bool)
+
+// Depth reads the remaining records from the coordinate-sorted f and calls fn in order for each
+// position covered by at least one aligned base. Records are included according to filt, or
+// DefaultCoverageFilter if filt is nil. If the input is found to be unsorted an error is returned.
+func Depth(f *BAMFile, filt *CoverageFilter, fn DepthFn) error {
+	var (
+		tid  = -1
+		base int
+		buf  []int
+	)
+	// flush emits depths for all buffered positions before end.
+	flush := func(end int) (done bool) {
+		n := end - base
+		if n > len(buf) {
+			n = len(buf)
+		}
+		for i, d := range buf[:n] {
+			if d != 0 && fn(tid, base+i, d) {
+				return true
+			}
+		}
+		buf = buf[:copy(buf, buf[n:])]
+		base = end
+		return false
+	}
+
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if !filt.accept(r) {
+			continue
+		}
+		switch {
+		case r.RefID() != tid:
+			if tid > r.RefID() {
+				return notSorted
+			}
+			if flush(base + len(buf)) {
+				return nil
+			}
+			tid, base = r.RefID(), r.Start()
+		case r.Start() < base:
+			return notSorted
+		default:
+			if flush(r.Start()) {
+				return nil
+			}
+		}
+		alignedBlocks(r.Start(), r.Cigar(), func(beg, end int) {
+			for end-base > len(buf) {
+				buf = append(buf, 0)
+			}
+			for i := beg - base; i < end-base; i++ {
+				buf[i]++
+			}
+		})
+	}
+	flush(base + len(buf))
+
+	return nil
+}
+
+// A BinnedCoverage holds the mean depth of aligned bases in fixed-size bins along each
+// reference sequence.
+type BinnedCoverage struct {
+	BinSize int         // The width of each bin.
+	Names   []string    // Names of the reference sequences.
+	Lengths []uint32    // Lengths of the reference sequences.
+	Depth   [][]float32 // Mean depth indexed by reference ID and bin number.
+}
+
+// BinCoverage reads the remaining records from f and returns the mean depth of coverage in bins
+// of binSize positions for each reference sequence described in the header of f. Records are
+// included according to filt, or DefaultCoverageFilter if filt is nil. The input need not be sorted.
+func BinCoverage(f *BAMFile, binSize int, filt *CoverageFilter) (*BinnedCoverage, error) {
+	if binSize <= 0 {
+		return nil, badBinSize
+	}
+
+	lens := f.RefLengths()
+	sums := make([][]uint64, len(lens))
+	for i, l := range lens {
+		sums[i] = make([]uint64, (int(l)+binSize-1)/binSize)
+	}
+
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if !filt.accept(r) || r.RefID() >= len(lens) {
+			continue
+		}
+		bins, l := sums[r.RefID()], int(lens[r.RefID()])
+		alignedBlocks(r.Start(), r.Cigar(), func(beg, end int) {
+			if end > l {
+				end = l
+			}
+			for beg < end {
+				b := beg / binSize
+				e := (b + 1) * binSize
+				if e > end {
+					e = end
+				}
+				bins[b] += uint64(e - beg)
+				beg = e
+			}
+		})
+	}
+
+	bc := &BinnedCoverage{
+		BinSize: binSize,
+		Names:   f.RefNames(),
+		Lengths: lens,
+		Depth:   make([][]float32, len(lens)),
+	}
+	for i, bins := range sums {
+		bc.Depth[i] = make([]float32, len(bins))
+		for j, s := range bins {
+			w := int(lens[i]) - j*binSize
+			if w > binSize {
+				w = binSize
+			}
+			bc.Depth[i][j] = float32(float64(s) / float64(w))
+		}
+	}
+
+	return bc, nil
+}
+
+// CoverageStats holds summary statistics for the depth of coverage over a set of positions.
+type CoverageStats struct {
+	// Length is the number of positions described.
+	Length int
+
+	// Sum is the total depth over all positions.
+	Sum uint64
+
+	// Histogram holds the number of positions at each depth. The final element
+	// counts all positions with depth at least len(Histogram)-1.
+	Histogram []int
+}
+
+// add includes a position of depth d in the statistics.
+func (self *CoverageStats) add(d int) {
+	if d >= len(self.Histogram) {
+		d = len(self.Histogram) - 1
+	}
+	self.Histogram[d]++
+}
+
+// Mean returns the mean depth of coverage.
+func (self *CoverageStats) Mean() float64 {
+	if self.Length == 0 {
+		return 0
+	}
+	return float64(self.Sum) / float64(self.Length)
+}
+
+// Median returns the median depth of coverage. If the median falls in the final histogram
+// element, the depth of that element is returned.
+func (self *CoverageStats) Median() int {
+	var n int
+	for d, c := range self.Histogram {
+		n += c
+		if 2*n >= self.Length {
+			return d
+		}
+	}
+	return len(self.Histogram) - 1
+}
+
+// Breadth returns the fraction of positions with a depth of coverage of at least min. A min
+// less than zero is treated as zero.
+func (self *CoverageStats) Breadth(min int) float64 {
+	if self.Length == 0 {
+		return 0
+	}
+	if min < 0 {
+		min = 0
+	}
+	if min >= len(self.Histogram) {
+		min = len(self.Histogram) - 1
+	}
+	var n int
+	for _, c := range self.Histogram[min:] {
+		n += c
+	}
+	return float64(n) / float64(self.Length)
+}
+
+// SummarizeCoverage reads the remaining records from the coordinate-sorted f and returns
+// depth of coverage statistics for each reference sequence described in the header of f and
+// for the complete set of references. Depth histograms are capped at maxDepth. Records are
+// included according to filt, or DefaultCoverageFilter if filt is nil.
+func SummarizeCoverage(f *BAMFile, maxDepth int, filt *CoverageFilter) (refs []CoverageStats, all CoverageStats, err error) {
+	if maxDepth < 1 {
+		maxDepth = 1
+	}
+	lens := f.RefLengths()
+	refs = make([]CoverageStats, len(lens))
+	all.Histogram = make([]int, maxDepth+1)
+	covered := make([]int, len(lens))
+	for i, l := range lens {
+		refs[i] = CoverageStats{Length: int(l), Histogram: make([]int, maxDepth+1)}
+		all.Length += int(l)
+	}
+
+	err = Depth(f, filt, func(tid, pos, depth int) bool {
+		if tid >= len(refs) || pos >= refs[tid].Length {
+			return false
+		}
+		refs[tid].add(depth)
+		refs[tid].Sum += uint64(depth)
+		all.add(depth)
+		all.Sum += uint64(depth)
+		covered[tid]++
+		return false
+	})
+	if err != nil {
+		return nil, all, err
+	}
+
+	for i := range refs {
+		refs[i].Histogram[0] = refs[i].Length - covered[i]
+		all.Histogram[0] += refs[i].Histogram[0]
+	}
+
+	return refs, all, nil
+}
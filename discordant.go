@@ -0,0 +1,133 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"math"
+	"strings"
+)
+
+// DefaultDiscordantDeviations is the default number of standard deviations from the mean
+// insert size beyond which pairs are classified as discordant.
+const DefaultDiscordantDeviations = 5
+
+// A DiscordantClass is a set of reasons for which a pair is discordant. The zero value
+// indicates a concordant pair.
+type DiscordantClass uint8
+
+const (
+	InterChromosomal DiscordantClass = 1 << iota // The mates are on different references.
+	WrongOrientation                             // The mates do not have the expected orientation.
+	LargeInsert                                  // The insert size is larger than expected.
+	SmallInsert                                  // The insert size is smaller than expected.
+)
+
+var discordantClasses = []string{"interchromosomal", "orientation", "large", "small"}
+
+// String returns a representation of the DiscordantClass as a comma separated list of reasons.
+func (self DiscordantClass) String() string {
+	if self == 0 {
+		return "concordant"
+	}
+	var reasons []string
+	for i, s := range discordantClasses {
+		if self&(1<<i) != 0 {
+			reasons = append(reasons, s)
+		}
+	}
+	return strings.Join(reasons, ",")
+}
+
+// A DiscordantClassifier classifies pairs as discordant on the basis of the references,
+// orientation and insert size of the mates, as used to prepare input for structural variant
+// callers. Classification uses only the fields of each record describing its mate, so both
+// records of a pair are classified identically without matching mates.
+type DiscordantClassifier struct {
+	// Lower and Upper are the bounds of concordant absolute
+	// template lengths. A zero Lower does not classify small
+	// inserts.
+	Lower, Upper int
+
+	// Orientation is the expected orientation of pairs.
+	Orientation PairOrientation
+}
+
+// NewDiscordantClassifier returns a DiscordantClassifier for inward pairs with insert sizes
+// within deviations standard deviations of the mean insert size described by st. If
+// deviations is not positive, DefaultDiscordantDeviations is used.
+func NewDiscordantClassifier(st *InsertSizeStats, deviations float64) *DiscordantClassifier {
+	if deviations <= 0 {
+		deviations = DefaultDiscordantDeviations
+	}
+	return &DiscordantClassifier{
+		Lower: max(0, int(math.Floor(st.Mean-deviations*st.SD))),
+		Upper: int(math.Ceil(st.Mean + deviations*st.SD)),
+	}
+}
+
+// Classify returns the DiscordantClass of the pair of which r is a member, and false if r is
+// not eligible for classification. Eligible records are paired primary records with both
+// mates mapped that are not QC failed or duplicates.
+func (self *DiscordantClassifier) Classify(r *Record) (DiscordantClass, bool) {
+	fl := r.Flags()
+	if fl&Paired == 0 || fl&(Unmapped|MateUnmapped|Secondary|Supplementary|QCFail|Duplicate) != 0 {
+		return 0, false
+	}
+	if r.RefID() != r.NextRefID() {
+		return InterChromosomal, true
+	}
+	var c DiscordantClass
+	if o, _ := orientation(r); o != self.Orientation {
+		c |= WrongOrientation
+	}
+	switch tlen := abs(r.TemplateLen()); {
+	case tlen > self.Upper:
+		c |= LargeInsert
+	case tlen < self.Lower:
+		c |= SmallInsert
+	}
+	return c, true
+}
+
+// A DiscordantSplitter is a Processor that passes all records through unaltered and writes
+// the records of discordant pairs to a separate RecordWriter.
+type DiscordantSplitter struct {
+	Classifier *DiscordantClassifier
+
+	// W receives the records of discordant pairs.
+	W RecordWriter
+
+	// Pairs holds the number of records of eligible pairs and
+	// Discordant the number of those records in each class.
+	Pairs      int
+	Discordant map[DiscordantClass]int
+}
+
+// NewDiscordantSplitter returns a DiscordantSplitter writing the records classified as
+// discordant by c to w.
+func NewDiscordantSplitter(c *DiscordantClassifier, w RecordWriter) *DiscordantSplitter {
+	return &DiscordantSplitter{Classifier: c, W: w, Discordant: make(map[DiscordantClass]int)}
+}
+
+// Process classifies r, writing it to the discordant output if it is discordant, and returns r.
+func (self *DiscordantSplitter) Process(r *Record) (*Record, error) {
+	c, ok := self.Classifier.Classify(r)
+	if !ok {
+		return r, nil
+	}
+	self.Pairs++
+	if c == 0 {
+		return r, nil
+	}
+	self.Discordant[c]++
+	n, err := self.W.Write(r)
+	if err == nil && n < 0 {
+		err = writeFailed
+	}
+	return r, err
+}
+
+// Flush returns no records.
+func (self *DiscordantSplitter) Flush() ([]*Record, error) { return nil, nil }
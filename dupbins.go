@@ -0,0 +1,122 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// DuplicateBins holds the numbers of mapped primary reads and duplicates starting in fixed-size
+// bins along each reference sequence, allowing amplification hotspots to be identified.
+type DuplicateBins struct {
+	BinSize    int      // The width of each bin.
+	Names      []string // Names of the reference sequences.
+	Lengths    []uint32 // Lengths of the reference sequences.
+	Reads      [][]int  // Number of reads indexed by reference ID and bin number.
+	Duplicates [][]int  // Number of duplicates indexed by reference ID and bin number.
+}
+
+// newDuplicateBins returns an empty DuplicateBins for the reference sequences described by h.
+func newDuplicateBins(h *Header, binSize int) *DuplicateBins {
+	lens := h.RefLengths()
+	db := &DuplicateBins{
+		BinSize:    binSize,
+		Names:      h.RefNames(),
+		Lengths:    lens,
+		Reads:      make([][]int, len(lens)),
+		Duplicates: make([][]int, len(lens)),
+	}
+	for i, l := range lens {
+		n := (int(l) + binSize - 1) / binSize
+		db.Reads[i] = make([]int, n)
+		db.Duplicates[i] = make([]int, n)
+	}
+	return db
+}
+
+// add includes r in the counts if it is a mapped primary record.
+func (self *DuplicateBins) add(r *Record) {
+	fl := r.Flags()
+	if fl&(Unmapped|Secondary|Supplementary) != 0 || r.RefID() < 0 || r.RefID() >= len(self.Reads) {
+		return
+	}
+	b := r.Start() / self.BinSize
+	if b < 0 || b >= len(self.Reads[r.RefID()]) {
+		return
+	}
+	self.Reads[r.RefID()][b]++
+	if fl&Duplicate != 0 {
+		self.Duplicates[r.RefID()][b]++
+	}
+}
+
+// Rate returns the fraction of reads in bin b of reference tid that are duplicates.
+func (self *DuplicateBins) Rate(tid, b int) float64 {
+	n := self.Reads[tid][b]
+	if n == 0 {
+		return 0
+	}
+	return float64(self.Duplicates[tid][b]) / float64(n)
+}
+
+// Hotspots returns the regions covered by bins holding at least minReads reads with a
+// duplicate rate of at least minRate. Adjacent bins are merged into a single region.
+func (self *DuplicateBins) Hotspots(minReads int, minRate float64) []Region {
+	var regs []Region
+	for tid, bins := range self.Reads {
+		for b, n := range bins {
+			if n < minReads || n == 0 || self.Rate(tid, b) < minRate {
+				continue
+			}
+			beg, end := b*self.BinSize, min((b+1)*self.BinSize, int(self.Lengths[tid]))
+			if l := len(regs) - 1; l >= 0 && regs[l].RefID == tid && regs[l].End == beg {
+				regs[l].End = end
+				continue
+			}
+			regs = append(regs, Region{RefID: tid, Start: beg, End: end})
+		}
+	}
+	return regs
+}
+
+// DuplicateRates reads the remaining records from f, which have been marked by MarkDuplicates
+// or another duplicate marking tool, and returns the numbers of mapped primary reads and
+// duplicates starting in bins of binSize positions. The input need not be sorted.
+func DuplicateRates(f *BAMFile, binSize int) (*DuplicateBins, error) {
+	if binSize <= 0 {
+		return nil, badBinSize
+	}
+	db := newDuplicateBins(f.Header(), binSize)
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		db.add(r)
+	}
+	return db, nil
+}
+
+// WriteDuplicateBins writes the bins of db holding at least one read to w in BED-like format,
+// holding the reference name, the zero-based start and end of the bin, the numbers of reads
+// and duplicates, and the duplicate rate, separated by tabs.
+func WriteDuplicateBins(w io.Writer, db *DuplicateBins) error {
+	bw := bufio.NewWriter(w)
+	for tid, bins := range db.Reads {
+		for b, n := range bins {
+			if n == 0 {
+				continue
+			}
+			beg, end := b*db.BinSize, min((b+1)*db.BinSize, int(db.Lengths[tid]))
+			fmt.Fprintf(bw, "%s\t%d\t%d\t%d\t%d\t%.4f\n", db.Names[tid], beg, end, n, db.Duplicates[tid][b], db.Rate(tid, b))
+		}
+	}
+	return bw.Flush()
+}
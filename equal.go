@@ -0,0 +1,100 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bytes"
+	"slices"
+)
+
+// EqualOptions specifies the fields ignored by Record.EqualWith.
+type EqualOptions struct {
+	// IgnoreQuality specifies that quality scores are not compared.
+	IgnoreQuality bool
+
+	// IgnoreTags specifies that no auxiliary fields are compared.
+	IgnoreTags bool
+
+	// Ignore lists auxiliary fields that are not compared.
+	Ignore []Tag
+}
+
+// Equal returns whether the record and other hold the same alignment data. It is equivalent
+// to EqualWith with a nil EqualOptions.
+func (self *Record) Equal(other *Record) bool {
+	return self.EqualWith(other, nil)
+}
+
+// EqualWith returns whether the record and other hold the same alignment data, ignoring the
+// fields specified by opts. The decoded fields are compared rather than the encoded data, so
+// records that differ only in the order of their auxiliary fields or in the integer type
+// used to encode an auxiliary value are equal. The BAM bin is not compared. A nil opts
+// compares all fields.
+func (self *Record) EqualWith(other *Record, opts *EqualOptions) bool {
+	if self == other {
+		return true
+	}
+	if self == nil || other == nil {
+		return false
+	}
+	if opts == nil {
+		opts = &EqualOptions{}
+	}
+	if self.RefID() != other.RefID() ||
+		self.Start() != other.Start() ||
+		self.Flags() != other.Flags() ||
+		self.Score() != other.Score() ||
+		self.NextRefID() != other.NextRefID() ||
+		self.NextStart() != other.NextStart() ||
+		self.TemplateLen() != other.TemplateLen() ||
+		self.Name() != other.Name() ||
+		!slices.Equal(self.Cigar(), other.Cigar()) ||
+		!bytes.Equal(self.Seq(), other.Seq()) {
+		return false
+	}
+	if !opts.IgnoreQuality && !bytes.Equal(self.Quality(), other.Quality()) {
+		return false
+	}
+	if opts.IgnoreTags {
+		return true
+	}
+	return equalTags(self.Tags(), other.Tags(), opts.Ignore)
+}
+
+// equalTags returns whether a and b hold the same set of auxiliary field values, excluding
+// fields with tags in ignore.
+func equalTags(a, b []Aux, ignore []Tag) bool {
+	keep := func(aa []Aux) []Aux {
+		var k []Aux
+		for _, a := range aa {
+			if !slices.Contains(ignore, a.Tag()) {
+				k = append(k, a)
+			}
+		}
+		return k
+	}
+	a, b = keep(a), keep(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for _, ta := range a {
+		i := slices.IndexFunc(b, func(tb Aux) bool { return tb.Tag() == ta.Tag() })
+		if i < 0 || !equalAux(ta, b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalAux returns whether a and b hold the same value. Integer values are compared
+// numerically, so values encoded with different integer types are equal.
+func equalAux(a, b Aux) bool {
+	ia, aIsInt := a.intValue()
+	ib, bIsInt := b.intValue()
+	if aIsInt && bIsInt {
+		return ia == ib
+	}
+	return bytes.Equal(a[2:], b[2:])
+}
@@ -0,0 +1,71 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"math"
+)
+
+// A Fasta represents an indexed FASTA file.
+type Fasta struct {
+	*faidx
+}
+
+// OpenFasta opens the FASTA file, filename, loading its index from filename.fai. If the index
+// does not exist it is built.
+func OpenFasta(filename string) (f *Fasta, err error) {
+	fi, err := faiLoad(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &Fasta{fi}, nil
+}
+
+// Seq returns the sequence of the named reference in the half-open interval [beg, end).
+// The interval is clipped to the bounds of the reference sequence.
+func (self *Fasta) Seq(name string, beg, end int) ([]byte, error) {
+	if end <= beg {
+		return []byte{}, nil
+	}
+	return self.faiFetchSeq(name, beg, end-1)
+}
+
+// Close closes the Fasta.
+func (self *Fasta) Close() error {
+	self.faiDestroy()
+	return nil
+}
+
+// A refCache holds the most recently requested complete reference sequence of a Fasta,
+// avoiding repeated loading for coordinate-sorted access.
+type refCache struct {
+	fa    *Fasta
+	names []string
+	tid   int
+	seq   []byte
+}
+
+// newRefCache returns a refCache reading sequences from fa for the reference sequences
+// named in names, in reference ID order.
+func newRefCache(fa *Fasta, names []string) *refCache {
+	return &refCache{fa: fa, names: names, tid: -1}
+}
+
+// seqFor returns the complete sequence of the reference with ID tid, or nil if it is not
+// present in the Fasta.
+func (self *refCache) seqFor(tid int) []byte {
+	if tid < 0 || tid >= len(self.names) {
+		return nil
+	}
+	if tid != self.tid {
+		self.tid = tid
+		var err error
+		self.seq, err = self.fa.Seq(self.names[tid], 0, math.MaxInt32)
+		if err != nil {
+			self.seq = nil
+		}
+	}
+	return self.seq
+}
@@ -0,0 +1,344 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	badFastq       = errors.New("boom: malformed FASTQ/FASTA record")
+	unmatchedPairs = errors.New("boom: paired inputs hold differing numbers of reads")
+	tooManyInputs  = errors.New("boom: too many input files")
+)
+
+// ImportOptions specifies the behaviour of ImportFastq.
+type ImportOptions struct {
+	// ReadGroup is the read group ID given to each record as an RG tag.
+	// A corresponding @RG header line is added, including the Sample,
+	// Library and Platform fields when they are not empty. If ReadGroup
+	// is empty no read group is assigned.
+	ReadGroup string
+	Sample    string
+	Library   string
+	Platform  string
+
+	// Interleaved specifies that a single input holds pairs of reads
+	// as consecutive records.
+	Interleaved bool
+
+	// BarcodeTag specifies a tag, such as BC, in which the barcode
+	// given as the final field of an Illumina read comment is stored.
+	// If BarcodeTag is the zero Tag, barcodes are not stored.
+	BarcodeTag Tag
+
+	// QualityOffset is the offset of ASCII encoded quality scores.
+	// If QualityOffset is zero, 33 is used.
+	QualityOffset byte
+}
+
+// ImportFastq reads the FASTQ or FASTA files, ins, and writes their reads to the BAM file, out,
+// as unaligned records. A single input holds unpaired reads unless opts specifies interleaved
+// input, and two inputs hold the first and second reads of each pair. Inputs with a .gz
+// extension are decompressed. Read names are truncated at the first white space and a trailing
+// /1 or /2 is removed. Records read from FASTA have no quality scores. If opts is nil, no read
+// group is assigned.
+func ImportFastq(out string, ins []string, opts *ImportOptions) error {
+	var o ImportOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.QualityOffset == 0 {
+		o.QualityOffset = 33
+	}
+	switch {
+	case len(ins) == 0:
+		return noInput
+	case len(ins) > 2:
+		return tooManyInputs
+	}
+
+	rs := make([]*fastqReader, len(ins))
+	for i, in := range ins {
+		fr, err := openFastq(in)
+		if err != nil {
+			return err
+		}
+		defer fr.Close()
+		rs[i] = fr
+	}
+
+	text := "@HD\tVN:1.0\tSO:unsorted\n"
+	if o.ReadGroup != "" {
+		text += "@RG\tID:" + o.ReadGroup
+		for _, f := range []struct{ tag, val string }{
+			{"SM", o.Sample},
+			{"LB", o.Library},
+			{"PL", o.Platform},
+		} {
+			if f.val != "" {
+				text += "\t" + f.tag + ":" + f.val
+			}
+		}
+		text += "\n"
+	}
+	h, err := NewHeader(text)
+	if err != nil {
+		return err
+	}
+	bf, err := CreateBAM(out, h, true)
+	if err != nil {
+		return err
+	}
+
+	write := func(fq *fastqRecord, fl Flags) error {
+		r, err := o.record(fq, fl)
+		if err != nil {
+			return err
+		}
+		n, err := bf.Write(r)
+		if err == nil && n < 0 {
+			err = writeFailed
+		}
+		return err
+	}
+
+	for {
+		var err error
+		switch {
+		case len(rs) == 2 || o.Interleaved:
+			var r1, r2 *fastqRecord
+			r1, err = rs[0].next()
+			if err != nil {
+				break
+			}
+			r2, err = rs[len(rs)-1].next()
+			if err == io.EOF {
+				err = unmatchedPairs
+			}
+			if err != nil {
+				break
+			}
+			if r1.name != r2.name {
+				err = fmt.Errorf("boom: mismatched read names in pair: %q and %q", r1.name, r2.name)
+				break
+			}
+			paired := Paired | Unmapped | MateUnmapped
+			err = write(r1, paired|Read1)
+			if err != nil {
+				break
+			}
+			err = write(r2, paired|Read2)
+		default:
+			var fq *fastqRecord
+			fq, err = rs[0].next()
+			if err != nil {
+				break
+			}
+			err = write(fq, Unmapped)
+		}
+		if err == io.EOF {
+			if len(rs) == 2 {
+				if _, err = rs[1].next(); err != io.EOF {
+					bf.Close()
+					return unmatchedPairs
+				}
+			}
+			break
+		}
+		if err != nil {
+			bf.Close()
+			return err
+		}
+	}
+
+	return bf.Close()
+}
+
+// record returns an unaligned Record holding the read fq with the flags fl.
+func (self *ImportOptions) record(fq *fastqRecord, fl Flags) (*Record, error) {
+	r, err := NewRecord()
+	if err != nil {
+		return nil, err
+	}
+	r.setTid(-1)
+	r.setPos(-1)
+	r.setMtid(-1)
+	r.setMpos(-1)
+	r.setBin(reg2bin(-1, 0))
+	r.setFlag(fl)
+
+	r.nameStr = fq.name
+	r.seqBytes = fq.seq
+	r.qualScores = make([]byte, len(fq.seq))
+	if fq.qual == nil {
+		for i := range r.qualScores {
+			r.qualScores[i] = 0xff
+		}
+	} else {
+		for i, q := range fq.qual {
+			if q < self.QualityOffset {
+				return nil, fmt.Errorf("boom: quality score out of range in read %q", fq.name)
+			}
+			r.qualScores[i] = q - self.QualityOffset
+		}
+	}
+
+	var aa []Aux
+	if self.ReadGroup != "" {
+		a, err := NewAux(Tag{'R', 'G'}, self.ReadGroup)
+		if err != nil {
+			return nil, err
+		}
+		aa = append(aa, a)
+	}
+	if self.BarcodeTag != (Tag{}) {
+		if bc := illuminaBarcode(fq.comment); bc != "" {
+			a, err := NewAux(self.BarcodeTag, bc)
+			if err != nil {
+				return nil, err
+			}
+			aa = append(aa, a)
+		}
+	}
+	r.SetTags(aa)
+
+	return r, nil
+}
+
+// illuminaBarcode returns the barcode held in the final field of an Illumina read comment
+// of the form "1:N:0:ACGTACGT", or the empty string if the comment is not of this form.
+func illuminaBarcode(comment string) string {
+	f := strings.Split(comment, ":")
+	if len(f) < 4 {
+		return ""
+	}
+	return f[len(f)-1]
+}
+
+// A fastqRecord holds a single FASTQ or FASTA read. The qual field is nil for FASTA reads.
+type fastqRecord struct {
+	name    string
+	comment string
+	seq     []byte
+	qual    []byte
+}
+
+// A fastqReader reads FASTQ or FASTA records.
+type fastqReader struct {
+	f  *os.File
+	gz *gzip.Reader
+	r  *bufio.Reader
+}
+
+// openFastq opens the FASTQ or FASTA file, filename, decompressing it if its name has a .gz
+// extension.
+func openFastq(filename string) (*fastqReader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	fr := &fastqReader{f: f}
+	if strings.HasSuffix(filename, ".gz") {
+		fr.gz, err = gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		fr.r = bufio.NewReader(fr.gz)
+	} else {
+		fr.r = bufio.NewReader(f)
+	}
+	return fr, nil
+}
+
+// Close closes the underlying file.
+func (self *fastqReader) Close() error {
+	if self.gz != nil {
+		self.gz.Close()
+	}
+	return self.f.Close()
+}
+
+// line returns the next line without its line ending, or io.EOF if no data remains.
+func (self *fastqReader) line() ([]byte, error) {
+	l, err := self.r.ReadBytes('\n')
+	if err == io.EOF && len(l) != 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(l, "\r\n"), nil
+}
+
+// next returns the next record, or io.EOF if no records remain. FASTA sequences may
+// span multiple lines; FASTQ records must occupy four lines.
+func (self *fastqReader) next() (*fastqRecord, error) {
+	var l []byte
+	for {
+		var err error
+		l, err = self.line()
+		if err != nil {
+			return nil, err
+		}
+		if len(l) != 0 {
+			break
+		}
+	}
+
+	var fq fastqRecord
+	desc := string(l[1:])
+	if i := strings.IndexAny(desc, " \t"); i >= 0 {
+		desc, fq.comment = desc[:i], strings.TrimSpace(desc[i:])
+	}
+	if strings.HasSuffix(desc, "/1") || strings.HasSuffix(desc, "/2") {
+		desc = desc[:len(desc)-2]
+	}
+	fq.name = desc
+
+	switch l[0] {
+	case '>':
+		for {
+			b, err := self.r.Peek(1)
+			if err == io.EOF || (err == nil && b[0] == '>') {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			l, err := self.line()
+			if err != nil {
+				return nil, err
+			}
+			fq.seq = append(fq.seq, l...)
+		}
+	case '@':
+		var err error
+		fq.seq, err = self.line()
+		if err != nil {
+			return nil, badFastq
+		}
+		l, err = self.line()
+		if err != nil || len(l) == 0 || l[0] != '+' {
+			return nil, badFastq
+		}
+		fq.qual, err = self.line()
+		if err != nil || len(fq.qual) != len(fq.seq) {
+			return nil, badFastq
+		}
+	default:
+		return nil, badFastq
+	}
+
+	return &fq, nil
+}
@@ -0,0 +1,88 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build biogo
+
+// The bíogo feature adapters depend on github.com/biogo/biogo and are only
+// built when the biogo build tag is provided.
+
+package boom
+
+import (
+	"github.com/biogo/biogo/feat"
+)
+
+var (
+	_ feat.Feature  = Feature{}
+	_ feat.Orienter = Feature{}
+	_ feat.Feature  = (*RefFeature)(nil)
+)
+
+// A RefFeature is a reference sequence described by a Header. It satisfies the bíogo feat.Feature
+// interface.
+type RefFeature struct {
+	ID     string
+	Length int
+}
+
+// RefFeatures returns the reference sequences described by the header as RefFeatures, indexed by
+// reference ID.
+func (self *Header) RefFeatures() []*RefFeature {
+	names, lens := self.RefNames(), self.RefLengths()
+	f := make([]*RefFeature, len(names))
+	for i, n := range names {
+		f[i] = &RefFeature{ID: n, Length: int(lens[i])}
+	}
+	return f
+}
+
+func (self *RefFeature) Start() int             { return 0 }
+func (self *RefFeature) End() int               { return self.Length }
+func (self *RefFeature) Len() int               { return self.Length }
+func (self *RefFeature) Name() string           { return self.ID }
+func (self *RefFeature) Description() string    { return "reference sequence" }
+func (self *RefFeature) Location() feat.Feature { return nil }
+
+// A Feature wraps an aligned Record to satisfy the bíogo feat.Feature and feat.Orienter
+// interfaces. The feature extends over the reference bases covered by the alignment and is
+// located on Ref.
+type Feature struct {
+	*Record
+	Ref *RefFeature
+}
+
+// NewFeature returns a Feature for r located on the reference with r's reference ID in refs,
+// as returned by Header.RefFeatures. The Ref field is nil if r is unplaced.
+func NewFeature(r *Record, refs []*RefFeature) Feature {
+	f := Feature{Record: r}
+	if tid := r.RefID(); tid >= 0 && tid < len(refs) {
+		f.Ref = refs[tid]
+	}
+	return f
+}
+
+// End returns the end of the reference region covered by the alignment.
+func (self Feature) End() int { return self.Start() + refLen(self.Cigar()) }
+
+// Len returns the length of the reference region covered by the alignment.
+func (self Feature) Len() int { return refLen(self.Cigar()) }
+
+// Description returns "alignment".
+func (self Feature) Description() string { return "alignment" }
+
+// Location returns the reference the alignment is located on.
+func (self Feature) Location() feat.Feature {
+	if self.Ref == nil {
+		return nil
+	}
+	return self.Ref
+}
+
+// Orientation returns the strand of the alignment relative to the reference.
+func (self Feature) Orientation() feat.Orientation {
+	if self.Flags()&Reverse != 0 {
+		return feat.Reverse
+	}
+	return feat.Forward
+}
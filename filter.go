@@ -0,0 +1,223 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A Filter specifies a set of records in the manner of the samtools view filtering options.
+// A record passes the filter if all the flags in Include are set (-f), none of the flags in
+// Exclude are set (-F), its mapping quality is at least MinMapQ (-q), its read group is one of
+// ReadGroups (-r) and belongs to one of Libraries (-l), it has all the tags in Tags, and its name
+// is one of Names or matches NameRegexp. Empty or nil fields do not restrict records.
+type Filter struct {
+	Include    Flags
+	Exclude    Flags
+	MinMapQ    byte
+	ReadGroups []string
+	Libraries  []string
+	Tags       []Tag
+	Names      []string
+	NameRegexp *regexp.Regexp
+}
+
+// A RecordFilter returns whether the record r is retained.
+type RecordFilter func(r *Record) bool
+
+// ForHeader returns a RecordFilter applying the filter to records described by the header h.
+// The header is used to resolve the libraries of read groups and may be nil if Libraries is
+// empty. A nil Filter retains all records.
+func (self *Filter) ForHeader(h *Header) RecordFilter {
+	if self == nil {
+		return func(*Record) bool { return true }
+	}
+	f := *self
+
+	var rgs map[string]bool
+	if len(f.ReadGroups) != 0 {
+		rgs = make(map[string]bool)
+		for _, rg := range f.ReadGroups {
+			rgs[rg] = true
+		}
+	}
+	if len(f.Libraries) != 0 {
+		libs := make(map[string]bool)
+		for _, lb := range f.Libraries {
+			libs[lb] = true
+		}
+		var lrgs map[string]bool
+		if h != nil {
+			lrgs = make(map[string]bool)
+			for rg, lb := range h.readGroupField("LB") {
+				if libs[lb] && (rgs == nil || rgs[rg]) {
+					lrgs[rg] = true
+				}
+			}
+		}
+		rgs = lrgs
+		if rgs == nil {
+			rgs = make(map[string]bool)
+		}
+	}
+
+	var names map[string]bool
+	if len(f.Names) != 0 {
+		names = make(map[string]bool)
+		for _, n := range f.Names {
+			names[n] = true
+		}
+	}
+
+	return func(r *Record) bool {
+		fl := r.Flags()
+		if fl&f.Include != f.Include || fl&f.Exclude != 0 || r.Score() < f.MinMapQ {
+			return false
+		}
+		if rgs != nil {
+			a, ok := r.Tag([]byte("RG"))
+			if !ok || a.Type() != 'Z' {
+				return false
+			}
+			if !rgs[a.Value().(string)] {
+				return false
+			}
+		}
+		for _, t := range f.Tags {
+			if _, ok := r.Tag(t[:]); !ok {
+				return false
+			}
+		}
+		if names != nil || f.NameRegexp != nil {
+			n := r.Name()
+			return names[n] || (f.NameRegexp != nil && f.NameRegexp.MatchString(n))
+		}
+		return true
+	}
+}
+
+// Grep reads the remaining records from r and returns those retained by keep. Grep is
+// intended for extracting small sets of records, such as those with particular names
+// selected by a Filter.
+func Grep(r RecordReader, keep RecordFilter) ([]*Record, error) {
+	var recs []*Record
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return recs, err
+		}
+		if keep(rec) {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, nil
+}
+
+// A FilterReader is a RecordReader that returns only the records of an underlying
+// RecordReader that are retained by a RecordFilter.
+type FilterReader struct {
+	r    RecordReader
+	keep RecordFilter
+}
+
+// NewFilterReader returns a FilterReader reading the records of r retained by keep.
+func NewFilterReader(r RecordReader, keep RecordFilter) *FilterReader {
+	return &FilterReader{r: r, keep: keep}
+}
+
+// Read returns the next retained record, the number of bytes read from the underlying
+// RecordReader for that record and any error.
+func (self *FilterReader) Read() (r *Record, n int, err error) {
+	for {
+		r, n, err = self.r.Read()
+		if err != nil || self.keep(r) {
+			return
+		}
+	}
+}
+
+// FilterFetch returns a FetchFn that calls fn only for records retained by keep.
+func FilterFetch(fn FetchFn, keep RecordFilter) FetchFn {
+	return func(r *Record) bool {
+		if !keep(r) {
+			return false
+		}
+		return fn(r)
+	}
+}
+
+// Convert reads the SAM or BAM file, in, and writes the records retained by filt to the SAM or
+// BAM file, out. Files with a .sam extension are treated as SAM with a header; all others are
+// treated as BAM. If filt is nil, all records are written.
+func Convert(in, out string, filt *Filter) error {
+	var (
+		r   RecordReader
+		h   *Header
+		err error
+	)
+	if isSAM(in) {
+		var sf *SAMFile
+		sf, err = OpenSAM(in, "")
+		if err != nil {
+			return err
+		}
+		defer sf.Close()
+		r, h = sf, sf.Header()
+	} else {
+		var bf *BAMFile
+		bf, err = OpenBAM(in)
+		if err != nil {
+			return err
+		}
+		defer bf.Close()
+		r, h = bf, bf.Header()
+	}
+
+	var w interface {
+		Write(*Record) (int, error)
+		Close() error
+	}
+	if isSAM(out) {
+		w, err = CreateSAM(out, h, true)
+	} else {
+		w, err = CreateBAM(out, h, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	fr := NewFilterReader(r, filt.ForHeader(h))
+	for {
+		rec, _, err := fr.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			w.Close()
+			return err
+		}
+		n, err := w.Write(rec)
+		if err == nil && n < 0 {
+			err = writeFailed
+		}
+		if err != nil {
+			w.Close()
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// isSAM returns whether filename has a .sam extension.
+func isSAM(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".sam")
+}
@@ -0,0 +1,195 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+)
+
+// FixMates reads the name-grouped BAM file, in, and writes its records to the BAM file, out,
+// with the mate information of each pair of primary alignments made consistent. For each pair,
+// the mate reference ID, position and MateReverse and MateUnmapped flags are set from the mate,
+// the template length is recomputed, an unmapped read is placed at its mapped mate's position,
+// and MC (mate CIGAR) and ms (mate score) tags are added. ProperPair is cleared if either read
+// is unmapped. Paired reads without a mate have their mate information cleared. Secondary and
+// supplementary alignments are written unaltered.
+func FixMates(in, out string) error {
+	f, err := OpenBAM(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bf, err := CreateBAM(out, f.Header(), true)
+	if err != nil {
+		return err
+	}
+
+	var group []*Record
+	flush := func() error {
+		var prim []*Record
+		for _, r := range group {
+			if r.Flags()&(Secondary|Supplementary) == 0 {
+				prim = append(prim, r)
+			}
+		}
+		switch len(prim) {
+		case 1:
+			unpaired(prim[0])
+		case 2:
+			err := syncMates(prim[0], prim[1])
+			if err != nil {
+				return err
+			}
+		}
+		for _, r := range group {
+			n, err := bf.Write(r)
+			if err == nil && n < 0 {
+				err = writeFailed
+			}
+			if err != nil {
+				return err
+			}
+		}
+		group = group[:0]
+		return nil
+	}
+
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			bf.Close()
+			return err
+		}
+		if len(group) != 0 && r.Name() != group[0].Name() {
+			err = flush()
+			if err != nil {
+				bf.Close()
+				return err
+			}
+		}
+		group = append(group, r)
+	}
+	err = flush()
+	if err != nil {
+		bf.Close()
+		return err
+	}
+
+	return bf.Close()
+}
+
+// unpaired clears the mate information of a record without a mate.
+func unpaired(r *Record) {
+	r.setMtid(-1)
+	r.setMpos(-1)
+	r.setIsize(0)
+	if fl := r.Flags(); fl&Paired != 0 {
+		r.setFlag(fl&^(MateReverse|ProperPair) | MateUnmapped)
+	}
+}
+
+// syncMates makes the mate information of the pair a and b consistent in the same manner as
+// samtools fixmate.
+func syncMates(a, b *Record) error {
+	aMapped, bMapped := a.Flags()&Unmapped == 0, b.Flags()&Unmapped == 0
+	switch {
+	case aMapped && !bMapped:
+		placeUnmapped(b, a)
+	case !aMapped && bMapped:
+		placeUnmapped(a, b)
+	}
+
+	a.setMtid(b.tid())
+	a.setMpos(b.pos())
+	b.setMtid(a.tid())
+	b.setMpos(a.pos())
+
+	if aMapped && bMapped && a.tid() == b.tid() {
+		a5, b5 := fivePrime(a), fivePrime(b)
+		a.setIsize(int32(b5 - a5))
+		b.setIsize(int32(a5 - b5))
+	} else {
+		a.setIsize(0)
+		b.setIsize(0)
+	}
+
+	setMateFlags(a, b)
+	setMateFlags(b, a)
+	err := setMateTags(a, b)
+	if err != nil {
+		return err
+	}
+	return setMateTags(b, a)
+}
+
+// placeUnmapped sets the position of the unmapped record u to that of its mapped mate m.
+func placeUnmapped(u, m *Record) {
+	u.setTid(m.tid())
+	u.setPos(m.pos())
+	u.setBin(reg2bin(int(m.pos()), int(m.pos())+1))
+}
+
+// fivePrime returns the reference position of the 5' end of the alignment of r, using the
+// end position for reverse strand alignments.
+func fivePrime(r *Record) int {
+	if r.Flags()&Reverse != 0 {
+		return r.Start() + refLen(r.Cigar())
+	}
+	return r.Start()
+}
+
+// setMateFlags sets the mate flags of r from the flags of its mate m.
+func setMateFlags(r, m *Record) {
+	fl, mfl := r.Flags(), m.Flags()
+	fl &^= MateReverse | MateUnmapped
+	if mfl&Reverse != 0 {
+		fl |= MateReverse
+	}
+	if mfl&Unmapped != 0 {
+		fl |= MateUnmapped
+	}
+	if (fl|mfl)&Unmapped != 0 {
+		fl &^= ProperPair
+	}
+	r.setFlag(fl)
+}
+
+// setMateTags replaces the MC and ms tags of r with the CIGAR and score of its mate m.
+// The MC tag is only added if m is mapped.
+func setMateTags(r, m *Record) error {
+	var aa []Aux
+	for _, a := range r.Tags() {
+		if t := a.Tag(); t != (Tag{'M', 'C'}) && t != (Tag{'m', 's'}) {
+			aa = append(aa, a)
+		}
+	}
+	if m.Flags()&Unmapped == 0 {
+		mc, err := NewAux(Tag{'M', 'C'}, cigarString(m.Cigar()))
+		if err != nil {
+			return err
+		}
+		aa = append(aa, mc)
+	}
+	ms, err := NewAux(Tag{'m', 's'}, int32(mateScore(m)))
+	if err != nil {
+		return err
+	}
+	r.SetTags(append(aa, ms))
+	return nil
+}
+
+// mateScore returns the sum of base qualities of at least 15 for r, as used by samtools.
+func mateScore(r *Record) int {
+	var s int
+	for _, q := range r.Quality() {
+		if q >= 15 {
+			s += int(q)
+		}
+	}
+	return s
+}
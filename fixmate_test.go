@@ -0,0 +1,154 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/biogo/boom"
+	"github.com/biogo/boom/generator"
+)
+
+// writeSAMAsBAM writes the SAM data, sam, to the BAM file, fn.
+func writeSAMAsBAM(t *testing.T, fn string, sam []byte) {
+	t.Helper()
+	err := os.WriteFile(fn+".sam", sam, 0o644)
+	if err != nil {
+		t.Fatalf("failed to write SAM: %v", err)
+	}
+	sf, err := boom.OpenSAM(fn+".sam", "")
+	if err != nil {
+		t.Fatalf("failed to open SAM: %v", err)
+	}
+	defer sf.Close()
+	bf, err := boom.CreateBAM(fn, sf.Header(), true)
+	if err != nil {
+		t.Fatalf("failed to create BAM: %v", err)
+	}
+	for {
+		r, _, err := sf.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("failed to read SAM: %v", err)
+		}
+		_, err = bf.Write(r)
+		if err != nil {
+			t.Fatalf("failed to write BAM: %v", err)
+		}
+	}
+	err = bf.Close()
+	if err != nil {
+		t.Fatalf("failed to close BAM: %v", err)
+	}
+}
+
+// mateKey returns a string holding the flags, placement and mate fields of r.
+func mateKey(r *boom.Record) string {
+	return fmt.Sprintf("%v %d:%d %d:%d %d", r.Flags(), r.RefID(), r.Start(), r.NextRefID(), r.NextStart(), r.TemplateLen())
+}
+
+func TestFixMates(t *testing.T) {
+	dir := t.TempDir()
+	g, err := generator.New(generator.Config{
+		Seed: 1,
+		References: []generator.Reference{
+			{Name: "chr1", Length: 30000},
+			{Name: "chr2", Length: 20000},
+		},
+		Paired:   true,
+		Coverage: 3,
+		Unmapped: 0.1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+	var buf bytes.Buffer
+	err = g.WriteSAM(&buf)
+	if err != nil {
+		t.Fatalf("failed to write SAM: %v", err)
+	}
+	want := filepath.Join(dir, "want.bam")
+	writeSAMAsBAM(t, want, buf.Bytes())
+
+	// Clear the mate fields and flags of every record
+	// so that FixMates must restore them from the mate.
+	var broken bytes.Buffer
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line == "" || line[0] == '@' {
+			broken.WriteString(line)
+			continue
+		}
+		f := strings.Split(line, "\t")
+		fl, err := strconv.Atoi(f[1])
+		if err != nil {
+			t.Fatalf("invalid flag in %q: %v", line, err)
+		}
+		f[1] = strconv.Itoa(int(boom.Flags(fl) &^ (boom.MateReverse | boom.MateUnmapped)))
+		f[6], f[7], f[8] = "*", "0", "0"
+		broken.WriteString(strings.Join(f, "\t"))
+	}
+	in := filepath.Join(dir, "in.bam")
+	writeSAMAsBAM(t, in, broken.Bytes())
+
+	named := filepath.Join(dir, "name.bam")
+	err = boom.Sort(in, named, &boom.SortOptions{By: boom.QueryName})
+	if err != nil {
+		t.Fatalf("failed to sort by name: %v", err)
+	}
+	out := filepath.Join(dir, "fixed.bam")
+	err = boom.FixMates(named, out)
+	if err != nil {
+		t.Fatalf("unexpected error fixing mates: %v", err)
+	}
+	checkSorted(t, out, boom.QueryName)
+
+	segment := func(r *boom.Record) string {
+		return fmt.Sprintf("%s/%d", r.Name(), r.Flags()&(boom.Read1|boom.Read2))
+	}
+	mate := func(r *boom.Record) string {
+		return fmt.Sprintf("%s/%d", r.Name(), r.Flags()&(boom.Read1|boom.Read2)^(boom.Read1|boom.Read2))
+	}
+	_, wantRecs := readRecords(t, want)
+	expect := make(map[string]string)
+	score := make(map[string]int)
+	for _, r := range wantRecs {
+		expect[segment(r)] = mateKey(r)
+		for _, q := range r.Quality() {
+			if q >= 15 {
+				score[segment(r)] += int(q)
+			}
+		}
+	}
+	_, got := readRecords(t, out)
+	if len(got) != len(wantRecs) {
+		t.Fatalf("unexpected number of records: got %d want %d", len(got), len(wantRecs))
+	}
+	for _, r := range got {
+		if k := mateKey(r); k != expect[segment(r)] {
+			t.Errorf("unexpected mate fields for %s: got %s want %s", segment(r), k, expect[segment(r)])
+		}
+		_, ok := r.Tag([]byte("MC"))
+		if mapped := r.Flags()&boom.MateUnmapped == 0; ok != mapped {
+			t.Errorf("unexpected presence of MC tag for %s with mate mapped=%t: %t", segment(r), mapped, ok)
+		}
+		ms, ok := r.Tag([]byte("ms"))
+		if !ok {
+			t.Errorf("no ms tag for %s", segment(r))
+			continue
+		}
+		if got, want := fmt.Sprint(ms.Value()), fmt.Sprint(score[mate(r)]); got != want {
+			t.Errorf("unexpected ms tag for %s: got %s want %s", segment(r), got, want)
+		}
+	}
+}
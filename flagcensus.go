@@ -0,0 +1,107 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// flagNames holds the samtools names of the flag bits, indexed by bit.
+var flagNames = [...]string{
+	"PAIRED",
+	"PROPER_PAIR",
+	"UNMAP",
+	"MUNMAP",
+	"REVERSE",
+	"MREVERSE",
+	"READ1",
+	"READ2",
+	"SECONDARY",
+	"QCFAIL",
+	"DUP",
+	"SUPPLEMENTARY",
+}
+
+// FlagNames returns the comma-separated samtools names of the bits set in f, or "0" if no bits
+// are set. Bits without a name are given in hexadecimal.
+func FlagNames(f Flags) string {
+	if f == 0 {
+		return "0"
+	}
+	var names []string
+	for i, n := range flagNames {
+		if f&(1<<uint(i)) != 0 {
+			names = append(names, n)
+		}
+	}
+	if rest := f &^ (1<<uint(len(flagNames)) - 1); rest != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint32(rest)))
+	}
+	return strings.Join(names, ",")
+}
+
+// A FlagCensus holds the number of records observed with each FLAG value.
+type FlagCensus map[Flags]int
+
+// Add includes the record r in the census.
+func (self FlagCensus) Add(r *Record) {
+	self[r.Flags()]++
+}
+
+// Flags returns the observed FLAG values in ascending order.
+func (self FlagCensus) Flags() []Flags {
+	fs := make([]Flags, 0, len(self))
+	for f := range self {
+		fs = append(fs, f)
+	}
+	sort.Slice(fs, func(i, j int) bool { return fs[i] < fs[j] })
+	return fs
+}
+
+// Count returns the number of records with FLAG values, f, satisfying f&mask == want, allowing
+// combinations of bits to be counted regardless of the state of other bits. For example,
+// Count(Secondary|Duplicate, Secondary|Duplicate) returns the number of duplicate secondary
+// alignments.
+func (self FlagCensus) Count(mask, want Flags) int {
+	var n int
+	for f, c := range self {
+		if f&mask == want {
+			n += c
+		}
+	}
+	return n
+}
+
+// FlagCensusOf reads the remaining records from r and returns the number of records with each
+// FLAG value.
+func FlagCensusOf(r RecordReader) (FlagCensus, error) {
+	c := make(FlagCensus)
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		c.Add(rec)
+	}
+	return c, nil
+}
+
+// WriteFlagCensus writes the census c to w, one line per observed FLAG value in ascending
+// order, holding the decimal and hexadecimal FLAG value, the flag string, the flag names and
+// the number of records, separated by tabs.
+func WriteFlagCensus(w io.Writer, c FlagCensus) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range c.Flags() {
+		fmt.Fprintf(bw, "%d\t0x%03x\t%v\t%s\t%d\n", uint32(f), uint32(f), f, FlagNames(f), c[f])
+	}
+	return bw.Flush()
+}
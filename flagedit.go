@@ -0,0 +1,64 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// A FlagEdit sets and clears flags on the records selected by a predicate. Flags in Clear are
+// cleared before flags in Set are set.
+type FlagEdit struct {
+	// When selects the records to edit. If When is nil all
+	// records are edited.
+	When RecordFilter
+
+	Set, Clear Flags
+}
+
+// apply applies the edit to r.
+func (self FlagEdit) apply(r *Record) {
+	if self.When != nil && !self.When(r) {
+		return
+	}
+	r.SetFlags(r.Flags()&^self.Clear | self.Set)
+}
+
+// ClearFlags returns a FlagEdit that clears the flags, fl, on all records, for example to
+// remove Duplicate marks before re-marking.
+func ClearFlags(fl Flags) FlagEdit { return FlagEdit{Clear: fl} }
+
+// SetFlagsWhen returns a FlagEdit that sets the flags, fl, on records selected by when.
+func SetFlagsWhen(fl Flags, when RecordFilter) FlagEdit { return FlagEdit{When: when, Set: fl} }
+
+// MarkFailing returns a FlagEdit that sets QCFail on records not retained by keep.
+func MarkFailing(keep RecordFilter) FlagEdit {
+	return FlagEdit{When: func(r *Record) bool { return !keep(r) }, Set: QCFail}
+}
+
+// A FlagEditor is a Processor that applies a sequence of FlagEdits to each record in order, so
+// the predicate of an edit sees the flags left by preceding edits. No records are dropped.
+type FlagEditor struct {
+	Edits []FlagEdit
+
+	// Edited is the number of records whose flags were changed.
+	Edited int
+}
+
+// NewFlagEditor returns a FlagEditor applying the edits.
+func NewFlagEditor(edits ...FlagEdit) *FlagEditor {
+	return &FlagEditor{Edits: edits}
+}
+
+// Process applies the FlagEditor's edits to r and returns it.
+func (self *FlagEditor) Process(r *Record) (*Record, error) {
+	fl := r.Flags()
+	for _, e := range self.Edits {
+		e.apply(r)
+	}
+	if r.Flags() != fl {
+		self.Edited++
+	}
+	return r, nil
+}
+
+// Flush returns no records.
+func (self *FlagEditor) Flush() ([]*Record, error) { return nil, nil }
@@ -0,0 +1,175 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// FlagStats holds counts of records in the categories reported by samtools flagstat. Each
+// count is indexed by QC status, with index 0 counting records that pass QC and index 1
+// counting records flagged as QCFail.
+type FlagStats struct {
+	Total             [2]int // All records.
+	Primary           [2]int // Records that are neither secondary nor supplementary.
+	Secondary         [2]int // Secondary alignments.
+	Supplementary     [2]int // Supplementary alignments.
+	Duplicates        [2]int // Records flagged as duplicates.
+	PrimaryDuplicates [2]int // Primary records flagged as duplicates.
+	Mapped            [2]int // Mapped records.
+	PrimaryMapped     [2]int // Mapped primary records.
+	Paired            [2]int // Primary records paired in sequencing.
+	Read1             [2]int // Primary paired records flagged as read 1.
+	Read2             [2]int // Primary paired records flagged as read 2.
+	ProperPair        [2]int // Primary records mapped in a proper pair.
+	BothMapped        [2]int // Primary paired records with both the record and its mate mapped.
+	Singletons        [2]int // Primary paired records that are mapped with an unmapped mate.
+	MateDiffRef       [2]int // Records with both mapped where the mate is mapped to a different reference.
+	MateDiffRefMapQ5  [2]int // Records counted in MateDiffRef with a mapping quality of at least 5.
+}
+
+// Add includes the record r in the counts.
+func (self *FlagStats) Add(r *Record) {
+	self.add(r.Flags(), r.mtid() != r.tid(), r.Score())
+}
+
+// add includes a record with the flags fl and mapping quality mapq in the counts. diffRef
+// specifies whether the record's mate is on a different reference.
+func (self *FlagStats) add(fl Flags, diffRef bool, mapq byte) {
+	var w int
+	if fl&QCFail != 0 {
+		w = 1
+	}
+
+	self.Total[w]++
+	mapped := fl&Unmapped == 0
+	if mapped {
+		self.Mapped[w]++
+	}
+	if fl&Duplicate != 0 {
+		self.Duplicates[w]++
+	}
+	switch {
+	case fl&Secondary != 0:
+		self.Secondary[w]++
+		return
+	case fl&Supplementary != 0:
+		self.Supplementary[w]++
+		return
+	}
+
+	self.Primary[w]++
+	if mapped {
+		self.PrimaryMapped[w]++
+	}
+	if fl&Duplicate != 0 {
+		self.PrimaryDuplicates[w]++
+	}
+	if fl&Paired == 0 {
+		return
+	}
+	self.Paired[w]++
+	if mapped && fl&ProperPair != 0 {
+		self.ProperPair[w]++
+	}
+	if fl&Read1 != 0 {
+		self.Read1[w]++
+	}
+	if fl&Read2 != 0 {
+		self.Read2[w]++
+	}
+	if mapped && fl&MateUnmapped != 0 {
+		self.Singletons[w]++
+	}
+	if mapped && fl&MateUnmapped == 0 {
+		self.BothMapped[w]++
+		if diffRef {
+			self.MateDiffRef[w]++
+			if mapq >= 5 {
+				self.MateDiffRefMapQ5[w]++
+			}
+		}
+	}
+}
+
+// String returns a report of the counts in the format used by samtools flagstat.
+func (self *FlagStats) String() string {
+	pct := func(n, d int) string {
+		if d == 0 {
+			return "N/A"
+		}
+		return fmt.Sprintf("%.2f%%", 100*float64(n)/float64(d))
+	}
+	var b bytes.Buffer
+	line := func(c [2]int, desc string) {
+		fmt.Fprintf(&b, "%d + %d %s\n", c[0], c[1], desc)
+	}
+	linePct := func(c, d [2]int, desc string) {
+		fmt.Fprintf(&b, "%d + %d %s (%s : %s)\n", c[0], c[1], desc, pct(c[0], d[0]), pct(c[1], d[1]))
+	}
+	line(self.Total, "in total (QC-passed reads + QC-failed reads)")
+	line(self.Primary, "primary")
+	line(self.Secondary, "secondary")
+	line(self.Supplementary, "supplementary")
+	line(self.Duplicates, "duplicates")
+	line(self.PrimaryDuplicates, "primary duplicates")
+	linePct(self.Mapped, self.Total, "mapped")
+	linePct(self.PrimaryMapped, self.Primary, "primary mapped")
+	line(self.Paired, "paired in sequencing")
+	line(self.Read1, "read1")
+	line(self.Read2, "read2")
+	linePct(self.ProperPair, self.Paired, "properly paired")
+	line(self.BothMapped, "with itself and mate mapped")
+	linePct(self.Singletons, self.Paired, "singletons")
+	line(self.MateDiffRef, "with mate mapped to a different chr")
+	line(self.MateDiffRefMapQ5, "with mate mapped to a different chr (mapQ>=5)")
+	return b.String()
+}
+
+// Flagstat reads the remaining records from r and returns counts of records by flag category.
+func Flagstat(r RecordReader) (*FlagStats, error) {
+	var fs FlagStats
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		fs.Add(rec)
+	}
+	return &fs, nil
+}
+
+// FlagstatBy reads the remaining records from r and returns counts of records by flag category
+// for each key returned by key, allowing the records of merged files to be summarised by read
+// group, using ReadGroupKey, or library, using LibraryKey. Records for which key returns false
+// are not counted.
+func FlagstatBy(r RecordReader, key KeyFn) (map[string]*FlagStats, error) {
+	stats := make(map[string]*FlagStats)
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		k, ok := key(rec)
+		if !ok {
+			continue
+		}
+		fs, ok := stats[k]
+		if !ok {
+			fs = &FlagStats{}
+			stats[k] = fs
+		}
+		fs.Add(rec)
+	}
+	return stats, nil
+}
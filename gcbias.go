@@ -0,0 +1,116 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"io"
+)
+
+var badWindow = errors.New("boom: window size must be positive")
+
+// DefaultGCWindow is the default window size used for GC bias calculations.
+const DefaultGCWindow = 100
+
+// GCBias holds the numbers of reference windows and aligned reads in windows of each GC
+// content, indexed by GC percentage.
+type GCBias struct {
+	Window  int      // The width of each window.
+	Windows [101]int // Number of reference windows with each GC percentage.
+	Reads   [101]int // Number of reads starting in windows with each GC percentage.
+}
+
+// NormalizedCoverage returns the mean number of reads starting in windows of each GC
+// percentage divided by the mean number of reads starting in all windows. GC percentages
+// without windows have a normalized coverage of zero.
+func (self *GCBias) NormalizedCoverage() [101]float64 {
+	var (
+		nc             [101]float64
+		windows, reads int
+	)
+	for gc, w := range self.Windows {
+		windows += w
+		reads += self.Reads[gc]
+	}
+	if reads == 0 {
+		return nc
+	}
+	mean := float64(reads) / float64(windows)
+	for gc, w := range self.Windows {
+		if w != 0 {
+			nc[gc] = float64(self.Reads[gc]) / float64(w) / mean
+		}
+	}
+	return nc
+}
+
+// GCBiasStats reads the remaining records from r, which are described by the header h, and
+// returns the GC bias of the reads starting in non-overlapping windows of the given size
+// along the reference sequences held in fa. Windows extending past the end of a reference
+// sequence, and windows with more than 4% of bases that are not A, C, G or T, are ignored,
+// as are references absent from fa. Records are included according to filt, or
+// DefaultCoverageFilter if filt is nil. The input need not be sorted. If window is zero,
+// DefaultGCWindow is used.
+func GCBiasStats(r RecordReader, h *Header, fa *Fasta, window int, filt *CoverageFilter) (*GCBias, error) {
+	if window == 0 {
+		window = DefaultGCWindow
+	}
+	if window < 0 {
+		return nil, badWindow
+	}
+
+	lens := h.RefLengths()
+	starts := make([][]int, len(lens))
+	for i, l := range lens {
+		starts[i] = make([]int, int(l)/window)
+	}
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if !filt.accept(rec) || rec.RefID() >= len(starts) {
+			continue
+		}
+		if w := rec.Start() / window; w < len(starts[rec.RefID()]) {
+			starts[rec.RefID()][w]++
+		}
+	}
+
+	g := &GCBias{Window: window}
+	refs := newRefCache(fa, h.RefNames())
+	for tid, counts := range starts {
+		seq := refs.seqFor(tid)
+		if seq == nil {
+			continue
+		}
+		for w, n := range counts {
+			end := (w + 1) * window
+			if end > len(seq) {
+				break
+			}
+			var gc, at int
+			for _, b := range seq[w*window : end] {
+				switch upper(b) {
+				case 'G', 'C':
+					gc++
+				case 'A', 'T':
+					at++
+				}
+			}
+			if 25*(window-gc-at) > window {
+				continue
+			}
+			pct := (100*gc + (gc+at)/2) / (gc + at)
+			g.Windows[pct]++
+			g.Reads[pct] += n
+		}
+	}
+
+	return g, nil
+}
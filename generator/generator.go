@@ -0,0 +1,444 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package generator produces deterministic synthetic alignment data for testing tools built
+// with boom. Reads are sampled from a random reference sequence with configurable length,
+// pairing, coverage and error rates, so that small, reproducible SAM, BAM and FASTA fixtures
+// can be created at test time rather than stored in repositories.
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/boom"
+)
+
+// Defaults used for zero fields of a Config.
+const (
+	DefaultReadLength = 100
+	DefaultInsertSize = 300
+	DefaultCoverage   = 1
+)
+
+// A Reference describes a synthetic reference sequence.
+type Reference struct {
+	Name   string
+	Length int
+}
+
+// A Config specifies the data produced by a Generator.
+type Config struct {
+	// Seed is the seed for the pseudo-random source. Generators
+	// with equal Configs produce identical output.
+	Seed int64
+
+	// References lists the reference sequences. If References is
+	// empty, a single 100kb reference named "chr1" is used.
+	References []Reference
+
+	// ReadLength is the length of each read. If ReadLength is zero,
+	// DefaultReadLength is used.
+	ReadLength int
+
+	// Paired specifies that reads are generated as proper pairs
+	// with fragment lengths drawn from a normal distribution with
+	// mean InsertSize and standard deviation InsertSD. If InsertSize
+	// is zero, DefaultInsertSize is used. Fragments are never shorter
+	// than ReadLength.
+	Paired     bool
+	InsertSize int
+	InsertSD   float64
+
+	// Coverage is the mean read depth over each reference. If
+	// Coverage is zero, DefaultCoverage is used; if it is negative,
+	// no reads are generated.
+	Coverage float64
+
+	// Mismatch is the per-base substitution rate and Indel the
+	// per-base rate of single base insertions and deletions.
+	Mismatch float64
+	Indel    float64
+
+	// Unmapped is the fraction of reads reported as unmapped.
+	Unmapped float64
+
+	// ReadGroup, if not empty, is added to the header with the
+	// sample name Sample and is attached to each read as an RG tag.
+	ReadGroup string
+	Sample    string
+}
+
+// A Generator produces synthetic alignment data.
+type Generator struct {
+	cfg  Config
+	refs []Reference
+	seqs [][]byte
+}
+
+// New returns a Generator for the given configuration. The reference sequences are generated
+// when New is called.
+func New(cfg Config) (*Generator, error) {
+	if cfg.ReadLength == 0 {
+		cfg.ReadLength = DefaultReadLength
+	}
+	if cfg.InsertSize == 0 {
+		cfg.InsertSize = DefaultInsertSize
+	}
+	switch {
+	case cfg.Coverage == 0:
+		cfg.Coverage = DefaultCoverage
+	case cfg.Coverage < 0:
+		cfg.Coverage = 0
+	}
+	refs := cfg.References
+	if len(refs) == 0 {
+		refs = []Reference{{Name: "chr1", Length: 100000}}
+	}
+	switch {
+	case cfg.ReadLength < 0:
+		return nil, fmt.Errorf("generator: invalid read length %d", cfg.ReadLength)
+	case cfg.Mismatch < 0 || cfg.Mismatch > 1, cfg.Indel < 0 || cfg.Indel > 1, cfg.Unmapped < 0 || cfg.Unmapped > 1:
+		return nil, fmt.Errorf("generator: rate out of range")
+	}
+	for _, ref := range refs {
+		if ref.Name == "" || ref.Length < 2*cfg.ReadLength {
+			return nil, fmt.Errorf("generator: invalid reference %q of length %d", ref.Name, ref.Length)
+		}
+	}
+
+	g := &Generator{cfg: cfg, refs: refs, seqs: make([][]byte, len(refs))}
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+	for i, ref := range refs {
+		s := make([]byte, ref.Length)
+		for j := range s {
+			s[j] = "ACGT"[rnd.Intn(4)]
+		}
+		g.seqs[i] = s
+	}
+	return g, nil
+}
+
+// HeaderText returns the SAM header text describing the generated data.
+func (self *Generator) HeaderText() string {
+	var b strings.Builder
+	b.WriteString("@HD\tVN:1.0\tSO:coordinate\n")
+	for _, ref := range self.refs {
+		fmt.Fprintf(&b, "@SQ\tSN:%s\tLN:%d\n", ref.Name, ref.Length)
+	}
+	if self.cfg.ReadGroup != "" {
+		fmt.Fprintf(&b, "@RG\tID:%s", self.cfg.ReadGroup)
+		if self.cfg.Sample != "" {
+			fmt.Fprintf(&b, "\tSM:%s", self.cfg.Sample)
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString("@PG\tID:boom-generator\tPN:generator\n")
+	return b.String()
+}
+
+// Header returns the Header describing the generated data.
+func (self *Generator) Header() (*boom.Header, error) {
+	return boom.NewHeader(self.HeaderText())
+}
+
+// Reference returns the sequence of the ith reference.
+func (self *Generator) Reference(i int) []byte {
+	return self.seqs[i]
+}
+
+// WriteFasta writes the reference sequences to w in FASTA format.
+func (self *Generator) WriteFasta(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i, ref := range self.refs {
+		fmt.Fprintf(bw, ">%s\n", ref.Name)
+		s := self.seqs[i]
+		for len(s) > 60 {
+			bw.Write(s[:60])
+			bw.WriteByte('\n')
+			s = s[60:]
+		}
+		bw.Write(s)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// WriteSAM writes the header and coordinate-sorted synthetic reads to w in SAM format.
+func (self *Generator) WriteSAM(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(self.HeaderText())
+
+	rnd := rand.New(rand.NewSource(self.cfg.Seed + 1))
+	var (
+		id       int
+		unplaced []*read
+	)
+	for tid := range self.refs {
+		recs := self.reads(rnd, tid, &id)
+		sort.SliceStable(recs, func(i, j int) bool { return recs[i].pos < recs[j].pos })
+		for _, r := range recs {
+			if r.pos < 0 {
+				unplaced = append(unplaced, r)
+				continue
+			}
+			r.format(bw, self.refs[tid].Name, self.cfg.ReadGroup)
+		}
+	}
+	// Unplaced reads follow all placed reads in coordinate order.
+	for _, r := range unplaced {
+		r.format(bw, "*", self.cfg.ReadGroup)
+	}
+	return bw.Flush()
+}
+
+// WriteBAM writes the header and coordinate-sorted synthetic reads to the BAM file, filename.
+func (self *Generator) WriteBAM(filename string) error {
+	if self.cfg.Coverage == 0 {
+		// libbam misreads SAM files holding only a header,
+		// so the empty BAM file is written directly.
+		h, err := boom.NewHeader(self.HeaderText())
+		if err != nil {
+			return err
+		}
+		bf, err := boom.CreateBAM(filename, h, true)
+		if err != nil {
+			return err
+		}
+		return bf.Close()
+	}
+
+	tmp, err := os.CreateTemp("", "boom-generator-*.sam")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = self.WriteSAM(tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	sf, err := boom.OpenSAM(tmp.Name(), "")
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	bf, err := boom.CreateBAM(filename, sf.Header(), true)
+	if err != nil {
+		return err
+	}
+	for {
+		r, _, err := sf.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			bf.Close()
+			return err
+		}
+		n, err := bf.Write(r)
+		if err == nil && n < 0 {
+			err = fmt.Errorf("generator: failed to write record")
+		}
+		if err != nil {
+			bf.Close()
+			return err
+		}
+	}
+	return bf.Close()
+}
+
+// read is a synthetic SAM record.
+type read struct {
+	name  string
+	flag  boom.Flags
+	pos   int // 0-based; -1 for unplaced reads.
+	cigar string
+	mpos  int
+	tlen  int
+	seq   []byte
+	qual  []byte
+	nm    int
+}
+
+// reads returns the reads sampled from the reference tid. Read names are numbered from *id.
+func (self *Generator) reads(rnd *rand.Rand, tid int, id *int) []*read {
+	cfg := &self.cfg
+	ref := self.seqs[tid]
+	perFrag := 1
+	if cfg.Paired {
+		perFrag = 2
+	}
+	n := int(cfg.Coverage * float64(len(ref)) / float64(cfg.ReadLength*perFrag))
+
+	var recs []*read
+	for k := 0; k < n; k++ {
+		*id++
+		name := "sim" + strconv.Itoa(*id)
+		if !cfg.Paired {
+			rev := rnd.Intn(2) == 1
+			r := self.sample(rnd, ref, rnd.Intn(len(ref)-2*cfg.ReadLength+1))
+			r.name = name
+			if rev {
+				r.flag |= boom.Reverse
+			}
+			if rnd.Float64() < cfg.Unmapped {
+				r.unmap()
+			}
+			recs = append(recs, r)
+			continue
+		}
+
+		frag := int(rnd.NormFloat64()*cfg.InsertSD) + cfg.InsertSize
+		if frag < cfg.ReadLength {
+			frag = cfg.ReadLength
+		}
+		if max := len(ref) - cfg.ReadLength; frag > max {
+			frag = max
+		}
+		start := rnd.Intn(len(ref) - frag - cfg.ReadLength + 1)
+		a := self.sample(rnd, ref, start)
+		b := self.sample(rnd, ref, start+frag-cfg.ReadLength)
+		a.name, b.name = name, name
+		a.flag |= boom.Paired | boom.ProperPair | boom.MateReverse
+		b.flag |= boom.Paired | boom.ProperPair | boom.Reverse
+		if rnd.Intn(2) == 0 {
+			a.flag |= boom.Read1
+			b.flag |= boom.Read2
+		} else {
+			a.flag |= boom.Read2
+			b.flag |= boom.Read1
+		}
+		a.tlen, b.tlen = frag, -frag
+		aUnmapped, bUnmapped := rnd.Float64() < cfg.Unmapped, rnd.Float64() < cfg.Unmapped
+		switch {
+		case aUnmapped && bUnmapped:
+			a.unmap()
+			b.unmap()
+			a.flag |= boom.MateUnmapped
+			b.flag |= boom.MateUnmapped
+			a.flag &^= boom.ProperPair | boom.Reverse | boom.MateReverse
+			b.flag &^= boom.ProperPair | boom.Reverse | boom.MateReverse
+		case aUnmapped:
+			a.place(b)
+		case bUnmapped:
+			b.place(a)
+		}
+		a.mpos, b.mpos = b.pos, a.pos
+		recs = append(recs, a, b)
+	}
+	return recs
+}
+
+// sample returns a read of the configured length starting at pos on ref, with errors applied.
+func (self *Generator) sample(rnd *rand.Rand, ref []byte, pos int) *read {
+	cfg := &self.cfg
+	r := &read{pos: pos, mpos: -1}
+	var (
+		cig   strings.Builder
+		op    byte
+		oplen int
+	)
+	emit := func(o byte) {
+		if o != op && oplen != 0 {
+			cig.WriteString(strconv.Itoa(oplen))
+			cig.WriteByte(op)
+			oplen = 0
+		}
+		op = o
+		oplen++
+	}
+	for i := pos; len(r.seq) < cfg.ReadLength; {
+		// Indels are not placed at the read ends so that the alignment
+		// remains anchored at pos.
+		if len(r.seq) > 0 && len(r.seq) < cfg.ReadLength-1 && rnd.Float64() < cfg.Indel {
+			r.nm++
+			if rnd.Intn(2) == 0 {
+				r.seq = append(r.seq, "ACGT"[rnd.Intn(4)])
+				emit('I')
+			} else {
+				i++
+				emit('D')
+			}
+			continue
+		}
+		b := ref[i]
+		if rnd.Float64() < cfg.Mismatch {
+			b = "ACGT"[(strings.IndexByte("ACGT", b)+1+rnd.Intn(3))%4]
+			r.nm++
+		}
+		r.seq = append(r.seq, b)
+		emit('M')
+		i++
+	}
+	emit(0)
+	r.cigar = cig.String()
+
+	r.qual = make([]byte, len(r.seq))
+	for i := range r.qual {
+		r.qual[i] = byte(20 + rnd.Intn(21))
+	}
+	return r
+}
+
+// unmap marks r as unmapped and unplaced.
+func (self *read) unmap() {
+	self.flag |= boom.Unmapped
+	self.flag &^= boom.ProperPair
+	self.pos = -1
+	self.cigar = ""
+	self.tlen = 0
+	self.nm = -1
+}
+
+// place marks r as unmapped and places it at the position of its mapped mate m.
+func (self *read) place(m *read) {
+	self.unmap()
+	self.pos = m.pos
+	self.flag &^= boom.Reverse
+	m.flag |= boom.MateUnmapped
+	m.flag &^= boom.ProperPair | boom.MateReverse
+	m.tlen = 0
+}
+
+// format writes r as a SAM line to w.
+func (self *read) format(w *bufio.Writer, ref, rg string) {
+	rname, pos, mpos := ref, self.pos+1, self.mpos+1
+	if self.pos < 0 {
+		rname, pos = "*", 0
+	}
+	mname := "="
+	if self.flag&boom.Paired == 0 || self.mpos < 0 {
+		mname, mpos = "*", 0
+		if self.flag&boom.Paired != 0 && self.pos >= 0 {
+			mname, mpos = "=", pos
+		}
+	}
+	cigar, mapq := self.cigar, 60
+	if cigar == "" {
+		cigar, mapq = "*", 0
+	}
+	qual := make([]byte, len(self.qual))
+	for i, q := range self.qual {
+		qual[i] = q + 33
+	}
+	fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\t%s\t%s\t%d\t%d\t%s\t%s",
+		self.name, self.flag, rname, pos, mapq, cigar, mname, mpos, self.tlen, self.seq, qual)
+	if self.nm >= 0 {
+		fmt.Fprintf(w, "\tNM:i:%d", self.nm)
+	}
+	if rg != "" {
+		fmt.Fprintf(w, "\tRG:Z:%s", rg)
+	}
+	w.WriteByte('\n')
+}
@@ -0,0 +1,261 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/biogo/boom/bgzf"
+)
+
+var (
+	notBGZF   = errors.New("boom: not a BGZF file")
+	noGZI     = errors.New("boom: no GZI index")
+	badWhence = errors.New("boom: invalid whence")
+	badGZI    = errors.New("boom: malformed GZI index")
+)
+
+// A GZIBlock holds the compressed and uncompressed file offsets of the start of a BGZF block.
+type GZIBlock struct {
+	Compressed   uint64
+	Uncompressed uint64
+}
+
+// A GZIIndex is an index of the blocks of a BGZF file in the format of the .gzi files written
+// by bgzip, allowing uncompressed file offsets to be converted to virtual file offsets.
+type GZIIndex struct {
+	// Blocks holds the offsets of each non-empty block after
+	// the first, in file order. The first block starts at offset
+	// zero in both the compressed and uncompressed data.
+	Blocks []GZIBlock
+}
+
+// BuildGZI builds a GZI index file, filename.gzi, for the BGZF file, filename.
+func BuildGZI(filename string) error {
+	gzi, err := scanGZI(filename)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filename + ".gzi")
+	if err != nil {
+		return err
+	}
+	_, err = gzi.WriteTo(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadGZI loads the GZI index file, filename.gzi, for the BGZF file, filename.
+func LoadGZI(filename string) (*GZIIndex, error) {
+	f, err := os.Open(filename + ".gzi")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadGZI(bufio.NewReader(f))
+}
+
+// scanGZI returns a GZIIndex for the BGZF file, filename, by reading the header and ISIZE
+// field of each block.
+func scanGZI(filename string) (*GZIIndex, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		gzi     GZIIndex
+		buf     [bgzf.HeaderLen]byte
+		off, uo uint64
+	)
+	for {
+		n, err := f.ReadAt(buf[:], int64(off))
+		if err == io.EOF && n == 0 {
+			break
+		}
+		if n != len(buf) {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		// BlockSize returns zero unless buf holds a gzip
+		// header with the BGZF BC extra field.
+		size := bgzf.BlockSize(buf[:])
+		if size < bgzf.HeaderLen+bgzf.FooterLen {
+			return nil, notBGZF
+		}
+		_, err = f.ReadAt(buf[:4], int64(off)+int64(size)-4)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		isize := binary.LittleEndian.Uint32(buf[:4])
+		if isize != 0 && off != 0 {
+			gzi.Blocks = append(gzi.Blocks, GZIBlock{Compressed: off, Uncompressed: uo})
+		}
+		off += uint64(size)
+		uo += uint64(isize)
+	}
+	return &gzi, nil
+}
+
+// ReadGZI reads a GZI index from r.
+func ReadGZI(r io.Reader) (*GZIIndex, error) {
+	var buf [16]byte
+	_, err := io.ReadFull(r, buf[:8])
+	if err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint64(buf[:8])
+	if n > baiMaxChunks {
+		return nil, badGZI
+	}
+	gzi := &GZIIndex{Blocks: make([]GZIBlock, n)}
+	for i := range gzi.Blocks {
+		_, err = io.ReadFull(r, buf[:])
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		gzi.Blocks[i] = GZIBlock{
+			Compressed:   binary.LittleEndian.Uint64(buf[:8]),
+			Uncompressed: binary.LittleEndian.Uint64(buf[8:]),
+		}
+	}
+	return gzi, nil
+}
+
+// WriteTo writes the GZI index to w in the format used by bgzip.
+func (self *GZIIndex) WriteTo(w io.Writer) (n int64, err error) {
+	bw := bufio.NewWriter(w)
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(len(self.Blocks)))
+	bw.Write(buf[:8])
+	for _, b := range self.Blocks {
+		binary.LittleEndian.PutUint64(buf[:8], b.Compressed)
+		binary.LittleEndian.PutUint64(buf[8:], b.Uncompressed)
+		bw.Write(buf[:])
+	}
+	return int64(8 + 16*len(self.Blocks)), bw.Flush()
+}
+
+// VirtualOffset returns the virtual file offset corresponding to the uncompressed file offset,
+// off.
+func (self *GZIIndex) VirtualOffset(off int64) int64 {
+	i := sort.Search(len(self.Blocks), func(i int) bool { return self.Blocks[i].Uncompressed > uint64(off) })
+	var b GZIBlock
+	if i > 0 {
+		b = self.Blocks[i-1]
+	}
+	return bgzf.MakeOffset(int64(b.Compressed), int(off-int64(b.Uncompressed)))
+}
+
+// A BGZF represents a block gzip compressed file opened for reading, such as a bgzipped FASTA
+// or SAM file. Data are read through the BGZF layer of libbam, so virtual file offsets match
+// those used by BAM indexes.
+type BGZF struct {
+	*bgzfFile
+	gzi *GZIIndex
+	pos int64 // Uncompressed offset of the next byte, or -1 if unknown.
+}
+
+// OpenBGZF opens the BGZF file, filename, for reading. If the GZI index file, filename.gzi,
+// exists it is loaded to allow the file to be positioned by uncompressed offset using Seek.
+func OpenBGZF(filename string) (*BGZF, error) {
+	bf, err := bgzfOpen(filename)
+	if err != nil {
+		return nil, err
+	}
+	b := &BGZF{bgzfFile: bf}
+	gzi, err := LoadGZI(filename)
+	switch {
+	case err == nil:
+		b.gzi = gzi
+	case !os.IsNotExist(err):
+		bf.bgzfClose()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Index returns the GZI index used by the BGZF, or nil if it has no index.
+func (self *BGZF) Index() *GZIIndex { return self.gzi }
+
+// SetIndex sets the GZI index used to position the BGZF by uncompressed offset.
+func (self *BGZF) SetIndex(gzi *GZIIndex) { self.gzi = gzi }
+
+// Read reads up to len(p) uncompressed bytes into p.
+func (self *BGZF) Read(p []byte) (n int, err error) {
+	n, err = self.bgzfRead(p)
+	if self.pos >= 0 {
+		self.pos += int64(n)
+	}
+	return n, err
+}
+
+// Tell returns the virtual file offset of the next byte to be read.
+func (self *BGZF) Tell() (int64, error) {
+	return self.bgzfTell()
+}
+
+// SeekVirtual positions the BGZF at the virtual file offset, off.
+func (self *BGZF) SeekVirtual(off int64) error {
+	err := self.bgzfSeek(off)
+	if err == nil {
+		self.pos = -1
+	}
+	return err
+}
+
+// Seek positions the BGZF at the uncompressed file offset given by offset and whence, using
+// the GZI index of the file, and returns the new offset. Seeking relative to the end of the
+// file is not supported, nor is seeking relative to the current position following a call to
+// SeekVirtual.
+func (self *BGZF) Seek(offset int64, whence int) (int64, error) {
+	if self.gzi == nil {
+		return 0, noGZI
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		if self.pos < 0 {
+			return 0, badWhence
+		}
+		offset += self.pos
+	default:
+		return 0, badWhence
+	}
+	if offset < 0 {
+		return 0, badOffset
+	}
+	err := self.bgzfSeek(self.gzi.VirtualOffset(offset))
+	if err != nil {
+		return 0, err
+	}
+	self.pos = offset
+	return offset, nil
+}
+
+// Close closes the BGZF.
+func (self *BGZF) Close() error {
+	if self == nil {
+		return nil
+	}
+	return self.bgzfClose()
+}
@@ -0,0 +1,153 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Haplotype returns the haplotype of r held in its HP tag and its phase set held in its PS tag.
+// If r has no integer HP tag, ok is false. If r has no integer PS tag, ps is -1.
+func Haplotype(r *Record) (hp, ps int, ok bool) {
+	ps = -1
+	if v, ok := intTag(r, "PS"); ok {
+		ps = int(v)
+	}
+	v, ok := intTag(r, "HP")
+	if !ok {
+		return 0, ps, false
+	}
+	return int(v), ps, true
+}
+
+// HaplotypeFilter returns a RecordFilter retaining records assigned to the haplotype hp. If hp
+// is zero, records without a haplotype are retained.
+func HaplotypeFilter(hp int) RecordFilter {
+	return func(r *Record) bool {
+		h, _, ok := Haplotype(r)
+		if !ok {
+			return hp == 0
+		}
+		return h == hp
+	}
+}
+
+// PhaseSetFilter returns a RecordFilter retaining phased records in the phase set ps.
+func PhaseSetFilter(ps int) RecordFilter {
+	return func(r *Record) bool {
+		_, s, ok := Haplotype(r)
+		return ok && s == ps
+	}
+}
+
+// A HaplotypeSplitter is a RecordWriter that routes records to per-haplotype BAM files
+// according to their HP tag. Records without a haplotype are written to a separate file.
+type HaplotypeSplitter struct {
+	h      *Header
+	prefix string
+
+	files  map[int]*BAMFile
+	counts map[int]int
+}
+
+// NewHaplotypeSplitter returns a HaplotypeSplitter writing records described by h to BAM files
+// named by the prefix followed by "hp" and the haplotype, or "untagged" for records without a
+// haplotype, and ".bam". The header is copied, so it need not outlive the file it was obtained
+// from.
+func NewHaplotypeSplitter(h *Header, prefix string) *HaplotypeSplitter {
+	return &HaplotypeSplitter{
+		h:      &Header{h.dup()},
+		prefix: prefix,
+		files:  make(map[int]*BAMFile),
+		counts: make(map[int]int),
+	}
+}
+
+// Write writes r to the file for its haplotype, creating the file if necessary, and returns
+// the number of bytes written.
+func (self *HaplotypeSplitter) Write(r *Record) (n int, err error) {
+	hp, _, ok := Haplotype(r)
+	if !ok {
+		hp = 0
+	}
+	bf, ok := self.files[hp]
+	if !ok {
+		bf, err = CreateBAM(self.Filename(hp), self.h, true)
+		if err != nil {
+			return 0, err
+		}
+		self.files[hp] = bf
+	}
+	n, err = bf.Write(r)
+	if err == nil && n < 0 {
+		err = writeFailed
+	}
+	if err == nil {
+		self.counts[hp]++
+	}
+	return n, err
+}
+
+// Haplotypes returns the haplotypes that have been written to, in ascending order, with zero
+// representing records without a haplotype.
+func (self *HaplotypeSplitter) Haplotypes() []int {
+	hps := make([]int, 0, len(self.counts))
+	for hp := range self.counts {
+		hps = append(hps, hp)
+	}
+	sort.Ints(hps)
+	return hps
+}
+
+// Count returns the number of records written for the haplotype hp.
+func (self *HaplotypeSplitter) Count(hp int) int { return self.counts[hp] }
+
+// Filename returns the name of the BAM file for the haplotype hp.
+func (self *HaplotypeSplitter) Filename(hp int) string {
+	if hp == 0 {
+		return self.prefix + "untagged.bam"
+	}
+	return fmt.Sprintf("%shp%d.bam", self.prefix, hp)
+}
+
+// Close closes the BAM files written by the splitter.
+func (self *HaplotypeSplitter) Close() error {
+	var err error
+	for _, bf := range self.files {
+		if cerr := bf.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// SplitHaplotypes reads the BAM file, in, and writes its records to per-haplotype BAM files
+// named as described for NewHaplotypeSplitter, returning the number of records written for
+// each haplotype.
+func SplitHaplotypes(in, prefix string) (map[int]int, error) {
+	f, err := OpenBAM(in)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := NewHaplotypeSplitter(f.Header(), prefix)
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			s.Close()
+			return nil, err
+		}
+		if _, err = s.Write(r); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s.counts, s.Close()
+}
@@ -4,7 +4,124 @@
 
 package boom
 
+import (
+	"strings"
+)
+
 // A Header represents a BAM header.
 type Header struct {
 	*bamHeader
 }
+
+// NewHeader returns a new Header described by the SAM header text, text. Reference sequences
+// are obtained from the @SQ lines of the text.
+func NewHeader(text string) (h *Header, err error) {
+	bh, err := newBamHeader(text)
+	if err != nil {
+		return
+	}
+	return &Header{bh}, nil
+}
+
+// Text returns the unparsed text of the header as a string.
+func (self *Header) Text() string {
+	return self.text()
+}
+
+// RefNames returns a slice of strings containing the names of reference sequences described
+// in the header.
+func (self *Header) RefNames() []string {
+	return self.targetNames()
+}
+
+// RefLengths returns a slice of integers containing the lengths of reference sequences described
+// in the header.
+func (self *Header) RefLengths() []uint32 {
+	return self.targetLengths()
+}
+
+// SortOrder returns the sort order declared in the SO field of the header's @HD line.
+// If no sort order is declared, UnknownOrder is returned.
+func (self *Header) SortOrder() SortOrder {
+	text := self.text()
+	if !strings.HasPrefix(text, "@HD") {
+		return UnknownOrder
+	}
+	if i := strings.Index(text, "\n"); i >= 0 {
+		text = text[:i]
+	}
+	text = strings.TrimSuffix(text, "\r")
+	for _, f := range strings.Split(text, "\t") {
+		if !strings.HasPrefix(f, "SO:") {
+			continue
+		}
+		for so, name := range sortOrders {
+			if f[3:] == name {
+				return SortOrder(so)
+			}
+		}
+	}
+	return UnknownOrder
+}
+
+// withText returns a copy of the header with the unparsed text replaced by text.
+// The reference sequences of the copy are those of the receiver.
+func (self *Header) withText(text string) *Header {
+	d := self.dup()
+	d.setText(text)
+	return &Header{d}
+}
+
+// setSortOrder returns the SAM header text, text, with the SO field of the @HD line set to
+// so, adding an @HD line if one is not present.
+func setSortOrder(text string, so SortOrder) string {
+	if !strings.HasPrefix(text, "@HD") {
+		return "@HD\tVN:1.0\tSO:" + so.String() + "\n" + text
+	}
+	var hd, rest string
+	if i := strings.Index(text, "\n"); i < 0 {
+		hd = text
+	} else {
+		hd, rest = text[:i], text[i:]
+	}
+	if strings.HasSuffix(hd, "\r") {
+		hd, rest = hd[:len(hd)-1], "\r"+rest
+	}
+	fields := strings.Split(hd, "\t")
+	var found bool
+	for i, f := range fields {
+		if strings.HasPrefix(f, "SO:") {
+			fields[i] = "SO:" + so.String()
+			found = true
+		}
+	}
+	if !found {
+		fields = append(fields, "SO:"+so.String())
+	}
+	return strings.Join(fields, "\t") + rest
+}
+
+// readGroupField returns a map from read group IDs to the value of the field with the given
+// two letter tag in the @RG lines of the header. Read groups without the field are omitted.
+func (self *Header) readGroupField(tag string) map[string]string {
+	m := make(map[string]string)
+	for _, line := range strings.Split(self.text(), "\n") {
+		if !strings.HasPrefix(line, "@RG") {
+			continue
+		}
+		var id, val string
+		var ok bool
+		for _, f := range strings.Split(strings.TrimSuffix(line, "\r"), "\t")[1:] {
+			switch {
+			case strings.HasPrefix(f, "ID:"):
+				id = f[3:]
+			case strings.HasPrefix(f, tag+":"):
+				val, ok = f[3:], true
+			}
+		}
+		if ok {
+			m[id] = val
+		}
+	}
+	return m
+}
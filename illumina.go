@@ -0,0 +1,98 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var notIllumina = errors.New("boom: not an Illumina read name")
+
+// An IlluminaName holds the components of an Illumina read name.
+type IlluminaName struct {
+	Instrument string
+	Run        int // The run number, or -1 for pre-CASAVA 1.8 names.
+	Flowcell   string
+	Lane       int
+	Tile       int
+	X, Y       int    // Cluster coordinates within the tile.
+	UMI        string // The unique molecular identifier, if present.
+	Index      string // The sample index following '#', if present.
+	Read       int    // The read number following '/', or zero if absent.
+}
+
+// ParseIlluminaName parses an Illumina read name. Names in the CASAVA 1.8 form,
+//
+//	instrument:run:flowcell:lane:tile:x:y[:UMI]
+//
+// and in the earlier form,
+//
+//	instrument:lane:tile:x:y[#index][/read]
+//
+// are recognised. A leading '@' and any comment following a space are ignored.
+func ParseIlluminaName(name string) (IlluminaName, error) {
+	n := IlluminaName{Run: -1}
+	name = strings.TrimPrefix(name, "@")
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		r, err := strconv.Atoi(name[i+1:])
+		if err != nil {
+			return IlluminaName{}, notIllumina
+		}
+		n.Read = r
+		name = name[:i]
+	}
+	if i := strings.IndexByte(name, '#'); i >= 0 {
+		n.Index = name[i+1:]
+		name = name[:i]
+	}
+
+	f := strings.Split(name, ":")
+	var ints []*int
+	switch len(f) {
+	case 8:
+		n.UMI = f[7]
+		f = f[:7]
+		fallthrough
+	case 7:
+		n.Instrument, n.Flowcell = f[0], f[2]
+		ints = []*int{&n.Run, nil, &n.Lane, &n.Tile, &n.X, &n.Y}
+		f = f[1:]
+	case 5:
+		n.Instrument = f[0]
+		ints = []*int{&n.Lane, &n.Tile, &n.X, &n.Y}
+		f = f[1:]
+	default:
+		return IlluminaName{}, notIllumina
+	}
+	for i, p := range ints {
+		if p == nil {
+			continue
+		}
+		v, err := strconv.Atoi(f[i])
+		if err != nil || v < 0 {
+			return IlluminaName{}, notIllumina
+		}
+		*p = v
+	}
+	return n, nil
+}
+
+// TileKey returns a string identifying the tile holding the cluster, distinct for each
+// instrument, run, flowcell, lane and tile.
+func (n IlluminaName) TileKey() string {
+	return fmt.Sprintf("%s:%d:%s:%d:%d", n.Instrument, n.Run, n.Flowcell, n.Lane, n.Tile)
+}
+
+// LaneKey returns a string identifying the lane holding the cluster, distinct for each
+// instrument, run, flowcell and lane.
+func (n IlluminaName) LaneKey() string {
+	return fmt.Sprintf("%s:%d:%s:%d", n.Instrument, n.Run, n.Flowcell, n.Lane)
+}
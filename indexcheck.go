@@ -0,0 +1,111 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+	"sort"
+)
+
+// An IndexMismatch is the error returned by CheckIndex when an entry in a BAM index is not
+// consistent with the records of the BAM file it describes.
+type IndexMismatch struct {
+	RefID  int    // Reference ID of the index entry, or -1 for the index as a whole.
+	Bin    int    // Bin of the chunk, or -1 for linear index and metadata entries.
+	Offset uint64 // Virtual file offset of the entry.
+	Reason string // A description of the inconsistency.
+}
+
+func (e *IndexMismatch) Error() string {
+	if e.RefID < 0 {
+		return "boom: index mismatch: " + e.Reason
+	}
+	return fmt.Sprintf("boom: index mismatch for reference %d bin %d at offset %#x: %s", e.RefID, e.Bin, e.Offset, e.Reason)
+}
+
+// CheckIndex checks that the BAM index of the BAM file, filename, describes the file, returning
+// an *IndexMismatch describing the first inconsistency found. Each chunk of the binning index,
+// each linear index entry and the start of each reference's records are checked to point to
+// the start of a record on the expected reference and, for chunks, in the expected bin. An
+// index built for another file will typically fail these checks, rather than yielding empty
+// results from Fetch.
+func CheckIndex(filename string) error {
+	idx, err := readBAIFile(filename)
+	if err != nil {
+		return err
+	}
+	f, err := OpenBAM(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if n := f.Targets(); n != len(idx.refs) {
+		return &IndexMismatch{RefID: -1, Bin: -1, Reason: fmt.Sprintf("index describes %d references, header describes %d", len(idx.refs), n)}
+	}
+
+	r, err := NewRecord()
+	if err != nil {
+		return err
+	}
+	checked := make(map[uint64]bool)
+	check := func(tid, bin int, off uint64) error {
+		if checked[off] && bin < 0 {
+			return nil
+		}
+		mismatch := func(format string, args ...interface{}) error {
+			return &IndexMismatch{RefID: tid, Bin: bin, Offset: off, Reason: fmt.Sprintf(format, args...)}
+		}
+		if err := f.SeekVirtual(int64(off)); err != nil {
+			return mismatch("cannot seek: %v", err)
+		}
+		if _, err := f.ReadInto(r); err != nil {
+			return mismatch("no record: %v", err)
+		}
+		if r.RefID() != tid {
+			return mismatch("record %q is on reference %d", r.Name(), r.RefID())
+		}
+		if bin >= 0 && int(r.bin()) != bin {
+			return mismatch("record %q is in bin %d", r.Name(), r.bin())
+		}
+		checked[off] = true
+		return nil
+	}
+
+	for tid := range idx.refs {
+		ref := &idx.refs[tid]
+		if beg, _, ok := ref.dataRange(); ok {
+			if err := check(tid, -1, beg); err != nil {
+				return err
+			}
+		}
+		bins := make([]int, 0, len(ref.bins))
+		for b := range ref.bins {
+			if b != baiPseudoBin {
+				bins = append(bins, int(b))
+			}
+		}
+		sort.Ints(bins)
+		for _, b := range bins {
+			for _, c := range ref.bins[uint32(b)] {
+				if c.end <= c.beg {
+					return &IndexMismatch{RefID: tid, Bin: b, Offset: c.beg, Reason: fmt.Sprintf("empty chunk ending at %#x", c.end)}
+				}
+				if err := check(tid, b, c.beg); err != nil {
+					return err
+				}
+			}
+		}
+		for _, off := range ref.intervals {
+			if off == 0 {
+				continue
+			}
+			if err := check(tid, -1, off); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+	"math"
+	"sort"
+)
+
+// DefaultMaxDeviations is the default number of median absolute deviations from the median
+// insert size beyond which insert sizes are trimmed as outliers.
+const DefaultMaxDeviations = 10
+
+// InsertSizeStats holds summary statistics of the absolute template lengths of proper pairs.
+// All statistics other than Trimmed describe the insert sizes remaining after outlier trimming.
+type InsertSizeStats struct {
+	Pairs   int     // Number of pairs described.
+	Trimmed int     // Number of pairs trimmed as outliers.
+	Min     int     // Smallest insert size.
+	Max     int     // Largest insert size.
+	Mean    float64 // Mean insert size.
+	SD      float64 // Standard deviation of insert sizes.
+	Median  float64 // Median insert size.
+	MAD     float64 // Median absolute deviation of insert sizes from Median.
+
+	// Histogram holds the number of pairs with each insert size,
+	// indexed by insert size up to Max.
+	Histogram []int
+}
+
+// InsertSizes reads the remaining records from r and returns insert size statistics for proper
+// pairs. Each pair is counted once, from its record with a positive template length. Secondary,
+// supplementary, QC failed and duplicate records are ignored. Insert sizes further than
+// maxDeviations median absolute deviations from the median are trimmed before statistics are
+// calculated; if maxDeviations is not positive, DefaultMaxDeviations is used.
+func InsertSizes(r RecordReader, maxDeviations float64) (*InsertSizeStats, error) {
+	if maxDeviations <= 0 {
+		maxDeviations = DefaultMaxDeviations
+	}
+
+	counts := make(map[int]int)
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		fl := rec.Flags()
+		if fl&(Paired|ProperPair) != Paired|ProperPair ||
+			fl&(Unmapped|MateUnmapped|Secondary|Supplementary|QCFail|Duplicate) != 0 {
+			continue
+		}
+		if tlen := rec.TemplateLen(); tlen > 0 {
+			counts[tlen]++
+		}
+	}
+
+	var st InsertSizeStats
+	if len(counts) == 0 {
+		return &st, nil
+	}
+	median, mad := medianMAD(counts)
+	lo, hi := median-maxDeviations*mad, median+maxDeviations*mad
+	for s, c := range counts {
+		if float64(s) < lo || float64(s) > hi {
+			st.Trimmed += c
+			delete(counts, s)
+		}
+	}
+
+	st.Min = math.MaxInt32
+	var sum float64
+	for s, c := range counts {
+		st.Pairs += c
+		sum += float64(s) * float64(c)
+		if s < st.Min {
+			st.Min = s
+		}
+		if s > st.Max {
+			st.Max = s
+		}
+	}
+	st.Mean = sum / float64(st.Pairs)
+	var ss float64
+	st.Histogram = make([]int, st.Max+1)
+	for s, c := range counts {
+		d := float64(s) - st.Mean
+		ss += d * d * float64(c)
+		st.Histogram[s] = c
+	}
+	if st.Pairs > 1 {
+		st.SD = math.Sqrt(ss / float64(st.Pairs-1))
+	}
+	st.Median, st.MAD = medianMAD(counts)
+
+	return &st, nil
+}
+
+// medianMAD returns the median and median absolute deviation of the values held with their
+// counts in counts.
+func medianMAD(counts map[int]int) (median, mad float64) {
+	median = weightedMedian(counts)
+	dev := make(map[float64]int, len(counts))
+	for s, c := range counts {
+		dev[math.Abs(float64(s)-median)] += c
+	}
+	vals := make([]float64, 0, len(dev))
+	var n int
+	for d, c := range dev {
+		vals = append(vals, d)
+		n += c
+	}
+	sort.Float64s(vals)
+	return median, medianOf(vals, func(v float64) int { return dev[v] }, n)
+}
+
+// weightedMedian returns the median of the integer values held with their counts in counts.
+func weightedMedian(counts map[int]int) float64 {
+	vals := make([]float64, 0, len(counts))
+	var n int
+	for s, c := range counts {
+		vals = append(vals, float64(s))
+		n += c
+	}
+	sort.Float64s(vals)
+	return medianOf(vals, func(v float64) int { return counts[int(v)] }, n)
+}
+
+// medianOf returns the median of n values given the sorted distinct values, vals, and a
+// function returning the count of each value.
+func medianOf(vals []float64, count func(float64) int, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	// Find the values at ranks (n-1)/2 and n/2.
+	var (
+		seen   int
+		lo, hi float64
+		haveLo bool
+	)
+	for _, v := range vals {
+		seen += count(v)
+		if !haveLo && seen > (n-1)/2 {
+			lo, haveLo = v, true
+		}
+		if seen > n/2 {
+			hi = v
+			break
+		}
+	}
+	return (lo + hi) / 2
+}
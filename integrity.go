@@ -0,0 +1,145 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+	"io"
+	"syscall"
+
+	"github.com/biogo/boom/bgzf"
+)
+
+// maxVerifyGap is the largest distance in bytes between the last verified block and the current
+// block that is assumed to have been read sequentially rather than skipped by a seek.
+const maxVerifyGap = 1 << 24
+
+// A BlockError is the error returned when a BGZF block read from a BAM file fails an integrity
+// check. It is the bgzf package's BlockError, so corrupt blocks found by either package are
+// reported with a single type.
+type BlockError = bgzf.BlockError
+
+// SetIntegrityCheck sets whether the BGZF blocks of the BAM file, which must be open for
+// reading, are checked against the CRC32 and ISIZE fields of their gzip member as they are
+// subsequently read. When a block fails the check, the read returns a *BlockError identifying
+// the block. Checking requires each block to be read and decompressed a second time.
+func (self *BAMFile) SetIntegrityCheck(on bool) error {
+	if !on {
+		self.verify = nil
+		return nil
+	}
+	fd, err := self.bamFileno()
+	if err != nil {
+		return err
+	}
+	off, err := self.bamTell()
+	if err != nil {
+		return err
+	}
+	self.verify = &blockVerifier{fd: fd, next: off >> 16}
+	return nil
+}
+
+// A blockVerifier checks the integrity of the BGZF blocks of a file.
+type blockVerifier struct {
+	fd   int
+	next int64 // File offset of the next block to be verified.
+
+	buf  []byte
+	dec  bgzf.Decoder
+	last int64 // File offset of the last verified block.
+}
+
+// verifyBlocks checks the integrity of any blocks read since the last check.
+func (sf *samFile) verifyBlocks() error {
+	if sf.verify == nil {
+		return nil
+	}
+	off, err := sf.bamTell()
+	if err != nil {
+		return err
+	}
+	return sf.verify.upTo(off >> 16)
+}
+
+// upTo verifies the blocks from the next unverified block up to and including the block at
+// the file offset cur. If cur precedes the next unverified block or is too far beyond it, a
+// seek is assumed and only the block at cur is verified.
+func (self *blockVerifier) upTo(cur int64) error {
+	if cur == self.last && cur < self.next {
+		return nil
+	}
+	if cur < self.next || cur-self.next > maxVerifyGap {
+		self.next = cur
+	}
+	for self.next <= cur {
+		n, err := self.block(self.next)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		self.last = self.next
+		self.next += int64(n)
+	}
+	return nil
+}
+
+// block verifies the block at the file offset off, returning its length, or zero at the end
+// of the file.
+func (self *blockVerifier) block(off int64) (int, error) {
+	fail := func(format string, args ...interface{}) (int, error) {
+		return 0, &BlockError{Offset: off, Err: fmt.Errorf(format, args...)}
+	}
+
+	if self.buf == nil {
+		self.buf = make([]byte, bgzf.MaxBlockSize)
+	}
+	n, err := self.readAt(self.buf[:bgzf.HeaderLen], off)
+	switch {
+	case n == 0 && err == io.EOF:
+		return 0, nil
+	case err == io.EOF:
+		return fail("truncated header")
+	case err != nil:
+		return 0, err
+	}
+	size := bgzf.BlockSize(self.buf)
+	switch {
+	case size == 0:
+		return fail("invalid header")
+	case size < bgzf.HeaderLen+bgzf.FooterLen:
+		return fail("invalid block size %d", size)
+	}
+
+	_, err = self.readAt(self.buf[bgzf.HeaderLen:size], off+bgzf.HeaderLen)
+	switch {
+	case err == io.EOF:
+		return fail("truncated block")
+	case err != nil:
+		return 0, err
+	}
+	if _, err = self.dec.DecodeBlock(self.buf[:size]); err != nil {
+		return 0, &BlockError{Offset: off, Err: err}
+	}
+	return size, nil
+}
+
+// readAt fills b from the file offset off, returning io.EOF if the file ends before b is full.
+func (self *blockVerifier) readAt(b []byte, off int64) (int, error) {
+	var n int
+	for n < len(b) {
+		m, err := syscall.Pread(self.fd, b[n:], off+int64(n))
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.EOF
+		}
+		n += m
+	}
+	return n, nil
+}
@@ -0,0 +1,182 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+	"iter"
+)
+
+// An Overlap is a pair of records whose alignments overlap.
+type Overlap struct {
+	A, B *Record
+}
+
+// OverlapJoin returns an iterator over the pairs of mapped records from a and b whose
+// alignments overlap on the reference, for comparing the alignments of two coordinate-sorted
+// inputs that share reference sequences. Pairs are yielded in the order of the records of a
+// and, for each record of a, in the order of the overlapping records of b. Both inputs are
+// read once, and records of b are held only while they may overlap later records of a.
+// Unmapped records are ignored. If either input is not coordinate sorted, or reading fails for
+// a reason other than the end of the input, the error is yielded and iteration ends.
+func OverlapJoin(a, b RecordReader) iter.Seq2[Overlap, error] {
+	return func(yield func(Overlap, error) bool) {
+		j := joiner{b: b}
+		defer j.close()
+		for ra, err := range sortedMapped(a) {
+			var jr joinRecord
+			if err == nil {
+				jr, err = j.advance(ra)
+			}
+			if err != nil {
+				yield(Overlap{}, err)
+				return
+			}
+			for _, rb := range j.overlapping(jr) {
+				if !yield(Overlap{A: ra, B: rb.r}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// OverlapFilter returns an iterator over the mapped records of a that overlap at least one
+// mapped record of b, with the requirements and behaviour described for OverlapJoin. It may
+// be used to restrict the records of a to the regions covered by a companion dataset.
+func OverlapFilter(a, b RecordReader) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		j := joiner{b: b}
+		defer j.close()
+		for ra, err := range sortedMapped(a) {
+			var jr joinRecord
+			if err == nil {
+				jr, err = j.advance(ra)
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if len(j.overlapping(jr)) != 0 && !yield(ra, nil) {
+				return
+			}
+		}
+	}
+}
+
+// A joinRecord is a record held by a joiner with its reference interval.
+type joinRecord struct {
+	r        *Record
+	tid      int
+	beg, end int
+}
+
+func newJoinRecord(r *Record) joinRecord {
+	beg := r.Start()
+	return joinRecord{r: r, tid: r.RefID(), beg: beg, end: max(beg+refLen(r.Cigar()), beg+1)}
+}
+
+// A joiner holds the records of the b input of a join that may overlap subsequent records of
+// the a input.
+type joiner struct {
+	b      RecordReader
+	pull   func() (*Record, error, bool)
+	stop   func()
+	ahead  *joinRecord
+	done   bool
+	active []joinRecord
+	hits   []joinRecord
+}
+
+// advance reads records of b that start before the end of ra and drops held records that end
+// before the start of ra. It returns ra with its reference interval.
+func (self *joiner) advance(ra *Record) (joinRecord, error) {
+	a := newJoinRecord(ra)
+	if self.pull == nil {
+		self.pull, self.stop = iter.Pull2(sortedMapped(self.b))
+	}
+	for !self.done {
+		if self.ahead == nil {
+			r, err, ok := self.pull()
+			if !ok {
+				self.done = true
+				break
+			}
+			if err != nil {
+				self.done = true
+				return a, err
+			}
+			jr := newJoinRecord(r)
+			self.ahead = &jr
+		}
+		if self.ahead.tid > a.tid || (self.ahead.tid == a.tid && self.ahead.beg >= a.end) {
+			break
+		}
+		self.active = append(self.active, *self.ahead)
+		self.ahead = nil
+	}
+
+	n := 0
+	for _, b := range self.active {
+		if b.tid == a.tid && b.end > a.beg {
+			self.active[n] = b
+			n++
+		}
+	}
+	clear(self.active[n:])
+	self.active = self.active[:n]
+	return a, nil
+}
+
+// overlapping returns the held records overlapping a. The returned slice is reused by
+// subsequent calls.
+func (self *joiner) overlapping(a joinRecord) []joinRecord {
+	self.hits = self.hits[:0]
+	for _, b := range self.active {
+		if b.beg < a.end && a.beg < b.end {
+			self.hits = append(self.hits, b)
+		}
+	}
+	return self.hits
+}
+
+// close stops reading from b.
+func (self *joiner) close() {
+	if self.stop != nil {
+		self.stop()
+	}
+}
+
+// sortedMapped returns an iterator over the mapped records of r, yielding an error if r is not
+// coordinate sorted. Iteration ends at the first unplaced record.
+func sortedMapped(r RecordReader) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		lastTid, lastPos := 0, -1
+		for {
+			rec, _, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					yield(nil, err)
+				}
+				return
+			}
+			tid, pos := rec.RefID(), rec.Start()
+			if tid < 0 {
+				return
+			}
+			if tid < lastTid || (tid == lastTid && pos < lastPos) {
+				yield(nil, notSorted)
+				return
+			}
+			lastTid, lastPos = tid, pos
+			if rec.Flags()&Unmapped != 0 {
+				continue
+			}
+			if !yield(rec, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A Junction is a splice junction inferred from CigarSkipped operations. Start and End give
+// the half-open reference interval of the intron, so Start is the first intronic base after the
+// donor exon and End is the first base of the acceptor exon on the forward strand.
+type Junction struct {
+	RefID      int
+	Start, End int
+	Strand     int8 // Strand from the XS tag: 1, -1 or 0 if unknown.
+
+	Reads       int // Number of alignments spanning the junction.
+	MaxOverhang int // Largest shorter-side anchor among the spanning alignments.
+}
+
+type junctionKey struct {
+	tid, beg, end int
+	strand        int8
+}
+
+// Junctions reads the remaining records from r and returns the splice junctions spanned by
+// the records retained by keep, sorted by reference, position and strand. If keep is nil,
+// unmapped, secondary, supplementary, QC failed and duplicate records are ignored.
+func Junctions(r RecordReader, keep RecordFilter) ([]Junction, error) {
+	if keep == nil {
+		keep = func(r *Record) bool {
+			return r.Flags()&(Unmapped|Secondary|Supplementary|QCFail|Duplicate) == 0
+		}
+	}
+
+	juncs := make(map[junctionKey]*Junction)
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if rec.Flags()&Unmapped != 0 || !keep(rec) {
+			continue
+		}
+		cigar := rec.Cigar()
+		if !hasSkip(cigar) {
+			continue
+		}
+		var strand int8
+		if xs, ok := rec.Tag([]byte("XS")); ok && xs.Type() == 'A' {
+			switch xs.Value().(byte) {
+			case '+':
+				strand = 1
+			case '-':
+				strand = -1
+			}
+		}
+
+		total := 0
+		for _, co := range cigar {
+			if isAligned(co.Type()) {
+				total += co.Len()
+			}
+		}
+		pos, left := rec.Start(), 0
+		for _, co := range cigar {
+			switch t := co.Type(); {
+			case isAligned(t):
+				pos += co.Len()
+				left += co.Len()
+			case t == CigarDeletion:
+				pos += co.Len()
+			case t == CigarSkipped:
+				k := junctionKey{tid: rec.RefID(), beg: pos, end: pos + co.Len(), strand: strand}
+				j, ok := juncs[k]
+				if !ok {
+					j = &Junction{RefID: k.tid, Start: k.beg, End: k.end, Strand: strand}
+					juncs[k] = j
+				}
+				j.Reads++
+				if o := min(left, total-left); o > j.MaxOverhang {
+					j.MaxOverhang = o
+				}
+				pos += co.Len()
+			}
+		}
+	}
+
+	js := make([]Junction, 0, len(juncs))
+	for _, j := range juncs {
+		js = append(js, *j)
+	}
+	sort.Slice(js, func(i, j int) bool {
+		a, b := js[i], js[j]
+		if a.RefID != b.RefID {
+			return a.RefID < b.RefID
+		}
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		if a.End != b.End {
+			return a.End < b.End
+		}
+		return a.Strand < b.Strand
+	})
+	return js, nil
+}
+
+func hasSkip(cigar []CigarOp) bool {
+	for _, co := range cigar {
+		if co.Type() == CigarSkipped {
+			return true
+		}
+	}
+	return false
+}
+
+func isAligned(t CigarOpType) bool {
+	return t == CigarMatch || t == CigarEqual || t == CigarMismatch
+}
+
+// WriteJunctions writes the junctions, js, to w as a tab-delimited table with the columns
+// reference name, first and last intronic bases (one-based), strand, supporting reads and
+// maximum overhang. Reference names are taken from names.
+func WriteJunctions(w io.Writer, names []string, js []Junction) error {
+	bw := bufio.NewWriter(w)
+	for _, j := range js {
+		strand := "."
+		switch j.Strand {
+		case 1:
+			strand = "+"
+		case -1:
+			strand = "-"
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%s\t%d\t%d\n", names[j.RefID], j.Start+1, j.End, strand, j.Reads, j.MaxOverhang)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,201 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Lane identifies a sequencing lane. Lane is zero if the lane of a record could not be
+// determined.
+type Lane struct {
+	Flowcell string
+	Lane     int
+}
+
+func (l Lane) String() string { return fmt.Sprintf("%s:%d", l.Flowcell, l.Lane) }
+
+// LaneStats holds counts of primary records and their bases for a lane or flowcell.
+type LaneStats struct {
+	Records    int // Primary records counted.
+	Mapped     int // Mapped primary records.
+	Duplicates int // Primary records flagged as duplicates.
+	QCFail     int // Primary records flagged as QCFail.
+
+	// Bases is the number of bases with an available quality
+	// score, QualSum is the sum of those scores and Q30 is the
+	// number with a score of at least 30.
+	Bases   int64
+	QualSum int64
+	Q30     int64
+}
+
+// Add includes the record r in the statistics if it is a primary record.
+func (self *LaneStats) Add(r *Record) {
+	fl := r.Flags()
+	if fl&(Secondary|Supplementary) != 0 {
+		return
+	}
+	self.Records++
+	if fl&Unmapped == 0 {
+		self.Mapped++
+	}
+	if fl&Duplicate != 0 {
+		self.Duplicates++
+	}
+	if fl&QCFail != 0 {
+		self.QCFail++
+	}
+	for _, q := range r.Quality() {
+		if q == 0xff {
+			break
+		}
+		self.Bases++
+		self.QualSum += int64(q)
+		if q >= 30 {
+			self.Q30++
+		}
+	}
+}
+
+func (self *LaneStats) merge(o *LaneStats) {
+	self.Records += o.Records
+	self.Mapped += o.Mapped
+	self.Duplicates += o.Duplicates
+	self.QCFail += o.QCFail
+	self.Bases += o.Bases
+	self.QualSum += o.QualSum
+	self.Q30 += o.Q30
+}
+
+// MappedFraction returns the fraction of primary records that are mapped.
+func (self *LaneStats) MappedFraction() float64 { return frac(self.Mapped, self.Records) }
+
+// DuplicateFraction returns the fraction of primary records flagged as duplicates.
+func (self *LaneStats) DuplicateFraction() float64 { return frac(self.Duplicates, self.Records) }
+
+// MeanQuality returns the mean base quality of bases with an available quality score.
+func (self *LaneStats) MeanQuality() float64 {
+	if self.Bases == 0 {
+		return 0
+	}
+	return float64(self.QualSum) / float64(self.Bases)
+}
+
+// FractionQ30 returns the fraction of bases with a quality score of at least 30.
+func (self *LaneStats) FractionQ30() float64 {
+	if self.Bases == 0 {
+		return 0
+	}
+	return float64(self.Q30) / float64(self.Bases)
+}
+
+func frac(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// LaneReport holds LaneStats for each lane seen in a set of records.
+type LaneReport struct {
+	Lanes map[Lane]*LaneStats
+
+	pu map[string]Lane
+}
+
+// NewLaneReport returns a LaneReport for records described by h. The lane of a record is
+// obtained from its Illumina read name or, if the name does not hold a flowcell, from the PU
+// field of its read group, interpreted as flowcell.lane[.barcode].
+func NewLaneReport(h *Header) *LaneReport {
+	lr := &LaneReport{Lanes: make(map[Lane]*LaneStats), pu: make(map[string]Lane)}
+	if h == nil {
+		return lr
+	}
+	for rg, pu := range h.readGroupField("PU") {
+		f := strings.SplitN(pu, ".", 3)
+		l := Lane{Flowcell: f[0]}
+		if len(f) > 1 {
+			l.Lane, _ = strconv.Atoi(f[1])
+		}
+		lr.pu[rg] = l
+	}
+	return lr
+}
+
+// LaneOf returns the lane of the record r.
+func (self *LaneReport) LaneOf(r *Record) Lane {
+	n, err := ParseIlluminaName(r.Name())
+	if err == nil && n.Flowcell != "" {
+		return Lane{Flowcell: n.Flowcell, Lane: n.Lane}
+	}
+	rg, _ := ReadGroupKey(r)
+	l, ok := self.pu[rg]
+	if err == nil && (!ok || l.Lane == 0) {
+		l.Lane = n.Lane
+	}
+	return l
+}
+
+// Add includes the record r in the statistics for its lane.
+func (self *LaneReport) Add(r *Record) {
+	l := self.LaneOf(r)
+	st, ok := self.Lanes[l]
+	if !ok {
+		st = &LaneStats{}
+		self.Lanes[l] = st
+	}
+	st.Add(r)
+}
+
+// Sorted returns the lanes held by the report sorted by flowcell and lane.
+func (self *LaneReport) Sorted() []Lane {
+	ls := make([]Lane, 0, len(self.Lanes))
+	for l := range self.Lanes {
+		ls = append(ls, l)
+	}
+	sort.Slice(ls, func(i, j int) bool {
+		if ls[i].Flowcell != ls[j].Flowcell {
+			return ls[i].Flowcell < ls[j].Flowcell
+		}
+		return ls[i].Lane < ls[j].Lane
+	})
+	return ls
+}
+
+// Flowcells returns the statistics of the report summed over the lanes of each flowcell.
+func (self *LaneReport) Flowcells() map[string]*LaneStats {
+	m := make(map[string]*LaneStats)
+	for l, st := range self.Lanes {
+		fc, ok := m[l.Flowcell]
+		if !ok {
+			fc = &LaneStats{}
+			m[l.Flowcell] = fc
+		}
+		fc.merge(st)
+	}
+	return m
+}
+
+// LaneStatistics reads the remaining records from r, described by h, and returns their
+// per-lane statistics.
+func LaneStatistics(r RecordReader, h *Header) (*LaneReport, error) {
+	lr := NewLaneReport(h)
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		lr.Add(rec)
+	}
+	return lr, nil
+}
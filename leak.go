@@ -0,0 +1,87 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// A Leak describes a SAM or BAM file that became unreachable without being closed.
+type Leak struct {
+	// Name is the name of the file, or a description of the
+	// file descriptor for files opened from an *os.File.
+	Name string
+
+	// Stack is the stack trace of the goroutine that opened
+	// the file, at the time it was opened.
+	Stack string
+}
+
+// String returns a description of the Leak including the stack trace.
+func (self Leak) String() string {
+	return fmt.Sprintf("boom: %s finalized without Close, opened at:\n%s", self.Name, self.Stack)
+}
+
+var leaks struct {
+	enabled atomic.Bool
+
+	sync.Mutex
+	handler func(Leak)
+}
+
+// TrackOpenFiles enables or disables recording of the stack traces at which SAM and BAM
+// files are opened or created, returning the previous setting. Files opened while tracking
+// is enabled that are finalized by the garbage collector without having been closed are
+// reported to the leak handler. Recording a stack trace is expensive, so tracking is
+// intended for debugging file descriptor leaks and is disabled by default.
+func TrackOpenFiles(on bool) (was bool) {
+	return leaks.enabled.Swap(on)
+}
+
+// SetLeakHandler sets the function called, on the finalizer goroutine, for each leaked file
+// detected when TrackOpenFiles is enabled. A nil handler restores the default, which writes
+// the Leak to os.Stderr.
+func SetLeakHandler(fn func(Leak)) {
+	leaks.Lock()
+	leaks.handler = fn
+	leaks.Unlock()
+}
+
+// trackOpen records the name and opening stack of sf if tracking is enabled.
+func (sf *samFile) trackOpen(name string) {
+	if !leaks.enabled.Load() || sf.fp == nil {
+		return
+	}
+	buf := make([]byte, 4096)
+	for {
+		n := runtime.Stack(buf, false)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	sf.opened = &Leak{Name: name, Stack: string(buf)}
+}
+
+// finalize is the finalizer of a samFile, reporting the file as leaked if it was tracked
+// before closing it.
+func (sf *samFile) finalize() {
+	if sf.fp != nil && sf.opened != nil {
+		leaks.Lock()
+		fn := leaks.handler
+		leaks.Unlock()
+		if fn == nil {
+			fmt.Fprintln(os.Stderr, sf.opened)
+		} else {
+			fn(*sf.opened)
+		}
+	}
+	sf.samClose()
+}
@@ -0,0 +1,124 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+)
+
+// MapQUnavailable is the mapping quality indicating that no mapping quality is available.
+const MapQUnavailable = 255
+
+// MapQStats holds the distribution of mapping qualities of mapped primary records and counts of
+// records identified as multi-mapping by their NH, AS and XS tags.
+type MapQStats struct {
+	Records int // Mapped primary records counted.
+
+	// Histogram holds the number of records with each mapping
+	// quality, indexed by mapping quality.
+	Histogram [256]int
+
+	// Tagged is the number of records carrying tags from which
+	// multi-mapping can be determined; either NH, or both AS and
+	// XS. MultiMapped is the number of those records with an NH
+	// greater than one or, without NH, an XS score at least as
+	// large as their AS score.
+	Tagged      int
+	MultiMapped int
+}
+
+// Add includes the record r in the statistics if it is a mapped primary record.
+func (self *MapQStats) Add(r *Record) {
+	if r.Flags()&(Unmapped|Secondary|Supplementary) != 0 {
+		return
+	}
+	self.Records++
+	self.Histogram[r.Score()]++
+
+	if nh, ok := r.HitCount(); ok {
+		self.Tagged++
+		if nh > 1 {
+			self.MultiMapped++
+		}
+		return
+	}
+	as, ok := intTag(r, "AS")
+	if !ok {
+		return
+	}
+	xs, ok := intTag(r, "XS")
+	if !ok {
+		return
+	}
+	self.Tagged++
+	if xs >= as {
+		self.MultiMapped++
+	}
+}
+
+// intTag returns the value of the integer tag t of r and whether it was found.
+func intTag(r *Record, t string) (int64, bool) {
+	a, ok := r.Tag([]byte(t))
+	if !ok {
+		return 0, false
+	}
+	return a.intValue()
+}
+
+// Mean returns the mean mapping quality of records with an available mapping quality.
+func (self *MapQStats) Mean() float64 {
+	var n, sum int
+	for q, c := range self.Histogram[:MapQUnavailable] {
+		n += c
+		sum += q * c
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(sum) / float64(n)
+}
+
+// AtLeast returns the number of records with an available mapping quality of at least q.
+func (self *MapQStats) AtLeast(q byte) int {
+	var n int
+	for _, c := range self.Histogram[q:MapQUnavailable] {
+		n += c
+	}
+	return n
+}
+
+// FractionZero returns the fraction of records with a mapping quality of zero.
+func (self *MapQStats) FractionZero() float64 {
+	if self.Records == 0 {
+		return 0
+	}
+	return float64(self.Histogram[0]) / float64(self.Records)
+}
+
+// FractionMultiMapped returns the fraction of records carrying multi-mapping tags that are
+// multi-mapping.
+func (self *MapQStats) FractionMultiMapped() float64 {
+	if self.Tagged == 0 {
+		return 0
+	}
+	return float64(self.MultiMapped) / float64(self.Tagged)
+}
+
+// MapQualities reads the remaining records from r and returns the distribution of mapping
+// qualities of mapped primary records.
+func MapQualities(r RecordReader) (*MapQStats, error) {
+	var st MapQStats
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		st.Add(rec)
+	}
+	return &st, nil
+}
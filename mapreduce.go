@@ -0,0 +1,129 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+	"runtime"
+	"sync"
+)
+
+// A MapFn is called by MapReduce for each shard with a RecordReader over the records of the
+// shard. The returned value is passed to the ReduceFn.
+type MapFn func(shard []Region, r RecordReader) (interface{}, error)
+
+// A ReduceFn combines an accumulated value, acc, with the result of a MapFn, v, returning the
+// new accumulated value. The first call to a ReduceFn is passed a nil acc.
+type ReduceFn func(acc, v interface{}) interface{}
+
+// MapReduce calls mapFn concurrently for each of the shards of the indexed BAM file, filename,
+// using at most threads goroutines, each with its own file handle and index. If threads is less
+// than one, runtime.GOMAXPROCS(0) goroutines are used. If shards is nil, the file is divided
+// into threads shards by PlanShards. The results of mapFn are combined by reduce in shard order,
+// and the final accumulated value is returned. A record is read only by the region containing
+// its start position, so records spanning region boundaries are seen exactly once; records
+// without a reference position are not read. If any call to mapFn returns an error, the
+// error of the first failing shard is returned.
+func MapReduce(filename string, shards [][]Region, threads int, mapFn MapFn, reduce ReduceFn) (interface{}, error) {
+	if threads < 1 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+	if shards == nil {
+		var err error
+		shards, err = PlanShards(filename, threads, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		vals = make([]interface{}, len(shards))
+		errs = make([]error, len(shards))
+
+		wg   sync.WaitGroup
+		work = make(chan int)
+	)
+	for i := 0; i < threads && i < len(shards); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range work {
+				vals[s], errs[s] = mapShard(filename, shards[s], mapFn)
+			}
+		}()
+	}
+	for s := range shards {
+		work <- s
+	}
+	close(work)
+	wg.Wait()
+
+	var acc interface{}
+	for s, v := range vals {
+		if errs[s] != nil {
+			return nil, errs[s]
+		}
+		acc = reduce(acc, v)
+	}
+	return acc, nil
+}
+
+// mapShard calls fn for the regions, regs, of the BAM file, filename, using a newly opened
+// file handle and index.
+func mapShard(filename string, regs []Region, fn MapFn) (interface{}, error) {
+	f, err := OpenBAM(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	idx, err := LoadIndex(filename)
+	if err != nil {
+		return nil, err
+	}
+	sr := &shardReader{f: f, idx: idx, regs: regs}
+	defer sr.close()
+
+	return fn(regs, sr)
+}
+
+// A shardReader reads the records starting within each of a list of regions in turn.
+type shardReader struct {
+	f    *BAMFile
+	idx  *Index
+	regs []Region
+	cur  Region
+	it   *Iterator
+}
+
+func (self *shardReader) Read() (r *Record, n int, err error) {
+	for {
+		if self.it == nil {
+			if len(self.regs) == 0 {
+				return nil, 0, io.EOF
+			}
+			self.cur, self.regs = self.regs[0], self.regs[1:]
+			self.it, err = self.f.Query(self.idx, self.cur.RefID, self.cur.Start, self.cur.End)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		r, n, err = self.it.Read()
+		if err == io.EOF {
+			self.close()
+			continue
+		}
+		if err != nil || r.Start() >= self.cur.Start {
+			return r, n, err
+		}
+	}
+}
+
+// close releases the current Iterator.
+func (self *shardReader) close() {
+	if self.it != nil {
+		self.it.Close()
+		self.it = nil
+	}
+}
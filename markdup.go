@@ -0,0 +1,677 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"container/heap"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	noMateTags   = errors.New("boom: paired record missing MC or ms tag: run FixMates first")
+	badDupWindow = errors.New("boom: duplicate window must not be negative")
+)
+
+// DefaultOpticalDistance is the default maximum pixel distance between two duplicate reads for
+// them to be classified as optical duplicates.
+const DefaultOpticalDistance = 100
+
+// MarkDupOptions specifies the behaviour of MarkDuplicates.
+type MarkDupOptions struct {
+	// Remove specifies that duplicates are omitted from the output
+	// rather than flagged.
+	Remove bool
+
+	// OpticalDistance is the maximum distance in pixels between the
+	// cluster coordinates of two duplicates on the same tile for them to
+	// be classified as optical duplicates. If OpticalDistance is zero,
+	// DefaultOpticalDistance is used. If it is negative, optical duplicates
+	// are not identified.
+	OpticalDistance int
+
+	// BinSize is the width of the bins in which duplicate rates
+	// are recorded in the Bins field of the returned metrics. If
+	// BinSize is zero, duplicate rates are not binned.
+	BinSize int
+
+	// Window is the maximum distance between the unclipped 5'
+	// ends, and between the unclipped 3' ends, of unpaired reads
+	// for them to be considered duplicates. It is intended for
+	// long reads, where PCR duplicates rarely share exact
+	// alignment ends. Reads are grouped with the first read, in
+	// order of 5' position, of a group whose ends they lie within
+	// Window of. If Window is zero, unpaired reads are duplicates
+	// only if their unclipped 5' ends are identical.
+	Window int
+}
+
+// DuplicateMetrics holds the summary of a duplicate marking run. Optical duplicates are
+// included in the duplicate counts; PCRDuplicates returns the remainder.
+type DuplicateMetrics struct {
+	UnpairedExamined   int // Mapped primary records examined without a mapped mate.
+	PairsExamined      int // Mapped primary read pairs examined.
+	Unmapped           int // Unmapped primary records.
+	UnpairedDuplicates int // Unpaired records marked as duplicates.
+	PairDuplicates     int // Read pairs marked as duplicates.
+	UnpairedOptical    int // Unpaired duplicates classified as optical duplicates.
+	PairOptical        int // Duplicate read pairs classified as optical duplicates.
+
+	// ByReadGroup and ByLibrary hold the metrics for each read
+	// group and library. Records without a read group, or whose
+	// read group has no library, are keyed by the empty string.
+	ByReadGroup map[string]*DuplicateMetrics
+	ByLibrary   map[string]*DuplicateMetrics
+
+	// Bins holds the duplicate rates in bins along the reference
+	// sequences if a BinSize was specified.
+	Bins *DuplicateBins
+}
+
+// with returns the metrics to be updated for a record in the read group rg of the library lib;
+// the overall metrics and those of the read group and library.
+func (self *DuplicateMetrics) with(rg, lib string) [3]*DuplicateMetrics {
+	get := func(m map[string]*DuplicateMetrics, k string) *DuplicateMetrics {
+		g, ok := m[k]
+		if !ok {
+			g = &DuplicateMetrics{}
+			m[k] = g
+		}
+		return g
+	}
+	if self.ByReadGroup == nil {
+		self.ByReadGroup = make(map[string]*DuplicateMetrics)
+		self.ByLibrary = make(map[string]*DuplicateMetrics)
+	}
+	return [3]*DuplicateMetrics{self, get(self.ByReadGroup, rg), get(self.ByLibrary, lib)}
+}
+
+// PCRDuplicates returns the number of unpaired and paired duplicates that are not optical
+// duplicates.
+func (self *DuplicateMetrics) PCRDuplicates() (unpaired, pairs int) {
+	return self.UnpairedDuplicates - self.UnpairedOptical, self.PairDuplicates - self.PairOptical
+}
+
+// Duplication returns the fraction of examined reads that are duplicates.
+func (self *DuplicateMetrics) Duplication() float64 {
+	n := self.UnpairedExamined + 2*self.PairsExamined
+	if n == 0 {
+		return 0
+	}
+	return float64(self.UnpairedDuplicates+2*self.PairDuplicates) / float64(n)
+}
+
+// MarkDuplicates reads the coordinate-sorted BAM file, in, and writes its records to out with
+// PCR and optical duplicates flagged, returning a summary of duplication. Records are grouped by
+// library and the unclipped 5' positions and strands of the read and, for pairs, its mate.
+// The record or pair with the highest sum of base qualities of at least 15 is retained in each
+// group, and unpaired reads at the position of a paired read are marked as duplicates. Paired
+// records must carry the MC and ms tags added by FixMates. If opts is nil, duplicates are
+// flagged and optical duplicates identified using DefaultOpticalDistance. The returned metrics
+// are also broken down by read group and library.
+//
+// The input is read once. A group is resolved, and its records written, when the sort position
+// has passed its 5' position by more than the length of the longest read seen, so only records
+// near the sort position and the names of pairs whose second record has not yet been read are
+// held in memory. Reads clipped by more than the length of every earlier read may not be grouped
+// with reads that have already been written.
+func MarkDuplicates(in, out string, opts *MarkDupOptions) (*DuplicateMetrics, error) {
+	var o MarkDupOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.OpticalDistance == 0 {
+		o.OpticalDistance = DefaultOpticalDistance
+	}
+	if o.BinSize < 0 {
+		return nil, badBinSize
+	}
+	if o.Window < 0 {
+		return nil, badDupWindow
+	}
+
+	f, err := OpenBAM(in)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := f.Header()
+	bf, err := CreateBAM(out, h, true)
+	if err != nil {
+		return nil, err
+	}
+	d := &dupMarker{
+		o:      o,
+		libs:   h.readGroupField("LB"),
+		groups: make(map[dupKey]*dupGroup),
+		ends:   make(map[dupKey]bool),
+		mates:  make(map[string]*dupState),
+	}
+	if o.BinSize > 0 {
+		d.m.Bins = newDuplicateBins(h, o.BinSize)
+	}
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			bf.Close()
+			return nil, err
+		}
+		err = d.add(r)
+		if err == nil {
+			err = d.flush(bf)
+		}
+		if err != nil {
+			bf.Close()
+			return nil, err
+		}
+	}
+	d.tid = math.MaxInt
+	d.retire()
+	err = d.flush(bf)
+	if err != nil {
+		bf.Close()
+		return nil, err
+	}
+
+	return &d.m, bf.Close()
+}
+
+// A dupMarker identifies duplicates in a stream of coordinate-sorted records.
+type dupMarker struct {
+	o    MarkDupOptions
+	libs map[string]string
+	m    DuplicateMetrics
+
+	// tid and pos are the current sort position, with unmapped
+	// records placed after all references, and span is the length
+	// of the longest read seen, including clipped bases.
+	tid, pos int
+	span     int
+
+	// queue holds the records read but not yet written, in input order.
+	queue []dupRecord
+
+	// groups holds the groups that may still gain entries, and pending
+	// orders them by the 5' position after which they are complete.
+	groups  map[dupKey]*dupGroup
+	pending dupHeap[*dupGroup]
+
+	// fuzzy holds the unpaired entries awaiting grouping within the
+	// window in order of their ends, and open holds the keys of the
+	// groups that they may join.
+	fuzzy dupHeap[*dupEntry]
+	open  []dupKey
+
+	// ends holds the keys of the ends of paired records that may share
+	// the position of an incomplete unpaired group, ordered by endq.
+	ends map[dupKey]bool
+	endq dupHeap[dupKey]
+
+	// mates holds the state of pairs whose second record has
+	// not been read, keyed by read name.
+	mates map[string]*dupState
+}
+
+// A dupState holds the duplicate status of a record or pair.
+type dupState struct {
+	decided bool
+	dup     bool
+}
+
+// A dupRecord is a record awaiting output. Records not examined for duplication have a nil state.
+type dupRecord struct {
+	r     *Record
+	state *dupState
+}
+
+// A dupGroup holds the entries sharing a dupKey. No entry may join the group once the sort
+// position has passed done.
+type dupGroup struct {
+	key     dupKey
+	done    int
+	entries []*dupEntry
+}
+
+// add adds r to the queue of records, grouping it for duplicate detection if it is a mapped primary
+// record, and resolves the groups that are complete at the position of r.
+func (self *dupMarker) add(r *Record) error {
+	tid, pos := r.RefID(), r.Start()
+	if tid < 0 {
+		tid = math.MaxInt
+	}
+	if tid < self.tid || (tid == self.tid && pos < self.pos) {
+		return notSorted
+	}
+	self.tid, self.pos = tid, pos
+
+	fl := r.Flags()
+	if fl&(Secondary|Supplementary|Unmapped) != 0 {
+		if fl&(Secondary|Supplementary) == 0 {
+			rg, _ := ReadGroupKey(r)
+			for _, g := range self.m.with(rg, self.libs[rg]) {
+				g.Unmapped++
+			}
+		}
+		self.retire()
+		self.queue = append(self.queue, dupRecord{r: r})
+		return nil
+	}
+	self.span = max(self.span, readLen(r.Cigar()))
+	self.retire()
+
+	e, err := newDupEntry(r, self.libs)
+	if err != nil {
+		return err
+	}
+	if e.key.paired {
+		if !self.ends[e.end] {
+			self.ends[e.end] = true
+			heap.Push(&self.endq, dupItem[dupKey]{tid: e.end.tid1, pos: e.end.pos1, v: e.end})
+		}
+		// The second record of a pair takes the status
+		// decided for the pair by the group of the first.
+		if s, ok := self.mates[e.name]; ok {
+			delete(self.mates, e.name)
+			self.queue = append(self.queue, dupRecord{r: r, state: s})
+			return nil
+		}
+	}
+	e.state = &dupState{}
+	self.queue = append(self.queue, dupRecord{r: r, state: e.state})
+	for _, g := range self.m.with(e.rg, e.key.lib) {
+		if e.key.paired {
+			g.PairsExamined++
+		} else {
+			g.UnpairedExamined++
+		}
+	}
+	if e.key.paired {
+		self.mates[e.name] = e.state
+	} else if self.o.Window > 0 {
+		heap.Push(&self.fuzzy, dupItem[*dupEntry]{tid: e.key.tid1, pos: e.key.pos1, sub: e.pos3, v: e})
+		return nil
+	}
+	g := self.group(e.key, 0)
+	g.entries = append(g.entries, e)
+	return nil
+}
+
+// group returns the group for the key k, creating it if necessary. The group is complete once
+// the sort position has passed w beyond the 5' position of k.
+func (self *dupMarker) group(k dupKey, w int) *dupGroup {
+	g, ok := self.groups[k]
+	if !ok {
+		g = &dupGroup{key: k, done: k.pos1 + w}
+		self.groups[k] = g
+		heap.Push(&self.pending, dupItem[*dupGroup]{tid: k.tid1, pos: g.done, v: g})
+	}
+	return g
+}
+
+// retire groups the unpaired entries and resolves the groups that can no longer gain entries at
+// the current sort position, and discards the ends that are no longer needed.
+func (self *dupMarker) retire() {
+	passed := func(tid, pos int) bool {
+		return tid < self.tid || (tid == self.tid && pos < self.pos-self.span)
+	}
+	for len(self.fuzzy) != 0 && passed(self.fuzzy[0].tid, self.fuzzy[0].pos) {
+		self.cluster(heap.Pop(&self.fuzzy).(dupItem[*dupEntry]).v)
+	}
+	for len(self.pending) != 0 && passed(self.pending[0].tid, self.pending[0].pos) {
+		g := heap.Pop(&self.pending).(dupItem[*dupGroup]).v
+		delete(self.groups, g.key)
+		self.resolve(g)
+	}
+	for len(self.endq) != 0 && passed(self.endq[0].tid, self.endq[0].pos+self.o.Window) {
+		delete(self.ends, heap.Pop(&self.endq).(dupItem[dupKey]).v)
+	}
+}
+
+// cluster adds the unpaired entry e, taken in order of 5' and then 3' position, to the group of
+// the first open key of its library, reference and strand whose 5' and 3' ends each lie within
+// the window of its own. Entries not within the window of an open key start a new group.
+func (self *dupMarker) cluster(e *dupEntry) {
+	w := self.o.Window
+	k := e.key
+	k.pos2 = e.pos3
+
+	n := 0
+	for _, a := range self.open {
+		if a.tid1 == k.tid1 && k.pos1-a.pos1 <= w {
+			self.open[n] = a
+			n++
+		}
+	}
+	self.open = self.open[:n]
+
+	for _, a := range self.open {
+		if a.lib == k.lib && a.rev1 == k.rev1 && abs(a.pos2-k.pos2) <= w {
+			k = a
+			break
+		}
+	}
+	e.key = k
+	g := self.group(k, w)
+	if len(g.entries) == 0 {
+		self.open = append(self.open, k)
+	}
+	g.entries = append(g.entries, e)
+}
+
+// resolve marks all entries of the complete group g other than the best as duplicates, and
+// records them in the metrics.
+func (self *dupMarker) resolve(g *dupGroup) {
+	var best *dupEntry
+	for _, e := range g.entries {
+		if best == nil || e.score > best.score || (e.score == best.score && e.name < best.name) {
+			best = e
+		}
+	}
+	if !g.key.paired && self.ends[g.key.end()] {
+		best = nil
+	}
+	var grid *opticalGrid
+	if self.o.OpticalDistance >= 0 && len(g.entries) > 1 {
+		grid = newOpticalGrid(g.entries, self.o.OpticalDistance)
+	}
+	for i, e := range g.entries {
+		e.state.decided = true
+		if e == best {
+			continue
+		}
+		e.state.dup = true
+		optical := grid != nil && grid.near(i)
+		for _, d := range self.m.with(e.rg, g.key.lib) {
+			if g.key.paired {
+				d.PairDuplicates++
+				if optical {
+					d.PairOptical++
+				}
+			} else {
+				d.UnpairedDuplicates++
+				if optical {
+					d.UnpairedOptical++
+				}
+			}
+		}
+	}
+}
+
+// flush writes the records at the head of the queue whose duplicate status is known to bf.
+func (self *dupMarker) flush(bf *BAMFile) error {
+	var n int
+	for _, q := range self.queue {
+		if q.state != nil && !q.state.decided {
+			break
+		}
+		r := q.r
+		if q.state != nil {
+			if fl := r.Flags(); q.state.dup {
+				r.SetFlags(fl | Duplicate)
+			} else {
+				r.SetFlags(fl &^ Duplicate)
+			}
+		}
+		if self.m.Bins != nil {
+			self.m.Bins.add(r)
+		}
+		n++
+		if self.o.Remove && q.state != nil && q.state.dup {
+			continue
+		}
+		c, err := bf.Write(r)
+		if err == nil && c < 0 {
+			err = writeFailed
+		}
+		if err != nil {
+			return err
+		}
+	}
+	clear(self.queue[:n])
+	self.queue = self.queue[n:]
+	return nil
+}
+
+// A dupKey identifies a set of potential duplicates. For unpaired reads only the first end is used,
+// except when grouping within a window, when pos2 holds the 3' end of the first read of the group.
+type dupKey struct {
+	lib    string
+	paired bool
+
+	tid1, pos1 int
+	rev1       bool
+	tid2, pos2 int
+	rev2       bool
+}
+
+// end returns the key of an unpaired read at the first end of the key.
+func (k dupKey) end() dupKey {
+	return dupKey{lib: k.lib, tid1: k.tid1, pos1: k.pos1, rev1: k.rev1}
+}
+
+// A dupEntry holds the information used for duplicate detection for a single record or pair.
+type dupEntry struct {
+	state *dupState
+	rg    string
+	key   dupKey
+	end   dupKey // Key of the record's own end.
+	pos3  int    // Unclipped 3' position of the record.
+	name  string
+	score int
+}
+
+func newDupEntry(r *Record, libs map[string]string) (*dupEntry, error) {
+	rg, _ := ReadGroupKey(r)
+	lib := libs[rg]
+	fl := r.Flags()
+	e := &dupEntry{
+		rg:    rg,
+		name:  r.Name(),
+		score: mateScore(r),
+	}
+	e.end = dupKey{
+		lib:  lib,
+		tid1: r.RefID(),
+		pos1: unclippedFivePrime(r.Start(), r.Cigar(), fl&Reverse != 0),
+		rev1: fl&Reverse != 0,
+	}
+	e.pos3 = unclippedFivePrime(r.Start(), r.Cigar(), fl&Reverse == 0)
+	e.key = e.end
+	if fl&Paired == 0 || fl&MateUnmapped != 0 {
+		return e, nil
+	}
+
+	mc, ok := r.Tag([]byte("MC"))
+	if !ok || mc.Type() != 'Z' {
+		return e, noMateTags
+	}
+	ms, ok := r.Tag([]byte("ms"))
+	if !ok {
+		return e, noMateTags
+	}
+	mcig, err := parseCigar(mc.Value().(string))
+	if err != nil {
+		return e, err
+	}
+	msv, _ := ms.intValue()
+	e.score += int(msv)
+
+	mate := dupKey{
+		tid1: r.NextRefID(),
+		pos1: unclippedFivePrime(r.NextStart(), mcig, fl&MateReverse != 0),
+		rev1: fl&MateReverse != 0,
+	}
+	e.key.paired = true
+	if mate.tid1 < e.key.tid1 || (mate.tid1 == e.key.tid1 && (mate.pos1 < e.key.pos1 || (mate.pos1 == e.key.pos1 && !mate.rev1 && e.key.rev1))) {
+		e.key.tid1, e.key.pos1, e.key.rev1, e.key.tid2, e.key.pos2, e.key.rev2 = mate.tid1, mate.pos1, mate.rev1, e.key.tid1, e.key.pos1, e.key.rev1
+	} else {
+		e.key.tid2, e.key.pos2, e.key.rev2 = mate.tid1, mate.pos1, mate.rev1
+	}
+	return e, nil
+}
+
+// dupHeap is a min-heap of values ordered by reference position.
+type dupHeap[T any] []dupItem[T]
+
+// A dupItem is a value held in a dupHeap at a reference position, with ties broken by sub.
+type dupItem[T any] struct {
+	tid, pos, sub int
+	v             T
+}
+
+func (h dupHeap[T]) Len() int { return len(h) }
+func (h dupHeap[T]) Less(i, j int) bool {
+	switch {
+	case h[i].tid != h[j].tid:
+		return h[i].tid < h[j].tid
+	case h[i].pos != h[j].pos:
+		return h[i].pos < h[j].pos
+	}
+	return h[i].sub < h[j].sub
+}
+func (h dupHeap[T]) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *dupHeap[T]) Push(x interface{}) { *h = append(*h, x.(dupItem[T])) }
+func (h *dupHeap[T]) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+// readLen returns the length of the read aligned by cigar, including clipped bases.
+func readLen(cigar []CigarOp) int {
+	var n int
+	for _, co := range cigar {
+		switch co.Type() {
+		case CigarMatch, CigarInsertion, CigarSoftClipped, CigarHardClipped, CigarEqual, CigarMismatch:
+			n += co.Len()
+		}
+	}
+	return n
+}
+
+// unclippedFivePrime returns the reference position of the 5' end of an alignment starting at pos
+// with the given CIGAR, including clipped bases.
+func unclippedFivePrime(pos int, cigar []CigarOp, rev bool) int {
+	clipped := func(co CigarOp) bool {
+		return co.Type() == CigarSoftClipped || co.Type() == CigarHardClipped
+	}
+	if !rev {
+		for _, co := range cigar {
+			if !clipped(co) {
+				break
+			}
+			pos -= co.Len()
+		}
+		return pos
+	}
+	pos += refLen(cigar)
+	for i := len(cigar) - 1; i >= 0 && clipped(cigar[i]); i-- {
+		pos += cigar[i].Len()
+	}
+	return pos - 1
+}
+
+// An opticalGrid holds the cluster coordinates of the entries of a group in square cells of
+// each tile, with sides one greater than the optical distance, so that entries within the
+// optical distance of each other lie in the same or adjacent cells.
+type opticalGrid struct {
+	dist  int
+	pts   []opticalPoint
+	cells map[opticalCell][]int
+}
+
+// An opticalCell identifies a cell of an opticalGrid.
+type opticalCell struct {
+	loc  string
+	x, y int
+}
+
+// An opticalPoint holds the cell and cluster coordinates of an entry, if they are known.
+type opticalPoint struct {
+	cell opticalCell
+	x, y int
+	ok   bool
+}
+
+// newOpticalGrid returns an opticalGrid holding the entries of a group whose read names encode
+// their cluster coordinates.
+func newOpticalGrid(entries []*dupEntry, dist int) *opticalGrid {
+	g := &opticalGrid{
+		dist:  dist,
+		pts:   make([]opticalPoint, len(entries)),
+		cells: make(map[opticalCell][]int),
+	}
+	for i, e := range entries {
+		loc, x, y, ok := tileXY(e.name)
+		if !ok {
+			continue
+		}
+		c := opticalCell{loc: loc, x: x / (dist + 1), y: y / (dist + 1)}
+		g.pts[i] = opticalPoint{cell: c, x: x, y: y, ok: true}
+		g.cells[c] = append(g.cells[c], i)
+	}
+	return g
+}
+
+// near returns whether the ith entry of the group is within the optical distance of another
+// entry of the group on the same tile.
+func (self *opticalGrid) near(i int) bool {
+	p := self.pts[i]
+	if !p.ok {
+		return false
+	}
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			c := opticalCell{loc: p.cell.loc, x: p.cell.x + dx, y: p.cell.y + dy}
+			for _, j := range self.cells[c] {
+				o := self.pts[j]
+				if j != i && abs(o.x-p.x) <= self.dist && abs(o.y-p.y) <= self.dist {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// tileXY returns a string identifying the tile, and the x and y cluster coordinates encoded
+// in an Illumina read name. Names not parsed by ParseIlluminaName are accepted if their final
+// three colon-separated fields can be interpreted as tile, x and y.
+func tileXY(name string) (loc string, x, y int, ok bool) {
+	if n, err := ParseIlluminaName(name); err == nil {
+		return n.TileKey(), n.X, n.Y, true
+	}
+	if i := strings.IndexAny(name, "#/ "); i >= 0 {
+		name = name[:i]
+	}
+	f := strings.Split(name, ":")
+	if len(f) < 3 {
+		return "", 0, 0, false
+	}
+	n := len(f)
+	x, err := strconv.Atoi(f[n-2])
+	if err != nil {
+		return "", 0, 0, false
+	}
+	y, err = strconv.Atoi(f[n-1])
+	if err != nil {
+		return "", 0, 0, false
+	}
+	return strings.Join(f[:n-2], ":"), x, y, true
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
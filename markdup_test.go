@@ -0,0 +1,180 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/biogo/boom"
+	"github.com/biogo/boom/generator"
+)
+
+// dupTestBAM writes a coordinate sorted BAM file in dir holding synthetic reads and low quality
+// copies of every fifth mapped fragment, named with a "dup-" prefix, and returns its path and
+// the number of fragments copied. Paired input is passed through FixMates. Coverage is low and
+// insert sizes vary so that the copies are the only duplicates.
+func dupTestBAM(t *testing.T, dir string, paired bool) (string, int) {
+	t.Helper()
+	g, err := generator.New(generator.Config{
+		Seed: 1,
+		References: []generator.Reference{
+			{Name: "chr1", Length: 60000},
+			{Name: "chr2", Length: 40000},
+		},
+		Paired:   paired,
+		InsertSD: 30,
+		Coverage: 0.5,
+		Unmapped: 0.05,
+	})
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+	var buf bytes.Buffer
+	err = g.WriteSAM(&buf)
+	if err != nil {
+		t.Fatalf("failed to write SAM: %v", err)
+	}
+
+	var (
+		sam    bytes.Buffer
+		frags  = make(map[string][][]string)
+		names  []string
+		copied int
+	)
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		sam.WriteString(line)
+		if line == "" || line[0] == '@' {
+			continue
+		}
+		f := strings.Split(strings.TrimSuffix(line, "\n"), "\t")
+		if _, ok := frags[f[0]]; !ok {
+			names = append(names, f[0])
+		}
+		frags[f[0]] = append(frags[f[0]], f)
+	}
+	for i, n := range names {
+		if i%5 != 0 {
+			continue
+		}
+		var mapped bool
+		for _, f := range frags[n] {
+			fl, err := strconv.Atoi(f[1])
+			if err != nil {
+				t.Fatalf("invalid flag in %q: %v", f, err)
+			}
+			mapped = boom.Flags(fl)&boom.Unmapped == 0
+			if !mapped {
+				break
+			}
+		}
+		if !mapped {
+			continue
+		}
+		for _, f := range frags[n] {
+			c := append([]string(nil), f...)
+			c[0] = "dup-" + n
+			c[10] = strings.Repeat("#", len(c[10]))
+			sam.WriteString(strings.Join(c, "\t") + "\n")
+		}
+		copied++
+	}
+
+	fn := filepath.Join(dir, "in.bam")
+	writeSAMAsBAM(t, fn, sam.Bytes())
+	if paired {
+		err = boom.Sort(fn, fn+".name.bam", &boom.SortOptions{By: boom.QueryName})
+		if err != nil {
+			t.Fatalf("failed to sort by name: %v", err)
+		}
+		err = boom.FixMates(fn+".name.bam", fn+".fixed.bam")
+		if err != nil {
+			t.Fatalf("failed to fix mates: %v", err)
+		}
+		fn += ".fixed.bam"
+	}
+	out := filepath.Join(dir, "sorted.bam")
+	err = boom.Sort(fn, out, nil)
+	if err != nil {
+		t.Fatalf("failed to sort by coordinate: %v", err)
+	}
+	return out, copied
+}
+
+func TestMarkDuplicates(t *testing.T) {
+	for _, paired := range []bool{false, true} {
+		t.Run(fmt.Sprintf("paired=%t", paired), func(t *testing.T) {
+			dir := t.TempDir()
+			in, copied := dupTestBAM(t, dir, paired)
+			if copied == 0 {
+				t.Fatal("no fragments copied")
+			}
+			_, want := readRecords(t, in)
+			expect := make(map[string]string)
+			wantDups := 0
+			for _, r := range want {
+				expect[fmt.Sprintf("%s/%d", r.Name(), r.Flags()&(boom.Read1|boom.Read2))] = mateKey(r)
+				if strings.HasPrefix(r.Name(), "dup-") {
+					wantDups++
+				}
+			}
+
+			for _, remove := range []bool{false, true} {
+				out := filepath.Join(dir, fmt.Sprintf("marked-%t.bam", remove))
+				m, err := boom.MarkDuplicates(in, out, &boom.MarkDupOptions{Remove: remove})
+				if err != nil {
+					t.Fatalf("unexpected error marking duplicates with Remove=%t: %v", remove, err)
+				}
+				checkSorted(t, out, boom.Coordinate)
+
+				gotDups := m.UnpairedDuplicates
+				if paired {
+					gotDups = m.PairDuplicates
+				}
+				if gotDups != copied || m.UnpairedDuplicates+m.PairDuplicates != copied {
+					t.Errorf("unexpected duplicate counts with Remove=%t: unpaired=%d pairs=%d want %d",
+						remove, m.UnpairedDuplicates, m.PairDuplicates, copied)
+				}
+				if m.UnpairedOptical != 0 || m.PairOptical != 0 {
+					t.Errorf("unexpected optical duplicates with Remove=%t: unpaired=%d pairs=%d",
+						remove, m.UnpairedOptical, m.PairOptical)
+				}
+
+				_, got := readRecords(t, out)
+				var dups, kept int
+				for _, r := range got {
+					isCopy := strings.HasPrefix(r.Name(), "dup-")
+					if isCopy {
+						dups++
+					}
+					marked := r.Flags()&boom.Duplicate != 0
+					if marked != isCopy {
+						t.Errorf("unexpected duplicate flag for %s with Remove=%t: got %t want %t",
+							r.Name(), remove, marked, isCopy)
+					}
+					// Only the duplicate flag may be changed.
+					seg := fmt.Sprintf("%s/%d", r.Name(), r.Flags()&(boom.Read1|boom.Read2))
+					r.SetFlags(r.Flags() &^ boom.Duplicate)
+					if k := mateKey(r); k != expect[seg] {
+						t.Errorf("unexpected fields for %s with Remove=%t: got %s want %s", seg, remove, k, expect[seg])
+					}
+					kept++
+				}
+				if remove {
+					if dups != 0 || kept != len(want)-wantDups {
+						t.Errorf("unexpected records after removal: got %d with %d duplicates want %d",
+							kept, dups, len(want)-wantDups)
+					}
+				} else if kept != len(want) {
+					t.Errorf("unexpected number of records: got %d want %d", kept, len(want))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"io"
+)
+
+var noPlacedMate = errors.New("boom: record has no placed mate")
+
+// GetMate returns the primary alignment of the mate of the paired record r by querying the
+// index i at the mate reference position recorded in r. The mate is identified by name, by
+// having the opposite read number and by its position. If the mate is not found, a nil Record
+// and nil error are returned. If r is not paired or its mate is unplaced, an error is returned.
+// GetMate moves the file position of the BAMFile, so it must not be interleaved with sequential
+// reads or Iterators of the same BAMFile; a second BAMFile opened on the same file may be used
+// for mate lookup during a sequential pass.
+func (self *BAMFile) GetMate(i *Index, r *Record) (*Record, error) {
+	fl := r.Flags()
+	mtid, mpos := r.NextRefID(), r.NextStart()
+	if fl&Paired == 0 || mtid < 0 || mpos < 0 {
+		return nil, noPlacedMate
+	}
+	name := r.Name()
+	want := fl&(Read1|Read2) ^ (Read1 | Read2)
+
+	it, err := self.Query(i, mtid, mpos, mpos+1)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for {
+		m, _, err := it.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if m.Start() > mpos {
+			return nil, nil
+		}
+		mfl := m.Flags()
+		if m.Start() != mpos || mfl&(Secondary|Supplementary) != 0 || mfl&(Read1|Read2) != want {
+			continue
+		}
+		if m.Name() == name {
+			return m, nil
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+var memoryLimitExceeded = errors.New("boom: memory limit exceeded")
+
+// MemoryStats describes the C memory held by live values, as tracked when memory accounting
+// is enabled. Memory allocated while accounting was disabled is not included.
+type MemoryStats struct {
+	Records    int64 // Bytes held by records, including their data blocks.
+	NumRecords int64 // Number of live records.
+	Headers    int64 // Bytes held by headers.
+	Indexes    int64 // Estimated bytes held by BAM indexes.
+}
+
+// Total returns the total number of bytes described by the MemoryStats.
+func (self MemoryStats) Total() int64 { return self.Records + self.Headers + self.Indexes }
+
+var mem struct {
+	enabled atomic.Bool
+	limit   atomic.Int64
+
+	// collected is set when a collection has been forced since
+	// tracked memory last fell within the limit.
+	collected atomic.Bool
+
+	records, numRecords, headers, indexes atomic.Int64
+}
+
+// EnableMemoryAccounting enables or disables tracking of the C memory held by records,
+// headers and indexes, returning the previous setting. Accounting adds a small cost to
+// record allocation and reading, and is disabled by default. Memory held by the decoded Go
+// fields of records and by the buffers of open files is not tracked.
+func EnableMemoryAccounting(on bool) (was bool) {
+	return mem.enabled.Swap(on)
+}
+
+// SetMemoryLimit sets a soft limit, in bytes, on the total tracked memory and returns the
+// previous limit. A limit of zero or less removes the limit. The limit is only enforced
+// when memory accounting is enabled. When allocating a record, header or index first exceeds
+// the limit, a garbage collection is forced so that unreachable values release their C
+// memory; if the limit would still be exceeded the allocation fails with an error, as do
+// later allocations until tracked memory falls within the limit again. Growth of the data
+// blocks of existing records during reading is tracked but never fails.
+func SetMemoryLimit(limit int64) (old int64) {
+	mem.collected.Store(false)
+	return mem.limit.Swap(limit)
+}
+
+// ReadMemoryStats returns the current tracked memory use.
+func ReadMemoryStats() MemoryStats {
+	return MemoryStats{
+		Records:    mem.records.Load(),
+		NumRecords: mem.numRecords.Load(),
+		Headers:    mem.headers.Load(),
+		Indexes:    mem.indexes.Load(),
+	}
+}
+
+// memReserve checks that allocating n more bytes does not exceed the memory limit, forcing
+// frees once each time the limit is crossed. It returns false if accounting is disabled, in
+// which case the allocation should not be tracked.
+func memReserve(n int64) (track bool, err error) {
+	if !mem.enabled.Load() {
+		return false, nil
+	}
+	limit := mem.limit.Load()
+	if limit <= 0 || ReadMemoryStats().Total()+n <= limit {
+		mem.collected.Store(false)
+		return true, nil
+	}
+	if mem.collected.Swap(true) {
+		return false, memoryLimitExceeded
+	}
+	// Finalizers run asynchronously after a collection,
+	// so give them an opportunity to release memory.
+	for i := 0; i < 2; i++ {
+		runtime.GC()
+		runtime.Gosched()
+		if ReadMemoryStats().Total()+n <= limit {
+			mem.collected.Store(false)
+			return true, nil
+		}
+	}
+	return false, memoryLimitExceeded
+}
+
+// indexSize returns an estimate of the memory held by the BAM index for the BAM file,
+// filename, based on the size of the index file.
+func indexSize(filename string) int64 {
+	for _, fn := range []string{filename + ".bai", strings.TrimSuffix(filename, ".bam") + ".bai"} {
+		fi, err := os.Stat(fn)
+		if err == nil {
+			return fi.Size()
+		}
+	}
+	return 0
+}
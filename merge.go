@@ -0,0 +1,459 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	noInput          = fmt.Errorf("boom: no input files")
+	refOrderConflict = fmt.Errorf("boom: inputs order their reference sequences inconsistently")
+)
+
+// MergeOptions specifies the behaviour of Merge.
+type MergeOptions struct {
+	// By specifies the sort order of the input files, either Coordinate or
+	// QueryName. If By is UnknownOrder, Coordinate is used.
+	By SortOrder
+
+	// AttachRG specifies that each record is given an RG tag identifying
+	// its input file, derived from the file name without its extension,
+	// replacing any existing RG tag. A corresponding @RG header line is
+	// added for each input.
+	AttachRG bool
+
+	// Region restricts the merged records to those overlapping a region
+	// given in samtools region format. Each input must be indexed.
+	// Inputs lacking the region's reference contribute no records,
+	// but a region that names no reference of any input is an error.
+	// If Region is empty, all records are merged.
+	Region string
+}
+
+// Merge merges the records of the sorted BAM files, ins, into a new BAM file, out. The reference
+// sequences of the input headers are reconciled by name, with reference IDs of records translated
+// to the merged header. For coordinate sorted input, the merged references are ordered so that
+// the reference order of each input is preserved; inputs whose reference orders conflict are
+// rejected. Other header lines are combined, omitting duplicates. @RG and @PG lines are merged
+// by ID, and an ID used by differing lines of different inputs is given a numeric suffix, with
+// the RG and PG tags of the input's records renamed to match. If opts is nil, coordinate sorted
+// input is assumed.
+func Merge(out string, ins []string, opts *MergeOptions) error {
+	var o MergeOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.By == UnknownOrder {
+		o.By = Coordinate
+	}
+	less, err := o.By.lessFunc()
+	if err != nil {
+		return err
+	}
+	if len(ins) == 0 {
+		return noInput
+	}
+
+	fs := make([]*BAMFile, len(ins))
+	hs := make([]*Header, len(ins))
+	for i, in := range ins {
+		f, err := OpenBAM(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fs[i], hs[i] = f, f.Header()
+	}
+
+	var rgs []string
+	if o.AttachRG {
+		rgs = make([]string, len(ins))
+		for i, in := range ins {
+			base := filepath.Base(in)
+			rgs[i] = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+	}
+
+	h, tids, ids, err := mergeHeaders(hs, o.By, rgs)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	if o.Region != "" {
+		tid, _, _, err := h.bamParseRegion(o.Region)
+		if err != nil {
+			return err
+		}
+		name = h.RefNames()[tid]
+	}
+
+	rs := make([]RecordReader, len(fs))
+	for i, f := range fs {
+		mr := &mergeReader{r: f, tids: tids[i], ids: ids[i]}
+		if rgs != nil {
+			mr.rg = renameID(ids[i], Tag{'R', 'G'}, rgs[i])
+		}
+		rs[i] = mr
+		if o.Region == "" {
+			continue
+		}
+
+		if _, ok := f.RefID(name); !ok {
+			// The region's reference may not be present in all inputs.
+			mr.r = emptyReader{}
+			continue
+		}
+		tid, beg, end, err := f.ParseRegion(o.Region)
+		if err != nil {
+			return err
+		}
+		idx, err := LoadIndex(ins[i])
+		if err != nil {
+			return err
+		}
+		it, err := f.Query(idx, tid, beg, end)
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		mr.r = it
+	}
+	return mergeReaders(out, h, rs, less)
+}
+
+// emptyReader is a RecordReader that holds no records.
+type emptyReader struct{}
+
+func (emptyReader) Read() (*Record, int, error) { return nil, 0, io.EOF }
+
+// mergeReader translates the reference IDs of records read from r to those of a merged header,
+// renames RG and PG tags according to ids and optionally attaches an RG tag.
+type mergeReader struct {
+	r    RecordReader
+	tids []int32
+	ids  map[Tag]map[string]string
+	rg   string
+}
+
+func (self *mergeReader) Read() (r *Record, n int, err error) {
+	r, n, err = self.r.Read()
+	if err != nil {
+		return
+	}
+	if tid := r.tid(); tid >= 0 {
+		if int(tid) >= len(self.tids) {
+			return nil, n, &MalformedRecord{Name: r.Name(), Reason: "reference ID out of range"}
+		}
+		r.setTid(self.tids[tid])
+	}
+	if mtid := r.mtid(); mtid >= 0 {
+		if int(mtid) >= len(self.tids) {
+			return nil, n, &MalformedRecord{Name: r.Name(), Reason: "mate reference ID out of range"}
+		}
+		r.setMtid(self.tids[mtid])
+	}
+	if self.rg == "" && len(self.ids) == 0 {
+		return
+	}
+
+	var (
+		aa      []Aux
+		changed bool
+	)
+	for _, a := range r.Tags() {
+		t := a.Tag()
+		if t == (Tag{'R', 'G'}) && self.rg != "" {
+			changed = true
+			continue
+		}
+		if id, ok := a.Value().(string); ok {
+			if nid := renameID(self.ids, t, id); nid != id {
+				a, err = NewAux(t, nid)
+				if err != nil {
+					return
+				}
+				changed = true
+			}
+		}
+		aa = append(aa, a)
+	}
+	if self.rg != "" {
+		var rg Aux
+		rg, err = NewAux(Tag{'R', 'G'}, self.rg)
+		if err != nil {
+			return
+		}
+		aa = append(aa, rg)
+		changed = true
+	}
+	if changed {
+		r.SetTags(aa)
+	}
+	return
+}
+
+// renameID returns the new name of the @RG or @PG ID, id, of the type t in ids, or id if it is
+// not renamed.
+func renameID(ids map[Tag]map[string]string, t Tag, id string) string {
+	if n, ok := ids[t][id]; ok {
+		return n
+	}
+	return id
+}
+
+// mergeHeaders returns a header combining the headers, hs, with the sort order so and with
+// additional read groups, rgs. The reference sequences of the merged header are the union of
+// the input reference sequences. For each input header, a mapping from its reference IDs to
+// those of the merged header is returned, with the @RG and @PG IDs of the input that were
+// renamed to avoid conflicting with other inputs, keyed by record type.
+func mergeHeaders(hs []*Header, so SortOrder, rgs []string) (h *Header, tids [][]int32, ids []map[Tag]map[string]string, err error) {
+	var (
+		names   []string
+		lengths []uint32
+		sqLines = make(map[string]string)
+		index   = make(map[string]int32)
+
+		hd    string
+		other []string
+		seen  = make(map[string]bool)
+		byID  = make(map[idKey]string)
+	)
+	tids = make([][]int32, len(hs))
+	ids = make([]map[Tag]map[string]string, len(hs))
+	for i, in := range hs {
+		var lines []string
+		for _, line := range strings.Split(in.Text(), "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			switch {
+			case line == "":
+			case strings.HasPrefix(line, "@HD"):
+				if hd == "" {
+					hd = line
+				}
+			case strings.HasPrefix(line, "@SQ"):
+				for _, f := range strings.Split(line, "\t") {
+					if strings.HasPrefix(f, "SN:") {
+						if _, ok := sqLines[f[3:]]; !ok {
+							sqLines[f[3:]] = line
+						}
+					}
+				}
+			default:
+				lines = append(lines, line)
+			}
+		}
+
+		// Rename IDs already used by a differing line
+		// of another input, then merge lines by ID.
+		reserved := make(map[idKey]bool)
+		for _, line := range lines {
+			k, ok := headerID(line)
+			if !ok {
+				continue
+			}
+			if prev, dup := byID[k]; !dup || prev == line {
+				continue
+			}
+			if _, done := ids[i][k.typ][k.id]; done {
+				continue
+			}
+			nk := k
+			for n := 1; ; n++ {
+				nk.id = k.id + "-" + strconv.Itoa(n)
+				if _, used := byID[nk]; !used && !reserved[nk] {
+					break
+				}
+			}
+			reserved[nk] = true
+			if ids[i] == nil {
+				ids[i] = make(map[Tag]map[string]string)
+			}
+			if ids[i][k.typ] == nil {
+				ids[i][k.typ] = make(map[string]string)
+			}
+			ids[i][k.typ][k.id] = nk.id
+		}
+		for _, line := range lines {
+			line = renameIDs(line, ids[i])
+			if k, ok := headerID(line); ok {
+				if _, dup := byID[k]; dup {
+					continue
+				}
+				byID[k] = line
+			} else if seen[line] {
+				continue
+			}
+			seen[line] = true
+			other = append(other, line)
+		}
+
+		lens := in.RefLengths()
+		tids[i] = make([]int32, len(lens))
+		for j, n := range in.RefNames() {
+			id, ok := index[n]
+			if !ok {
+				id = int32(len(names))
+				index[n] = id
+				names = append(names, n)
+				lengths = append(lengths, lens[j])
+			} else if lengths[id] != lens[j] {
+				return nil, nil, nil, fmt.Errorf("boom: conflicting lengths for reference %q: %d and %d", n, lengths[id], lens[j])
+			}
+			tids[i][j] = id
+		}
+	}
+	for i, rg := range rgs {
+		k := idKey{typ: Tag{'R', 'G'}, id: renameID(ids[i], Tag{'R', 'G'}, rg)}
+		if _, dup := byID[k]; !dup {
+			line := "@RG\tID:" + k.id
+			byID[k] = line
+			other = append(other, line)
+		}
+	}
+
+	order, ok := mergeRefOrder(tids, len(names))
+	if !ok {
+		if so == Coordinate {
+			return nil, nil, nil, refOrderConflict
+		}
+		// Name sorted output does not depend on the
+		// reference order, so keep the order of first
+		// appearance.
+		order = order[:0]
+		for id := range names {
+			order = append(order, int32(id))
+		}
+	}
+	rank := make([]int32, len(order))
+	sortedNames := make([]string, len(order))
+	sortedLengths := make([]uint32, len(order))
+	for r, id := range order {
+		rank[id] = int32(r)
+		sortedNames[r], sortedLengths[r] = names[id], lengths[id]
+	}
+	names, lengths = sortedNames, sortedLengths
+	for _, t := range tids {
+		for j, id := range t {
+			t[j] = rank[id]
+		}
+	}
+
+	if hd == "" {
+		hd = "@HD\tVN:1.0"
+	}
+	lines := []string{setSortOrder(hd, so)}
+	for i, n := range names {
+		line, ok := sqLines[n]
+		if !ok || !strings.Contains(line, "\tLN:"+strconv.Itoa(int(lengths[i]))) {
+			line = fmt.Sprintf("@SQ\tSN:%s\tLN:%d", n, lengths[i])
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, other...)
+
+	h, err = NewHeader(strings.Join(lines, "\n") + "\n")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if int(h.nTargets()) != len(names) {
+		return nil, nil, nil, fmt.Errorf("boom: failed to construct merged header")
+	}
+	return h, tids, ids, nil
+}
+
+// mergeRefOrder returns an ordering of the n merged reference IDs, numbered in order of first
+// appearance, that preserves the order of the references of each input mapped by tids. Where
+// the inputs allow, references are kept in order of first appearance. If the inputs order their
+// references inconsistently, a partial ordering and false are returned.
+func mergeRefOrder(tids [][]int32, n int) ([]int32, bool) {
+	next := make([][]int32, n)
+	deg := make([]int, n)
+	for _, t := range tids {
+		for j := 1; j < len(t); j++ {
+			next[t[j-1]] = append(next[t[j-1]], t[j])
+			deg[t[j]]++
+		}
+	}
+	var ready refHeap
+	for id, d := range deg {
+		if d == 0 {
+			ready = append(ready, int32(id))
+		}
+	}
+	heap.Init(&ready)
+	order := make([]int32, 0, n)
+	for ready.Len() > 0 {
+		id := heap.Pop(&ready).(int32)
+		order = append(order, id)
+		for _, s := range next[id] {
+			deg[s]--
+			if deg[s] == 0 {
+				heap.Push(&ready, s)
+			}
+		}
+	}
+	return order, len(order) == n
+}
+
+// refHeap is a min-heap of reference IDs.
+type refHeap []int32
+
+func (h refHeap) Len() int            { return len(h) }
+func (h refHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h refHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *refHeap) Push(x interface{}) { *h = append(*h, x.(int32)) }
+func (h *refHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// An idKey identifies an @RG or @PG header line by its record type and ID.
+type idKey struct {
+	typ Tag
+	id  string
+}
+
+// headerID returns the key of an @RG or @PG header line, and whether the line is such a line
+// with an ID field.
+func headerID(line string) (idKey, bool) {
+	if !strings.HasPrefix(line, "@RG\t") && !strings.HasPrefix(line, "@PG\t") {
+		return idKey{}, false
+	}
+	for _, f := range strings.Split(line[4:], "\t") {
+		if strings.HasPrefix(f, "ID:") {
+			return idKey{typ: Tag{line[1], line[2]}, id: f[3:]}, true
+		}
+	}
+	return idKey{}, false
+}
+
+// renameIDs returns the header line with its ID field, and the PP field of a @PG line, renamed
+// according to ids.
+func renameIDs(line string, ids map[Tag]map[string]string) string {
+	k, ok := headerID(line)
+	if !ok || len(ids) == 0 {
+		return line
+	}
+	f := strings.Split(line, "\t")
+	for j, v := range f[1:] {
+		switch {
+		case strings.HasPrefix(v, "ID:"):
+			f[j+1] = "ID:" + renameID(ids, k.typ, v[3:])
+		case strings.HasPrefix(v, "PP:") && k.typ == (Tag{'P', 'G'}):
+			f[j+1] = "PP:" + renameID(ids, k.typ, v[3:])
+		}
+	}
+	return strings.Join(f, "\t")
+}
@@ -0,0 +1,168 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/biogo/boom"
+	"github.com/biogo/boom/generator"
+)
+
+// placedKey returns a string holding the placement and read group of r, with reference IDs
+// given as names from h, and with the read group renamed by rgs if it is not nil.
+func placedKey(h *boom.Header, r *boom.Record, rgs map[string]string) string {
+	ref := func(id int) string {
+		if id < 0 {
+			return "*"
+		}
+		return h.RefNames()[id]
+	}
+	var rg string
+	if a, ok := r.Tag([]byte("RG")); ok {
+		rg = a.Value().(string)
+	}
+	if n, ok := rgs[rg]; ok {
+		rg = n
+	}
+	return fmt.Sprintf("%s %s:%d %v %s:%d %d %s",
+		r.Name(), ref(r.RefID()), r.Start(), r.Flags(), ref(r.NextRefID()), r.NextStart(), r.TemplateLen(), rg)
+}
+
+// headerIDs returns the ID fields of the header lines of the record type, typ, in h.
+func headerIDs(h *boom.Header, typ string) []string {
+	var ids []string
+	for _, line := range strings.Split(h.Text(), "\n") {
+		if !strings.HasPrefix(line, typ+"\t") {
+			continue
+		}
+		for _, f := range strings.Split(line, "\t") {
+			if strings.HasPrefix(f, "ID:") {
+				ids = append(ids, f[3:])
+			}
+		}
+	}
+	return ids
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	ref := map[string]generator.Reference{
+		"chr1": {Name: "chr1", Length: 30000},
+		"chr2": {Name: "chr2", Length: 20000},
+		"chr3": {Name: "chr3", Length: 10000},
+	}
+	input := func(name string, seed int64, sample string, refs ...string) string {
+		cfg := generator.Config{
+			Seed:      seed,
+			Paired:    true,
+			Coverage:  2,
+			Unmapped:  0.05,
+			ReadGroup: "rg1",
+			Sample:    sample,
+		}
+		for _, n := range refs {
+			cfg.References = append(cfg.References, ref[n])
+		}
+		return writeTestBAM(t, dir, name, cfg)
+	}
+
+	// The references of a are first seen in an order
+	// that b does not share, so the merged order must
+	// be built from both inputs.
+	a := input("rg1.bam", 1, "a", "chr2", "chr3")
+	b := input("b.bam", 2, "b", "chr1", "chr2")
+	c := input("c.bam", 3, "c", "chr3", "chr2")
+
+	for _, test := range []struct {
+		attach bool
+		rgs    []map[string]string
+		ids    []string
+	}{
+		{
+			rgs: []map[string]string{nil, {"rg1": "rg1-1"}},
+			ids: []string{"rg1", "rg1-1"},
+		},
+		{
+			// The read group attached to a is described by
+			// a's existing @RG line.
+			attach: true,
+			rgs:    []map[string]string{{"": "rg1"}, {"rg1": "b", "": "b"}},
+			ids:    []string{"rg1", "rg1-1", "b"},
+		},
+	} {
+		out := filepath.Join(dir, fmt.Sprintf("merged-%t.bam", test.attach))
+		err := boom.Merge(out, []string{a, b}, &boom.MergeOptions{AttachRG: test.attach})
+		if err != nil {
+			t.Fatalf("unexpected error merging with AttachRG=%t: %v", test.attach, err)
+		}
+		checkSorted(t, out, boom.Coordinate)
+
+		h, got := readRecords(t, out)
+		if names := h.RefNames(); !slices.Equal(names, []string{"chr1", "chr2", "chr3"}) {
+			t.Errorf("unexpected merged references with AttachRG=%t: %v", test.attach, names)
+		}
+		err = h.Validate()
+		if err != nil {
+			t.Errorf("invalid merged header with AttachRG=%t: %v", test.attach, err)
+		}
+		if ids := headerIDs(h, "@RG"); !slices.Equal(ids, test.ids) {
+			t.Errorf("unexpected @RG IDs with AttachRG=%t: got %v want %v", test.attach, ids, test.ids)
+		}
+		if ids := headerIDs(h, "@PG"); len(ids) != 1 {
+			t.Errorf("unexpected @PG IDs with AttachRG=%t: %v", test.attach, ids)
+		}
+
+		var want []string
+		for i, in := range []string{a, b} {
+			h, recs := readRecords(t, in)
+			for _, r := range recs {
+				want = append(want, placedKey(h, r, test.rgs[i]))
+			}
+		}
+		var gotKeys []string
+		for _, r := range got {
+			gotKeys = append(gotKeys, placedKey(h, r, nil))
+		}
+		slices.Sort(want)
+		slices.Sort(gotKeys)
+		if !slices.Equal(gotKeys, want) {
+			t.Errorf("merged records do not match inputs with AttachRG=%t", test.attach)
+		}
+	}
+
+	err := boom.Merge(filepath.Join(dir, "conflict.bam"), []string{a, c}, nil)
+	if err == nil {
+		t.Error("expected error merging inputs with conflicting reference orders")
+	}
+
+	// Name sorted inputs may be merged regardless
+	// of their reference orders.
+	var named []string
+	for _, in := range []string{a, c} {
+		out := strings.TrimSuffix(in, ".bam") + ".name.bam"
+		err := boom.Sort(in, out, &boom.SortOptions{By: boom.QueryName})
+		if err != nil {
+			t.Fatalf("failed to sort by name: %v", err)
+		}
+		named = append(named, out)
+	}
+	out := filepath.Join(dir, "merged.name.bam")
+	err = boom.Merge(out, named, &boom.MergeOptions{By: boom.QueryName})
+	if err != nil {
+		t.Fatalf("unexpected error merging name sorted inputs: %v", err)
+	}
+	checkSorted(t, out, boom.QueryName)
+	_, got := readRecords(t, out)
+	_, ra := readRecords(t, a)
+	_, rc := readRecords(t, c)
+	if len(got) != len(ra)+len(rc) {
+		t.Errorf("unexpected number of merged records: got %d want %d", len(got), len(ra)+len(rc))
+	}
+}
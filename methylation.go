@@ -0,0 +1,272 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DefaultModThreshold is the default likelihood at or above which a modification call is
+// classified as modified.
+const DefaultModThreshold = 204
+
+var badModOffset = errors.New("boom: modified base offset outside motif")
+
+// MethylationOptions specifies the behaviour of a MethylationTable.
+type MethylationOptions struct {
+	// Code is the modification code counted. If Code is empty,
+	// "m", 5-methylcytosine, is used.
+	Code string
+
+	// Motif is the reference sequence context of counted sites
+	// and Offset is the position of the modified base within
+	// it. 'N' in the motif matches any base. If Motif is empty,
+	// "CG" is used.
+	Motif  string
+	Offset int
+
+	// Threshold is the likelihood, on the [0, 255] scale of the
+	// ML tag, at or above which a call is classified as modified.
+	// Calls with a likelihood at or below 255-Threshold are
+	// classified as unmodified and others as ambiguous. If
+	// Threshold is zero, DefaultModThreshold is used.
+	Threshold int
+
+	// CombineStrands specifies that calls on the minus strand
+	// are counted at the position of the modified base of the
+	// motif on the plus strand. It should only be used with
+	// palindromic motifs such as CG.
+	CombineStrands bool
+
+	// MinMapQ is the minimum mapping quality of counted
+	// records.
+	MinMapQ byte
+
+	// Regions restricts the counted sites to those within the
+	// set. If Regions is nil, all sites are counted.
+	Regions *RegionSet
+}
+
+// A ModSite is a reference position and strand at which modifications are counted.
+type ModSite struct {
+	RefID  int
+	Pos    int
+	Strand byte // '+' or '-'.
+}
+
+// ModCounts holds the counts of modification calls at a site.
+type ModCounts struct {
+	Modified   int
+	Unmodified int
+	Ambiguous  int
+}
+
+// Coverage returns the number of calls classified as modified or unmodified.
+func (self *ModCounts) Coverage() int { return self.Modified + self.Unmodified }
+
+// Frequency returns the fraction of classified calls that are modified.
+func (self *ModCounts) Frequency() float64 { return frac(self.Modified, self.Coverage()) }
+
+// A MethylationTable counts base modification calls held in the MM and ML tags of aligned
+// records at the reference sites matching a motif.
+type MethylationTable struct {
+	Sites map[ModSite]*ModCounts
+
+	// Records is the number of records counted. Skipped is the
+	// number of records not counted because they are unmapped,
+	// secondary, supplementary, duplicates, QC failures or below
+	// the minimum mapping quality.
+	Records int
+	Skipped int
+
+	opts MethylationOptions
+	refs *refCache
+}
+
+// NewMethylationTable returns a MethylationTable counting calls in records described by h
+// against the reference sequences held in fa. If opts is nil, 5mC calls at CG sites are
+// counted.
+func NewMethylationTable(h *Header, fa *Fasta, opts *MethylationOptions) (*MethylationTable, error) {
+	var o MethylationOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Code == "" {
+		o.Code = "m"
+	}
+	if o.Motif == "" {
+		o.Motif = "CG"
+	}
+	if o.Offset < 0 || o.Offset >= len(o.Motif) {
+		return nil, badModOffset
+	}
+	if o.Threshold == 0 {
+		o.Threshold = DefaultModThreshold
+	}
+	return &MethylationTable{
+		Sites: make(map[ModSite]*ModCounts),
+		opts:  o,
+		refs:  newRefCache(fa, h.RefNames()),
+	}, nil
+}
+
+// Add counts the modification calls of r at sites matching the motif. Calls at read bases
+// that are not aligned to the reference are ignored.
+func (self *MethylationTable) Add(r *Record) error {
+	fl := r.Flags()
+	if fl&(Unmapped|Secondary|Supplementary|Duplicate|QCFail) != 0 || r.Score() < self.opts.MinMapQ {
+		self.Skipped++
+		return nil
+	}
+	self.Records++
+	mods, err := r.BaseMods()
+	if err != nil || len(mods) == 0 {
+		return err
+	}
+	tid := r.RefID()
+	ref := self.refs.seqFor(tid)
+	if ref == nil {
+		return nil
+	}
+
+	refAt := make([]int, r.Len())
+	for i := range refAt {
+		refAt[i] = -1
+	}
+	q, p := 0, r.Start()
+	for _, co := range r.Cigar() {
+		n := co.Len()
+		switch co.Type() {
+		case CigarMatch, CigarEqual, CigarMismatch:
+			for i := 0; i < n && q+i < len(refAt); i++ {
+				refAt[q+i] = p + i
+			}
+			q += n
+			p += n
+		case CigarInsertion, CigarSoftClipped:
+			q += n
+		case CigarDeletion, CigarSkipped:
+			p += n
+		}
+	}
+
+	motif, off := self.opts.Motif, self.opts.Offset
+	for _, m := range mods {
+		if m.Code != self.opts.Code || m.Pos >= len(refAt) || refAt[m.Pos] < 0 {
+			continue
+		}
+		pos := refAt[m.Pos]
+		minus := (fl&Reverse != 0) != (m.Strand == '-')
+		if !motifAt(ref, pos, motif, off, minus) {
+			continue
+		}
+		site := ModSite{RefID: tid, Pos: pos, Strand: '+'}
+		if minus {
+			if self.opts.CombineStrands {
+				site.Pos = pos + 2*off - (len(motif) - 1)
+			} else {
+				site.Strand = '-'
+			}
+		}
+		if self.opts.Regions != nil && !self.opts.Regions.Overlaps(tid, site.Pos, site.Pos+1) {
+			continue
+		}
+		c, ok := self.Sites[site]
+		if !ok {
+			c = &ModCounts{}
+			self.Sites[site] = c
+		}
+		switch {
+		case m.Prob >= self.opts.Threshold:
+			c.Modified++
+		case m.Prob <= 255-self.opts.Threshold:
+			c.Unmodified++
+		default:
+			c.Ambiguous++
+		}
+	}
+	return nil
+}
+
+// motifAt returns whether the modified base at offset off of motif is at position pos of ref,
+// reading the motif on the minus strand if minus is true.
+func motifAt(ref []byte, pos int, motif string, off int, minus bool) bool {
+	for j := 0; j < len(motif); j++ {
+		m := motif[j]
+		q := pos - off + j
+		if minus {
+			q = pos + off - j
+			m = complement(m)
+		}
+		if q < 0 || q >= len(ref) {
+			return false
+		}
+		if m != 'N' && upper(ref[q]) != m {
+			return false
+		}
+	}
+	return true
+}
+
+// Sorted returns the sites held by the table in order of reference, position and strand.
+func (self *MethylationTable) Sorted() []ModSite {
+	s := make([]ModSite, 0, len(self.Sites))
+	for k := range self.Sites {
+		s = append(s, k)
+	}
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].RefID != s[j].RefID {
+			return s[i].RefID < s[j].RefID
+		}
+		if s[i].Pos != s[j].Pos {
+			return s[i].Pos < s[j].Pos
+		}
+		return s[i].Strand < s[j].Strand
+	})
+	return s
+}
+
+// SummarizeMethylation reads the remaining records from r, described by h, and returns the
+// counts of their modification calls at sites in the reference sequences held in fa. To
+// summarize a region of an indexed BAM file, r may be an Iterator returned by Query, with
+// opts.Regions restricting the counted sites to the region.
+func SummarizeMethylation(r RecordReader, h *Header, fa *Fasta, opts *MethylationOptions) (*MethylationTable, error) {
+	t, err := NewMethylationTable(h, fa, opts)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if err = t.Add(rec); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// WriteMethylation writes the sites of t to w as a tab-delimited table in BED coordinates
+// with the columns reference name, start, end, modification code, strand, modified calls,
+// unmodified calls, ambiguous calls and percentage modified. Reference names are taken from
+// names.
+func WriteMethylation(w io.Writer, names []string, t *MethylationTable) error {
+	bw := bufio.NewWriter(w)
+	for _, s := range t.Sorted() {
+		c := t.Sites[s]
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%s\t%c\t%d\t%d\t%d\t%.2f\n",
+			names[s.RefID], s.Pos, s.Pos+1, t.opts.Code, s.Strand,
+			c.Modified, c.Unmodified, c.Ambiguous, 100*c.Frequency())
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,148 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"io"
+	"iter"
+)
+
+var indexIncomplete = errors.New("boom: mini index incomplete")
+
+// miniIndexShift is the log2 size of the windows of a MiniIndex, matching the linear index
+// of a BAI file.
+const miniIndexShift = 14
+
+// A MiniIndex is a transient in-memory index of a coordinate-sorted BAM file, built by an
+// IndexingReader as the file is read. It holds, for each 16kb window of each reference, the
+// virtual file offset of the first record overlapping the window.
+type MiniIndex struct {
+	refs     [][]int64
+	complete bool
+	sorted   bool
+}
+
+// An IndexingReader is a RecordReader that builds a MiniIndex of the BAM file it reads, so
+// that regions of the file can later be queried without a BAI index on disk.
+type IndexingReader struct {
+	b   *BAMFile
+	idx *MiniIndex
+
+	tid, pos int
+}
+
+// NewIndexingReader returns an IndexingReader reading from the current position of b.
+func NewIndexingReader(b *BAMFile) *IndexingReader {
+	return &IndexingReader{b: b, idx: &MiniIndex{sorted: true}, tid: -1}
+}
+
+// Read reads the next record from the underlying BAM file and adds it to the index.
+func (self *IndexingReader) Read() (r *Record, n int, err error) {
+	off, err := self.b.Tell()
+	if err != nil {
+		return nil, 0, err
+	}
+	r, n, err = self.b.Read()
+	if err != nil {
+		if err == io.EOF {
+			self.idx.complete = true
+		}
+		return r, n, err
+	}
+	self.add(r, off)
+	return r, n, nil
+}
+
+// add adds the record r at the virtual offset off to the index.
+func (self *IndexingReader) add(r *Record, off int64) {
+	tid, pos := r.RefID(), r.Start()
+	if tid < 0 {
+		self.tid = int(^uint(0) >> 1)
+		return
+	}
+	if tid < self.tid || (tid == self.tid && pos < self.pos) {
+		self.idx.sorted = false
+	}
+	self.tid, self.pos = tid, pos
+	if !self.idx.sorted {
+		return
+	}
+
+	for len(self.idx.refs) <= tid {
+		self.idx.refs = append(self.idx.refs, nil)
+	}
+	lin := self.idx.refs[tid]
+	beg, end := recordSpan(r)
+	for w := beg >> miniIndexShift; w <= (end-1)>>miniIndexShift; w++ {
+		for len(lin) <= w {
+			lin = append(lin, -1)
+		}
+		if lin[w] < 0 {
+			lin[w] = off
+		}
+	}
+	self.idx.refs[tid] = lin
+}
+
+// Index returns the MiniIndex built by the IndexingReader. The index may be used for queries
+// once the reader has returned io.EOF.
+func (self *IndexingReader) Index() *MiniIndex { return self.idx }
+
+// Query returns an iterator over the records of the BAM file, b, overlapping the interval
+// [beg, end) of the reference identified by tid. b must be the file, or an open copy of the
+// file, that the index was built from. Query changes the position of b, so the position
+// should be recorded with Tell and restored with SeekVirtual if b is also being read
+// sequentially. If the index is incomplete or the file was not coordinate sorted, the error
+// is yielded with a nil Record.
+func (self *MiniIndex) Query(b *BAMFile, tid, beg, end int) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		switch {
+		case !self.complete:
+			yield(nil, indexIncomplete)
+			return
+		case !self.sorted:
+			yield(nil, notSorted)
+			return
+		}
+		off, ok := self.offset(tid, beg, end)
+		if !ok {
+			return
+		}
+		err := b.SeekVirtual(off)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for r, err := range RecordsErr(b) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if r.RefID() != tid || r.Start() >= end {
+				return
+			}
+			if rb, re := recordSpan(r); rb < end && re > beg && !yield(r, nil) {
+				return
+			}
+		}
+	}
+}
+
+// offset returns the virtual offset from which records overlapping [beg, end) on tid can be
+// read, and false if there are no such records. Offsets in the linear index do not decrease,
+// so the first set window in the interval gives the lowest offset.
+func (self *MiniIndex) offset(tid, beg, end int) (int64, bool) {
+	if tid < 0 || tid >= len(self.refs) || end <= beg {
+		return 0, false
+	}
+	lin := self.refs[tid]
+	for w := max(beg, 0) >> miniIndexShift; w <= (end-1)>>miniIndexShift && w < len(lin); w++ {
+		if lin[w] >= 0 {
+			return lin[w], true
+		}
+	}
+	return 0, false
+}
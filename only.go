@@ -0,0 +1,31 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// IsPrimary is a RecordFilter retaining records that are neither secondary nor supplementary.
+func IsPrimary(r *Record) bool { return r.Flags()&(Secondary|Supplementary) == 0 }
+
+// IsMapped is a RecordFilter retaining mapped records.
+func IsMapped(r *Record) bool { return r.Flags()&Unmapped == 0 }
+
+// IsUnique is a RecordFilter retaining mapped primary records with an NH tag of one. Records
+// without an NH tag are retained if they are mapped and primary.
+func IsUnique(r *Record) bool {
+	if !IsMapped(r) || !IsPrimary(r) {
+		return false
+	}
+	nh, ok := r.HitCount()
+	return !ok || nh == 1
+}
+
+// PrimaryOnly returns a FilterReader reading the primary records of r. The reader r may be a
+// BAMFile, a SAMFile or an Iterator returned by Query.
+func PrimaryOnly(r RecordReader) *FilterReader { return NewFilterReader(r, IsPrimary) }
+
+// MappedOnly returns a FilterReader reading the mapped records of r.
+func MappedOnly(r RecordReader) *FilterReader { return NewFilterReader(r, IsMapped) }
+
+// UniqueOnly returns a FilterReader reading the records of r retained by IsUnique.
+func UniqueOnly(r RecordReader) *FilterReader { return NewFilterReader(r, IsUnique) }
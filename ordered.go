@@ -0,0 +1,116 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var writerClosed = errors.New("boom: ordered writer closed")
+
+// An OrderedWriter writes batches of records submitted concurrently by multiple goroutines to
+// a RecordWriter in the order of their sequence numbers. Batches are numbered from zero and
+// each sequence number must be submitted exactly once, with an empty batch if there are no
+// records. For parallel processing of regions, the index of each region in a sorted list of
+// regions may be used as the sequence number so that the output remains sorted.
+type OrderedWriter struct {
+	w      RecordWriter
+	window uint64
+
+	mu      sync.Mutex
+	ready   sync.Cond
+	next    uint64
+	pending map[uint64][]*Record
+	err     error
+	closed  bool
+}
+
+// NewOrderedWriter returns an OrderedWriter writing to w. If window is positive, calls to
+// Write for sequence numbers window or more ahead of the next batch to be written block until
+// the preceding batches have been written, bounding the number of held batches.
+func NewOrderedWriter(w RecordWriter, window int) *OrderedWriter {
+	ow := &OrderedWriter{w: w, pending: make(map[uint64][]*Record)}
+	if window > 0 {
+		ow.window = uint64(window)
+	}
+	ow.ready.L = &ow.mu
+	return ow
+}
+
+// Write submits the batch of records, recs, with the sequence number seq. If seq is the next
+// batch to be written, recs and any held batches that follow it are written by the calling
+// goroutine; otherwise recs is held until the preceding batches have been written. The
+// records must not be modified after they are passed to Write. Write returns the first
+// error that occurred while writing, which may be from another goroutine's batch.
+func (self *OrderedWriter) Write(seq uint64, recs []*Record) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for self.window != 0 && seq >= self.next+self.window && self.err == nil && !self.closed {
+		self.ready.Wait()
+	}
+	switch {
+	case self.err != nil:
+		return self.err
+	case self.closed:
+		return writerClosed
+	case seq < self.next:
+		return fmt.Errorf("boom: sequence number %d already written", seq)
+	}
+	if _, dup := self.pending[seq]; dup {
+		return fmt.Errorf("boom: sequence number %d already submitted", seq)
+	}
+	if recs == nil {
+		recs = []*Record{}
+	}
+	self.pending[seq] = recs
+
+	for {
+		recs, ok := self.pending[self.next]
+		if !ok {
+			break
+		}
+		delete(self.pending, self.next)
+		self.next++
+		for _, r := range recs {
+			n, err := self.w.Write(r)
+			if err == nil && n < 0 {
+				err = writeFailed
+			}
+			if err != nil {
+				self.err = err
+				self.ready.Broadcast()
+				return err
+			}
+		}
+		self.ready.Broadcast()
+	}
+	return nil
+}
+
+// Pending returns the number of batches held waiting for preceding batches.
+func (self *OrderedWriter) Pending() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return len(self.pending)
+}
+
+// Close marks the OrderedWriter as closed, releasing any blocked calls to Write. It returns
+// the first write error, or an error if batches are still held because a preceding sequence
+// number was never submitted. Close does not close the underlying RecordWriter.
+func (self *OrderedWriter) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.closed = true
+	self.ready.Broadcast()
+	if self.err != nil {
+		return self.err
+	}
+	if len(self.pending) != 0 {
+		return fmt.Errorf("boom: %d batches held waiting for sequence number %d", len(self.pending), self.next)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// An OverlapClipper is a Processor that clips the bases of the rightmost read of each pair
+// that align to the same reference positions as its mate, so that overlapping bases are not
+// counted twice by depth and variant calling analyses. Input must be coordinate sorted.
+// The end of the leftmost read is held until its mate is seen; if the leftmost read has not
+// been seen, its end is obtained from the MC tag of the rightmost read when present. Rightmost
+// reads contained entirely within their mates are not clipped. Mate positions are not adjusted,
+// so FixMates may be used on the name-grouped output to make mate information consistent.
+// Clipping may alter the order of coordinate-sorted records.
+type OverlapClipper struct {
+	// Hard specifies that overlapping bases are hard clipped
+	// rather than soft clipped.
+	Hard bool
+
+	Clipped      int // Number of records clipped.
+	ClippedBases int // Number of query bases clipped.
+	Contained    int // Number of records contained within their mates.
+
+	ends map[string]int
+}
+
+// NewOverlapClipper returns a soft clipping OverlapClipper.
+func NewOverlapClipper() *OverlapClipper {
+	return &OverlapClipper{ends: make(map[string]int)}
+}
+
+// Process clips the overlap between r and its mate if r is the rightmost read of its pair.
+func (self *OverlapClipper) Process(r *Record) (*Record, error) {
+	fl := r.Flags()
+	if fl&(Paired|Unmapped|MateUnmapped|Secondary|Supplementary) != Paired || r.RefID() != r.NextRefID() {
+		return r, nil
+	}
+	if self.ends == nil {
+		self.ends = make(map[string]int)
+	}
+	pos, mpos := r.Start(), r.NextStart()
+	name := r.Name()
+
+	mend, ok := self.ends[name]
+	switch {
+	case ok:
+		delete(self.ends, name)
+	case mpos < pos:
+		mc, ok := r.Tag([]byte("MC"))
+		if !ok || mc.Type() != 'Z' {
+			return r, nil
+		}
+		mcig, err := parseCigar(mc.Value().(string))
+		if err != nil {
+			return nil, err
+		}
+		mend = mpos + refLen(mcig)
+	default:
+		// r is the leftmost read, so hold its end if the mate may overlap it.
+		if end := pos + refLen(r.Cigar()); end > mpos {
+			self.ends[name] = end
+		}
+		return r, nil
+	}
+
+	if mend <= pos {
+		return r, nil
+	}
+	n, ok := r.clipStart(mend, self.Hard)
+	if !ok {
+		self.Contained++
+		return r, nil
+	}
+	self.Clipped++
+	self.ClippedBases += n
+	return r, nil
+}
+
+// Flush discards the ends of leftmost reads whose mates were not seen and returns no records.
+func (self *OverlapClipper) Flush() ([]*Record, error) {
+	self.ends = make(map[string]int)
+	return nil, nil
+}
@@ -0,0 +1,242 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"container/heap"
+	"io"
+	"sort"
+)
+
+// DefaultMaxPairDistance is the default bound on the distance between mates held in the
+// window of a PairReader.
+const DefaultMaxPairDistance = 1000
+
+// A Pair holds the primary records of a template. For paired records, Read1 and Read2 hold the
+// first and second reads; a nil field indicates that the mate was not found in the input.
+// Unpaired records are returned in Read1.
+type Pair struct {
+	Read1, Read2 *Record
+}
+
+// A PairReader matches mates from a coordinate-sorted RecordReader without requiring a name
+// sort. Records are held until their mates are read: records whose mates lie within the
+// maximum distance on the same reference are held in a window ordered by mate position and are
+// returned as orphans once reading has passed that position without the mate being found;
+// records with more distant mates are held in a side map that is only examined when reading
+// moves to a new reference. Secondary and supplementary records are skipped.
+type PairReader struct {
+	r       RecordReader
+	maxDist int
+
+	near   pendingHeap
+	far    map[string]*pending
+	byName map[string]*pending
+
+	tid, pos int
+	out      []Pair
+	err      error
+}
+
+// A pending record waiting for its mate.
+type pending struct {
+	r          *Record
+	mtid, mpos int
+	far        bool
+	index      int
+}
+
+// NewPairReader returns a PairReader reading from the coordinate-sorted r. Mates at most
+// maxDist bases apart are held in the window; if maxDist is zero, DefaultMaxPairDistance is
+// used.
+func NewPairReader(r RecordReader, maxDist int) *PairReader {
+	if maxDist == 0 {
+		maxDist = DefaultMaxPairDistance
+	}
+	return &PairReader{
+		r:       r,
+		maxDist: maxDist,
+		far:     make(map[string]*pending),
+		byName:  make(map[string]*pending),
+		tid:     -1,
+	}
+}
+
+// Pending returns the number of records held waiting for their mates.
+func (self *PairReader) Pending() int { return len(self.byName) }
+
+// Read returns the next Pair. Pairs are returned when their second record is read, so they are
+// ordered by the position of their rightmost read. At the end of the input, any unmatched
+// records are returned as orphans before io.EOF.
+func (self *PairReader) Read() (Pair, error) {
+	for len(self.out) == 0 {
+		if self.err != nil {
+			return Pair{}, self.err
+		}
+		self.step()
+	}
+	p := self.out[0]
+	self.out = self.out[1:]
+	return p, nil
+}
+
+// step reads one record, queueing any Pairs completed or orphaned.
+func (self *PairReader) step() {
+	r, _, err := self.r.Read()
+	if err != nil {
+		if err == io.EOF {
+			self.flushAll()
+		}
+		self.err = err
+		return
+	}
+	self.add(r)
+}
+
+// add adds the record r to the held records, queueing any Pairs completed or orphaned.
+func (self *PairReader) add(r *Record) {
+	fl := r.Flags()
+	if fl&(Secondary|Supplementary) != 0 {
+		return
+	}
+
+	tid, pos := r.RefID(), r.Start()
+	if tid >= 0 {
+		if tid != self.tid {
+			self.flushFar(tid)
+		}
+		self.tid, self.pos = tid, pos
+		self.evict(tid, pos)
+	}
+
+	if fl&Paired == 0 {
+		self.out = append(self.out, Pair{Read1: r})
+		return
+	}
+	name := r.Name()
+	if p, ok := self.byName[name]; ok {
+		self.remove(name, p)
+		self.out = append(self.out, makePair(p.r, r))
+		return
+	}
+
+	mtid, mpos := r.NextRefID(), r.NextStart()
+	if mtid >= 0 && tid >= 0 && (mtid < tid || (mtid == tid && mpos < pos)) {
+		// The mate should already have been read.
+		self.out = append(self.out, makePair(r, nil))
+		return
+	}
+	p := &pending{r: r, mtid: mtid, mpos: mpos}
+	self.byName[name] = p
+	if mtid != tid || mpos-pos > self.maxDist || tid < 0 {
+		p.far = true
+		self.far[name] = p
+		return
+	}
+	heap.Push(&self.near, p)
+}
+
+// remove removes the pending record p from the held records.
+func (self *PairReader) remove(name string, p *pending) {
+	delete(self.byName, name)
+	if p.far {
+		delete(self.far, name)
+	} else {
+		heap.Remove(&self.near, p.index)
+	}
+}
+
+// evict returns as orphans the records in the window whose mates lie before pos on tid.
+func (self *PairReader) evict(tid, pos int) {
+	for len(self.near) != 0 {
+		p := self.near[0]
+		if p.mtid > tid || (p.mtid == tid && p.mpos >= pos) {
+			break
+		}
+		heap.Pop(&self.near)
+		delete(self.byName, p.r.Name())
+		self.out = append(self.out, makePair(p.r, nil))
+	}
+}
+
+// flushFar returns as orphans the records in the side map whose mates lie on references before tid.
+func (self *PairReader) flushFar(tid int) {
+	var orphans []*pending
+	for name, p := range self.far {
+		if p.mtid >= 0 && p.mtid < tid {
+			delete(self.far, name)
+			delete(self.byName, name)
+			orphans = append(orphans, p)
+		}
+	}
+	self.queueOrphans(orphans)
+}
+
+// flushAll returns all held records as orphans.
+func (self *PairReader) flushAll() {
+	orphans := make([]*pending, 0, len(self.byName))
+	for _, p := range self.byName {
+		orphans = append(orphans, p)
+	}
+	self.byName = make(map[string]*pending)
+	self.far = make(map[string]*pending)
+	self.near = self.near[:0]
+	self.queueOrphans(orphans)
+}
+
+// queueOrphans queues the records as orphans in file order.
+func (self *PairReader) queueOrphans(orphans []*pending) {
+	sort.Slice(orphans, func(i, j int) bool {
+		a, b := orphans[i].r, orphans[j].r
+		if a.RefID() != b.RefID() {
+			return uint(a.RefID()) < uint(b.RefID())
+		}
+		if a.Start() != b.Start() {
+			return a.Start() < b.Start()
+		}
+		return a.Name() < b.Name()
+	})
+	for _, p := range orphans {
+		self.out = append(self.out, makePair(p.r, nil))
+	}
+}
+
+// makePair returns a Pair holding the mates a and b, either of which may be nil.
+func makePair(a, b *Record) Pair {
+	if a == nil {
+		a, b = b, a
+	}
+	if a.Flags()&Read2 != 0 {
+		return Pair{Read1: b, Read2: a}
+	}
+	return Pair{Read1: a, Read2: b}
+}
+
+// pendingHeap is a min-heap of pending records ordered by mate position.
+type pendingHeap []*pending
+
+func (h pendingHeap) Len() int { return len(h) }
+func (h pendingHeap) Less(i, j int) bool {
+	if h[i].mtid != h[j].mtid {
+		return h[i].mtid < h[j].mtid
+	}
+	return h[i].mpos < h[j].mpos
+}
+func (h pendingHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *pendingHeap) Push(x interface{}) {
+	p := x.(*pending)
+	p.index = len(*h)
+	*h = append(*h, p)
+}
+func (h *pendingHeap) Pop() interface{} {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
@@ -0,0 +1,137 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"sort"
+)
+
+// DefaultPrimerTolerance is the default number of bases outside a primer that a read end may
+// lie and still be considered to start within the primer.
+const DefaultPrimerTolerance = 5
+
+// A PrimerClipper is a Processor that clips amplicon primer sequences from aligned reads in the
+// manner of samtools ampliconclip. A read whose 5' end lies within a primer, or within Tolerance
+// bases outside it, has the bases aligned to the primer clipped, with its position, CIGAR and
+// template length adjusted. The mate position is not adjusted, so FixMates may be used on the
+// name-grouped output to make mate information consistent. Clipping may alter the order of
+// coordinate-sorted records.
+type PrimerClipper struct {
+	// Hard specifies that primer bases are hard clipped rather
+	// than soft clipped.
+	Hard bool
+
+	// BothEnds specifies that primers are clipped from both ends
+	// of reads rather than only from the 5' end.
+	BothEnds bool
+
+	// Tolerance is the allowed distance of a read end outside a
+	// primer. If Tolerance is negative, read ends must lie within
+	// primers.
+	Tolerance int
+
+	// DropUnclippable specifies that mapped reads lying entirely
+	// within primers are dropped. Otherwise they are passed on
+	// unaltered.
+	DropUnclippable bool
+
+	Clipped     int // Number of records clipped.
+	Unclippable int // Number of records lying entirely within primers.
+
+	primers [][]Region
+	maxLen  []int
+}
+
+// NewPrimerClipper returns a soft clipping PrimerClipper using the primer regions, primers, and
+// DefaultPrimerTolerance.
+func NewPrimerClipper(primers []Region) *PrimerClipper {
+	p := &PrimerClipper{Tolerance: DefaultPrimerTolerance}
+	for _, r := range primers {
+		for len(p.primers) <= r.RefID {
+			p.primers = append(p.primers, nil)
+			p.maxLen = append(p.maxLen, 0)
+		}
+		p.primers[r.RefID] = append(p.primers[r.RefID], r)
+		if r.Len() > p.maxLen[r.RefID] {
+			p.maxLen[r.RefID] = r.Len()
+		}
+	}
+	for _, regs := range p.primers {
+		sort.Slice(regs, func(i, j int) bool { return regs[i].Start < regs[j].Start })
+	}
+	return p
+}
+
+// Process clips primer bases from r.
+func (self *PrimerClipper) Process(r *Record) (*Record, error) {
+	fl := r.Flags()
+	tid := r.RefID()
+	if fl&Unmapped != 0 || tid < 0 || tid >= len(self.primers) {
+		return r, nil
+	}
+	tol := self.Tolerance
+	if tol < 0 {
+		tol = 0
+	}
+	rev := fl&Reverse != 0
+	beg, end := r.Start(), r.Start()+refLen(r.Cigar())
+
+	// Find the primers containing the alignment ends.
+	primerEnd, primerStart := -1, -1
+	regs := self.primers[tid]
+	i := sort.Search(len(regs), func(i int) bool { return regs[i].Start > end+tol })
+	for i--; i >= 0 && regs[i].Start+self.maxLen[tid]+tol >= beg; i-- {
+		p := regs[i]
+		if (!rev || self.BothEnds) && p.Start-tol <= beg && beg < p.End && p.End > primerEnd {
+			primerEnd = p.End
+		}
+		if (rev || self.BothEnds) && p.Start < end && end <= p.End+tol && (primerStart < 0 || p.Start < primerStart) {
+			primerStart = p.Start
+		}
+	}
+	if primerEnd < 0 && primerStart < 0 {
+		return r, nil
+	}
+	if primerEnd >= 0 && primerStart >= 0 && primerEnd >= primerStart ||
+		primerEnd >= end || primerStart >= 0 && primerStart <= beg {
+		self.Unclippable++
+		if self.DropUnclippable {
+			return nil, nil
+		}
+		return r, nil
+	}
+
+	tlen := r.TemplateLen()
+	if primerEnd >= 0 {
+		if _, ok := r.clipStart(primerEnd, self.Hard); !ok {
+			self.Unclippable++
+			if self.DropUnclippable {
+				return nil, nil
+			}
+			return r, nil
+		}
+		if tlen > 0 {
+			tlen -= r.Start() - beg
+		}
+	}
+	if primerStart >= 0 {
+		if _, ok := r.clipEnd(primerStart, self.Hard); !ok {
+			self.Unclippable++
+			if self.DropUnclippable {
+				return nil, nil
+			}
+			return r, nil
+		}
+		if tlen < 0 {
+			tlen += end - (r.Start() + refLen(r.Cigar()))
+		}
+	}
+	r.setIsize(int32(tlen))
+	self.Clipped++
+	return r, nil
+}
+
+// Flush returns no records.
+func (self *PrimerClipper) Flush() ([]*Record, error) { return nil, nil }
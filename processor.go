@@ -0,0 +1,168 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+)
+
+// A RecordWriter writes alignment records. BAMFile and SAMFile satisfy RecordWriter.
+type RecordWriter interface {
+	Write(r *Record) (n int, err error)
+}
+
+// A Processor is a stage of a record processing pipeline.
+type Processor interface {
+	// Process handles the record r, returning the record to pass
+	// to the next stage or nil if no record is to be passed on.
+	// A Processor that holds records back, such as one reordering
+	// or grouping records, may return a previously held record.
+	Process(r *Record) (*Record, error)
+
+	// Flush is called once at the end of the input and returns any
+	// records still held by the Processor, in output order.
+	Flush() ([]*Record, error)
+}
+
+// A ProcessorFunc is a Processor that holds no records. Returning a nil Record drops the
+// record.
+type ProcessorFunc func(r *Record) (*Record, error)
+
+// Process returns fn(r).
+func (fn ProcessorFunc) Process(r *Record) (*Record, error) { return fn(r) }
+
+// Flush returns no records.
+func (fn ProcessorFunc) Flush() ([]*Record, error) { return nil, nil }
+
+// FilterProcessor returns a Processor that drops records not retained by keep.
+func FilterProcessor(keep RecordFilter) Processor {
+	return ProcessorFunc(func(r *Record) (*Record, error) {
+		if !keep(r) {
+			return nil, nil
+		}
+		return r, nil
+	})
+}
+
+// A Pipeline is a sequence of Processors applied in order. A Pipeline is itself a Processor.
+type Pipeline []Processor
+
+// Process passes r through each stage of the pipeline in turn, returning the record emitted
+// by the final stage, or nil if a stage did not pass a record on.
+func (self Pipeline) Process(r *Record) (*Record, error) {
+	return self.from(0, r)
+}
+
+// from passes r through the pipeline starting at stage i.
+func (self Pipeline) from(i int, r *Record) (*Record, error) {
+	var err error
+	for _, p := range self[i:] {
+		r, err = p.Process(r)
+		if err != nil || r == nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Flush flushes each stage in order, passing the records flushed from a stage through the
+// subsequent stages before they are flushed, and returns the records emitted by the final
+// stage.
+func (self Pipeline) Flush() ([]*Record, error) {
+	var out []*Record
+	for i, p := range self {
+		recs, err := p.Flush()
+		if err != nil {
+			return out, err
+		}
+		for _, r := range recs {
+			r, err = self.from(i+1, r)
+			if err != nil {
+				return out, err
+			}
+			if r != nil {
+				out = append(out, r)
+			}
+		}
+	}
+	return out, nil
+}
+
+// Run reads all the remaining records from r, passes them through the pipeline and writes the
+// resulting records to w, flushing the pipeline at the end of the input.
+func (self Pipeline) Run(r RecordReader, w RecordWriter) error {
+	write := func(rec *Record) error {
+		n, err := w.Write(rec)
+		if err == nil && n < 0 {
+			err = writeFailed
+		}
+		return err
+	}
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		rec, err = self.Process(rec)
+		if err != nil {
+			return err
+		}
+		if rec != nil {
+			err = write(rec)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	recs, err := self.Flush()
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		err = write(rec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A ProcessorWriter is a RecordWriter that passes records through a Processor before writing
+// them to an underlying RecordWriter. Flush must be called after the final record is written.
+type ProcessorWriter struct {
+	W RecordWriter
+	P Processor
+}
+
+// Write processes r and writes the resulting record, if any. The returned count is the number
+// of bytes written, which is zero if the Processor held or dropped the record.
+func (self *ProcessorWriter) Write(r *Record) (n int, err error) {
+	r, err = self.P.Process(r)
+	if err != nil || r == nil {
+		return 0, err
+	}
+	return self.W.Write(r)
+}
+
+// Flush flushes the Processor and writes any records it returns.
+func (self *ProcessorWriter) Flush() error {
+	recs, err := self.P.Flush()
+	if err != nil {
+		return err
+	}
+	for _, r := range recs {
+		n, err := self.W.Write(r)
+		if err == nil && n < 0 {
+			err = writeFailed
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
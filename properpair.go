@@ -0,0 +1,185 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sort"
+)
+
+var (
+	badPercentiles = errors.New("boom: percentiles must satisfy 0 <= lower <= upper <= 1")
+	noPairs        = errors.New("boom: no pairs with the required orientation")
+)
+
+// A PairOrientation describes the relative strands of the mates of a pair.
+type PairOrientation int
+
+const (
+	// InwardPair (FR) pairs have a forward strand leftmost read and a
+	// reverse strand rightmost read, as produced by standard paired-end
+	// libraries.
+	InwardPair PairOrientation = iota
+
+	// OutwardPair (RF) pairs have a reverse strand leftmost read and a
+	// forward strand rightmost read, as produced by mate-pair libraries.
+	OutwardPair
+
+	// TandemPair (FF/RR) pairs have both reads on the same strand.
+	TandemPair
+)
+
+// ProperPairOptions specifies the behaviour of ReflagProperPairs.
+type ProperPairOptions struct {
+	// Lower and Upper are the percentiles of the empirical insert
+	// size distribution bounding the insert sizes of proper pairs.
+	// If both are zero, 0.005 and 0.995 are used.
+	Lower, Upper float64
+
+	// Orientation is the orientation required of proper pairs.
+	Orientation PairOrientation
+}
+
+// orientation returns the orientation of the pair of which r is a member, and whether the
+// orientation can be determined.
+func orientation(r *Record) (PairOrientation, bool) {
+	fl := r.Flags()
+	if fl&(Paired|Unmapped|MateUnmapped) != Paired || r.RefID() != r.NextRefID() {
+		return 0, false
+	}
+	rev, mrev := fl&Reverse != 0, fl&MateReverse != 0
+	if rev == mrev {
+		return TandemPair, true
+	}
+	var leftRev bool
+	switch pos, mpos := r.Start(), r.NextStart(); {
+	case pos < mpos:
+		leftRev = rev
+	case pos > mpos:
+		leftRev = mrev
+	default:
+		// Overlapping starts with opposing strands are treated as inward.
+		return InwardPair, true
+	}
+	if leftRev {
+		return OutwardPair, true
+	}
+	return InwardPair, true
+}
+
+// ReflagProperPairs reads the BAM file, in, and learns the distribution of absolute template
+// lengths of pairs with both reads mapped to the same reference in the orientation given by
+// opts. The records are then written to the BAM file, out, with the ProperPair flag set for
+// pairs with that orientation and template lengths within the Lower and Upper percentiles of
+// the distribution, and cleared for all other records. Secondary, supplementary, QC failed and
+// duplicate records do not contribute to the distribution. The template length bounds applied
+// are returned. If opts is nil, inward pairs within the 0.5th and 99.5th percentiles are
+// retained.
+func ReflagProperPairs(in, out string, opts *ProperPairOptions) (lo, hi int, err error) {
+	var o ProperPairOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Lower == 0 && o.Upper == 0 {
+		o.Lower, o.Upper = 0.005, 0.995
+	}
+	if o.Lower < 0 || o.Upper > 1 || o.Lower > o.Upper {
+		return 0, 0, badPercentiles
+	}
+
+	f, err := OpenBAM(in)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	start, err := f.Tell()
+	if err != nil {
+		return 0, 0, err
+	}
+	counts := make(map[int]int)
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, 0, err
+		}
+		if r.Flags()&(Secondary|Supplementary|QCFail|Duplicate) != 0 {
+			continue
+		}
+		if ori, ok := orientation(r); ok && ori == o.Orientation {
+			if tlen := r.TemplateLen(); tlen > 0 {
+				counts[tlen]++
+			}
+		}
+	}
+	if len(counts) == 0 {
+		return 0, 0, noPairs
+	}
+	lo, hi = quantile(counts, o.Lower), quantile(counts, o.Upper)
+
+	err = f.SeekVirtual(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	bf, err := CreateBAM(out, f.Header(), true)
+	if err != nil {
+		return 0, 0, err
+	}
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			bf.Close()
+			return 0, 0, err
+		}
+		fl := r.Flags() &^ ProperPair
+		if ori, ok := orientation(r); ok && ori == o.Orientation {
+			if tlen := abs(r.TemplateLen()); lo <= tlen && tlen <= hi {
+				fl |= ProperPair
+			}
+		}
+		r.SetFlags(fl)
+		n, err := bf.Write(r)
+		if err == nil && n < 0 {
+			err = writeFailed
+		}
+		if err != nil {
+			bf.Close()
+			return 0, 0, err
+		}
+	}
+
+	return lo, hi, bf.Close()
+}
+
+// quantile returns the value at the qth quantile of the values held with their counts in
+// counts, using the nearest rank method.
+func quantile(counts map[int]int, q float64) int {
+	vals := make([]int, 0, len(counts))
+	var n int
+	for v, c := range counts {
+		vals = append(vals, v)
+		n += c
+	}
+	sort.Ints(vals)
+	rank := int(math.Ceil(q * float64(n)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int
+	for _, v := range vals {
+		seen += counts[v]
+		if seen >= rank {
+			return v
+		}
+	}
+	return vals[len(vals)-1]
+}
@@ -0,0 +1,51 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// A Pruner is a Processor that drops secondary and supplementary alignments, as is commonly
+// done before quantification.
+type Pruner struct {
+	// Secondary and Supplementary specify which alignments
+	// are dropped.
+	Secondary     bool
+	Supplementary bool
+
+	// RewriteHits specifies that when secondary alignments are
+	// dropped, the NH and HI tags of retained records are set to
+	// one, since each query then has a single reported alignment.
+	// Only tags already present are rewritten.
+	RewriteHits bool
+
+	Dropped int // Number of records dropped.
+}
+
+// NewPruner returns a Pruner dropping both secondary and supplementary alignments and
+// rewriting the NH and HI tags of retained records.
+func NewPruner() *Pruner {
+	return &Pruner{Secondary: true, Supplementary: true, RewriteHits: true}
+}
+
+// Process returns r, or nil if r is dropped.
+func (self *Pruner) Process(r *Record) (*Record, error) {
+	fl := r.Flags()
+	if (self.Secondary && fl&Secondary != 0) || (self.Supplementary && fl&Supplementary != 0) {
+		self.Dropped++
+		return nil, nil
+	}
+	if self.RewriteHits && self.Secondary {
+		for _, t := range []Tag{{'N', 'H'}, {'H', 'I'}} {
+			if v, ok := intTag(r, t.String()); ok && v != 1 {
+				err := setTag(r, t, uint8(1))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// Flush returns no records.
+func (self *Pruner) Flush() ([]*Record, error) { return nil, nil }
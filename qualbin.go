@@ -0,0 +1,78 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+)
+
+var badBins = errors.New("boom: quality bin bounds must be increasing and match values")
+
+// QualityBins is a Processor that replaces each base quality score q of a record with
+// QualityBins[q], reducing the number of distinct scores so that BAM output compresses better.
+// Missing qualities are left unaltered.
+type QualityBins [256]byte
+
+// IlluminaBins is the Illumina 8-level quality binning scheme: scores below 2 are unaltered,
+// 2-9 become 6, 10-19 become 15, 20-24 become 22, 25-29 become 27, 30-34 become 33, 35-39
+// become 37 and scores of 40 or more become 40.
+var IlluminaBins = mustQualityBins(
+	[]byte{2, 10, 20, 25, 30, 35, 40},
+	[]byte{6, 15, 22, 27, 33, 37, 40},
+)
+
+// NewQualityBins returns QualityBins mapping scores of at least bounds[i] and below bounds[i+1]
+// to values[i]. Scores below bounds[0] are unaltered and scores of at least the final bound are
+// mapped to the final value.
+func NewQualityBins(bounds, values []byte) (*QualityBins, error) {
+	if len(bounds) != len(values) || len(bounds) == 0 {
+		return nil, badBins
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return nil, badBins
+		}
+	}
+	var b QualityBins
+	for q := range b {
+		b[q] = byte(q)
+	}
+	for i, lo := range bounds {
+		hi := 0xff
+		if i+1 < len(bounds) {
+			hi = int(bounds[i+1])
+		}
+		for q := int(lo); q < hi; q++ {
+			b[q] = values[i]
+		}
+	}
+	b[0xff] = 0xff
+	return &b, nil
+}
+
+func mustQualityBins(bounds, values []byte) *QualityBins {
+	b, err := NewQualityBins(bounds, values)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Process bins the base quality scores of r.
+func (self *QualityBins) Process(r *Record) (*Record, error) {
+	q := r.Quality()
+	if len(q) == 0 || q[0] == 0xff {
+		return r, nil
+	}
+	binned := make([]byte, len(q))
+	for i, s := range q {
+		binned[i] = self[s]
+	}
+	r.SetQuality(binned)
+	return r, nil
+}
+
+// Flush returns no records.
+func (self *QualityBins) Flush() ([]*Record, error) { return nil, nil }
@@ -0,0 +1,122 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+	"io"
+	"syscall"
+)
+
+// A ReadError is the error returned when a record cannot be read for a reason other than
+// reaching the end of the file, such as a truncated file or a failing device.
+type ReadError struct {
+	Code   int        // The value returned by libbam.
+	Reason string     // A description of the failure.
+	Err    error      // The underlying system error, or nil.
+	Pos    *RecordPos // The position of the failed read if it is known.
+}
+
+func (e *ReadError) Error() string {
+	s := "boom: read failed: " + e.Reason
+	if e.Err != nil {
+		s = fmt.Sprintf("%s: %v", s, e.Err)
+	}
+	if e.Pos != nil {
+		s += " at " + e.Pos.String()
+	}
+	return s
+}
+
+// Unwrap returns the underlying system error.
+func (e *ReadError) Unwrap() error { return e.Err }
+
+// A RecordPos describes the position of a record in the stream of records read from a file,
+// allowing an offending record to be located and inspected with other tools.
+type RecordPos struct {
+	// Ordinal is the number of records preceding the record
+	// in the stream, counted from the opening of the file or
+	// the last seek, or from the start of an iteration over
+	// an indexed region.
+	Ordinal int64
+
+	// Offset is the BGZF virtual file offset of the start of
+	// the record, or -1 if it is not known. Offsets are not
+	// known for SAM files or for records read from indexed
+	// regions.
+	Offset int64
+}
+
+func (p *RecordPos) String() string {
+	if p.Offset < 0 {
+		return fmt.Sprintf("record %d", p.Ordinal)
+	}
+	return fmt.Sprintf("record %d, virtual offset %d (block %d, offset %d)",
+		p.Ordinal, p.Offset, p.Offset>>16, p.Offset&0xffff)
+}
+
+// atPos returns err with the position of the record described by ordinal and off recorded
+// if err is a *MalformedRecord or a *ReadError.
+func atPos(err error, ordinal, off int64) error {
+	switch e := err.(type) {
+	case *MalformedRecord:
+		e.Pos = &RecordPos{Ordinal: ordinal, Offset: off}
+	case *ReadError:
+		e.Pos = &RecordPos{Ordinal: ordinal, Offset: off}
+	}
+	return err
+}
+
+// bamReadReasons and samReadReasons describe the negative values returned by bam_read1 and
+// bam_iter_read, and by sam_read1, indexed by the negated value.
+var (
+	bamReadReasons = []string{
+		2: "truncated record length",
+		3: "truncated record fields",
+		4: "truncated record data",
+		5: "invalid record in indexed region",
+	}
+	samReadReasons = []string{
+		2: "missing reference name",
+		3: "missing fields following reference name",
+		4: "invalid mate reference name",
+		5: "missing sequence",
+		6: "missing quality scores",
+	}
+)
+
+// readError returns the error corresponding to the negative value, ret, returned by a libbam
+// read on the file, and errno, the value of errno following the read. A normal end of file is
+// reported as io.EOF.
+func (sf *samFile) readError(ret int, errno error) error {
+	failed, reason := sf.ferror()
+	if ret == -1 && !failed {
+		return io.EOF
+	}
+	e := &ReadError{Code: ret}
+	if failed {
+		if en, ok := errno.(syscall.Errno); ok && en != 0 {
+			e.Err = en
+		} else {
+			e.Err = syscall.EIO
+		}
+	}
+	reasons := samReadReasons
+	if sf.fileType()&bamFile != 0 {
+		reasons = bamReadReasons
+	}
+	switch {
+	case -ret < len(reasons) && reasons[-ret] != "":
+		e.Reason = reasons[-ret]
+	case failed:
+		e.Reason = "I/O error"
+	default:
+		e.Reason = fmt.Sprintf("error %d", ret)
+	}
+	if reason != "" {
+		e.Reason += " (BGZF " + reason + ")"
+	}
+	return e
+}
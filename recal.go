@@ -0,0 +1,180 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Default quality limits used by NewRecalibrator.
+const (
+	DefaultPreserveQuality = 6
+	DefaultMaxQuality      = 93
+)
+
+// A RecalKey identifies a recalibration covariate. Keys with a zero Quality hold read group
+// adjustments, keys with a zero Cycle and empty Context hold adjustments for a reported quality
+// within a read group, and keys with a non-zero Cycle or non-empty Context hold adjustments for
+// machine cycle and dinucleotide context given the read group and reported quality.
+type RecalKey struct {
+	ReadGroup string
+	Quality   byte
+
+	// Cycle is the one-based position of the base in sequencing
+	// order, negated for the second read of a pair.
+	Cycle int
+
+	// Context is the base preceding the base in sequencing order
+	// followed by the base itself, both on the sequenced strand.
+	Context string
+}
+
+// A RecalTable holds additive quality score adjustments keyed by covariate. The recalibrated
+// quality of a base is its reported quality plus the adjustments held for its read group, its
+// read group and reported quality, its cycle and its context. Absent keys contribute nothing.
+type RecalTable map[RecalKey]float64
+
+// ReadRecalTable reads a recalibration table from r. Each non-empty line not starting with '#'
+// holds tab-separated read group, reported quality, cycle, context and adjustment fields. A
+// quality or cycle of "0" or "*" and a context of "*" indicate that the covariate is not used.
+func ReadRecalTable(r io.Reader) (RecalTable, error) {
+	t := make(RecalTable)
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		s := sc.Text()
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		f := strings.Split(s, "\t")
+		if len(f) != 5 {
+			return nil, fmt.Errorf("boom: wrong number of fields in recalibration table line %d", line)
+		}
+		var (
+			k   = RecalKey{ReadGroup: f[0]}
+			err error
+		)
+		if f[1] != "*" {
+			var q int
+			q, err = strconv.Atoi(f[1])
+			if err != nil || q < 0 || q > 0xfe {
+				return nil, fmt.Errorf("boom: bad quality in recalibration table line %d", line)
+			}
+			k.Quality = byte(q)
+		}
+		if f[2] != "*" {
+			k.Cycle, err = strconv.Atoi(f[2])
+			if err != nil {
+				return nil, fmt.Errorf("boom: bad cycle in recalibration table line %d: %v", line, err)
+			}
+		}
+		if f[3] != "*" {
+			k.Context = f[3]
+		}
+		d, err := strconv.ParseFloat(f[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("boom: bad adjustment in recalibration table line %d: %v", line, err)
+		}
+		t[k] = d
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// A Recalibrator is a Processor that applies a RecalTable to the base qualities of records.
+// Records without an RG tag are recalibrated using the adjustments for the empty read group.
+type Recalibrator struct {
+	Table RecalTable
+
+	// Preserve is the quality below which scores are not altered.
+	Preserve byte
+
+	// Max is the maximum recalibrated quality.
+	Max byte
+}
+
+// NewRecalibrator returns a Recalibrator applying t with DefaultPreserveQuality and
+// DefaultMaxQuality.
+func NewRecalibrator(t RecalTable) *Recalibrator {
+	return &Recalibrator{Table: t, Preserve: DefaultPreserveQuality, Max: DefaultMaxQuality}
+}
+
+// Process recalibrates the base qualities of r.
+func (self *Recalibrator) Process(r *Record) (*Record, error) {
+	q := r.Quality()
+	if len(q) == 0 || q[0] == 0xff {
+		return r, nil
+	}
+	var rg string
+	if a, ok := r.Tag([]byte("RG")); ok && a.Type() == 'Z' {
+		rg = a.Value().(string)
+	}
+	fl := r.Flags()
+	rev := fl&Reverse != 0
+	sign := 1
+	if fl&(Paired|Read2) == Paired|Read2 {
+		sign = -1
+	}
+	seq := r.Seq()
+	rgDelta := self.Table[RecalKey{ReadGroup: rg}]
+
+	recal := make([]byte, len(q))
+	for i, s := range q {
+		if s < self.Preserve {
+			recal[i] = s
+			continue
+		}
+		// Determine the cycle and context in sequencing order.
+		cycle, prev, cur := i+1, -1, seq[i]
+		if rev {
+			cycle = len(q) - i
+			cur = complement(cur)
+			if i+1 < len(seq) {
+				prev = int(complement(seq[i+1]))
+			}
+		} else if i > 0 {
+			prev = int(seq[i-1])
+		}
+		d := rgDelta + self.Table[RecalKey{ReadGroup: rg, Quality: s}]
+		d += self.Table[RecalKey{ReadGroup: rg, Quality: s, Cycle: sign * cycle}]
+		if prev >= 0 {
+			d += self.Table[RecalKey{ReadGroup: rg, Quality: s, Context: string([]byte{byte(prev), cur})}]
+		}
+		v := math.Round(float64(s) + d)
+		switch {
+		case v < 0:
+			v = 0
+		case v > float64(self.Max):
+			v = float64(self.Max)
+		}
+		recal[i] = byte(v)
+	}
+	r.SetQuality(recal)
+	return r, nil
+}
+
+// Flush returns no records.
+func (self *Recalibrator) Flush() ([]*Record, error) { return nil, nil }
+
+// complement returns the complement of the IUPAC nucleotide b.
+func complement(b byte) byte {
+	switch b {
+	case 'A':
+		return 'T'
+	case 'C':
+		return 'G'
+	case 'G':
+		return 'C'
+	case 'T':
+		return 'A'
+	}
+	return 'N'
+}
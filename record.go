@@ -9,20 +9,32 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"strings"
 	"unsafe"
 )
 
 // A Record contains alignment data for one BAM alignment record.
 type Record struct {
 	*bamRecord
-	unmarshalled bool
-	marshalled   bool
-	cigar        []CigarOp
-	nameStr      string
-	seqBytes     []byte
-	qualScores   []byte
-	auxBytes     []byte
-	auxTags      []Aux
+	decoded    recordField
+	marshalled bool
+	cigar      []CigarOp
+	nameStr    string
+	seqBytes   []byte
+	qualScores []byte
+	auxBytes   []byte
+	auxTags    []Aux
+
+	// alpha is the Alphabet used to decode and encode the
+	// sequence, or nil for UpperAlphabet.
+	alpha *Alphabet
+
+	// refs holds the reference sequence names of the header
+	// of the file the record was read from, if known.
+	refs []string
 }
 
 // NewRecord creates a new BAM record type, allocating the required C stuctures.
@@ -31,57 +43,58 @@ func NewRecord() (r *Record, err error) {
 	if err != nil {
 		return
 	}
-	r = &Record{bamRecord: br}
+	r = &Record{bamRecord: br, decoded: allFields}
 
 	return
 }
 
 // RefID returns the target ID number for the alignment.
 func (self *Record) RefID() int {
-	self.unmarshalData()
 	return int(self.tid())
 }
 
 // Name returns the name of the alignment query.
 func (self *Record) Name() string {
-	self.unmarshalData()
+	self.decode(nameField)
 	return self.nameStr
 }
 
 // Seq returns a byte slice containing the sequence of the alignment query.
 func (self *Record) Seq() []byte {
-	self.unmarshalData()
+	self.decode(seqField)
 	return self.seqBytes
 }
 
 // Quality returns a byte slice containing the Phred quality scores of the alignment query.
 func (self *Record) Quality() []byte {
-	self.unmarshalData()
+	self.decode(qualField)
 	return self.qualScores
 }
 
 // SetSeq sets the sequence of the alignment query to the byte slice s.
 func (self *Record) SetSeq(s []byte) {
+	self.unmarshalData()
 	self.seqBytes = s
 	self.marshalled = false
 }
 
 // SetQuality sets the sequence of the alignment query to the byte slice q.
 func (self *Record) SetQuality(q []byte) {
+	self.unmarshalData()
 	self.qualScores = q
 	self.marshalled = false
 }
 
 // Cigar returns a slice of CigarOps describing the alignment.
 func (self *Record) Cigar() []CigarOp {
-	self.unmarshalData()
+	self.decode(cigarField)
 	return self.cigar
 }
 
 // Tag returns an Aux tag whose tag ID matches the first two bytes of tag and true.
 // If no tag matches, nil and false are returned.
 func (self *Record) Tag(tag []byte) (v Aux, ok bool) {
-	self.unmarshalData()
+	self.decode(auxField)
 	for i := range self.auxTags {
 		if bytes.Compare(self.auxTags[i][:2], tag) == 0 {
 			return self.auxTags[i], true
@@ -92,10 +105,83 @@ func (self *Record) Tag(tag []byte) (v Aux, ok bool) {
 
 // Tags returns all Aux tags for the aligment.
 func (self *Record) Tags() []Aux {
-	self.unmarshalData()
+	self.decode(auxField)
 	return self.auxTags
 }
 
+// SetTags sets the Aux tags for the alignment to aa.
+func (self *Record) SetTags(aa []Aux) {
+	self.unmarshalData()
+	self.auxBytes = buildAux(aa)
+	self.auxTags = parseAux(self.auxBytes)
+	self.marshalled = false
+}
+
+// RawData returns a copy of the BAM encoded variable length data of the record: the
+// NUL-terminated read name, CIGAR operations, 4-bit encoded sequence, quality scores and
+// auxiliary fields, in the byte order of the host. Pending changes made by setter methods
+// are encoded into the returned data. The returned slice may be retained and modified
+// without affecting the record.
+func (self *Record) RawData() []byte {
+	if !self.marshalled {
+		return self.marshalData()
+	}
+	return self.data()
+}
+
+// Clone returns a deep copy of the record that shares no memory with it. Pending changes made
+// by setter methods are included in the copy.
+func (self *Record) Clone() (*Record, error) {
+	d := self.RawData()
+	br, err := self.cloneCore()
+	if err != nil {
+		return nil, err
+	}
+	br.setData(d)
+	return &Record{bamRecord: br, marshalled: true, alpha: self.alpha, refs: self.refs}, nil
+}
+
+// A RecordCore holds the fixed-length fields of a BAM record, as described in the SAM/BAM
+// format specification. The length fields describe the layout of the variable length data
+// returned by RecordData.
+type RecordCore struct {
+	RefID     int32  // Reference sequence ID, -1 for unplaced records.
+	Pos       int32  // Zero-based leftmost position, -1 for unplaced records.
+	Bin       uint16 // BAM index bin.
+	MapQ      uint8  // Mapping quality.
+	LQName    uint8  // Length of the read name including the NUL terminator.
+	Flags     Flags  // Bitwise flags.
+	NCigar    uint16 // Number of CIGAR operations.
+	LSeq      int32  // Length of the sequence.
+	NextRefID int32  // Reference sequence ID of the next segment.
+	NextPos   int32  // Zero-based leftmost position of the next segment.
+	TLen      int32  // Template length.
+	LAux      int32  // Length of the auxiliary field data.
+}
+
+// RecordData returns a copy of the BAM encoded variable length data of the record, as
+// described for RawData, and the fixed-length fields describing it. The variable length data
+// comprises, in order, LQName bytes of read name, NCigar 32-bit CIGAR operations, (LSeq+1)/2
+// bytes of 4-bit encoded sequence, LSeq bytes of quality scores and LAux bytes of auxiliary
+// fields.
+func (self *Record) RecordData() ([]byte, RecordCore) {
+	d := self.RawData()
+	return d, RecordCore{
+		RefID:     self.tid(),
+		Pos:       self.pos(),
+		Bin:       self.bin(),
+		MapQ:      self.qual(),
+		LQName:    self.lQname(),
+		Flags:     self.flag(),
+		NCigar:    self.nCigar(),
+		LSeq:      self.lQseq(),
+		NextRefID: self.mtid(),
+		NextPos:   self.mpos(),
+		TLen:      self.isize(),
+		LAux:      self.lAux(),
+	}
+}
+
 // Start returns the lower-coordinate end of the alignment.
 func (self *Record) Start() int {
 	return int(self.pos())
@@ -153,22 +239,9 @@ func (self *Record) NextStart() int {
 	return int(self.mpos())
 }
 
-// String returns a string representation of the Record.
-func (self *Record) String() string {
-	return fmt.Sprintf("%s %v %d:%d..%d %d %v %d:%d %d %s %v %v",
-		self.Name(),
-		self.Flags(),
-		self.RefID(),
-		self.Start(),
-		self.End(),
-		self.Score(),
-		self.Cigar(),
-		self.NextRefID(),
-		self.NextStart(),
-		self.Len(),
-		self.Seq(),
-		self.Quality(),
-		self.Tags())
+// TemplateLen returns the observed length of the template.
+func (self *Record) TemplateLen() int {
+	return int(self.isize())
 }
 
 var (
@@ -194,7 +267,6 @@ var (
 )
 
 // marshalData fills the bam1_t->data in the context of the bam1_t description fields to store the Record's fields.
-//
 func (self *Record) marshalData() (d []byte) {
 	d = make([]byte, 0, 0+
 		len(self.nameStr)+1+ // qName
@@ -222,8 +294,9 @@ func (self *Record) marshalData() (d []byte) {
 	self.setLQseq(int32(len(self.seqBytes)))
 	// Encode nucleotide nybbles.
 	sn := make([]byte, (len(self.seqBytes)+1)>>1)
+	enc := &self.alphabet().enc
 	for i, c := range self.seqBytes {
-		sn[i>>1] |= bamNT16Table[c] << (4 * uint(^i&1))
+		sn[i>>1] |= enc[c] << (4 * uint(^i&1))
 	}
 	d = append(d, sn...)
 
@@ -237,62 +310,227 @@ func (self *Record) marshalData() (d []byte) {
 	return
 }
 
+// marshal ensures that the encoded data of the record include any pending changes made by
+// setter methods, so that the encoded data may be used directly.
+func (self *Record) marshal() {
+	if !self.marshalled {
+		self.setData(self.marshalData())
+		self.marshalled = true
+	}
+}
+
+// A recordField identifies a variable length field of a Record for lazy decoding.
+type recordField uint8
+
+const (
+	nameField recordField = 1 << iota
+	cigarField
+	seqField
+	qualField
+	auxField
+
+	allFields = nameField | cigarField | seqField | qualField | auxField
+)
+
 // unmarshalData interogates the bam1_t->data in the context of the bam1_t description fields to fill the Record's fields.
 // unmarshalData is idempotent in this implementation although this may change.
 func (self *Record) unmarshalData() {
-	if self.unmarshalled || self.bamRecord.b == nil {
+	self.decode(allFields)
+}
+
+// decode fills the Record's Go fields identified by f from the bam1_t->data, if they have not
+// already been decoded. Existing Go field allocations are reused where they have sufficient
+// capacity.
+func (self *Record) decode(f recordField) {
+	f &^= self.decoded
+	if f == 0 || self.bamRecord == nil || self.bamRecord.b == nil {
 		return
 	}
 
-	d := self.dataUnsafe()
-	var s, e int
+	d := self.dataView()
+	defer runtime.KeepAlive(self.bamRecord)
+	var (
+		nameEnd  = int(self.lQname())
+		cigarEnd = nameEnd + int(self.nCigar())<<2 // CIGAR represented as C.uint32 so length is 4*n_cigar
+		lSeq     = int(self.lQseq())
+		seqEnd   = cigarEnd + (lSeq+1)>>1
+		qualEnd  = seqEnd + lSeq
+		auxEnd   = qualEnd + int(self.lAux())
+	)
 
-	// Get query name.
-	s, e = 0, int(self.lQname())
-	self.nameStr = string(d[s : e-1])
+	// Get query name, avoiding allocation if it is unchanged.
+	if f&nameField != 0 {
+		if name := d[:nameEnd-1]; self.nameStr != string(name) {
+			self.nameStr = string(name)
+		}
+	}
 
 	// Get CIGAR data.
-	nCigar := self.nCigar()
-	s, e = e, e+int(nCigar<<2) // CIGAR represented as C.uint32 so length is 4*n_cigar
-	self.cigar = make([]CigarOp, nCigar)
-	err := binary.Read(bytes.NewBuffer(d[s:e]), endian, &self.cigar)
-	if err != nil {
-		panic(fmt.Sprintf("boom: binary.Read failed: %v", err))
-	}
-
-	// Get sequence data.
-	lQqual := int(self.lQseq())
-	lQseq := (lQqual + 1) >> 1
-	// Extract nucleotide nybbles.
-	s, e = e, e+lQseq
-	self.seqBytes = make([]byte, lQqual)
-	for i, c := range d[s:e] {
-		i2 := i << 1
-		self.seqBytes[i2] = bamNT16TableRev[c>>4]
-		if i2++; i2 == len(self.seqBytes) {
-			break
+	if f&cigarField != 0 {
+		n := int(self.nCigar())
+		if cap(self.cigar) < n {
+			self.cigar = make([]CigarOp, n)
+		}
+		self.cigar = self.cigar[:n]
+		for i := range self.cigar {
+			self.cigar[i] = CigarOp(endian.Uint32(d[nameEnd+i<<2:]))
+		}
+	}
+
+	// Get sequence data, extracting nucleotide nybbles.
+	if f&seqField != 0 {
+		self.seqBytes = resize(self.seqBytes, lSeq)
+		dec := &self.alphabet().dec
+		for i, c := range d[cigarEnd:seqEnd] {
+			i2 := i << 1
+			self.seqBytes[i2] = dec[c>>4]
+			if i2++; i2 == len(self.seqBytes) {
+				break
+			}
+			self.seqBytes[i2] = dec[c&0xf]
 		}
-		self.seqBytes[i2] = bamNT16TableRev[c&0xf]
 	}
+
 	// Get quality scores.
-	s, e = e, e+lQqual
-	self.qualScores = make([]byte, lQqual)
-	q := d[s:e]
-	copy(self.qualScores, *(*[]byte)(unsafe.Pointer(&q)))
+	if f&qualField != 0 {
+		self.qualScores = resize(self.qualScores, lSeq)
+		copy(self.qualScores, d[seqEnd:qualEnd])
+	}
 
 	// Get auxilliary tags.
-	lAux := int(self.lAux())
-	s, e = e, e+lAux
-	self.auxBytes = make([]byte, lAux)
-	copy(self.auxBytes, d[s:e])
-	self.auxTags = parseAux(self.auxBytes)
+	if f&auxField != 0 {
+		self.auxBytes = append(self.auxBytes[:0], d[qualEnd:auxEnd]...)
+		self.auxTags = appendAux(self.auxTags[:0], self.auxBytes)
+	}
+
+	self.decoded |= f
+}
+
+// resize returns b resliced to length n, allocating a new slice if the capacity of b is
+// insufficient.
+func resize(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
+
+// MalformedRecord is the error returned when the encoded data of a record read from a file is
+// internally inconsistent. A reader returning a MalformedRecord error may be read from again
+// to obtain subsequent records.
+type MalformedRecord struct {
+	Name   string     // The read name of the record if it could be decoded.
+	Reason string     // A description of the inconsistency.
+	Pos    *RecordPos // The position of the record if it is known.
+}
+
+func (e *MalformedRecord) Error() string {
+	var s string
+	if e.Name == "" {
+		s = "boom: malformed record: " + e.Reason
+	} else {
+		s = fmt.Sprintf("boom: malformed record %q: %s", e.Name, e.Reason)
+	}
+	if e.Pos != nil {
+		s += " at " + e.Pos.String()
+	}
+	return s
+}
+
+// validate checks that the lengths described by the bam1_t's fixed fields are consistent
+// with its variable length data, and that the auxiliary fields are well formed, so that
+// the record can be safely unmarshalled.
+func (br *bamRecord) validate() error {
+	d := br.dataView()
+	defer runtime.KeepAlive(br)
+
+	lq := int(br.lQname())
+	if lq < 1 || lq > len(d) || d[lq-1] != 0 {
+		return &MalformedRecord{Reason: "invalid read name length"}
+	}
+	name := func() string { return string(d[:lq-1]) }
+	e := lq + 4*int(br.nCigar())
+	if e > len(d) {
+		return &MalformedRecord{Name: name(), Reason: "CIGAR exceeds record data"}
+	}
+	lSeq := int(br.lQseq())
+	if lSeq < 0 {
+		return &MalformedRecord{Name: name(), Reason: "negative sequence length"}
+	}
+	e += (lSeq+1)>>1 + lSeq
+	if e > len(d) {
+		return &MalformedRecord{Name: name(), Reason: "sequence exceeds record data"}
+	}
+	if la := int(br.lAux()); la < 0 || e+la > len(d) {
+		return &MalformedRecord{Name: name(), Reason: "auxiliary data exceeds record data"}
+	} else if err := validateAux(d[e : e+la]); err != "" {
+		return &MalformedRecord{Name: name(), Reason: err}
+	}
+	return nil
+}
+
+// validateAux returns a description of the first inconsistency found in the encoded
+// auxiliary fields, aux, or the empty string if aux is well formed.
+func validateAux(aux []byte) string {
+	for i := 0; i < len(aux); {
+		if len(aux)-i < 3 {
+			return "truncated auxiliary field"
+		}
+		t := aux[i+2]
+		switch j := jumps[t]; {
+		case j > 0:
+			i += 3 + j
+			if i > len(aux) {
+				return "truncated auxiliary field"
+			}
+		case t == 'Z' || t == 'H':
+			n := bytes.IndexByte(aux[i+3:], 0)
+			if n < 0 {
+				return "unterminated auxiliary string"
+			}
+			if t == 'H' && !isHex(aux[i+3:i+3+n]) {
+				return "invalid auxiliary hex string"
+			}
+			i += 3 + n + 1
+		case t == 'B':
+			if len(aux)-i < 8 {
+				return "truncated auxiliary array"
+			}
+			w := jumps[aux[i+3]]
+			if w <= 0 || aux[i+3] == 'A' {
+				return fmt.Sprintf("invalid auxiliary array type: %q", aux[i+3])
+			}
+			n := int64(endian.Uint32(aux[i+4 : i+8]))
+			if n*int64(w) > int64(len(aux)-i-8) {
+				return "truncated auxiliary array"
+			}
+			i += 8 + int(n)*w
+		default:
+			return fmt.Sprintf("unrecognised auxiliary field type: %q", t)
+		}
+	}
+	return ""
+}
 
-	self.unmarshalled = true
+// isHex returns whether h is an even length string of hexadecimal digits.
+func isHex(h []byte) bool {
+	if len(h)%2 != 0 {
+		return false
+	}
+	for _, c := range h {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
 }
 
 // A CigarOp represents a Compact Idiosyncratic Gapped Alignment Report operation.
 type CigarOp uint32
 
+// NewCigarOp returns a CIGAR operation of the specified type and length.
+func NewCigarOp(t CigarOpType, n int) CigarOp { return CigarOp(n<<4 | int(t)) }
+
 // Type returns the type of the CIGAR operation for the CigarOp.
 func (co CigarOp) Type() CigarOpType { return CigarOpType(co & 0xf) }
 
@@ -302,6 +540,60 @@ func (co CigarOp) Len() int { return int(co >> 4) }
 // String returns the string representation of the CigarOp
 func (co CigarOp) String() string { return fmt.Sprintf("%d%s", co.Len(), co.Type().String()) }
 
+// cigarString returns the SAM string representation of cigar, or "*" if cigar is empty.
+func cigarString(cigar []CigarOp) string {
+	if len(cigar) == 0 {
+		return "*"
+	}
+	var b bytes.Buffer
+	for _, co := range cigar {
+		fmt.Fprint(&b, co)
+	}
+	return b.String()
+}
+
+// parseCigar returns the CIGAR operations described by the SAM CIGAR string, s.
+func parseCigar(s string) ([]CigarOp, error) {
+	if s == "*" {
+		return nil, nil
+	}
+	var (
+		cigar []CigarOp
+		n     int
+		digit bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if '0' <= c && c <= '9' {
+			n = n*10 + int(c-'0')
+			digit = true
+			continue
+		}
+		t := strings.IndexByte("MIDNSHP=X", c)
+		if t < 0 || !digit {
+			return nil, fmt.Errorf("boom: invalid CIGAR string %q", s)
+		}
+		cigar = append(cigar, CigarOp(n<<4|t))
+		n, digit = 0, false
+	}
+	if digit {
+		return nil, fmt.Errorf("boom: invalid CIGAR string %q", s)
+	}
+	return cigar, nil
+}
+
+// refLen returns the number of reference positions consumed by the alignment described by cigar.
+func refLen(cigar []CigarOp) int {
+	var n int
+	for _, co := range cigar {
+		switch co.Type() {
+		case CigarMatch, CigarDeletion, CigarSkipped, CigarEqual, CigarMismatch:
+			n += co.Len()
+		}
+	}
+	return n
+}
+
 // A CigarOpType represents the type of operation described by a CigarOp.
 type CigarOpType byte
 
@@ -357,54 +649,152 @@ var (
 // parseAux examines the data of a SAM record's OPT fields,
 // returning a slice of Aux that are backed by the original data.
 func parseAux(aux []byte) (aa []Aux) {
+	return appendAux(nil, aux)
+}
+
+// appendAux appends the Aux fields parsed from aux to aa and returns the extended slice.
+func appendAux(aa []Aux, aux []byte) []Aux {
 	for i := 0; i+2 < len(aux); {
-		t := aux[i+2]
-		switch j := jumps[t]; {
-		case j > 0:
-			j += 3
-			aa = append(aa, Aux(aux[i:i+j]))
-			i += j
-		case j < 0:
-			switch t {
-			case 'Z', 'H':
-				var (
-					j int
-					v byte
-				)
-				for j, v = range aux[i:] {
-					if v == 0 { // C string termination
-						break // Truncate terminal zero.
-					}
-				}
-				aa = append(aa, Aux(aux[i:i+j]))
-				i += j + 1
-			case 'B':
-				var length int32
-				err := binary.Read(bytes.NewBuffer([]byte(aux[i+4:i+8])), endian, &length)
-				if err != nil {
-					panic(fmt.Sprintf("boom: binary.Read failed: %v", err))
-				}
-				j = int(length)*jumps[aux[i+3]] + int(unsafe.Sizeof(length)) + 4
-				aa = append(aa, Aux(aux[i:i+j]))
-				i += j
+		a, n := nextAux(aux[i:])
+		aa = append(aa, a)
+		i += n
+	}
+	return aa
+}
+
+// nextAux returns the first Aux field held in aux and the number of bytes it occupies,
+// including the terminal zero of 'Z' and 'H' fields.
+func nextAux(aux []byte) (Aux, int) {
+	t := aux[2]
+	switch j := jumps[t]; {
+	case j > 0:
+		j += 3
+		return Aux(aux[:j]), j
+	case j < 0:
+		switch t {
+		case 'Z', 'H':
+			// Truncate the terminal zero of the C string,
+			// which follows the tag and type.
+			j := bytes.IndexByte(aux[3:], 0)
+			if j < 0 {
+				return Aux(aux), len(aux)
 			}
-		default:
-			panic(fmt.Sprintf("boom: unrecognised optional field type: %q", t))
+			j += 3
+			return Aux(aux[:j]), j + 1
+		case 'B':
+			length := int32(endian.Uint32(aux[4:8]))
+			j = int(length)*jumps[aux[3]] + int(unsafe.Sizeof(length)) + 4
+			return Aux(aux[:j]), j
 		}
 	}
-	return
+	panic(fmt.Sprintf("boom: unrecognised optional field type: %q", t))
 }
 
 // buildAux constructs a single byte slice that represents a slice of Aux.
 func buildAux(aa []Aux) (aux []byte) {
 	for _, a := range aa {
 		// TODO: validate each 'a'
-		// TODO: note that Z and H types should have a terminal null added.
 		aux = append(aux, []byte(a)...)
+		switch a.Type() {
+		case 'Z', 'H':
+			aux = append(aux, 0)
+		}
 	}
 	return
 }
 
+// NewAux returns an Aux tag with the tag ID, t, holding value. The type of the Aux is determined
+// by the dynamic type of value:
+//
+//	int8, uint8, int16, uint16, int32, uint32 - 'c', 'C', 's', 'S', 'i' and 'I'
+//	int - the smallest integer type able to hold the value
+//	float32, float64 - 'f'
+//	string - 'Z'
+//	[]int8, []uint8, []int16, []uint16, []int32, []uint32, []float32 - 'B' with the corresponding subtype
+func NewAux(t Tag, value interface{}) (Aux, error) {
+	a := Aux{t[0], t[1], 0}
+	var buf [4]byte
+	switch v := value.(type) {
+	case int8:
+		a[2] = 'c'
+		a = append(a, byte(v))
+	case uint8:
+		a[2] = 'C'
+		a = append(a, v)
+	case int16:
+		a[2] = 's'
+		endian.PutUint16(buf[:], uint16(v))
+		a = append(a, buf[:2]...)
+	case uint16:
+		a[2] = 'S'
+		endian.PutUint16(buf[:], v)
+		a = append(a, buf[:2]...)
+	case int32:
+		a[2] = 'i'
+		endian.PutUint32(buf[:], uint32(v))
+		a = append(a, buf[:]...)
+	case uint32:
+		a[2] = 'I'
+		endian.PutUint32(buf[:], v)
+		a = append(a, buf[:]...)
+	case int:
+		switch {
+		case int64(v) < math.MinInt32 || int64(v) > math.MaxUint32:
+			return nil, fmt.Errorf("boom: integer value out of range: %d", v)
+		case v < math.MinInt16:
+			return NewAux(t, int32(v))
+		case v < math.MinInt8:
+			return NewAux(t, int16(v))
+		case v < 0:
+			return NewAux(t, int8(v))
+		case v <= math.MaxUint8:
+			return NewAux(t, uint8(v))
+		case v <= math.MaxUint16:
+			return NewAux(t, uint16(v))
+		default:
+			return NewAux(t, uint32(v))
+		}
+	case float32:
+		a[2] = 'f'
+		endian.PutUint32(buf[:], math.Float32bits(v))
+		a = append(a, buf[:]...)
+	case float64:
+		return NewAux(t, float32(v))
+	case string:
+		if strings.IndexByte(v, 0) >= 0 {
+			return nil, fmt.Errorf("boom: string value contains NUL")
+		}
+		a[2] = 'Z'
+		a = append(a, v...)
+	case []int8, []uint8, []int16, []uint16, []int32, []uint32, []float32:
+		a[2] = 'B'
+		rv := reflect.ValueOf(v)
+		a = append(a, bArrayTypes[rv.Type().Elem().Kind()])
+		endian.PutUint32(buf[:], uint32(rv.Len()))
+		a = append(a, buf[:]...)
+		b := bytes.NewBuffer(a)
+		err := binary.Write(b, endian, v)
+		if err != nil {
+			return nil, err
+		}
+		a = b.Bytes()
+	default:
+		return nil, fmt.Errorf("boom: unsupported aux value type %T", value)
+	}
+	return a, nil
+}
+
+// bArrayTypes maps slice element kinds to 'B' aux array subtypes.
+var bArrayTypes = map[reflect.Kind]byte{
+	reflect.Int8:    'c',
+	reflect.Uint8:   'C',
+	reflect.Int16:   's',
+	reflect.Uint16:  'S',
+	reflect.Int32:   'i',
+	reflect.Uint32:  'I',
+	reflect.Float32: 'f',
+}
+
 // String returns the string representation of an Aux type.
 func (self Aux) String() string {
 	return fmt.Sprintf("%s:%c:%v", []byte(self[:2]), auxTypes[self.Type()], self.Value())
@@ -423,6 +813,47 @@ func (self Aux) Tag() Tag { var t Tag; copy(t[:], self[:2]); return t }
 // Returned values are in {'A', 'c', 'C', 's', 'S', 'i', 'I', 'f', 'Z', 'H', 'B'}.
 func (self Aux) Type() byte { return self[2] }
 
+// isNumber returns whether the auxilliary tag holds a single integer or float value.
+func (self Aux) isNumber() bool {
+	switch self.Type() {
+	case 'c', 'C', 's', 'S', 'i', 'I', 'f':
+		return true
+	}
+	return false
+}
+
+// intValue returns the value of an integer auxilliary tag as an int64 and true. If the tag
+// does not hold an integer value, 0 and false are returned.
+func (self Aux) intValue() (v int64, ok bool) {
+	switch self.Type() {
+	case 'c':
+		return int64(int8(self[3])), true
+	case 'C':
+		return int64(self[3]), true
+	case 's':
+		return int64(int16(endian.Uint16(self[3:5]))), true
+	case 'S':
+		return int64(endian.Uint16(self[3:5])), true
+	case 'i':
+		return int64(int32(endian.Uint32(self[3:7]))), true
+	case 'I':
+		return int64(endian.Uint32(self[3:7])), true
+	}
+	return 0, false
+}
+
+// floatValue returns the value of a numeric auxilliary tag as a float64. If the tag does not
+// hold a numeric value, 0 is returned.
+func (self Aux) floatValue() float64 {
+	if v, ok := self.intValue(); ok {
+		return float64(v)
+	}
+	if self.Type() == 'f' {
+		return float64(math.Float32frombits(endian.Uint32(self[3:7])))
+	}
+	return 0
+}
+
 // Value returns v containing the value of the auxilliary tag.
 func (self Aux) Value() (v interface{}) {
 	switch t := self.Type(); t {
@@ -434,35 +865,35 @@ func (self Aux) Value() (v interface{}) {
 		return uint8(self[3])
 	case 's':
 		s := int16(0)
-		err := binary.Read(bytes.NewBuffer([]byte(self[4:6])), endian, &s)
+		err := binary.Read(bytes.NewBuffer([]byte(self[3:5])), endian, &s)
 		if err != nil {
 			panic(fmt.Sprintf("boom: binary.Read failed: %v", err))
 		}
 		return s
 	case 'S':
 		S := uint16(0)
-		err := binary.Read(bytes.NewBuffer([]byte(self[4:6])), endian, &S)
+		err := binary.Read(bytes.NewBuffer([]byte(self[3:5])), endian, &S)
 		if err != nil {
 			panic(fmt.Sprintf("boom: binary.Read failed: %v", err))
 		}
 		return S
 	case 'i':
 		i := int32(0)
-		err := binary.Read(bytes.NewBuffer([]byte(self[4:8])), endian, &i)
+		err := binary.Read(bytes.NewBuffer([]byte(self[3:7])), endian, &i)
 		if err != nil {
 			panic(fmt.Sprintf("boom: binary.Read failed: %v", err))
 		}
 		return i
 	case 'I':
 		I := uint32(0)
-		err := binary.Read(bytes.NewBuffer([]byte(self[4:8])), endian, &I)
+		err := binary.Read(bytes.NewBuffer([]byte(self[3:7])), endian, &I)
 		if err != nil {
 			panic(fmt.Sprintf("boom: binary.Read failed: %v", err))
 		}
 		return I
 	case 'f':
 		f := float32(0)
-		err := binary.Read(bytes.NewBuffer([]byte(self[4:8])), endian, &f)
+		err := binary.Read(bytes.NewBuffer([]byte(self[3:7])), endian, &f)
 		if err != nil {
 			panic(fmt.Sprintf("boom: binary.Read failed: %v", err))
 		}
@@ -484,10 +915,10 @@ func (self Aux) Value() (v interface{}) {
 		}
 		switch t := self[3]; t {
 		case 'c':
-			c := self[4:]
+			c := self[8:]
 			return *(*[]int8)(unsafe.Pointer(&c))
 		case 'C':
-			return []uint8(self[4:])
+			return []uint8(self[8:])
 		case 's':
 			Bs := make([]int16, length)
 			err := binary.Read(bytes.NewBuffer([]byte(self[8:])), endian, &Bs)
@@ -529,5 +960,4 @@ func (self Aux) Value() (v interface{}) {
 	default:
 		panic(fmt.Sprintf("boom: unknown type %q", t))
 	}
-	return
 }
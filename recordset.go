@@ -0,0 +1,206 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"iter"
+	"math/bits"
+	"sort"
+)
+
+// A RecordSet is an in-memory collection of records supporting overlap queries. Records are
+// indexed by an implicit augmented interval tree for each reference, built when the set is
+// first queried after records have been added, so queries take O(log n + k) time to return k
+// records.
+type RecordSet struct {
+	refs     []recordTree
+	unplaced []*Record
+	n        int
+}
+
+// recordTree is an implicit interval tree over records sorted by start position. The node at
+// index i with k trailing one bits has children at i±2^(k-1), and max[i] holds the greatest
+// end position in the subtree rooted at i.
+type recordTree struct {
+	recs       []*Record
+	start, end []int
+	max        []int
+	dirty      bool
+}
+
+// recordSpan returns the reference interval covered by the alignment of r. Records with no
+// aligned length are treated as covering their position.
+func recordSpan(r *Record) (beg, end int) {
+	beg = r.Start()
+	end = beg + refLen(r.Cigar())
+	if end == beg {
+		end++
+	}
+	return beg, end
+}
+
+// NewRecordSet returns a RecordSet holding copies of recs.
+func NewRecordSet(recs []*Record) (*RecordSet, error) {
+	s := &RecordSet{}
+	for _, r := range recs {
+		err := s.Add(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ReadRecordSet returns a RecordSet holding the remaining records read from r.
+func ReadRecordSet(r RecordReader) (*RecordSet, error) {
+	s := &RecordSet{}
+	for rec, err := range RecordsErr(r) {
+		if err != nil {
+			return nil, err
+		}
+		err = s.add(rec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add adds a copy of r to the set.
+func (self *RecordSet) Add(r *Record) error {
+	c, err := r.Clone()
+	if err != nil {
+		return err
+	}
+	return self.add(c)
+}
+
+// add adds r to the set without copying it.
+func (self *RecordSet) add(r *Record) error {
+	self.n++
+	tid := r.RefID()
+	if tid < 0 {
+		self.unplaced = append(self.unplaced, r)
+		return nil
+	}
+	for len(self.refs) <= tid {
+		self.refs = append(self.refs, recordTree{})
+	}
+	t := &self.refs[tid]
+	t.recs = append(t.recs, r)
+	t.dirty = true
+	return nil
+}
+
+// Len returns the number of records in the set.
+func (self *RecordSet) Len() int { return self.n }
+
+// Overlapping returns an iterator over the records in the set whose alignments overlap the
+// half-open interval [beg, end) of the reference identified by tid, in order of start
+// position. Records with no aligned length are treated as covering their position. The
+// records must not be modified, and records must not be added to the set during iteration.
+func (self *RecordSet) Overlapping(tid, beg, end int) iter.Seq[*Record] {
+	return func(yield func(*Record) bool) {
+		if tid < 0 || tid >= len(self.refs) || end <= beg {
+			return
+		}
+		t := &self.refs[tid]
+		t.index()
+		if len(t.recs) == 0 {
+			return
+		}
+		k := bits.Len(uint(len(t.recs))) - 1
+		t.query(1<<k-1, k, beg, end, yield)
+	}
+}
+
+// All returns an iterator over all the records in the set in coordinate order, with unplaced
+// records last in the order they were added.
+func (self *RecordSet) All() iter.Seq[*Record] {
+	return func(yield func(*Record) bool) {
+		for i := range self.refs {
+			t := &self.refs[i]
+			t.index()
+			for _, r := range t.recs {
+				if !yield(r) {
+					return
+				}
+			}
+		}
+		for _, r := range self.unplaced {
+			if !yield(r) {
+				return
+			}
+		}
+	}
+}
+
+// index sorts the records of the tree and rebuilds the node maxima if records have been added.
+func (self *recordTree) index() {
+	if !self.dirty {
+		return
+	}
+	self.dirty = false
+	sort.Stable(ByCoordinate(self.recs))
+	n := len(self.recs)
+	self.start = make([]int, n)
+	self.end = make([]int, n)
+	self.max = make([]int, n)
+	for i, r := range self.recs {
+		self.start[i], self.end[i] = recordSpan(r)
+		self.max[i] = self.end[i]
+	}
+	if n == 0 {
+		return
+	}
+
+	// suffix[i] is the greatest end at or after i, used for nodes
+	// whose right subtree extends past the last record.
+	suffix := make([]int, n+1)
+	for i := n - 1; i >= 0; i-- {
+		suffix[i] = max(suffix[i+1], self.end[i])
+	}
+	for k := 1; 1<<k <= n; k++ {
+		half := 1 << (k - 1)
+		for i := 1<<k - 1; i < n; i += 1 << (k + 1) {
+			m := max(self.max[i], self.max[i-half])
+			if r := i + half; r < n {
+				m = max(m, self.max[r])
+			} else {
+				m = max(m, suffix[i+1])
+			}
+			self.max[i] = m
+		}
+	}
+}
+
+// query calls yield on the records overlapping [beg, end) in the subtree rooted at node i at
+// level k, in order. It returns false if yield returned false.
+func (self *recordTree) query(i, k, beg, end int, yield func(*Record) bool) bool {
+	if i >= len(self.recs) {
+		// The node is past the last record but its
+		// left subtree may hold records.
+		if k == 0 {
+			return true
+		}
+		return self.query(i-1<<(k-1), k-1, beg, end, yield)
+	}
+	if self.max[i] <= beg {
+		return true
+	}
+	if k != 0 && !self.query(i-1<<(k-1), k-1, beg, end, yield) {
+		return false
+	}
+	if self.start[i] >= end {
+		return true
+	}
+	if self.end[i] > beg && !yield(self.recs[i]) {
+		return false
+	}
+	if k == 0 {
+		return true
+	}
+	return self.query(i+1<<(k-1), k-1, beg, end, yield)
+}
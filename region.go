@@ -0,0 +1,87 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A Region is a half-open interval [Start, End) on the reference sequence identified by RefID.
+type Region struct {
+	RefID      int
+	Start, End int
+}
+
+// Len returns the length of the region.
+func (self Region) Len() int { return self.End - self.Start }
+
+// Format returns the region in samtools region format using the reference names, names.
+// The returned string uses one-based inclusive coordinates.
+func (self Region) Format(names []string) string {
+	return fmt.Sprintf("%s:%d-%d", names[self.RefID], self.Start+1, self.End)
+}
+
+// ReadBED reads BED intervals from r, returning them as regions on the reference sequences
+// described by h. Track, browser and comment lines are ignored. Intervals on references not
+// described by h are returned as an error.
+func ReadBED(r io.Reader, h *Header) ([]Region, error) {
+	var regs []Region
+	err := readBED(r, h, func(reg Region, _ []string) {
+		regs = append(regs, reg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
+
+// readBED reads BED intervals from r, calling fn with the region on the reference sequences
+// described by h and the fields of each interval line. Track, browser and comment lines are
+// ignored. Intervals on references not described by h are returned as an error.
+func readBED(r io.Reader, h *Header, fn func(reg Region, f []string)) error {
+	index := refIndex(h)
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		t := strings.TrimSpace(sc.Text())
+		if t == "" || t[0] == '#' || strings.HasPrefix(t, "track") || strings.HasPrefix(t, "browser") {
+			continue
+		}
+		f := strings.Fields(t)
+		if len(f) < 3 {
+			return fmt.Errorf("boom: too few fields in BED line %d", line)
+		}
+		tid, ok := index[f[0]]
+		if !ok {
+			return fmt.Errorf("boom: unknown reference %q in BED line %d", f[0], line)
+		}
+		beg, err := strconv.Atoi(f[1])
+		if err != nil {
+			return fmt.Errorf("boom: bad start in BED line %d: %v", line, err)
+		}
+		end, err := strconv.Atoi(f[2])
+		if err != nil {
+			return fmt.Errorf("boom: bad end in BED line %d: %v", line, err)
+		}
+		if beg < 0 || end < beg {
+			return fmt.Errorf("boom: invalid interval in BED line %d", line)
+		}
+		fn(Region{RefID: tid, Start: beg, End: end}, f)
+	}
+	return sc.Err()
+}
+
+// refIndex returns a map from the reference names described by h to their IDs.
+func refIndex(h *Header) map[string]int {
+	index := make(map[string]int)
+	for i, n := range h.RefNames() {
+		index[n] = i
+	}
+	return index
+}
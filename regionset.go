@@ -0,0 +1,121 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"iter"
+	"sort"
+)
+
+// A RegionSet is a set of reference regions supporting logarithmic time overlap queries.
+// Overlapping and abutting regions are merged when the set is constructed.
+type RegionSet struct {
+	refs [][]Region
+}
+
+// NewRegionSet returns a RegionSet holding the regions, regs.
+func NewRegionSet(regs []Region) *RegionSet {
+	s := &RegionSet{}
+	for _, r := range mergeRegions(regs) {
+		for len(s.refs) <= r.RefID {
+			s.refs = append(s.refs, nil)
+		}
+		s.refs[r.RefID] = append(s.refs[r.RefID], r)
+	}
+	return s
+}
+
+// Overlaps returns whether the half-open interval [beg, end) on the reference tid overlaps a
+// region in the set.
+func (self *RegionSet) Overlaps(tid, beg, end int) bool {
+	if tid < 0 || tid >= len(self.refs) || end <= beg {
+		return false
+	}
+	regs := self.refs[tid]
+	// Find the first region ending after beg. Regions are disjoint
+	// and sorted, so it is the only candidate for overlap.
+	i := sort.Search(len(regs), func(i int) bool { return regs[i].End > beg })
+	return i < len(regs) && regs[i].Start < end
+}
+
+// Regions returns the merged regions of the set in reference and position order.
+func (self *RegionSet) Regions() []Region {
+	var regs []Region
+	for _, r := range self.refs {
+		regs = append(regs, r...)
+	}
+	return regs
+}
+
+// OverlapsRecord returns whether the reference interval covered by the alignment of r overlaps
+// a region in the set. Unmapped records placed at a position are treated as covering that
+// position. Unplaced records do not overlap any region.
+func (self *RegionSet) OverlapsRecord(r *Record) bool {
+	beg, end := recordSpan(r)
+	return self.Overlaps(r.RefID(), beg, end)
+}
+
+// Excluding returns a RecordFilter that retains records that do not overlap any region in the
+// set, as used for blacklist filtering.
+func (self *RegionSet) Excluding() RecordFilter {
+	return func(r *Record) bool { return !self.OverlapsRecord(r) }
+}
+
+// Including returns a RecordFilter that retains only records that overlap a region in the set.
+func (self *RegionSet) Including() RecordFilter {
+	return self.OverlapsRecord
+}
+
+// complement returns the half-open intervals of the reference tid of length n not covered by
+// regions in the set.
+func (self *RegionSet) complement(tid, n int) []Region {
+	var (
+		gaps []Region
+		beg  int
+	)
+	if tid < len(self.refs) {
+		for _, r := range self.refs[tid] {
+			if r.Start > beg {
+				gaps = append(gaps, Region{RefID: tid, Start: beg, End: min(r.Start, n)})
+			}
+			beg = max(beg, r.End)
+			if beg >= n {
+				return gaps
+			}
+		}
+	}
+	if beg < n {
+		gaps = append(gaps, Region{RefID: tid, Start: beg, End: n})
+	}
+	return gaps
+}
+
+// ComplementRecords returns an iterator over the placed records of the BAM file that do not
+// overlap any region in s, in coordinate order. Only the index bins covering the gaps between
+// regions are read, so covered ranges are skipped. Records beginning in a gap but extending
+// into a region are read and discarded. Unplaced records are not returned. Errors are yielded
+// with a nil Record and end iteration.
+func (self *BAMFile) ComplementRecords(i *Index, s *RegionSet) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		for tid, n := range self.RefLengths() {
+			for _, g := range s.complement(tid, int(n)) {
+				for r, err := range self.QueryRecords(i, g.RefID, g.Start, g.End) {
+					if err != nil {
+						yield(nil, err)
+						return
+					}
+					// Records reaching outside the gap necessarily overlap
+					// an adjacent region, so no record is returned twice.
+					if s.OverlapsRecord(r) {
+						continue
+					}
+					if !yield(r, nil) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biogo/boom/bgzf"
+)
+
+// DefaultRetryDelay is the default delay before the first retry of a failed remote request.
+const DefaultRetryDelay = 500 * time.Millisecond
+
+var noRanges = errors.New("boom: server does not support range requests")
+
+// RemoteConfig specifies how remote files are accessed.
+type RemoteConfig struct {
+	// Timeout is the time limit for each request, including
+	// reading the response body. If Timeout is zero, requests
+	// do not time out.
+	Timeout time.Duration
+
+	// Retries is the number of times a request that fails with
+	// a network error, or a 429 or 5xx status, is retried.
+	// RetryDelay is the delay before the first retry, doubling
+	// for each subsequent retry. If RetryDelay is zero,
+	// DefaultRetryDelay is used.
+	Retries    int
+	RetryDelay time.Duration
+
+	// Proxy is the URL of the proxy used for requests. If Proxy
+	// is nil, the proxy is determined by the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy *url.URL
+
+	// Header holds headers added to each request, such as an
+	// Authorization header holding an access token.
+	Header http.Header
+}
+
+// A RemoteError is the error returned when a remote request receives an unexpected response.
+type RemoteError struct {
+	URL    string
+	Status string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("boom: request for %s failed: %s", e.URL, e.Status)
+}
+
+// A RemoteFile provides random access to a file served over HTTP using range requests. Remote
+// BAM files are read using OpenRemoteBAM, and other BGZF data may be read with the bgzf package.
+// A RemoteFile is not safe for concurrent use except through ReadAt.
+type RemoteFile struct {
+	url    string
+	cfg    RemoteConfig
+	client *http.Client
+	size   int64
+	off    int64
+}
+
+// OpenRemote opens the file at rawurl for reading using the configuration in cfg. If cfg is
+// nil, requests do not time out, are not retried and use the environment's proxy settings.
+func OpenRemote(rawurl string, cfg *RemoteConfig) (*RemoteFile, error) {
+	f := &RemoteFile{url: rawurl}
+	if cfg != nil {
+		f.cfg = *cfg
+	}
+	if f.cfg.RetryDelay == 0 {
+		f.cfg.RetryDelay = DefaultRetryDelay
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if f.cfg.Proxy != nil {
+		tr.Proxy = http.ProxyURL(f.cfg.Proxy)
+	}
+	f.client = &http.Client{Transport: tr, Timeout: f.cfg.Timeout}
+
+	var b [1]byte
+	resp, err := f.get(0, 0, b[:])
+	if err != nil {
+		return nil, err
+	}
+	cr := resp.Header.Get("Content-Range")
+	i := strings.LastIndexByte(cr, '/')
+	if i < 0 {
+		return nil, noRanges
+	}
+	f.size, err = strconv.ParseInt(cr[i+1:], 10, 64)
+	if err != nil {
+		return nil, noRanges
+	}
+	return f, nil
+}
+
+// get requests the bytes [beg, end] of the file, reading the response body into b, and retrying
+// failed requests according to the RemoteConfig.
+func (self *RemoteFile) get(beg, end int64, b []byte) (*http.Response, error) {
+	delay := self.cfg.RetryDelay
+	for try := 0; ; try++ {
+		resp, retry, err := self.try(beg, end, b)
+		if err == nil || !retry || try >= self.cfg.Retries {
+			return resp, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// try makes a single request for the bytes [beg, end] of the file, reading the response body
+// into b, and returns whether a failed request may be retried.
+func (self *RemoteFile) try(beg, end int64, b []byte) (resp *http.Response, retry bool, err error) {
+	req, err := http.NewRequest("GET", self.url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	for k, v := range self.cfg.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", beg, end))
+	resp, err = self.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK:
+		return nil, false, noRanges
+	default:
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, &RemoteError{URL: self.url, Status: resp.Status}
+	}
+	_, err = io.ReadFull(resp.Body, b)
+	if err != nil {
+		return nil, true, err
+	}
+	return resp, false, nil
+}
+
+// Size returns the size of the remote file in bytes.
+func (self *RemoteFile) Size() int64 { return self.size }
+
+// ReadAt reads len(p) bytes from the remote file starting at off using a single range request.
+func (self *RemoteFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, badOffset
+	}
+	if off >= self.size {
+		return 0, io.EOF
+	}
+	n = len(p)
+	if rem := self.size - off; int64(n) > rem {
+		n = int(rem)
+		err = io.EOF
+	}
+	if n == 0 {
+		return 0, err
+	}
+	if _, gerr := self.get(off, off+int64(n)-1, p[:n]); gerr != nil {
+		return 0, gerr
+	}
+	return n, err
+}
+
+// Read reads up to len(p) bytes from the current position of the remote file.
+func (self *RemoteFile) Read(p []byte) (n int, err error) {
+	n, err = self.ReadAt(p, self.off)
+	self.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the position of the next Read according to offset and whence.
+func (self *RemoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += self.off
+	case io.SeekEnd:
+		offset += self.size
+	default:
+		return 0, badWhence
+	}
+	if offset < 0 {
+		return 0, badOffset
+	}
+	self.off = offset
+	return offset, nil
+}
+
+// Close releases the connections held by the RemoteFile.
+func (self *RemoteFile) Close() error {
+	self.client.CloseIdleConnections()
+	return nil
+}
+
+// OpenRemoteBAM opens the BAM file at rawurl, and its index at the same URL with the path
+// extended by ".bai", for reading using the configuration in cfg. If c is not nil, decompressed
+// blocks of the BAM file and pages of the index are retained in c keyed by their URLs and file
+// offsets, so that BAMReaders sharing c do not repeat requests for nearby regions. The BAM file
+// is read ahead in pages of bgzf.DefaultPageSize bytes.
+func OpenRemoteBAM(rawurl string, cfg *RemoteConfig, c *bgzf.Cache) (*BAMReader, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	u.Path += ".bai"
+	idxurl := u.String()
+
+	f, err := OpenRemote(rawurl, cfg)
+	if err != nil {
+		return nil, err
+	}
+	br, err := NewBAMReader(newRemoteReader(f, nil, rawurl), rawurl, c)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	fi, err := OpenRemote(idxurl, cfg)
+	if err != nil {
+		br.Close()
+		return nil, err
+	}
+	defer fi.Close()
+	err = br.ReadIndex(bufio.NewReader(newRemoteReader(fi, c, idxurl)))
+	if err != nil {
+		br.Close()
+		return nil, err
+	}
+	return br, nil
+}
+
+// remoteReader is an io.ReadSeeker reading a RemoteFile through a bgzf.PageReader.
+type remoteReader struct {
+	*io.SectionReader
+	f *RemoteFile
+}
+
+// newRemoteReader returns a remoteReader reading f in pages retained in c keyed by name.
+func newRemoteReader(f *RemoteFile, c *bgzf.Cache, name string) *remoteReader {
+	pr := bgzf.NewPageReader(f, f.Size(), c, name, 0)
+	return &remoteReader{SectionReader: io.NewSectionReader(pr, 0, f.Size()), f: f}
+}
+
+// Close closes the underlying RemoteFile.
+func (self *remoteReader) Close() error { return self.f.Close() }
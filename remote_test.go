@@ -0,0 +1,137 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom_test
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/biogo/boom"
+	"github.com/biogo/boom/bgzf"
+	"github.com/biogo/boom/generator"
+)
+
+// recordKey returns a string holding the fixed and variable length fields of r.
+func recordKey(r *boom.Record) string {
+	d, c := r.RecordData()
+	return fmt.Sprintf("%+v %x", c, d)
+}
+
+func TestRemoteBAM(t *testing.T) {
+	dir := t.TempDir()
+	g, err := generator.New(generator.Config{
+		Seed: 1,
+		References: []generator.Reference{
+			{Name: "chr1", Length: 200000},
+			{Name: "chr2", Length: 50000},
+		},
+		Paired:   true,
+		Coverage: 5,
+		Unmapped: 0.05,
+	})
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+	fn := filepath.Join(dir, "remote.bam")
+	err = g.WriteBAM(fn)
+	if err != nil {
+		t.Fatalf("failed to write BAM: %v", err)
+	}
+	err = boom.BuildIndex(fn)
+	if err != nil {
+		t.Fatalf("failed to build index: %v", err)
+	}
+
+	var requests atomic.Int64
+	fs := http.FileServer(http.Dir(dir))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fs.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c := bgzf.NewCache(64 << 20)
+	rb, err := boom.OpenRemoteBAM(srv.URL+"/remote.bam", nil, c)
+	if err != nil {
+		t.Fatalf("failed to open remote BAM: %v", err)
+	}
+	defer rb.Close()
+	lf, err := boom.OpenBAM(fn)
+	if err != nil {
+		t.Fatalf("failed to open BAM: %v", err)
+	}
+	defer lf.Close()
+	idx, err := boom.LoadIndex(fn)
+	if err != nil {
+		t.Fatalf("failed to load index: %v", err)
+	}
+	if rb.Header().Text() != lf.Header().Text() || !slices.Equal(rb.Header().RefNames(), lf.Header().RefNames()) {
+		t.Errorf("header mismatch")
+	}
+
+	for i := 0; ; i++ {
+		got, _, errGot := rb.Read()
+		want, _, errWant := lf.Read()
+		if errGot != errWant {
+			t.Fatalf("unexpected error for record %d: got %v want %v", i, errGot, errWant)
+		}
+		if errGot == io.EOF {
+			break
+		}
+		if recordKey(got) != recordKey(want) {
+			t.Fatalf("record %d mismatch:\ngot: %v\nwant:%v", i, got, want)
+		}
+	}
+
+	query := func(rb *boom.BAMReader, rnd *rand.Rand, check bool) {
+		lens := lf.RefLengths()
+		for i := 0; i < 200; i++ {
+			tid := rnd.Intn(len(lens))
+			beg := rnd.Intn(int(lens[tid]))
+			end := beg + rnd.Intn(5000) + 1
+			var got, want []string
+			for r, err := range rb.Query(tid, beg, end) {
+				if err != nil {
+					t.Fatalf("unexpected query error: %v", err)
+				}
+				got = append(got, recordKey(r))
+			}
+			if !check {
+				continue
+			}
+			for r, err := range lf.QueryRecords(idx, tid, beg, end) {
+				if err != nil {
+					t.Fatalf("unexpected query error: %v", err)
+				}
+				want = append(want, recordKey(r))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("query %d:%d-%d mismatch: got %d records want %d", tid, beg, end, len(got), len(want))
+			}
+		}
+	}
+	query(rb, rand.New(rand.NewSource(1)), true)
+
+	// A reader sharing the cache takes the header, the index
+	// and the queried blocks from the cache, requesting only
+	// the sizes of the BAM file and index.
+	n := requests.Load()
+	rb2, err := boom.OpenRemoteBAM(srv.URL+"/remote.bam", nil, c)
+	if err != nil {
+		t.Fatalf("failed to open remote BAM: %v", err)
+	}
+	defer rb2.Close()
+	query(rb2, rand.New(rand.NewSource(1)), false)
+	if got := requests.Load() - n; got != 2 {
+		t.Errorf("unexpected number of requests with a shared cache: got %d want 2", got)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// Repair copies the records of the BAM file, in, to the BAM file, out, up to the end of the
+// file or the first record that cannot be read, returning the number of records copied. The
+// output is written with an EOF marker block, so a BAM file that has been truncated, or has
+// been corrupted after its header, is recovered as a valid BAM file holding the intact records
+// preceding the damage. Records are not otherwise validated. The header of in must be intact.
+func Repair(in, out string) (n int, err error) {
+	f, err := OpenBAM(in)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	bf, err := CreateBAM(out, f.Header(), true)
+	if err != nil {
+		return 0, err
+	}
+
+	r, err := NewRecord()
+	if err != nil {
+		bf.Close()
+		return 0, err
+	}
+	for {
+		if _, err := f.ReadInto(r); err != nil {
+			break
+		}
+		wn, err := bf.Write(r)
+		if err == nil && wn < 0 {
+			err = writeFailed
+		}
+		if err != nil {
+			bf.Close()
+			return n, err
+		}
+		n++
+	}
+
+	return n, bf.Close()
+}
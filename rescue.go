@@ -0,0 +1,155 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"io"
+	"slices"
+)
+
+// RescueStats holds the counts of records found by RescueMates.
+type RescueStats struct {
+	Pairs   int // Pairs written.
+	Orphans int // Candidate records whose mate was not found.
+
+	// Skipped is the number of reference sequences that were
+	// not read because the BAM index records no placed
+	// unmapped records on them.
+	Skipped int
+}
+
+// RescueMates writes the primary records of the BAM file, filename, that are unmapped with a
+// mapped mate, or mapped with an unmapped mate, to w1 and w2 as paired FASTQ records for
+// remapping, the first read of each pair to w1 and the second to w2. Reads aligned to the
+// reverse strand are reverse complemented to restore their sequenced orientation, and bases
+// without quality scores are written with a score of zero.
+//
+// Unmapped reads with a mapped mate are expected to be placed at the position of their mate,
+// as done by common aligners. If the file has a BAM index holding record counts, only the
+// reference sequences on which the index records placed unmapped records are read; otherwise
+// the whole file is read. Unplaced unmapped records are not examined, so a mapped read whose
+// unmapped mate is unplaced is counted as an orphan.
+func RescueMates(filename string, w1, w2 io.Writer) (*RescueStats, error) {
+	f, err := OpenBAM(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fq1, fq2 := bufio.NewWriter(w1), bufio.NewWriter(w2)
+	var st RescueStats
+	resc := mateRescuer{fq: [2]*bufio.Writer{fq1, fq2}, st: &st}
+
+	bi, err := readBAIFile(filename)
+	if err != nil || !bi.hasCount || len(bi.refs) != f.Targets() {
+		if err = resc.readFrom(f); err != nil {
+			return nil, err
+		}
+	} else {
+		idx, err := LoadIndex(filename)
+		if err != nil {
+			return nil, err
+		}
+		lens := f.RefLengths()
+		for tid := range bi.refs {
+			if _, u, ok := bi.refs[tid].counts(); ok && u == 0 {
+				st.Skipped++
+				continue
+			}
+			it, err := f.Query(idx, tid, 0, int(lens[tid]))
+			if err != nil {
+				return nil, err
+			}
+			err = resc.readFrom(it)
+			it.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = fq1.Flush(); err != nil {
+		return nil, err
+	}
+	if err = fq2.Flush(); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// A mateRescuer pairs candidate records for RescueMates.
+type mateRescuer struct {
+	fq [2]*bufio.Writer
+	st *RescueStats
+}
+
+// readFrom pairs the candidate records of r, writing each completed pair. Candidates left
+// unpaired when r is exhausted are counted as orphans.
+func (self *mateRescuer) readFrom(r RecordReader) error {
+	pending := make(map[string]*Record)
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		fl := rec.Flags()
+		if fl&Paired == 0 || fl&(Secondary|Supplementary) != 0 {
+			continue
+		}
+		if (fl&Unmapped == 0) == (fl&MateUnmapped == 0) {
+			continue
+		}
+		name := rec.Name()
+		m, ok := pending[name]
+		if !ok {
+			pending[name] = rec
+			continue
+		}
+		delete(pending, name)
+		if rec.Flags()&Read1 != 0 {
+			rec, m = m, rec
+		}
+		if err = writeFastq(self.fq[0], m); err != nil {
+			return err
+		}
+		if err = writeFastq(self.fq[1], rec); err != nil {
+			return err
+		}
+		self.st.Pairs++
+	}
+	self.st.Orphans += len(pending)
+	return nil
+}
+
+// writeFastq writes r to w as a FASTQ record in its sequenced orientation.
+func writeFastq(w *bufio.Writer, r *Record) error {
+	seq := append([]byte(nil), r.Seq()...)
+	qual := make([]byte, len(seq))
+	for i, q := range r.Quality() {
+		if q == 0xff {
+			q = 0
+		}
+		qual[i] = q + 33
+	}
+	if r.Flags()&Reverse != 0 {
+		slices.Reverse(seq)
+		for i, b := range seq {
+			seq[i] = complement(upper(b))
+		}
+		slices.Reverse(qual)
+	}
+	w.WriteByte('@')
+	w.WriteString(r.Name())
+	w.WriteByte('\n')
+	w.Write(seq)
+	w.WriteString("\n+\n")
+	w.Write(qual)
+	_, err := w.WriteString("\n")
+	return err
+}
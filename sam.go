@@ -68,20 +68,77 @@ func (self *SAMFile) Close() error {
 	return self.samClose()
 }
 
+// SetVerbosity sets the level of debugging information emitted on stderr by libbam for
+// subsequent operations on the file, independently of the process-wide level set by
+// Verbosity. Passing a negative value restores use of the process-wide level.
+func (self *SAMFile) SetVerbosity(v int) {
+	self.setVerbosity(v)
+}
+
+// SetTagRewriter sets fn to be applied to the auxiliary fields of subsequently written records,
+// allowing tags to be stripped or rewritten as records are encoded for output. Records passed
+// to Write are not modified. Passing nil removes the TagRewriter.
+func (self *SAMFile) SetTagRewriter(fn TagRewriter) {
+	self.rewrite = fn
+}
+
+// SetSortOrderCheck sets the sort order, by, that subsequently written records are required
+// to follow, typically the order declared in the file's header. Write returns an error, and
+// does not write the record, if a record sorts before the previously written record.
+// Passing UnknownOrder or Unsorted disables the check.
+func (self *SAMFile) SetSortOrderCheck(by SortOrder) {
+	self.order = by
+	self.last = nil
+}
+
 // Read reads a single SAM record and returns this or any error, and the number of bytes read.
+// At the end of the file the error is io.EOF; other read failures return a *ReadError.
 func (self *SAMFile) Read() (r *Record, n int, err error) {
 	n, br, err := self.samRead()
 	r = &Record{bamRecord: br, marshalled: true}
+	self.attach(r)
+	return
+}
+
+// ReadInto reads the next SAM record into r, reusing the allocations held by r as described
+// for BAMFile.ReadInto.
+func (self *SAMFile) ReadInto(r *Record) (n int, err error) {
+	if r.bamRecord == nil {
+		r.bamRecord, err = newBamRecord(nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err = self.samReadInto(r.bamRecord)
+	r.marshalled = true
+	r.decoded = 0
+	self.attach(r)
 	return
 }
 
 // Write writes a BAM record, r, returning the number of bytes written and any error that occurred.
 func (self *SAMFile) Write(r *Record) (n int, err error) {
+	err = self.checkValid(r)
+	if err != nil {
+		return 0, err
+	}
+	k, err := self.checkOrder(r, self.last)
+	if err != nil {
+		return 0, err
+	}
 	if r.marshalled == false {
-		r.setDataUnsafe(r.marshalData())
+		r.setData(r.marshalData())
 		r.marshalled = true
 	}
-	return self.samWrite(r.bamRecord)
+	br, err := self.rewriteTags(r.bamRecord)
+	if err != nil {
+		return 0, err
+	}
+	n, err = self.samWrite(br)
+	if err == nil && n >= 0 {
+		self.setLast(k)
+	}
+	return n, err
 }
 
 // RefID returns the tid corresponding to the string chr and true if a match is present.
@@ -0,0 +1,194 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// attach gives r the alphabet and reference sequence names of the file it was read from.
+func (sf *samFile) attach(r *Record) {
+	r.alpha = sf.alpha
+	if sf.refs == nil && sf.fp != nil {
+		if h := sf.header(); h != nil && h.bh != nil {
+			sf.refs = h.targetNames()
+		}
+	}
+	r.refs = sf.refs
+}
+
+// AttachHeader sets the reference sequence names used to format the record as SAM to those of
+// h. Records read from a file have the names of the file's header attached. Passing nil removes
+// the names.
+func (self *Record) AttachHeader(h *Header) {
+	if h == nil {
+		self.refs = nil
+		return
+	}
+	self.refs = h.targetNames()
+}
+
+// String returns the record formatted as a line of SAM, without a line terminator, using the
+// reference sequence names attached to the record. If the record refers to a reference sequence
+// whose name is not attached, String returns the debugging representation given by GoString,
+// which is not valid SAM.
+func (self *Record) String() string {
+	b, err := self.appendSAM(nil, self.refs)
+	if err != nil {
+		return self.GoString()
+	}
+	return string(b)
+}
+
+// FormatSAM returns the record formatted as a line of SAM, without a line terminator, using the
+// reference sequence names of h.
+func (self *Record) FormatSAM(h *Header) (string, error) {
+	var refs []string
+	if h != nil {
+		refs = h.targetNames()
+	}
+	b, err := self.appendSAM(nil, refs)
+	return string(b), err
+}
+
+// GoString returns a debugging representation of the record. The representation is not SAM.
+func (self *Record) GoString() string {
+	return fmt.Sprintf("&boom.Record{Name:%q Flags:%v RefID:%d Start:%d End:%d MapQ:%d Cigar:%v NextRefID:%d NextStart:%d TemplateLen:%d Seq:%q Quality:%v Tags:%v}",
+		self.Name(),
+		self.Flags(),
+		self.RefID(),
+		self.Start(),
+		self.End(),
+		self.Score(),
+		self.Cigar(),
+		self.NextRefID(),
+		self.NextStart(),
+		self.TemplateLen(),
+		self.Seq(),
+		self.Quality(),
+		self.Tags())
+}
+
+// appendSAM appends the SAM representation of the record to dst using the reference names, refs.
+func (self *Record) appendSAM(dst []byte, refs []string) ([]byte, error) {
+	refName := func(id int) (string, error) {
+		switch {
+		case id < 0:
+			return "*", nil
+		case id < len(refs):
+			return refs[id], nil
+		}
+		return "", fmt.Errorf("boom: no name for reference ID %d", id)
+	}
+	rname, err := refName(self.RefID())
+	if err != nil {
+		return dst, err
+	}
+	rnext, err := refName(self.NextRefID())
+	if err != nil {
+		return dst, err
+	}
+	if self.NextRefID() >= 0 && self.NextRefID() == self.RefID() {
+		rnext = "="
+	}
+
+	name := self.Name()
+	if name == "" {
+		name = "*"
+	}
+	dst = append(dst, name...)
+	dst = append(dst, '\t')
+	dst = strconv.AppendUint(dst, uint64(self.Flags()), 10)
+	dst = append(dst, '\t')
+	dst = append(dst, rname...)
+	dst = append(dst, '\t')
+	dst = strconv.AppendInt(dst, int64(self.Start()+1), 10)
+	dst = append(dst, '\t')
+	dst = strconv.AppendUint(dst, uint64(self.Score()), 10)
+	dst = append(dst, '\t')
+	if cigar := self.Cigar(); len(cigar) == 0 {
+		dst = append(dst, '*')
+	} else {
+		for _, co := range cigar {
+			dst = strconv.AppendInt(dst, int64(co.Len()), 10)
+			dst = append(dst, co.Type().String()...)
+		}
+	}
+	dst = append(dst, '\t')
+	dst = append(dst, rnext...)
+	dst = append(dst, '\t')
+	dst = strconv.AppendInt(dst, int64(self.NextStart()+1), 10)
+	dst = append(dst, '\t')
+	dst = strconv.AppendInt(dst, int64(self.TemplateLen()), 10)
+	dst = append(dst, '\t')
+	if seq := self.Seq(); len(seq) == 0 {
+		dst = append(dst, '*')
+	} else {
+		dst = append(dst, seq...)
+	}
+	dst = append(dst, '\t')
+	if q := self.Quality(); len(q) == 0 || q[0] == 0xff {
+		dst = append(dst, '*')
+	} else {
+		for _, v := range q {
+			dst = append(dst, v+33)
+		}
+	}
+	for _, a := range self.Tags() {
+		dst = append(dst, '\t')
+		dst = appendSAMAux(dst, a)
+	}
+	return dst, nil
+}
+
+// appendSAMAux appends the SAM representation of the auxiliary field, a, to dst.
+func appendSAMAux(dst []byte, a Aux) []byte {
+	dst = append(dst, a[0], a[1], ':', auxTypes[a.Type()], ':')
+	switch a.Type() {
+	case 'A', 'Z', 'H':
+		return append(dst, a[3:]...)
+	case 'f':
+		return strconv.AppendFloat(dst, float64(math.Float32frombits(endian.Uint32(a[3:7]))), 'g', -1, 32)
+	case 'B':
+		dst = append(dst, a[3])
+		if a[3] == 'f' {
+			fs, _ := a.DecodeFloats(nil)
+			for _, v := range fs {
+				dst = append(dst, ',')
+				dst = strconv.AppendFloat(dst, float64(v), 'g', -1, 32)
+			}
+			return dst
+		}
+		_, n, d, err := a.array()
+		if err != nil {
+			return dst
+		}
+		size := auxElemSize[a[3]]
+		for i := 0; i < n; i++ {
+			var v int64
+			switch e := d[i*size:]; a[3] {
+			case 'c':
+				v = int64(int8(e[0]))
+			case 'C':
+				v = int64(e[0])
+			case 's':
+				v = int64(int16(endian.Uint16(e)))
+			case 'S':
+				v = int64(endian.Uint16(e))
+			case 'i':
+				v = int64(int32(endian.Uint32(e)))
+			case 'I':
+				v = int64(endian.Uint32(e))
+			}
+			dst = append(dst, ',')
+			dst = strconv.AppendInt(dst, v, 10)
+		}
+		return dst
+	}
+	v, _ := a.intValue()
+	return strconv.AppendInt(dst, v, 10)
+}
@@ -0,0 +1,27 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// AlignmentScore returns the aligner's alignment score held in the AS tag of the record, and
+// whether the record has an integer AS tag. Any integer encoding of the tag is accepted.
+func (self *Record) AlignmentScore() (int, bool) {
+	v, ok := intTag(self, "AS")
+	return int(v), ok
+}
+
+// EditDistance returns the edit distance to the reference held in the NM tag of the record,
+// and whether the record has an integer NM tag. Any integer encoding of the tag is accepted.
+func (self *Record) EditDistance() (int, bool) {
+	v, ok := intTag(self, "NM")
+	return int(v), ok
+}
+
+// HitCount returns the number of reported alignments of the query held in the NH tag of the
+// record, and whether the record has an integer NH tag. Any integer encoding of the tag is
+// accepted.
+func (self *Record) HitCount() (int, bool) {
+	v, ok := intTag(self, "NH")
+	return int(v), ok
+}
@@ -0,0 +1,80 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+	"iter"
+)
+
+// Records returns an iterator over the remaining records of r. Iteration ends at the end of
+// the input or at the first error; use RecordsErr to observe errors.
+func Records(r RecordReader) iter.Seq[*Record] {
+	return func(yield func(*Record) bool) {
+		for {
+			rec, _, err := r.Read()
+			if err != nil || !yield(rec) {
+				return
+			}
+		}
+	}
+}
+
+// RecordsErr returns an iterator over the remaining records of r paired with a nil error.
+// If reading fails for a reason other than the end of the input, the error is yielded with
+// a nil Record and iteration ends.
+func RecordsErr(r RecordReader) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		for {
+			rec, _, err := r.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(rec, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Records returns an iterator over the remaining records of the BAM file.
+// See the Records function for details.
+func (self *BAMFile) Records() iter.Seq[*Record] { return Records(self) }
+
+// RecordsErr returns an iterator over the remaining records of the BAM file with errors.
+// See the RecordsErr function for details.
+func (self *BAMFile) RecordsErr() iter.Seq2[*Record, error] { return RecordsErr(self) }
+
+// Records returns an iterator over the remaining records of the SAM file.
+// See the Records function for details.
+func (self *SAMFile) Records() iter.Seq[*Record] { return Records(self) }
+
+// RecordsErr returns an iterator over the remaining records of the SAM file with errors.
+// See the RecordsErr function for details.
+func (self *SAMFile) RecordsErr() iter.Seq2[*Record, error] { return RecordsErr(self) }
+
+// QueryRecords returns an iterator over the records within the interval [beg, end) of the
+// reference sequence identified by tid. The underlying Iterator is created when iteration
+// starts and closed when it ends, including when the loop is exited early. Errors, including
+// a failure to query the index, are yielded with a nil Record and end iteration.
+func (self *BAMFile) QueryRecords(i *Index, tid, beg, end int) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		it, err := self.Query(i, tid, beg, end)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer it.Close()
+		for r, err := range RecordsErr(it) {
+			if !yield(r, err) {
+				return
+			}
+		}
+	}
+}
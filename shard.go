@@ -0,0 +1,152 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"sort"
+)
+
+var badShardCount = errors.New("boom: shard count must be positive")
+
+// PlanShards partitions the reference sequences of the indexed BAM file, filename, into at most
+// n shards holding approximately equal volumes of data. If regs is not nil, only the regions in
+// regs are partitioned, otherwise complete reference sequences are used. Data volume is estimated
+// from the compressed file offsets of the linear index, so shard boundaries fall on 16kb index
+// windows; if the index holds no data, shards are of approximately equal length. Each shard is
+// returned as a list of non-overlapping regions in coordinate order.
+func PlanShards(filename string, n int, regs []Region) ([][]Region, error) {
+	if n < 1 {
+		return nil, badShardCount
+	}
+	f, err := OpenBAM(filename)
+	if err != nil {
+		return nil, err
+	}
+	lens := f.RefLengths()
+	f.Close()
+	idx, err := readBAIFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if regs == nil {
+		for tid, l := range lens {
+			regs = append(regs, Region{RefID: tid, Start: 0, End: int(l)})
+		}
+	}
+	regs = mergeRegions(regs)
+
+	// Divide the regions into index windows weighted by estimated data volume.
+	type unit struct {
+		r Region
+		w float64
+	}
+	var (
+		units []unit
+		total float64
+	)
+	const win = 1 << baiLinearShift
+	for _, r := range regs {
+		var (
+			ref        *baiRef
+			dbeg, dend uint64
+		)
+		if r.RefID < len(idx.refs) {
+			ref = &idx.refs[r.RefID]
+			dbeg, dend, _ = ref.dataRange()
+		}
+		for beg := r.Start; beg < r.End; {
+			end := (beg>>baiLinearShift + 1) << baiLinearShift
+			if end > r.End {
+				end = r.End
+			}
+			w := ref.windowVolume(beg>>baiLinearShift, dbeg, dend) * float64(end-beg) / win
+			units = append(units, unit{Region{RefID: r.RefID, Start: beg, End: end}, w})
+			total += w
+			beg = end
+		}
+	}
+	if total == 0 {
+		for i := range units {
+			units[i].w = float64(units[i].r.Len())
+			total += units[i].w
+		}
+	}
+
+	target := total / float64(n)
+	shards := [][]Region{nil}
+	var cum float64
+	for _, u := range units {
+		last := len(shards) - 1
+		if cum+u.w/2 > float64(len(shards))*target && len(shards) < n && len(shards[last]) != 0 {
+			shards = append(shards, nil)
+			last++
+		}
+		s := shards[last]
+		if k := len(s) - 1; k >= 0 && s[k].RefID == u.r.RefID && s[k].End == u.r.Start {
+			s[k].End = u.r.End
+		} else {
+			shards[last] = append(s, u.r)
+		}
+		cum += u.w
+	}
+	if len(shards[0]) == 0 {
+		return nil, nil
+	}
+
+	return shards, nil
+}
+
+// windowVolume returns the compressed data volume of the records starting in the linear index
+// window w, estimated from the index offsets of w and the following window. The virtual offsets
+// beg and end bound the data of the reference.
+func (self *baiRef) windowVolume(w int, beg, end uint64) float64 {
+	if self == nil || w >= len(self.intervals) {
+		return 0
+	}
+	off := func(i int) uint64 {
+		o := end
+		if i < len(self.intervals) {
+			o = self.intervals[i]
+		}
+		switch {
+		case o < beg:
+			o = beg
+		case o > end:
+			o = end
+		}
+		return o >> 16
+	}
+	return float64(off(w+1) - off(w))
+}
+
+// mergeRegions returns the regions sorted by coordinate with overlapping and abutting
+// regions merged and empty regions removed.
+func mergeRegions(regs []Region) []Region {
+	s := make([]Region, 0, len(regs))
+	for _, r := range regs {
+		if r.Len() > 0 {
+			s = append(s, r)
+		}
+	}
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].RefID != s[j].RefID {
+			return s[i].RefID < s[j].RefID
+		}
+		return s[i].Start < s[j].Start
+	})
+	var m []Region
+	for _, r := range s {
+		if k := len(m) - 1; k >= 0 && m[k].RefID == r.RefID && r.Start <= m[k].End {
+			if r.End > m[k].End {
+				m[k].End = r.End
+			}
+			continue
+		}
+		m = append(m, r)
+	}
+	return m
+}
@@ -0,0 +1,627 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bytes"
+	"cmp"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+)
+
+var badSortOrder = errors.New("boom: invalid sort order")
+
+// A SortOrder describes the ordering of records in a SAM or BAM file.
+type SortOrder int
+
+const (
+	UnknownOrder SortOrder = iota // The sort order is not known.
+	Unsorted                      // The records are not sorted.
+	QueryName                     // The records are sorted by query name.
+	Coordinate                    // The records are sorted by reference ID and position.
+)
+
+var sortOrders = []string{"unknown", "unsorted", "queryname", "coordinate"}
+
+// String returns the string representation of a SortOrder as used in the SO field of the
+// SAM header @HD line.
+func (so SortOrder) String() string {
+	if so < UnknownOrder || so > Coordinate {
+		so = UnknownOrder
+	}
+	return sortOrders[so]
+}
+
+// lessFunc returns the record comparison function for the sort order.
+func (so SortOrder) lessFunc() (func(a, b *Record) bool, error) {
+	switch so {
+	case Coordinate:
+		return coordinateLess, nil
+	case QueryName:
+		return nameLess, nil
+	}
+	return nil, badSortOrder
+}
+
+// coordinateKey returns the sort key used by samtools for coordinate sorting. Unmapped
+// records without a reference ID are placed after all others.
+func coordinateKey(r *Record) uint64 {
+	return uint64(uint32(r.tid()))<<32 | uint64(uint32(r.pos()+1))
+}
+
+// CompareCoordinate compares the records a and b in the coordinate sort order used by samtools,
+// returning -1, 0 or 1 if a sorts before, with or after b. Records are ordered by reference ID
+// and then by position, with records without a reference ID placed after all others. No
+// further tie-breaking is performed, so a stable sort, such as slices.SortStableFunc, must be
+// used to reproduce the order of records written by Sort.
+func CompareCoordinate(a, b *Record) int {
+	return cmp.Compare(coordinateKey(a), coordinateKey(b))
+}
+
+// CompareName compares the records a and b in the query name sort order used by samtools,
+// returning -1, 0 or 1 if a sorts before, with or after b. Names are compared with runs of
+// digits treated as integers and ties are broken by CompareCoordinate. As for
+// CompareCoordinate, a stable sort must be used to reproduce the order of records written by
+// Sort.
+func CompareName(a, b *Record) int {
+	if c := strnumCmp(a.Name(), b.Name()); c != 0 {
+		return c
+	}
+	return CompareCoordinate(a, b)
+}
+
+func coordinateLess(a, b *Record) bool { return CompareCoordinate(a, b) < 0 }
+
+func nameLess(a, b *Record) bool { return CompareName(a, b) < 0 }
+
+// A sortKey holds the sort keys of a record for checking the order of written records.
+type sortKey struct {
+	coord uint64
+	name  string
+}
+
+// checkOrder returns the sort keys of r, or an error if r sorts before the record with the keys
+// last in the sort order enforced by the file. Records are ordered by name alone in QueryName
+// order, since name sorted files need not order the records of a template by position. If last
+// is nil, r is the first record.
+func (sf *samFile) checkOrder(r *Record, last *sortKey) (sortKey, error) {
+	var k sortKey
+	switch sf.order {
+	case Coordinate:
+		k.coord = coordinateKey(r)
+		if last != nil && k.coord < last.coord {
+			return k, fmt.Errorf("boom: record %s written out of %v order", r.Name(), sf.order)
+		}
+	case QueryName:
+		k.name = r.Name()
+		if last != nil && strnumCmp(k.name, last.name) < 0 {
+			return k, fmt.Errorf("boom: record %s written out of %v order", r.Name(), sf.order)
+		}
+	}
+	return k, nil
+}
+
+// setLast records the sort keys of the last record successfully written.
+func (sf *samFile) setLast(k sortKey) {
+	if sf.order != Coordinate && sf.order != QueryName {
+		return
+	}
+	if sf.last == nil {
+		sf.last = &sortKey{}
+	}
+	*sf.last = k
+}
+
+// ByCoordinate implements sort.Interface, ordering records by CompareCoordinate. It should be
+// sorted with sort.Stable.
+type ByCoordinate []*Record
+
+func (self ByCoordinate) Len() int           { return len(self) }
+func (self ByCoordinate) Less(i, j int) bool { return coordinateLess(self[i], self[j]) }
+func (self ByCoordinate) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// ByName implements sort.Interface, ordering records by CompareName. It should be sorted with
+// sort.Stable.
+type ByName []*Record
+
+func (self ByName) Len() int           { return len(self) }
+func (self ByName) Less(i, j int) bool { return nameLess(self[i], self[j]) }
+func (self ByName) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// SortRecords stably sorts recs in place in the order, by, which must be Coordinate or
+// QueryName. The resulting order is the order in which Sort writes the records.
+func SortRecords(recs []*Record, by SortOrder) error {
+	switch by {
+	case Coordinate:
+		slices.SortStableFunc(recs, CompareCoordinate)
+	case QueryName:
+		slices.SortStableFunc(recs, CompareName)
+	default:
+		return badSortOrder
+	}
+	return nil
+}
+
+// strnumCmp compares the strings a and b, treating runs of digits as integers, in the same
+// manner as samtools.
+func strnumCmp(a, b string) int {
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	var i, j int
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			var ai, bi int64
+			for ; i < len(a) && isDigit(a[i]); i++ {
+				ai = ai*10 + int64(a[i]-'0')
+			}
+			for ; j < len(b) && isDigit(b[j]); j++ {
+				bi = bi*10 + int64(b[j]-'0')
+			}
+			switch {
+			case ai < bi:
+				return -1
+			case ai > bi:
+				return 1
+			}
+		} else {
+			if a[i] != b[j] {
+				break
+			}
+			i++
+			j++
+		}
+	}
+	var ca, cb byte
+	if i < len(a) {
+		ca = a[i]
+	}
+	if j < len(b) {
+		cb = b[j]
+	}
+	switch {
+	case ca == cb && i < j, ca < cb:
+		return -1
+	case ca == cb && i > j, ca > cb:
+		return 1
+	}
+	return 0
+}
+
+// tagLess returns a less function that orders records by the value of the aux tag, tag,
+// breaking ties with less. Records without the tag are placed first, followed by records
+// with numeric values and then other value types.
+func tagLess(tag Tag, less func(a, b *Record) bool) func(a, b *Record) bool {
+	return func(a, b *Record) bool {
+		ta, _ := a.Tag(tag[:])
+		tb, _ := b.Tag(tag[:])
+		switch c := compareAux(ta, tb); {
+		case c < 0:
+			return true
+		case c > 0:
+			return false
+		}
+		return less(a, b)
+	}
+}
+
+// compareAux compares the values of the aux fields a and b, where a nil Aux represents an absent
+// tag. Integer and float values are compared numerically and other values are compared bytewise.
+func compareAux(a, b Aux) int {
+	class := func(a Aux) int {
+		switch {
+		case a == nil:
+			return 0
+		case a.isNumber():
+			return 1
+		}
+		return 2
+	}
+	ca, cb := class(a), class(b)
+	switch {
+	case ca < cb:
+		return -1
+	case ca > cb:
+		return 1
+	case ca == 0:
+		return 0
+	case ca == 2:
+		return bytes.Compare(a[2:], b[2:])
+	}
+
+	ia, aIsInt := a.intValue()
+	ib, bIsInt := b.intValue()
+	if aIsInt && bIsInt {
+		switch {
+		case ia < ib:
+			return -1
+		case ia > ib:
+			return 1
+		}
+		return 0
+	}
+	fa, fb := a.floatValue(), b.floatValue()
+	switch {
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+	return 0
+}
+
+// recordSorter sorts a slice of records using a less function.
+type recordSorter struct {
+	recs []*Record
+	less func(a, b *Record) bool
+}
+
+func (self recordSorter) Len() int           { return len(self.recs) }
+func (self recordSorter) Less(i, j int) bool { return self.less(self.recs[i], self.recs[j]) }
+func (self recordSorter) Swap(i, j int)      { self.recs[i], self.recs[j] = self.recs[j], self.recs[i] }
+
+// A mergeItem is a record held in a recordHeap and the index of the input it was read from.
+type mergeItem struct {
+	r *Record
+	i int
+}
+
+// recordHeap is a min-heap of records used for k-way merging. Ties are broken by input index.
+type recordHeap struct {
+	items []mergeItem
+	less  func(a, b *Record) bool
+}
+
+func (self *recordHeap) Len() int { return len(self.items) }
+func (self *recordHeap) Less(i, j int) bool {
+	a, b := self.items[i], self.items[j]
+	switch {
+	case self.less(a.r, b.r):
+		return true
+	case self.less(b.r, a.r):
+		return false
+	}
+	return a.i < b.i
+}
+func (self *recordHeap) Swap(i, j int)      { self.items[i], self.items[j] = self.items[j], self.items[i] }
+func (self *recordHeap) Push(x interface{}) { self.items = append(self.items, x.(mergeItem)) }
+func (self *recordHeap) Pop() interface{} {
+	n := len(self.items) - 1
+	it := self.items[n]
+	self.items = self.items[:n]
+	return it
+}
+
+// DefaultSortMem is the default amount of record memory held by Sort before records are
+// written to temporary files.
+const DefaultSortMem = 512 << 20
+
+// SortOptions specifies the behaviour of Sort.
+type SortOptions struct {
+	// By specifies the required sort order, either Coordinate or QueryName.
+	By SortOrder
+
+	// MaxMem is the approximate number of bytes of record data to hold in memory
+	// before writing a sorted run to a temporary file. If MaxMem is zero,
+	// DefaultSortMem is used.
+	MaxMem int
+
+	// TempDir is the directory used for temporary files. If TempDir is empty,
+	// the system default temporary directory is used.
+	TempDir string
+
+	// Threads is the number of goroutines used to sort and compress runs
+	// of records concurrently. If Threads is zero, GOMAXPROCS is used.
+	// The memory budget given by MaxMem is shared between threads.
+	Threads int
+
+	// Tag specifies an aux tag used as the primary sort key, with the order
+	// given by By used to break ties. If Tag is the zero Tag, records are
+	// sorted by the order given by By alone.
+	Tag Tag
+}
+
+// Sort sorts the records of the BAM file, in, writing the result to the BAM file, out. The sort
+// order is recorded in the SO field of the output header. If opts is nil, records are sorted by
+// coordinate with the default memory budget and temporary directory. The ordering of records
+// matches that of samtools sort, including when sorting by tag.
+func Sort(in, out string, opts *SortOptions) error {
+	o := SortOptions{By: Coordinate}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxMem <= 0 {
+		o.MaxMem = DefaultSortMem
+	}
+	less, err := o.By.lessFunc()
+	if err != nil {
+		return err
+	}
+	if o.Tag != (Tag{}) {
+		less = tagLess(o.Tag, less)
+	}
+
+	f, err := OpenBAM(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := f.Header().withText(setSortOrder(f.Text(), o.By))
+
+	threads := o.Threads
+	if threads <= 0 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+	chunkMem := o.MaxMem / threads
+
+	var (
+		recs []*Record
+		mem  int
+
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, threads)
+		mu     sync.Mutex
+		shards = make(map[int]string)
+		serr   error
+	)
+	defer func() {
+		wg.Wait()
+		for _, s := range shards {
+			os.Remove(s)
+		}
+	}()
+	// spill sorts and writes the nth run of records to a temporary file concurrently.
+	spill := func(n int, recs []*Record) {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			s, err := writeShard(o.TempDir, h, recs, less)
+			mu.Lock()
+			if s != "" {
+				shards[n] = s
+			}
+			if err != nil && serr == nil {
+				serr = err
+			}
+			mu.Unlock()
+		}()
+	}
+	var n int
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		recs = append(recs, r)
+		mem += r.size()
+		if mem >= chunkMem {
+			mu.Lock()
+			err = serr
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+			spill(n, recs)
+			n++
+			recs, mem = nil, 0
+		}
+	}
+
+	if n == 0 {
+		parallelSort(recs, less, threads)
+		return writeRecords(out, bWModes[0], h, recs)
+	}
+	if len(recs) != 0 {
+		spill(n, recs)
+		n++
+	}
+	wg.Wait()
+	if serr != nil {
+		return serr
+	}
+
+	names := make([]string, n)
+	for i := range names {
+		names[i] = shards[i]
+	}
+	return mergeFiles(out, h, names, less)
+}
+
+// parallelSort performs a stable sort of recs using up to threads goroutines.
+func parallelSort(recs []*Record, less func(a, b *Record) bool, threads int) {
+	if threads < 2 || len(recs) < 2*threads {
+		sort.Stable(recordSorter{recs: recs, less: less})
+		return
+	}
+
+	var wg sync.WaitGroup
+	width := (len(recs) + threads - 1) / threads
+	for lo := 0; lo < len(recs); lo += width {
+		hi := lo + width
+		if hi > len(recs) {
+			hi = len(recs)
+		}
+		wg.Add(1)
+		go func(run []*Record) {
+			defer wg.Done()
+			sort.Stable(recordSorter{recs: run, less: less})
+		}(recs[lo:hi])
+	}
+	wg.Wait()
+
+	src, dst := recs, make([]*Record, len(recs))
+	for ; width < len(recs); width *= 2 {
+		for lo := 0; lo < len(recs); lo += 2 * width {
+			mid, hi := lo+width, lo+2*width
+			if mid > len(recs) {
+				mid = len(recs)
+			}
+			if hi > len(recs) {
+				hi = len(recs)
+			}
+			wg.Add(1)
+			go func(lo, mid, hi int) {
+				defer wg.Done()
+				mergeRuns(dst[lo:hi], src[lo:mid], src[mid:hi], less)
+			}(lo, mid, hi)
+		}
+		wg.Wait()
+		src, dst = dst, src
+	}
+	copy(recs, src)
+}
+
+// mergeRuns performs a stable merge of the sorted runs a and b into dst.
+func mergeRuns(dst, a, b []*Record, less func(a, b *Record) bool) {
+	var i, j int
+	for k := range dst {
+		if j == len(b) || (i < len(a) && !less(b[j], a[i])) {
+			dst[k] = a[i]
+			i++
+		} else {
+			dst[k] = b[j]
+			j++
+		}
+	}
+}
+
+// writeShard sorts recs and writes them to a new temporary BAM file in dir, returning the
+// name of the file.
+func writeShard(dir string, h *Header, recs []*Record, less func(a, b *Record) bool) (string, error) {
+	sort.Stable(recordSorter{recs: recs, less: less})
+	tf, err := os.CreateTemp(dir, "boom-sort-")
+	if err != nil {
+		return "", err
+	}
+	name := tf.Name()
+	tf.Close()
+	return name, writeRecords(name, "wb1", h, recs)
+}
+
+// writeRecords writes recs to a new BAM file, filename, opened with the given mode, freeing the
+// C data of each record once it has been written.
+func writeRecords(filename, mode string, h *Header, recs []*Record) error {
+	sf, err := samOpen(filename, mode, h.bamHeader)
+	if err != nil {
+		return err
+	}
+	bf := &BAMFile{sf}
+	for _, r := range recs {
+		n, err := bf.Write(r)
+		if err == nil && n < 0 {
+			err = writeFailed
+		}
+		if err != nil {
+			bf.Close()
+			return err
+		}
+		r.bamRecordFree()
+	}
+	return bf.Close()
+}
+
+// mergeFiles merges the records of the sorted BAM files, ins, into a new BAM file, out, with
+// the header h using less to order records.
+func mergeFiles(out string, h *Header, ins []string, less func(a, b *Record) bool) error {
+	rs := make([]RecordReader, len(ins))
+	for i, in := range ins {
+		f, err := OpenBAM(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		rs[i] = f
+	}
+	return mergeReaders(out, h, rs, less)
+}
+
+// mergeReaders merges the records of the sorted RecordReaders, rs, into a new BAM file, out,
+// with the header h using less to order records.
+func mergeReaders(out string, h *Header, rs []RecordReader, less func(a, b *Record) bool) error {
+	rh := &recordHeap{less: less}
+	for i, r := range rs {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				continue
+			}
+			return err
+		}
+		rh.items = append(rh.items, mergeItem{r: rec, i: i})
+	}
+	heap.Init(rh)
+
+	bf, err := CreateBAM(out, h, true)
+	if err != nil {
+		return err
+	}
+	for rh.Len() > 0 {
+		it := rh.items[0]
+		n, err := bf.Write(it.r)
+		if err == nil && n < 0 {
+			err = writeFailed
+		}
+		if err != nil {
+			bf.Close()
+			return err
+		}
+		it.r.bamRecordFree()
+
+		rec, _, err := rs[it.i].Read()
+		if err != nil {
+			if err != io.EOF {
+				bf.Close()
+				return err
+			}
+			heap.Pop(rh)
+			continue
+		}
+		rh.items[0].r = rec
+		heap.Fix(rh, 0)
+	}
+	return bf.Close()
+}
+
+// IsSorted reads the remaining records of f and reports whether they are in the sort order
+// given by by, using the ordering of samtools sort. In QueryName order only the names of records
+// are compared, so that files whose templates are grouped by name without ordering their records
+// by position, as written by Picard and later versions of samtools, are accepted. If a record is
+// found to be out of order, false is returned with the first such record. Reading stops at the
+// first violation.
+func IsSorted(f *BAMFile, by SortOrder) (ok bool, first *Record, err error) {
+	less, err := by.lessFunc()
+	if err != nil {
+		return false, nil, err
+	}
+	if by == QueryName {
+		less = func(a, b *Record) bool { return strnumCmp(a.Name(), b.Name()) < 0 }
+	}
+	var last *Record
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				return true, nil, nil
+			}
+			return false, nil, err
+		}
+		if last != nil && less(r, last) {
+			return false, r, nil
+		}
+		last = r
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom_test
+
+import (
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/biogo/boom"
+	"github.com/biogo/boom/generator"
+)
+
+// writeTestBAM writes the synthetic reads described by cfg to the BAM file name in dir and
+// returns its path.
+func writeTestBAM(t *testing.T, dir, name string, cfg generator.Config) string {
+	t.Helper()
+	g, err := generator.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+	fn := filepath.Join(dir, name)
+	err = g.WriteBAM(fn)
+	if err != nil {
+		t.Fatalf("failed to write BAM: %v", err)
+	}
+	return fn
+}
+
+// readRecords returns the header and records of the BAM file, fn. The file is held open until
+// the test completes, since the header belongs to it.
+func readRecords(t *testing.T, fn string) (*boom.Header, []*boom.Record) {
+	t.Helper()
+	f, err := boom.OpenBAM(fn)
+	if err != nil {
+		t.Fatalf("failed to open BAM: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	var recs []*boom.Record
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("failed to read %s: %v", fn, err)
+		}
+		recs = append(recs, r)
+	}
+	return f.Header(), recs
+}
+
+// checkSorted fails the test if the BAM file, fn, is not sorted in the order, by, or does not
+// declare that order in its header.
+func checkSorted(t *testing.T, fn string, by boom.SortOrder) {
+	t.Helper()
+	f, err := boom.OpenBAM(fn)
+	if err != nil {
+		t.Fatalf("failed to open BAM: %v", err)
+	}
+	defer f.Close()
+	if got := f.Header().SortOrder(); got != by {
+		t.Errorf("unexpected sort order in %s header: got %v want %v", fn, got, by)
+	}
+	ok, first, err := boom.IsSorted(f, by)
+	if err != nil {
+		t.Fatalf("failed to check order of %s: %v", fn, err)
+	}
+	if !ok {
+		t.Errorf("%s is not sorted by %v at record %v", fn, by, first)
+	}
+}
+
+// recordKeys returns the sorted keys of recs, for comparing record sets ignoring order.
+func recordKeys(recs []*boom.Record) []string {
+	keys := make([]string, len(recs))
+	for i, r := range recs {
+		keys[i] = recordKey(r)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestSort(t *testing.T) {
+	dir := t.TempDir()
+	in := writeTestBAM(t, dir, "in.bam", generator.Config{
+		Seed: 1,
+		References: []generator.Reference{
+			{Name: "chr1", Length: 50000},
+			{Name: "chr2", Length: 20000},
+		},
+		Paired:   true,
+		Coverage: 3,
+		Unmapped: 0.05,
+	})
+	_, want := readRecords(t, in)
+
+	// A small memory budget forces records to be spilled
+	// to several runs that must be merged.
+	src := in
+	for _, by := range []boom.SortOrder{boom.QueryName, boom.Coordinate} {
+		out := filepath.Join(dir, by.String()+".bam")
+		err := boom.Sort(src, out, &boom.SortOptions{By: by, MaxMem: 64 << 10, TempDir: dir, Threads: 2})
+		if err != nil {
+			t.Fatalf("failed to sort by %v: %v", by, err)
+		}
+		checkSorted(t, out, by)
+		_, got := readRecords(t, out)
+		if !slices.Equal(recordKeys(got), recordKeys(want)) {
+			t.Errorf("records changed by sorting by %v", by)
+		}
+		src = out
+	}
+}
+
+func TestWriteOrder(t *testing.T) {
+	dir := t.TempDir()
+	in := writeTestBAM(t, dir, "in.bam", generator.Config{Seed: 1, Paired: true})
+	named := filepath.Join(dir, "name.bam")
+	err := boom.Sort(in, named, &boom.SortOptions{By: boom.QueryName})
+	if err != nil {
+		t.Fatalf("failed to sort by name: %v", err)
+	}
+	h, recs := readRecords(t, named)
+
+	// Write the records of each template in descending
+	// position order, which name sorted files allow.
+	for i := 0; i+1 < len(recs); i += 2 {
+		if recs[i].Name() == recs[i+1].Name() && recs[i].Start() < recs[i+1].Start() {
+			recs[i], recs[i+1] = recs[i+1], recs[i]
+		}
+	}
+	out := filepath.Join(dir, "out.bam")
+	bf, err := boom.CreateBAM(out, h, true)
+	if err != nil {
+		t.Fatalf("failed to create BAM: %v", err)
+	}
+	bf.SetSortOrderCheck(boom.QueryName)
+	for i, r := range recs {
+		_, err = bf.Write(r)
+		if err != nil {
+			t.Fatalf("unexpected error writing record %d: %v", i, err)
+		}
+		if i != len(recs)/2 {
+			continue
+		}
+
+		// A rejected record does not change the order
+		// against which later records are checked.
+		_, err = bf.Write(recs[0])
+		if err == nil {
+			t.Fatal("expected error writing record out of order")
+		}
+	}
+	err = bf.Close()
+	if err != nil {
+		t.Fatalf("failed to close BAM: %v", err)
+	}
+	checkSorted(t, out, boom.QueryName)
+}
@@ -0,0 +1,167 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+	"slices"
+)
+
+// DefaultMinSplitClip is the default minimum soft clip length for which a read without an SA
+// tag is selected by a SplitReadSplitter.
+const DefaultMinSplitClip = 20
+
+// A SplitReadSplitter is a Processor that passes all records through unaltered and writes split
+// reads to a separate RecordWriter for breakpoint assembly. Records with an SA tag, and primary
+// records with a soft clip of at least MinClip bases at either end, are selected. Unmapped,
+// secondary, QC failed and duplicate records are not selected.
+type SplitReadSplitter struct {
+	// MinClip is the minimum selected soft clip length. If
+	// MinClip is zero, DefaultMinSplitClip is used, and if it is
+	// negative clipped reads without an SA tag are not selected.
+	MinClip int
+
+	// Segments specifies that for selected primary records with an
+	// SA tag, a supplementary record is constructed from each SA
+	// entry and written after the primary record. The constructed
+	// records take their sequence and qualities from the primary
+	// record, and have no sequence if the primary record is hard
+	// clipped. Supplementary records in the input should be
+	// excluded when Segments is used to avoid duplicates.
+	Segments bool
+
+	// W receives the selected records.
+	W RecordWriter
+
+	// Split and Clipped count the selected records with SA tags
+	// and with soft clips only, and Constructed counts the records
+	// constructed from SA entries.
+	Split, Clipped, Constructed int
+
+	tids map[string]int
+}
+
+// NewSplitReadSplitter returns a SplitReadSplitter writing to w split reads from an input with
+// the header h.
+func NewSplitReadSplitter(h *Header, w RecordWriter) *SplitReadSplitter {
+	return &SplitReadSplitter{W: w, tids: refIndex(h)}
+}
+
+// Process writes r to the split read output if it is selected, and returns r.
+func (self *SplitReadSplitter) Process(r *Record) (*Record, error) {
+	fl := r.Flags()
+	if fl&(Unmapped|Secondary|QCFail|Duplicate) != 0 {
+		return r, nil
+	}
+	sa, err := SupplementaryAlignments(r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case sa != nil:
+		self.Split++
+	case fl&Supplementary == 0 && self.clipped(r.Cigar()):
+		self.Clipped++
+	default:
+		return r, nil
+	}
+	err = self.write(r)
+	if err != nil || !self.Segments || fl&Supplementary != 0 {
+		return r, err
+	}
+	for _, s := range sa {
+		seg, err := self.segment(r, s)
+		if err != nil {
+			return nil, err
+		}
+		err = self.write(seg)
+		if err != nil {
+			return nil, err
+		}
+		self.Constructed++
+	}
+	return r, nil
+}
+
+// Flush returns no records.
+func (self *SplitReadSplitter) Flush() ([]*Record, error) { return nil, nil }
+
+func (self *SplitReadSplitter) write(r *Record) error {
+	n, err := self.W.Write(r)
+	if err == nil && n < 0 {
+		err = writeFailed
+	}
+	return err
+}
+
+// clipped returns whether the alignment described by cigar has a soft clip of at least the
+// minimum length at either end.
+func (self *SplitReadSplitter) clipped(cigar []CigarOp) bool {
+	min := self.MinClip
+	switch {
+	case min == 0:
+		min = DefaultMinSplitClip
+	case min < 0:
+		return false
+	}
+	return leadingSoft(cigar) >= min || leadingSoft(reverseCigar(cigar)) >= min
+}
+
+// segment returns a supplementary record for the primary record r constructed from the SA
+// entry s.
+func (self *SplitReadSplitter) segment(r *Record, s SupplementaryAlignment) (*Record, error) {
+	tid, ok := self.tids[s.Ref]
+	if !ok {
+		return nil, fmt.Errorf("boom: unknown reference %q in SA tag", s.Ref)
+	}
+	seg, err := r.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	var seq, qual []byte
+	if !slices.ContainsFunc(r.Cigar(), func(co CigarOp) bool { return co.Type() == CigarHardClipped }) {
+		seq = append([]byte(nil), r.Seq()...)
+		qual = append([]byte(nil), r.Quality()...)
+		if s.Reverse != (r.Flags()&Reverse != 0) {
+			slices.Reverse(seq)
+			for i, b := range seq {
+				seq[i] = complement(upper(b))
+			}
+			slices.Reverse(qual)
+		}
+		// Remove bases hard clipped by the segment alignment.
+		var head, tail int
+		if len(s.Cigar) != 0 && s.Cigar[0].Type() == CigarHardClipped {
+			head = s.Cigar[0].Len()
+		}
+		if n := len(s.Cigar); n > 1 && s.Cigar[n-1].Type() == CigarHardClipped {
+			tail = s.Cigar[n-1].Len()
+		}
+		if head+tail > len(seq) {
+			return nil, fmt.Errorf("boom: SA entry for %s clips more than the read length", r.Name())
+		}
+		seq, qual = seq[head:len(seq)-tail], qual[head:len(qual)-tail]
+	}
+
+	fl := r.Flags()&^(Reverse|Secondary) | Supplementary
+	if s.Reverse {
+		fl |= Reverse
+	}
+	seg.SetFlags(fl)
+	seg.setTid(int32(tid))
+	seg.setPos(int32(s.Pos))
+	seg.setBin(reg2bin(s.Pos, s.Pos+max(refLen(s.Cigar), 1)))
+	seg.setQual(s.MapQ)
+	seg.setIsize(0)
+	seg.setCigar(s.Cigar)
+	seg.setSeqQual(seq, qual)
+	nm, err := NewAux(Tag{'N', 'M'}, s.NM)
+	if err != nil {
+		return nil, err
+	}
+	seg.SetTags([]Aux{nm})
+	return seg, nil
+}
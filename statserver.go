@@ -0,0 +1,327 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"container/list"
+	"sync"
+	"unsafe"
+)
+
+// DefaultServerCache is the default number of bytes of region statistics held by a StatServer.
+const DefaultServerCache = 1 << 28
+
+// statTileSize is the width of the fixed reference tiles in which a StatServer calculates and
+// caches statistics.
+const statTileSize = 1 << 15
+
+// A RegionSummary holds the statistics of the records overlapping a region.
+type RegionSummary struct {
+	Region  Region
+	Records int       // Records overlapping the region.
+	Flags   FlagStats // Flag statistics of the overlapping records.
+}
+
+// A StatServer answers queries for statistics over regions of an indexed BAM file. It keeps
+// a pool of open handles on the file so that queries may be made concurrently. Statistics are
+// calculated and cached in fixed width tiles of the reference sequences, so that queries over
+// nearby regions share calculations, and depth of coverage is only calculated for tiles
+// queried by Coverage. A StatServer is safe for concurrent use.
+type StatServer struct {
+	idx     *Index
+	handles chan *BAMFile
+	lens    []uint32
+	filt    *CoverageFilter
+
+	mu    sync.Mutex
+	max   int
+	used  int
+	lru   list.List
+	cache map[tileKey]*list.Element
+
+	// pending holds the tiles being calculated, so that
+	// concurrent queries for a tile share a single pass.
+	pending map[tileKey]*pendingTile
+
+	hits, misses int64
+}
+
+// A tileKey identifies the tile holding reference positions [i*statTileSize, (i+1)*statTileSize)
+// of the reference sequence tid.
+type tileKey struct {
+	tid, i int
+}
+
+// A statTile holds the records overlapping a tile and, if requested, the depth of coverage at
+// each position of the tile.
+type statTile struct {
+	key   tileKey
+	recs  []tileRecord
+	depth []int32
+}
+
+// size returns the approximate number of bytes held by the tile.
+func (self *statTile) size() int {
+	return int(unsafe.Sizeof(*self)) + len(self.recs)*int(unsafe.Sizeof(tileRecord{})) + 4*len(self.depth)
+}
+
+// A tileRecord holds the fields of a record needed to count it in a RegionSummary.
+type tileRecord struct {
+	start, end int32 // Half-open reference interval used for overlap queries.
+	flags      Flags
+	mapq       byte
+	diffRef    bool // The mate is on a different reference.
+}
+
+// A pendingTile is a tile being calculated by a StatServer.
+type pendingTile struct {
+	done  chan struct{}
+	depth bool
+	t     *statTile
+	err   error
+}
+
+// NewStatServer returns a StatServer for the BAM file, filename, and its index, holding up to
+// handles open handles on the file and caching statistics held in up to cache bytes. Depth is
+// calculated from records accepted by filt, or DefaultCoverageFilter if filt is nil. If handles
+// is not positive, a single handle is used. If cache is zero, DefaultServerCache is used; if it
+// is negative, statistics are not cached.
+func NewStatServer(filename string, handles, cache int, filt *CoverageFilter) (*StatServer, error) {
+	if handles < 1 {
+		handles = 1
+	}
+	if cache == 0 {
+		cache = DefaultServerCache
+	}
+	idx, err := LoadIndex(filename)
+	if err != nil {
+		return nil, err
+	}
+	s := &StatServer{
+		idx:     idx,
+		handles: make(chan *BAMFile, handles),
+		filt:    filt,
+		max:     cache,
+		cache:   make(map[tileKey]*list.Element),
+		pending: make(map[tileKey]*pendingTile),
+	}
+	for i := 0; i < handles; i++ {
+		f, err := OpenBAM(filename)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.lens = f.RefLengths()
+		s.handles <- f
+	}
+	return s, nil
+}
+
+// Close closes the file handles held by the server. It must not be called while queries are
+// in progress.
+func (self *StatServer) Close() error {
+	var err error
+	for len(self.handles) != 0 {
+		if cerr := (<-self.handles).Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// CacheStats returns the numbers of tiles used by queries that were found in the cache or
+// were being calculated by a concurrent query, and of tiles requiring a pass over the records.
+func (self *StatServer) CacheStats() (hits, misses int64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.hits, self.misses
+}
+
+// clip returns the half-open interval [beg, end) clipped to the reference sequence identified
+// by tid, and an error if the result is empty.
+func (self *StatServer) clip(tid, beg, end int) (int, int, error) {
+	if tid < 0 || tid >= len(self.lens) {
+		return 0, 0, badRegion
+	}
+	beg, end = max(beg, 0), min(end, int(self.lens[tid]))
+	if beg >= end {
+		return 0, 0, badRegion
+	}
+	return beg, end, nil
+}
+
+// Summary returns the statistics of the records overlapping the half-open interval [beg, end)
+// of the reference sequence identified by tid. The interval is clipped to the reference.
+func (self *StatServer) Summary(tid, beg, end int) (*RegionSummary, error) {
+	beg, end, err := self.clip(tid, beg, end)
+	if err != nil {
+		return nil, err
+	}
+	s := &RegionSummary{Region: Region{RefID: tid, Start: beg, End: end}}
+	for i := beg / statTileSize; i*statTileSize < end; i++ {
+		t, err := self.tile(tileKey{tid: tid, i: i}, false)
+		if err != nil {
+			return nil, err
+		}
+		tbeg, tend := i*statTileSize, (i+1)*statTileSize
+		for _, r := range t.recs {
+			if int(r.start) >= end || int(r.end) <= beg {
+				continue
+			}
+			// A record overlapping several tiles is counted
+			// only in the tile holding its first position
+			// within the query.
+			if p := max(int(r.start), beg); p < tbeg || tend <= p {
+				continue
+			}
+			s.Records++
+			s.Flags.add(r.flags, r.diffRef, r.mapq)
+		}
+	}
+	return s, nil
+}
+
+// Count returns the number of records overlapping the interval [beg, end) of the reference
+// sequence identified by tid.
+func (self *StatServer) Count(tid, beg, end int) (int, error) {
+	s, err := self.Summary(tid, beg, end)
+	if err != nil {
+		return 0, err
+	}
+	return s.Records, nil
+}
+
+// FlagStat returns the flag statistics of the records overlapping the interval [beg, end) of
+// the reference sequence identified by tid.
+func (self *StatServer) FlagStat(tid, beg, end int) (FlagStats, error) {
+	s, err := self.Summary(tid, beg, end)
+	if err != nil {
+		return FlagStats{}, err
+	}
+	return s.Flags, nil
+}
+
+// Coverage returns the depth of coverage at each position of the interval [beg, end) of the
+// reference sequence identified by tid, after clipping to the reference, by records accepted
+// by the server's filter.
+func (self *StatServer) Coverage(tid, beg, end int) ([]int32, error) {
+	beg, end, err := self.clip(tid, beg, end)
+	if err != nil {
+		return nil, err
+	}
+	depth := make([]int32, end-beg)
+	for i := beg / statTileSize; i*statTileSize < end; i++ {
+		t, err := self.tile(tileKey{tid: tid, i: i}, true)
+		if err != nil {
+			return nil, err
+		}
+		tbeg := i * statTileSize
+		lo, hi := max(beg, tbeg), min(end, tbeg+len(t.depth))
+		copy(depth[lo-beg:hi-beg], t.depth[lo-tbeg:hi-tbeg])
+	}
+	return depth, nil
+}
+
+// tile returns the tile identified by key, calculating its depth of coverage if depth is true.
+// The returned tile is shared and must not be modified.
+func (self *StatServer) tile(key tileKey, depth bool) (*statTile, error) {
+	self.mu.Lock()
+	if el, ok := self.cache[key]; ok {
+		if t := el.Value.(*statTile); !depth || t.depth != nil {
+			self.hits++
+			self.lru.MoveToFront(el)
+			self.mu.Unlock()
+			return t, nil
+		}
+	}
+	if p, ok := self.pending[key]; ok && (!depth || p.depth) {
+		self.hits++
+		self.mu.Unlock()
+		<-p.done
+		return p.t, p.err
+	}
+	self.misses++
+	p := &pendingTile{done: make(chan struct{}), depth: depth}
+	self.pending[key] = p
+	self.mu.Unlock()
+
+	p.t, p.err = self.load(key, depth)
+	self.mu.Lock()
+	if self.pending[key] == p {
+		delete(self.pending, key)
+	}
+	if p.err == nil {
+		self.insert(p.t)
+	}
+	self.mu.Unlock()
+	close(p.done)
+	return p.t, p.err
+}
+
+// load calculates the tile identified by key, including its depth of coverage if depth is true.
+func (self *StatServer) load(key tileKey, depth bool) (*statTile, error) {
+	f := <-self.handles
+	defer func() { self.handles <- f }()
+	beg := key.i * statTileSize
+	end := min(beg+statTileSize, int(self.lens[key.tid]))
+	t := &statTile{key: key}
+	if depth {
+		t.depth = make([]int32, end-beg)
+	}
+	for r, err := range f.QueryRecords(self.idx, key.tid, beg, end) {
+		if err != nil {
+			return nil, err
+		}
+		start := r.Start()
+		stop := start + refLen(r.Cigar())
+		if stop == start {
+			stop++
+		}
+		t.recs = append(t.recs, tileRecord{
+			start:   int32(start),
+			end:     int32(stop),
+			flags:   r.Flags(),
+			mapq:    r.Score(),
+			diffRef: r.mtid() != r.tid(),
+		})
+		if !depth || !self.filt.accept(r) {
+			continue
+		}
+		alignedBlocks(start, r.Cigar(), func(b, e int) {
+			for p := max(b, beg); p < min(e, end); p++ {
+				t.depth[p-beg]++
+			}
+		})
+	}
+	return t, nil
+}
+
+// insert adds t to the cache, replacing any cached tile with the same key and evicting the
+// least recently used tiles as needed. It must be called with the server's lock held.
+func (self *StatServer) insert(t *statTile) {
+	size := t.size()
+	if size > self.max {
+		return
+	}
+	if el, ok := self.cache[t.key]; ok {
+		old := el.Value.(*statTile)
+		if old.depth != nil && t.depth == nil {
+			return
+		}
+		self.used -= old.size()
+		el.Value = t
+		self.lru.MoveToFront(el)
+	} else {
+		self.cache[t.key] = self.lru.PushFront(t)
+	}
+	self.used += size
+	for self.used > self.max {
+		el := self.lru.Back()
+		old := el.Value.(*statTile)
+		self.lru.Remove(el)
+		delete(self.cache, old.key)
+		self.used -= old.size()
+	}
+}
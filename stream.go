@@ -0,0 +1,77 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"context"
+	"io"
+)
+
+// A Stream delivers records read from a RecordReader by a background goroutine over a
+// buffered channel.
+type Stream struct {
+	// C delivers the records read. C is closed when the input is
+	// exhausted, a read fails or the stream is stopped.
+	C <-chan *Record
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// NewStream starts a goroutine reading records from r and sending them on the returned
+// Stream's channel, which has a buffer of size buf. The goroutine stops when the input is
+// exhausted, a read fails, ctx is cancelled or Stop is called. The RecordReader must not be
+// used by other goroutines until the Stream's channel has been closed.
+func NewStream(ctx context.Context, r RecordReader, buf int) *Stream {
+	if buf < 0 {
+		buf = 0
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c := make(chan *Record, buf)
+	s := &Stream{C: c, cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(s.done)
+		defer close(c)
+		for {
+			if err := ctx.Err(); err != nil {
+				s.err = err
+				return
+			}
+			rec, _, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					s.err = err
+				}
+				return
+			}
+			select {
+			case c <- rec:
+			case <-ctx.Done():
+				s.err = ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+// Err returns the error that ended the stream, or nil if the input was read to completion.
+// Err blocks until the stream's reading goroutine has finished, so it should be called after
+// the channel has been drained or Stop has been called.
+func (self *Stream) Err() error {
+	<-self.done
+	return self.err
+}
+
+// Stop stops the stream's reading goroutine and waits for it to finish. Records remaining in
+// the channel buffer may still be received. If the stream was stopped before the input was
+// exhausted, Err returns context.Canceled.
+func (self *Stream) Stop() {
+	self.cancel()
+	<-self.done
+}
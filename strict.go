@@ -0,0 +1,82 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"fmt"
+)
+
+// ParseAux parses the BAM encoded auxiliary field data, aux, returning the fields as a slice
+// of Aux. If aux is not well formed, an error is returned.
+func ParseAux(aux []byte) ([]Aux, error) {
+	if err := validateAux(aux); err != "" {
+		return nil, &MalformedRecord{Reason: err}
+	}
+	return parseAux(aux), nil
+}
+
+// Decode fully decodes the record, including the values of its auxiliary fields, returning a
+// MalformedRecord error rather than panicking if any part of the record cannot be decoded.
+func (self *Record) Decode() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &MalformedRecord{Name: self.nameStr, Reason: fmt.Sprint(r)}
+		}
+	}()
+	if self.bamRecord != nil && self.bamRecord.b != nil && self.marshalled && self.decoded != allFields {
+		err = self.validate()
+		if err != nil {
+			return err
+		}
+	}
+	self.unmarshalData()
+	for _, a := range self.auxTags {
+		if len(a) < 3 {
+			return &MalformedRecord{Name: self.nameStr, Reason: "truncated auxiliary field"}
+		}
+		a.Value()
+	}
+	return nil
+}
+
+// A StrictReader is a RecordReader that fully decodes each record read from an underlying
+// RecordReader, so that records returned by a StrictReader can be used without the risk of
+// decoding panics. Records that cannot be decoded are reported as MalformedRecord errors or,
+// if Skip is true, are skipped and counted.
+type StrictReader struct {
+	r RecordReader
+
+	// Skip specifies that malformed records are skipped.
+	Skip bool
+
+	// Skipped is the number of malformed records skipped.
+	Skipped int
+
+	// LastErr is the error describing the most recently skipped record.
+	LastErr error
+}
+
+// NewStrictReader returns a StrictReader reading from r, skipping malformed records if skip
+// is true.
+func NewStrictReader(r RecordReader, skip bool) *StrictReader {
+	return &StrictReader{r: r, Skip: skip}
+}
+
+// Read returns the next record that can be fully decoded. Errors from the underlying reader
+// other than MalformedRecord errors are returned regardless of Skip.
+func (self *StrictReader) Read() (r *Record, n int, err error) {
+	for {
+		r, n, err = self.r.Read()
+		if err == nil {
+			err = r.Decode()
+		}
+		if _, ok := err.(*MalformedRecord); ok && self.Skip {
+			self.Skipped++
+			self.LastErr = err
+			continue
+		}
+		return r, n, err
+	}
+}
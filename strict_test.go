@@ -0,0 +1,129 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+var (
+	seedAux = []byte("NMc\x01XSs\x10\x00ASi\x20\x00\x00\x00XZZabc\x00XHH1AE3\x00XBBC\x02\x00\x00\x00\x01\x02XFf\x00\x00\x80\x3f")
+
+	// seedData is the variable length data of a record named r1 with a 4M CIGAR,
+	// the sequence ACGT, qualities of 30 and the auxiliary fields of seedAux.
+	seedData = append([]byte("r1\x00\x40\x00\x00\x00\x12\x48\x1e\x1e\x1e\x1e"), seedAux...)
+)
+
+func FuzzParseAux(f *testing.F) {
+	f.Add(seedAux)
+	f.Add([]byte("XZZunterminated"))
+	f.Add([]byte("XBBi\xff\xff\xff\xff"))
+	f.Add([]byte("XB"))
+	f.Fuzz(func(t *testing.T, aux []byte) {
+		aa, err := ParseAux(aux)
+		if err != nil {
+			if _, ok := err.(*MalformedRecord); !ok {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+			return
+		}
+		for _, a := range aa {
+			_ = a.String()
+		}
+		if got := buildAux(aa); !bytes.Equal(got, aux) {
+			t.Errorf("aux round trip mismatch:\ngot: %q\nwant:%q", got, aux)
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(uint8(3), uint16(1), int32(4), int32(len(seedAux)), seedData)
+	f.Add(uint8(3), uint16(1), int32(4), int32(len(seedAux)+1), seedData)
+	f.Add(uint8(3), uint16(2), int32(4), int32(len(seedAux)), seedData)
+	f.Add(uint8(0), uint16(0), int32(-1), int32(0), []byte{})
+	f.Fuzz(func(t *testing.T, lQname uint8, nCigar uint16, lSeq, lAux int32, data []byte) {
+		r, err := NewRecord()
+		if err != nil {
+			t.Fatalf("failed to create record: %v", err)
+		}
+		var core [recordCoreLen]byte
+		endian.PutUint32(core[0:], uint32(len(data)))
+		endian.PutUint32(core[4:], 0xffffffff)
+		endian.PutUint32(core[8:], 0xffffffff)
+		core[15] = lQname
+		endian.PutUint16(core[18:], nCigar)
+		endian.PutUint32(core[20:], uint32(lSeq))
+		endian.PutUint32(core[24:], 0xffffffff)
+		endian.PutUint32(core[28:], 0xffffffff)
+		endian.PutUint32(core[36:], uint32(lAux))
+		readRecord(r, append(core[:], data...))
+
+		err = r.Decode()
+		if err != nil {
+			if _, ok := err.(*MalformedRecord); !ok {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+			return
+		}
+		_ = r.Name()
+		_ = r.Cigar()
+		_ = r.Seq()
+		_ = r.Quality()
+		for _, a := range r.Tags() {
+			_ = a.String()
+		}
+	})
+}
+
+func FuzzStrictReader(f *testing.F) {
+	f.Add(uint8(3), uint16(1), int32(4), int32(len(seedAux)), seedData)
+	f.Add(uint8(3), uint16(1), int32(5), int32(len(seedAux)), seedData)
+	f.Fuzz(func(t *testing.T, lQname uint8, nCigar uint16, lSeq, lAux int32, data []byte) {
+		var core [recordCoreLen]byte
+		endian.PutUint32(core[0:], uint32(len(data)))
+		core[15] = lQname
+		endian.PutUint16(core[18:], nCigar)
+		endian.PutUint32(core[20:], uint32(lSeq))
+		endian.PutUint32(core[36:], uint32(lAux))
+		enc := append(core[:], data...)
+
+		// Present the record twice, so that a skipped record
+		// is followed by another skipped record.
+		sr := NewStrictReader(&encodedReader{b: append(enc, enc...)}, true)
+		var n int
+		for {
+			_, _, err := sr.Read()
+			if err != nil {
+				if err != io.EOF {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				break
+			}
+			n++
+		}
+		if n+sr.Skipped != 2 {
+			t.Errorf("unexpected record count: read %d skipped %d", n, sr.Skipped)
+		}
+	})
+}
+
+// encodedReader is a RecordReader returning records encoded by appendRecord.
+type encodedReader struct {
+	b []byte
+}
+
+func (self *encodedReader) Read() (*Record, int, error) {
+	if len(self.b) == 0 {
+		return nil, 0, io.EOF
+	}
+	r, err := NewRecord()
+	if err != nil {
+		return nil, 0, err
+	}
+	self.b = readRecord(r, self.b)
+	return r, 0, nil
+}
@@ -0,0 +1,89 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"errors"
+	"io"
+)
+
+var badFraction = errors.New("boom: fraction must be in [0, 1]")
+
+// A Subsampler selects a reproducible fraction of templates. The decision for a record is based
+// only on a hash of its name and the seed, so all records of a template are kept or dropped
+// together. Selection matches that of samtools view -s.
+type Subsampler struct {
+	Fraction float64 // The fraction of templates to keep.
+	Seed     uint32  // The seed mixed into the read name hash.
+}
+
+// Keep returns whether the record r is retained by the subsampler.
+func (self Subsampler) Keep(r *Record) bool {
+	k := wangHash(x31Hash(r.Name()) ^ self.Seed)
+	return float64(k&0xffffff)/0x1000000 < self.Fraction
+}
+
+// x31Hash returns the khash X31 hash of s.
+func x31Hash(s string) uint32 {
+	var h uint32
+	for i := 0; i < len(s); i++ {
+		h = h<<5 - h + uint32(s[i])
+	}
+	return h
+}
+
+// wangHash returns the khash Wang integer hash of k.
+func wangHash(k uint32) uint32 {
+	k += ^(k << 15)
+	k ^= k >> 10
+	k += k << 3
+	k ^= k >> 6
+	k += ^(k << 11)
+	k ^= k >> 16
+	return k
+}
+
+// Subsample reads the BAM file, in, and writes the records of the fraction of templates selected
+// by a Subsampler with the given seed to the BAM file, out.
+func Subsample(in, out string, fraction float64, seed uint32) error {
+	if fraction < 0 || fraction > 1 {
+		return badFraction
+	}
+	s := Subsampler{Fraction: fraction, Seed: seed}
+
+	f, err := OpenBAM(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bf, err := CreateBAM(out, f.Header(), true)
+	if err != nil {
+		return err
+	}
+
+	for {
+		r, _, err := f.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			bf.Close()
+			return err
+		}
+		if !s.Keep(r) {
+			continue
+		}
+		n, err := bf.Write(r)
+		if err == nil && n < 0 {
+			err = writeFailed
+		}
+		if err != nil {
+			bf.Close()
+			return err
+		}
+	}
+
+	return bf.Close()
+}
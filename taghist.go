@@ -0,0 +1,142 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"io"
+	"math"
+	"sort"
+)
+
+// A TagHistogram counts the values of an auxiliary tag over a set of records. Integer values
+// are counted in Ints, floating point values in Floats and character, string and hex string
+// values in Strings. Array values are not counted.
+type TagHistogram struct {
+	Tag Tag
+
+	// BinWidth is the width of the bins used to count
+	// floating point values. Each value is counted in the
+	// bin starting at the largest multiple of BinWidth not
+	// greater than the value. If BinWidth is not positive,
+	// values are counted exactly.
+	BinWidth float64
+
+	Ints    map[int64]int
+	Floats  map[float64]int
+	Strings map[string]int
+
+	Records int // Records counted.
+	Missing int // Records counted without the tag.
+	Arrays  int // Records with an array value for the tag.
+}
+
+// NewTagHistogram returns a TagHistogram counting values of the tag t.
+func NewTagHistogram(t Tag) *TagHistogram {
+	return &TagHistogram{
+		Tag:     t,
+		Ints:    make(map[int64]int),
+		Floats:  make(map[float64]int),
+		Strings: make(map[string]int),
+	}
+}
+
+// Add includes the value of the tag held by r in the histogram.
+func (self *TagHistogram) Add(r *Record) {
+	self.Records++
+	a, ok := r.AuxGet(self.Tag)
+	if !ok {
+		self.Missing++
+		return
+	}
+	if v, ok := a.intValue(); ok {
+		self.Ints[v]++
+		return
+	}
+	switch a.Type() {
+	case 'f':
+		v := a.floatValue()
+		if self.BinWidth > 0 {
+			v = math.Floor(v/self.BinWidth) * self.BinWidth
+		}
+		self.Floats[v]++
+	case 'A':
+		self.Strings[string(a[3:4])]++
+	case 'Z', 'H':
+		self.Strings[string(a[3:])]++
+	default:
+		self.Arrays++
+	}
+}
+
+// Count returns the number of records holding a value of the tag.
+func (self *TagHistogram) Count() int {
+	return self.Records - self.Missing - self.Arrays
+}
+
+// IntValues returns the distinct integer values counted, in ascending order.
+func (self *TagHistogram) IntValues() []int64 {
+	v := make([]int64, 0, len(self.Ints))
+	for k := range self.Ints {
+		v = append(v, k)
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+	return v
+}
+
+// FloatValues returns the distinct floating point values or bins counted, in ascending order.
+func (self *TagHistogram) FloatValues() []float64 {
+	v := make([]float64, 0, len(self.Floats))
+	for k := range self.Floats {
+		v = append(v, k)
+	}
+	sort.Float64s(v)
+	return v
+}
+
+// StringValues returns the distinct string values counted, in ascending order.
+func (self *TagHistogram) StringValues() []string {
+	v := make([]string, 0, len(self.Strings))
+	for k := range self.Strings {
+		v = append(v, k)
+	}
+	sort.Strings(v)
+	return v
+}
+
+// Mean returns the mean of the numeric values counted. Binned floating point values
+// contribute the start of their bin.
+func (self *TagHistogram) Mean() float64 {
+	var n int
+	var sum float64
+	for v, c := range self.Ints {
+		n += c
+		sum += float64(v) * float64(c)
+	}
+	for v, c := range self.Floats {
+		n += c
+		sum += v * float64(c)
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// HistogramTag reads the remaining records from r and returns the histogram of values of the
+// tag t. To histogram a region of an indexed BAM file, r may be an Iterator returned by Query.
+func HistogramTag(r RecordReader, t Tag) (*TagHistogram, error) {
+	h := NewTagHistogram(t)
+	for {
+		rec, _, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		h.Add(rec)
+	}
+	return h, nil
+}
@@ -0,0 +1,80 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// A TagRewriter is applied to each auxiliary field of records as they are written. It returns
+// the field to be written in place of a, and false if the field should be removed. The
+// returned Aux may be a itself, a modified copy or a new field, and must be validly encoded.
+type TagRewriter func(a Aux) (Aux, bool)
+
+// StripTags returns a TagRewriter that removes the auxiliary fields with the given tags, for
+// example OQ or BI and BD, and retains all other fields unaltered.
+func StripTags(tags ...Tag) TagRewriter {
+	strip := make(map[Tag]bool, len(tags))
+	for _, t := range tags {
+		strip[t] = true
+	}
+	return func(a Aux) (Aux, bool) { return a, !strip[a.Tag()] }
+}
+
+// rewriteAux applies fn to each auxiliary field encoded in aux, returning the encoding of the
+// rewritten fields and whether any field was altered.
+func rewriteAux(aux []byte, fn TagRewriter) ([]byte, bool) {
+	var (
+		aa      = parseAux(aux)
+		out     = aa[:0]
+		changed bool
+	)
+	for _, a := range aa {
+		b, ok := fn(a)
+		if !ok {
+			changed = true
+			continue
+		}
+		if len(b) != len(a) || unsafe.SliceData(b) != unsafe.SliceData(a) {
+			changed = true
+		}
+		out = append(out, b)
+	}
+	if !changed {
+		return aux, false
+	}
+	return buildAux(out), true
+}
+
+// rewriteTags returns a bamRecord holding the data of br with the file's TagRewriter applied to
+// its auxiliary fields. If the file has no TagRewriter or no field is altered br is returned,
+// otherwise the rewritten record is constructed in storage owned by the file so that br is not
+// modified.
+func (sf *samFile) rewriteTags(br *bamRecord) (*bamRecord, error) {
+	if sf.rewrite == nil {
+		return br, nil
+	}
+	defer runtime.KeepAlive(br)
+	d := br.dataView()
+	auxStart := len(d) - int(br.lAux())
+	aux, changed := rewriteAux(d[auxStart:], sf.rewrite)
+	if !changed {
+		return br, nil
+	}
+	if sf.scratch == nil {
+		var err error
+		sf.scratch, err = newBamRecord(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	nd := make([]byte, auxStart, auxStart+len(aux))
+	copy(nd, d)
+	sf.scratch.b.core = br.b.core
+	sf.scratch.setData(append(nd, aux...))
+	sf.scratch.setLAux(int32(len(aux)))
+	return sf.scratch, nil
+}
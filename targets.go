@@ -0,0 +1,131 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// A TargetSummary holds summary statistics for a single reference sequence.
+type TargetSummary struct {
+	Name   string
+	Length int
+
+	// Mapped and Unmapped are the numbers of mapped records and of
+	// unmapped records placed on the reference. They are taken from
+	// the BAM index if it holds record counts.
+	Mapped, Unmapped int
+
+	// Reads is the number of records accepted by the coverage
+	// filter, and Bases the number of their aligned bases.
+	Reads int
+	Bases int64
+
+	mapQSum int64
+}
+
+// MeanMapQ returns the mean mapping quality of the accepted records.
+func (self *TargetSummary) MeanMapQ() float64 {
+	if self.Reads == 0 {
+		return 0
+	}
+	return float64(self.mapQSum) / float64(self.Reads)
+}
+
+// MeanDepth returns the mean depth of coverage of the reference by the accepted records.
+func (self *TargetSummary) MeanDepth() float64 {
+	if self.Length == 0 {
+		return 0
+	}
+	return float64(self.Bases) / float64(self.Length)
+}
+
+// A TargetReport summarizes the records of a BAM file by reference sequence.
+type TargetReport struct {
+	Targets []TargetSummary
+
+	// Unplaced is the number of records with no reference.
+	Unplaced int
+
+	// FromIndex indicates that the Mapped, Unmapped and Unplaced
+	// counts were taken from the BAM index.
+	FromIndex bool
+}
+
+// SummarizeTargets returns a TargetReport for the BAM file, filename, in a single pass over its
+// records. Record counts are taken from the BAM index when an index holding counts is
+// present, and otherwise counted during the pass. Reads, bases and mapping qualities are
+// counted for records accepted by filt, or DefaultCoverageFilter if filt is nil.
+func SummarizeTargets(filename string, filt *CoverageFilter) (*TargetReport, error) {
+	f, err := OpenBAM(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, lens := f.RefNames(), f.RefLengths()
+	rep := &TargetReport{Targets: make([]TargetSummary, len(names))}
+	for i, n := range names {
+		rep.Targets[i] = TargetSummary{Name: n, Length: int(lens[i])}
+	}
+	if idx, err := readBAIFile(filename); err == nil && idx.hasCount && len(idx.refs) == len(names) {
+		rep.FromIndex = true
+		for i := range idx.refs {
+			m, u, ok := idx.refs[i].counts()
+			if !ok {
+				continue
+			}
+			rep.Targets[i].Mapped, rep.Targets[i].Unmapped = int(m), int(u)
+		}
+		rep.Unplaced = int(idx.noCoord)
+	}
+
+	for r, err := range f.RecordsErr() {
+		if err != nil {
+			return nil, err
+		}
+		tid := r.RefID()
+		if tid < 0 || tid >= len(rep.Targets) {
+			if !rep.FromIndex {
+				rep.Unplaced++
+			}
+			continue
+		}
+		t := &rep.Targets[tid]
+		if !rep.FromIndex {
+			if r.Flags()&Unmapped != 0 {
+				t.Unmapped++
+			} else {
+				t.Mapped++
+			}
+		}
+		if !filt.accept(r) {
+			continue
+		}
+		t.Reads++
+		t.mapQSum += int64(r.Score())
+		alignedBlocks(r.Start(), r.Cigar(), func(beg, end int) { t.Bases += int64(end - beg) })
+	}
+
+	return rep, nil
+}
+
+// WriteTargetReport writes rep to w as a tab-delimited table with a header line and the
+// columns reference name, length, mapped and unmapped records, accepted reads, aligned bases,
+// mean mapping quality and mean depth, followed by a line named "*" holding the number of
+// unplaced records in the unmapped column.
+func WriteTargetReport(w io.Writer, rep *TargetReport) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#name\tlength\tmapped\tunmapped\treads\tbases\tmean_mapq\tmean_depth")
+	for i := range rep.Targets {
+		t := &rep.Targets[i]
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%d\t%d\t%d\t%.2f\t%.4f\n",
+			t.Name, t.Length, t.Mapped, t.Unmapped, t.Reads, t.Bases, t.MeanMapQ(), t.MeanDepth())
+	}
+	fmt.Fprintf(bw, "*\t0\t0\t%d\t0\t0\t0\t0\n", rep.Unplaced)
+	return bw.Flush()
+}
@@ -0,0 +1,287 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Template holds the linear and supplementary alignments of a single read that together
+// make up a chimeric alignment.
+type Template struct {
+	Name string
+	Read int // 1 or 2 for the reads of a pair, 0 for unpaired reads.
+
+	// Segments holds the alignments ordered by the position of
+	// their aligned bases in the read as sequenced.
+	Segments []*Record
+
+	// Complete indicates that all the segments described by the
+	// SA tags of the alignments were found.
+	Complete bool
+}
+
+// Primary returns the primary alignment of the template, or nil if it was not found.
+func (self *Template) Primary() *Record {
+	for _, r := range self.Segments {
+		if r.Flags()&Supplementary == 0 {
+			return r
+		}
+	}
+	return nil
+}
+
+// A TemplateReader groups the primary and supplementary alignments of each read into a Template
+// using the SA tags of the alignments. Records are held until all the segments of their template
+// have been read. For coordinate-sorted input, templates whose segments have not all been found
+// by the time reading passes the last segment position described by their SA tags are returned
+// as incomplete templates. Templates are returned as they are completed, and remaining templates
+// are returned at the end of the input. Secondary alignments are skipped.
+type TemplateReader struct {
+	r     RecordReader
+	index map[string]int
+
+	pending map[templateKey]*templateEntry
+	queue   templateHeap
+	out     []*Template
+	err     error
+}
+
+type templateKey struct {
+	name string
+	read int
+}
+
+type templateEntry struct {
+	key      templateKey
+	t        *Template
+	want     int
+	tid, pos int // Position of the rightmost expected segment.
+	index    int
+}
+
+// NewTemplateReader returns a TemplateReader reading records described by the header h from r.
+func NewTemplateReader(r RecordReader, h *Header) *TemplateReader {
+	return &TemplateReader{
+		r:       r,
+		index:   refIndex(h),
+		pending: make(map[templateKey]*templateEntry),
+	}
+}
+
+// Read returns the next Template.
+func (self *TemplateReader) Read() (*Template, error) {
+	for len(self.out) == 0 {
+		if self.err != nil {
+			return nil, self.err
+		}
+		self.step()
+	}
+	t := self.out[0]
+	self.out = self.out[1:]
+	return t, nil
+}
+
+// step reads one record, queueing any Templates completed or evicted.
+func (self *TemplateReader) step() {
+	r, _, err := self.r.Read()
+	if err != nil {
+		if err == io.EOF {
+			self.flushAll()
+		}
+		self.err = err
+		return
+	}
+	fl := r.Flags()
+	if fl&Secondary != 0 {
+		return
+	}
+	tid, pos := r.RefID(), r.Start()
+	if tid >= 0 {
+		self.evict(tid, pos)
+	}
+
+	k := templateKey{name: r.Name()}
+	switch fl & (Paired | Read1 | Read2) {
+	case Paired | Read1:
+		k.read = 1
+	case Paired | Read2:
+		k.read = 2
+	}
+	e, ok := self.pending[k]
+	if !ok {
+		sa, err := SupplementaryAlignments(r)
+		if err != nil {
+			self.err = err
+			return
+		}
+		e = &templateEntry{
+			key:  k,
+			t:    &Template{Name: k.name, Read: k.read},
+			want: 1 + len(sa),
+			tid:  tid,
+			pos:  pos,
+		}
+		for _, s := range sa {
+			stid, ok := self.index[s.Ref]
+			if !ok {
+				continue
+			}
+			if stid > e.tid || (stid == e.tid && s.Pos > e.pos) {
+				e.tid, e.pos = stid, s.Pos
+			}
+		}
+		if e.want > 1 {
+			self.pending[k] = e
+			heap.Push(&self.queue, e)
+		}
+	}
+	e.t.Segments = append(e.t.Segments, r)
+	if len(e.t.Segments) >= e.want {
+		if e.want > 1 {
+			delete(self.pending, k)
+			heap.Remove(&self.queue, e.index)
+		}
+		e.t.Complete = true
+		orderSegments(e.t)
+		self.out = append(self.out, e.t)
+	}
+}
+
+// evict queues the pending templates whose last expected segment lies before pos on tid.
+func (self *TemplateReader) evict(tid, pos int) {
+	for len(self.queue) != 0 {
+		e := self.queue[0]
+		if uint(e.tid) > uint(tid) || (e.tid == tid && e.pos >= pos) {
+			break
+		}
+		heap.Pop(&self.queue)
+		delete(self.pending, e.key)
+		orderSegments(e.t)
+		self.out = append(self.out, e.t)
+	}
+}
+
+// flushAll queues all pending templates.
+func (self *TemplateReader) flushAll() {
+	for len(self.queue) != 0 {
+		e := heap.Pop(&self.queue).(*templateEntry)
+		delete(self.pending, e.key)
+		orderSegments(e.t)
+		self.out = append(self.out, e.t)
+	}
+}
+
+// orderSegments orders the segments of t by their query position.
+func orderSegments(t *Template) {
+	sort.SliceStable(t.Segments, func(i, j int) bool {
+		return queryStart(t.Segments[i]) < queryStart(t.Segments[j])
+	})
+}
+
+// queryStart returns the offset of the first aligned base of r in the read as sequenced.
+func queryStart(r *Record) int {
+	cigar := r.Cigar()
+	if r.Flags()&Reverse != 0 {
+		cigar = reverseCigar(cigar)
+	}
+	var n int
+	for _, co := range cigar {
+		switch co.Type() {
+		case CigarSoftClipped, CigarHardClipped:
+			n += co.Len()
+			continue
+		}
+		break
+	}
+	return n
+}
+
+// templateHeap is a min-heap of pending templates ordered by the position of their rightmost
+// expected segment.
+type templateHeap []*templateEntry
+
+func (h templateHeap) Len() int { return len(h) }
+func (h templateHeap) Less(i, j int) bool {
+	if h[i].tid != h[j].tid {
+		return uint(h[i].tid) < uint(h[j].tid)
+	}
+	return h[i].pos < h[j].pos
+}
+func (h templateHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *templateHeap) Push(x interface{}) {
+	e := x.(*templateEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *templateHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// A SupplementaryAlignment is an alignment described by an SA tag.
+type SupplementaryAlignment struct {
+	Ref     string
+	Pos     int // Zero-based position.
+	Reverse bool
+	Cigar   []CigarOp
+	MapQ    byte
+	NM      int
+}
+
+// SupplementaryAlignments returns the other alignments of a chimeric alignment described by the
+// SA tag of r. If r has no SA tag, a nil slice is returned.
+func SupplementaryAlignments(r *Record) ([]SupplementaryAlignment, error) {
+	a, ok := r.Tag([]byte("SA"))
+	if !ok || a.Type() != 'Z' {
+		return nil, nil
+	}
+	var sa []SupplementaryAlignment
+	for _, s := range strings.Split(a.Value().(string), ";") {
+		if s == "" {
+			continue
+		}
+		f := strings.Split(s, ",")
+		if len(f) != 6 || (f[2] != "+" && f[2] != "-") {
+			return nil, fmt.Errorf("boom: malformed SA tag %q", s)
+		}
+		pos, err := strconv.Atoi(f[1])
+		if err != nil || pos < 1 {
+			return nil, fmt.Errorf("boom: malformed SA tag %q", s)
+		}
+		cigar, err := parseCigar(f[3])
+		if err != nil {
+			return nil, err
+		}
+		mapq, err := strconv.ParseUint(f[4], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("boom: malformed SA tag %q", s)
+		}
+		nm, err := strconv.Atoi(f[5])
+		if err != nil {
+			return nil, fmt.Errorf("boom: malformed SA tag %q", s)
+		}
+		sa = append(sa, SupplementaryAlignment{
+			Ref:     f[0],
+			Pos:     pos - 1,
+			Reverse: f[2] == "-",
+			Cigar:   cigar,
+			MapQ:    byte(mapq),
+			NM:      nm,
+		})
+	}
+	return sa, nil
+}
@@ -0,0 +1,145 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// WriteBedGraph writes the per-base depth of coverage of the remaining records in the
+// coordinate-sorted f to w in bedGraph format. Adjacent positions with equal depth are
+// merged into a single interval and uncovered positions are omitted. Records are included
+// according to filt, or DefaultCoverageFilter if filt is nil.
+func WriteBedGraph(w io.Writer, f *BAMFile, filt *CoverageFilter) error {
+	bw := bufio.NewWriter(w)
+	names := f.RefNames()
+
+	var (
+		werr error
+
+		tid       = -1
+		beg, end  int
+		lastDepth int
+	)
+	emit := func() {
+		if tid < 0 || werr != nil {
+			return
+		}
+		_, werr = fmt.Fprintf(bw, "%s\t%d\t%d\t%d\n", names[tid], beg, end, lastDepth)
+	}
+	err := Depth(f, filt, func(t, pos, depth int) bool {
+		if t != tid || pos != end || depth != lastDepth {
+			emit()
+			tid, beg, lastDepth = t, pos, depth
+		}
+		end = pos + 1
+		return werr != nil
+	})
+	emit()
+	if err != nil {
+		return err
+	}
+	if werr != nil {
+		return werr
+	}
+
+	return bw.Flush()
+}
+
+// WriteWiggle writes the per-base depth of coverage of the remaining records in the
+// coordinate-sorted f to w in variableStep wiggle format. Uncovered positions are omitted.
+// Records are included according to filt, or DefaultCoverageFilter if filt is nil.
+func WriteWiggle(w io.Writer, f *BAMFile, filt *CoverageFilter) error {
+	bw := bufio.NewWriter(w)
+	names := f.RefNames()
+
+	var (
+		werr error
+		tid  = -1
+	)
+	err := Depth(f, filt, func(t, pos, depth int) bool {
+		if t != tid {
+			tid = t
+			_, werr = fmt.Fprintf(bw, "variableStep chrom=%s\n", names[tid])
+			if werr != nil {
+				return true
+			}
+		}
+		_, werr = fmt.Fprintf(bw, "%d\t%d\n", pos+1, depth)
+		return werr != nil
+	})
+	if err != nil {
+		return err
+	}
+	if werr != nil {
+		return werr
+	}
+
+	return bw.Flush()
+}
+
+// WriteBedGraph writes the binned coverage to w in bedGraph format with one interval per bin.
+// Bins with zero coverage are omitted.
+func (self *BinnedCoverage) WriteBedGraph(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for tid, bins := range self.Depth {
+		for i, d := range bins {
+			if d == 0 {
+				continue
+			}
+			beg, end := i*self.BinSize, (i+1)*self.BinSize
+			if end > int(self.Lengths[tid]) {
+				end = int(self.Lengths[tid])
+			}
+			_, err := fmt.Fprintf(bw, "%s\t%d\t%d\t%g\n", self.Names[tid], beg, end, d)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteWiggle writes the binned coverage to w in fixedStep wiggle format with a step and
+// span equal to the bin size. The span of a final bin that extends past the end of its
+// reference is clamped to the reference end.
+func (self *BinnedCoverage) WriteWiggle(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for tid, bins := range self.Depth {
+		if len(bins) == 0 {
+			continue
+		}
+		// short is the index of a final bin that must be written with a
+		// shorter span, or -1 if all bins have the full span.
+		short := len(bins) - 1
+		beg, span := short*self.BinSize, self.BinSize
+		if l := int(self.Lengths[tid]); beg < l && l < beg+span {
+			span = l - beg
+		} else {
+			short = -1
+		}
+		for i, d := range bins {
+			var err error
+			switch {
+			case i == short:
+				_, err = fmt.Fprintf(bw, "fixedStep chrom=%s start=%d step=%d span=%d\n", self.Names[tid], beg+1, self.BinSize, span)
+			case i == 0:
+				_, err = fmt.Fprintf(bw, "fixedStep chrom=%s start=1 step=%d span=%d\n", self.Names[tid], self.BinSize, self.BinSize)
+			}
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(bw, "%g\n", d)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
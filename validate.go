@@ -0,0 +1,104 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boom
+
+// maxPhred is the largest quality score representable in SAM.
+const maxPhred = 93
+
+// Validate checks that the record is structurally valid, returning a *MalformedRecord
+// describing the first problem found. The record is checked by libbam's bam_validate1 and
+// by additional checks of the consistency of its fields: that the encoded lengths agree with
+// its data, that its auxiliary fields are well formed, that its positions are consistent
+// with its reference IDs and flags and lie within the reference sequences described by h, that
+// its CIGAR describes its sequence, that its quality scores are representable in SAM and that
+// its bin agrees with its alignment. If h is nil, reference IDs and positions are not checked
+// against reference sequences.
+func (self *Record) Validate(h *Header) error {
+	self.marshal()
+	var bh *bamHeader
+	if h != nil {
+		bh = h.bamHeader
+	}
+	if err := self.validate(); err != nil {
+		return err
+	}
+	name := self.Name()
+	if !self.bamValidate(bh) {
+		return &MalformedRecord{Name: name, Reason: "invalid reference ID or read name"}
+	}
+	fail := func(reason string) error { return &MalformedRecord{Name: name, Reason: reason} }
+
+	tid, pos := int(self.tid()), int(self.pos())
+	mtid, mpos := int(self.mtid()), int(self.mpos())
+	fl := self.flag()
+	switch {
+	case pos < -1 || mpos < -1:
+		return fail("negative position")
+	case tid < 0 && pos != -1:
+		return fail("unplaced record has a position")
+	case mtid < 0 && mpos != -1:
+		return fail("unplaced mate has a position")
+	case tid < 0 && fl&Unmapped == 0:
+		return fail("unplaced record is not flagged as unmapped")
+	}
+	if bh != nil {
+		if l := bh.targetLen(tid); tid >= 0 && pos >= l {
+			return fail("position beyond end of reference")
+		}
+		if l := bh.targetLen(mtid); mtid >= 0 && mpos >= l {
+			return fail("mate position beyond end of reference")
+		}
+	}
+
+	if nc, lSeq := int(self.nCigar()), int(self.lQseq()); nc != 0 && lSeq != 0 && self.cigar2qlen() != lSeq {
+		return fail("CIGAR query length does not match sequence length")
+	}
+	if q := self.Quality(); len(q) != 0 && q[0] != 0xff {
+		for _, v := range q {
+			if v > maxPhred {
+				return fail("quality score out of range")
+			}
+		}
+	}
+
+	if tid >= 0 {
+		end := self.calEnd()
+		if end == pos {
+			end++
+		}
+		bin := self.bin()
+		if bin != reg2bin(pos, end) && !(fl&Unmapped != 0 && bin == reg2bin(-1, 0)) {
+			return fail("bin does not match alignment")
+		}
+	}
+	return nil
+}
+
+// IsValid returns whether the record passes the checks made by Validate.
+func (self *Record) IsValid(h *Header) bool {
+	return self.Validate(h) == nil
+}
+
+// SetValidation sets whether subsequently written records are checked by Validate against the
+// file's header. When validation is on, Write returns the error, and does not write the record,
+// if the record is invalid.
+func (self *BAMFile) SetValidation(on bool) {
+	self.validate = on
+}
+
+// SetValidation sets whether subsequently written records are checked by Validate against the
+// file's header. When validation is on, Write returns the error, and does not write the record,
+// if the record is invalid.
+func (self *SAMFile) SetValidation(on bool) {
+	self.validate = on
+}
+
+// checkValid validates r against the file's header if validation is on.
+func (sf *samFile) checkValid(r *Record) error {
+	if !sf.validate {
+		return nil
+	}
+	return r.Validate(&Header{sf.header()})
+}